@@ -0,0 +1,116 @@
+package toolconfig
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/egose/database-tools/storage"
+)
+
+type rateLimitOverride struct {
+	name      string
+	direction string
+	rate      int64
+}
+
+// Bandwidth returns the transfer rate limits for the storage instance named
+// instance of type backend. Entries in BackendRateLimits override the global
+// upload and download limits; an entry without a direction, such as
+// "aws=10MiB", sets both. Entries naming the instance take precedence over
+// entries naming its backend type. It returns nil when the instance is
+// unlimited in both directions.
+func (s StorageOptions) Bandwidth(backend string, instance string) (*storage.Bandwidth, error) {
+	uploadRate, err := storage.ParseByteRate(s.UploadRateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("upload-rate-limit: %w", err)
+	}
+	downloadRate, err := storage.ParseByteRate(s.DownloadRateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("download-rate-limit: %w", err)
+	}
+
+	overrides, err := parseBackendRateLimits(s.BackendRateLimits)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{backend, instance} {
+		for _, override := range overrides {
+			if override.name != name {
+				continue
+			}
+
+			switch override.direction {
+			case "upload":
+				uploadRate = override.rate
+			case "download":
+				downloadRate = override.rate
+			default:
+				uploadRate, downloadRate = override.rate, override.rate
+			}
+		}
+	}
+
+	schedule, err := storage.ParseBandwidthSchedule(s.RateLimitSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("rate-limit-schedule: %w", err)
+	}
+
+	if uploadRate == 0 && downloadRate == 0 {
+		return nil, nil
+	}
+	return &storage.Bandwidth{UploadRate: uploadRate, DownloadRate: downloadRate, Schedule: schedule, Location: s.RateLimitLocation}, nil
+}
+
+// ValidateBandwidth reports malformed rate limit settings before any backend
+// is contacted.
+func (s StorageOptions) ValidateBandwidth() error {
+	instances, err := s.Instances()
+	if err != nil {
+		return err
+	}
+
+	known := knownStorageNames(instances)
+	overrides, err := parseBackendRateLimits(s.BackendRateLimits)
+	if err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		if !slices.Contains(known, override.name) {
+			return fmt.Errorf("backend-rate-limits: unknown backend or storage instance %q (expected one of %s)", override.name, strings.Join(known, ", "))
+		}
+	}
+
+	for _, backend := range backendNames() {
+		if _, err := s.Bandwidth(backend, backend); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseBackendRateLimits(raw string) ([]rateLimitOverride, error) {
+	overrides := make([]rateLimitOverride, 0)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, rawRate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("backend-rate-limits: invalid entry %q: expected <backend>[.upload|.download]=<rate>", entry)
+		}
+		name, direction, _ := strings.Cut(strings.TrimSpace(key), ".")
+		if direction != "" && direction != "upload" && direction != "download" {
+			return nil, fmt.Errorf("backend-rate-limits: unknown direction %q in %q", direction, entry)
+		}
+		rate, err := storage.ParseByteRate(rawRate)
+		if err != nil {
+			return nil, fmt.Errorf("backend-rate-limits: %w", err)
+		}
+		overrides = append(overrides, rateLimitOverride{name: name, direction: direction, rate: rate})
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,176 @@
+package toolconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/egose/database-tools/storage"
+)
+
+var storageInstanceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// StorageInstance is one configured storage backend. The discrete backend
+// flags configure an instance named after its backend type; StorageInstances
+// adds named instances whose settings are read from STORAGE__<NAME>__<KEY>
+// environment variables, where KEY is the environment key of the matching
+// discrete flag. ExpiryDays is nil when the instance does not set its own
+// retention.
+type StorageInstance struct {
+	Name         string
+	Backend      string
+	Settings     storage.BackendSettings
+	BackupPrefix string
+	ExpiryDays   *int
+}
+
+type prefixedEnv struct {
+	env    EnvReader
+	prefix string
+}
+
+func (e prefixedEnv) GetValue(key string, defaultValues ...string) string {
+	return e.env.GetValue(e.prefix+key, defaultValues...)
+}
+
+// storageInstanceEnvKey returns the environment key, without the tool's
+// prefix, that sets key for the named storage instance.
+func storageInstanceEnvKey(name string, key string) string {
+	return "STORAGE__" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "__" + key
+}
+
+// Instances returns every configured storage instance: first those set up by
+// the discrete flags, in backend registration order, then those given as
+// StorageURLs, then the named instances in the order StorageInstances lists
+// them.
+func (s StorageOptions) Instances() ([]StorageInstance, error) {
+	instances := make([]StorageInstance, 0)
+	for _, backendType := range storage.Backends() {
+		if backendType.Enabled(s.Settings) {
+			backupPrefix, err := s.backupPrefix(backendType.Name, backendType.Name)
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, StorageInstance{Name: backendType.Name, Backend: backendType.Name, Settings: s.Settings, BackupPrefix: backupPrefix})
+		}
+	}
+
+	urlInstances, err := s.urlInstances()
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range urlInstances {
+		for _, existing := range instances {
+			if existing.Name == instance.Name {
+				return nil, fmt.Errorf("storage URLs: instance name %q is already in use; add ?name=<name> to the URL to tell them apart", instance.Name)
+			}
+		}
+		instances = append(instances, instance)
+	}
+
+	for _, entry := range strings.Split(s.StorageInstances, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, backend, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		backend = strings.ToLower(strings.TrimSpace(backend))
+		if !ok || name == "" || backend == "" {
+			return nil, fmt.Errorf("storage-instances: invalid entry %q: expected <name>=<backend>", entry)
+		}
+		if !storageInstanceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("storage-instances: invalid instance name %q: use lowercase letters, digits, and dashes", name)
+		}
+		backendType, ok := storage.LookupBackend(backend)
+		if !ok {
+			return nil, fmt.Errorf("storage-instances: unknown backend %q for instance %q (expected one of %s)", backend, name, strings.Join(backendNames(), ", "))
+		}
+		for _, existing := range instances {
+			if existing.Name == name {
+				return nil, fmt.Errorf("storage-instances: instance name %q is already in use", name)
+			}
+		}
+
+		instance, err := s.namedInstance(name, backendType)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func (s StorageOptions) namedInstance(name string, backendType storage.BackendType) (StorageInstance, error) {
+	backupPrefix, err := s.backupPrefix(backendType.Name, name)
+	if err != nil {
+		return StorageInstance{}, err
+	}
+
+	var env EnvReader
+	rawExpiryDays := ""
+	if s.env != nil {
+		env = prefixedEnv{env: s.env, prefix: storageInstanceEnvKey(name, "")}
+		backupPrefix = env.GetValue(storageFlagDefs.backupPrefix.EnvKey, backupPrefix)
+		rawExpiryDays = env.GetValue("EXPIRY_DAYS")
+	}
+
+	settings := backendType.Settings(env)
+	if missing := backendType.Missing(settings); len(missing) > 0 {
+		required := make([]string, 0, len(missing))
+		for _, flagName := range missing {
+			required = append(required, storageInstanceEnvKey(name, backendFlagEnvKey(backendType, flagName)))
+		}
+		return StorageInstance{}, fmt.Errorf("storage instance %q is incomplete: %s requires %s", name, backendType.Name, strings.Join(required, ", "))
+	}
+
+	instance := StorageInstance{Name: name, Backend: backendType.Name, Settings: settings, BackupPrefix: backupPrefix}
+	if rawExpiryDays != "" {
+		expiryDays, err := strconv.Atoi(rawExpiryDays)
+		if err != nil || expiryDays < 0 {
+			return StorageInstance{}, fmt.Errorf("storage instance %q: %s must be a non-negative integer", name, storageInstanceEnvKey(name, "EXPIRY_DAYS"))
+		}
+		instance.ExpiryDays = &expiryDays
+	}
+
+	return instance, nil
+}
+
+func (i StorageInstance) label() string {
+	label := i.Backend
+	if backendType, ok := storage.LookupBackend(i.Backend); ok && backendType.Label != "" {
+		label = backendType.Label
+	}
+	if i.Name == i.Backend {
+		return label
+	}
+	return i.Name + " (" + label + ")"
+}
+
+// backendNames lists the registered backend types in registration order.
+func backendNames() []string {
+	names := make([]string, 0)
+	for _, backendType := range storage.Backends() {
+		names = append(names, backendType.Name)
+	}
+	return names
+}
+
+// backendFlagEnvKey returns the environment key of the named flag of
+// backendType, which keys the flag for named instances too.
+func backendFlagEnvKey(backendType storage.BackendType, flagName string) string {
+	for _, def := range backendType.StringFlags {
+		if def.Name == flagName {
+			return def.EnvKey
+		}
+	}
+	for _, def := range backendType.BoolFlags {
+		if def.Name == flagName {
+			return def.EnvKey
+		}
+	}
+	return flagName
+}
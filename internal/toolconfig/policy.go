@@ -0,0 +1,146 @@
+package toolconfig
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/egose/database-tools/storage"
+)
+
+type backendPolicyOverride struct {
+	name  string
+	value string
+}
+
+// backupPrefix returns the backup prefix for the storage instance named
+// instance of type backend when the instance does not set its own. Entries in
+// BackendPrefixes override the global BackupPrefix, and entries naming the
+// instance take precedence over entries naming its backend type.
+func (s StorageOptions) backupPrefix(backend string, instance string) (string, error) {
+	overrides, err := parseBackendPolicyOverrides("backend-prefixes", "prefix", s.BackendPrefixes)
+	if err != nil {
+		return "", err
+	}
+	if prefix, ok := lookupBackendPolicy(overrides, backend, instance); ok {
+		return prefix, nil
+	}
+	return s.BackupPrefix, nil
+}
+
+// NameTemplate parses BackupNameTemplate, restricted to BackupTier when set.
+// It returns nil, the legacy naming, when no template is set.
+func (s StorageOptions) NameTemplate() (*storage.NameTemplate, error) {
+	template, err := storage.ParseNameTemplate(s.BackupNameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("backup-name-template: %w", err)
+	}
+	return template.ForTier(s.BackupTier), nil
+}
+
+// InstanceExpiryDays returns the retention of instance in days: its own
+// EXPIRY_DAYS setting, else the BackendExpiryDays entry naming the instance
+// or its backend type, else expiryDays. Zero means backups never expire.
+func (s StorageOptions) InstanceExpiryDays(instance StorageInstance, expiryDays int) (int, error) {
+	if instance.ExpiryDays != nil {
+		return *instance.ExpiryDays, nil
+	}
+
+	overrides, err := parseBackendPolicyOverrides("backend-expiry-days", "days", s.BackendExpiryDays)
+	if err != nil {
+		return 0, err
+	}
+	raw, ok := lookupBackendPolicy(overrides, instance.Backend, instance.Name)
+	if !ok {
+		return expiryDays, nil
+	}
+	return parseBackendExpiryDays(raw)
+}
+
+// ValidateBackendPolicies reports malformed per-backend prefix and retention
+// settings before any backend is contacted.
+func (s StorageOptions) ValidateBackendPolicies() error {
+	instances, err := s.Instances()
+	if err != nil {
+		return err
+	}
+
+	known := knownStorageNames(instances)
+	for _, policy := range []struct{ flagName, valueName, raw string }{
+		{flagName: "backend-prefixes", valueName: "prefix", raw: s.BackendPrefixes},
+		{flagName: "backend-expiry-days", valueName: "days", raw: s.BackendExpiryDays},
+	} {
+		overrides, err := parseBackendPolicyOverrides(policy.flagName, policy.valueName, policy.raw)
+		if err != nil {
+			return err
+		}
+		for _, override := range overrides {
+			if !slices.Contains(known, override.name) {
+				return fmt.Errorf("%s: unknown backend or storage instance %q (expected one of %s)", policy.flagName, override.name, strings.Join(known, ", "))
+			}
+		}
+	}
+
+	overrides, err := parseBackendPolicyOverrides("backend-expiry-days", "days", s.BackendExpiryDays)
+	if err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		if _, err := parseBackendExpiryDays(override.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseBackendExpiryDays(raw string) (int, error) {
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("backend-expiry-days: invalid value %q: must be a non-negative integer", raw)
+	}
+	return days, nil
+}
+
+func parseBackendPolicyOverrides(flagName string, valueName string, raw string) ([]backendPolicyOverride, error) {
+	overrides := make([]backendPolicyOverride, 0)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("%s: invalid entry %q: expected <backend>=<%s>", flagName, entry, valueName)
+		}
+		overrides = append(overrides, backendPolicyOverride{name: name, value: value})
+	}
+
+	return overrides, nil
+}
+
+// lookupBackendPolicy returns the value of the last entry naming instance, or
+// failing that the last entry naming backend.
+func lookupBackendPolicy(overrides []backendPolicyOverride, backend string, instance string) (string, bool) {
+	value, found := "", false
+	for _, name := range []string{backend, instance} {
+		for _, override := range overrides {
+			if override.name == name {
+				value, found = override.value, true
+			}
+		}
+	}
+	return value, found
+}
+
+// knownStorageNames lists the registered backend types followed by the names
+// of the configured storage instances.
+func knownStorageNames(instances []StorageInstance) []string {
+	known := backendNames()
+	for _, instance := range instances {
+		known = append(known, instance.Name)
+	}
+	return known
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/egose/database-tools/storage"
 	"github.com/egose/database-tools/utils"
@@ -166,149 +167,114 @@ func (b MongoFlagBindings) Apply(target *MongoOptions) {
 }
 
 type StorageFlagBindings struct {
-	AZEndpoint          *string
-	AZAccountName       *string
-	AZAccountKey        *string
-	AZContainerName     *string
-	AWSEndpoint         *string
-	AWSAccessKeyID      *string
-	AWSSecretAccessKey  *string
-	AWSRegion           *string
-	AWSBucket           *string
-	AWSS3ForcePathStyle *bool
-	GCPEndpoint         *string
-	GCPBucket           *string
-	GCPCredsFile        *string
-	GCPProjectID        *string
-	GCPPrivateKeyID     *string
-	GCPPrivateKey       *string
-	GCPClientEmail      *string
-	GCPClientID         *string
-	LocalPath           *string
-	BackupPrefix        *string
-	StorageBackend      *string
+	BackendStrings    map[string]*string
+	BackendBools      map[string]*bool
+	BackupPrefix      *string
+	BackendPrefixes   *string
+	NameTemplate      *string
+	StorageBackend    *string
+	UploadRateLimit   *string
+	DownloadRateLimit *string
+	BackendRateLimits *string
+	RateLimitSchedule *string
+	StorageInstances  *string
+
+	env EnvReader
 }
 
 var storageFlagDefs = struct {
-	azEndpoint          StringFlagDef
-	azAccountName       StringFlagDef
-	azAccountKey        StringFlagDef
-	azContainerName     StringFlagDef
-	awsEndpoint         StringFlagDef
-	awsAccessKeyID      StringFlagDef
-	awsSecretAccessKey  StringFlagDef
-	awsRegion           StringFlagDef
-	awsBucket           StringFlagDef
-	awsS3ForcePathStyle BoolFlagDef
-	gcpEndpoint         StringFlagDef
-	gcpBucket           StringFlagDef
-	gcpCredsFile        StringFlagDef
-	gcpProjectID        StringFlagDef
-	gcpPrivateKeyID     StringFlagDef
-	gcpPrivateKey       StringFlagDef
-	gcpClientEmail      StringFlagDef
-	gcpClientID         StringFlagDef
-	localPath           StringFlagDef
-	backupPrefix        StringFlagDef
-	storageBackend      StringFlagDef
+	backupPrefix      StringFlagDef
+	backendPrefixes   StringFlagDef
+	nameTemplate      StringFlagDef
+	storageBackend    StringFlagDef
+	uploadRateLimit   StringFlagDef
+	downloadRateLimit StringFlagDef
+	backendRateLimits StringFlagDef
+	rateLimitSchedule StringFlagDef
+	storageInstances  StringFlagDef
 }{
-	azEndpoint:          StringFlagDef{Name: "az-endpoint", EnvKey: "AZ_ENDPOINT", Usage: "specify the emulator hostname and Azure Blob Storage port"},
-	azAccountName:       StringFlagDef{Name: "az-account-name", EnvKey: "AZ_ACCOUNT_NAME", Usage: "Azure Blob Storage Account Name"},
-	azAccountKey:        StringFlagDef{Name: "az-account-key", EnvKey: "AZ_ACCOUNT_KEY", Usage: "Azure Blob Storage Account Key"},
-	azContainerName:     StringFlagDef{Name: "az-container-name", EnvKey: "AZ_CONTAINER_NAME", Usage: "Azure Blob Storage Container Name"},
-	awsEndpoint:         StringFlagDef{Name: "aws-endpoint", EnvKey: "AWS_ENDPOINT", Usage: "AWS endpoint URL (hostname only or fully qualified URI)"},
-	awsAccessKeyID:      StringFlagDef{Name: "aws-access-key-id", EnvKey: "AWS_ACCESS_KEY_ID", Usage: "AWS access key associated with an IAM account"},
-	awsSecretAccessKey:  StringFlagDef{Name: "aws-secret-access-key", EnvKey: "AWS_SECRET_ACCESS_KEY", Usage: "AWS secret key associated with the access key"},
-	awsRegion:           StringFlagDef{Name: "aws-region", EnvKey: "AWS_REGION", Usage: "AWS Region whose servers you want to send your requests to", Defaults: []string{"us-east-1"}},
-	awsBucket:           StringFlagDef{Name: "aws-bucket", EnvKey: "AWS_BUCKET", Usage: "AWS S3 bucket name"},
-	awsS3ForcePathStyle: BoolFlagDef{Name: "aws-s3-force-path-style", EnvKey: "AWS_S3_FORCE_PATH_STYLE", Usage: "force the request to use path-style addressing, i.e., `http://s3.amazonaws.com/BUCKET/KEY`. By default, the S3 client will use virtual hosted bucket addressing when possible (`http://BUCKET.s3.amazonaws.com/KEY`)"},
-	gcpEndpoint:         StringFlagDef{Name: "gcp-endpoint", EnvKey: "GCP_ENDPOINT", Usage: "GCP endpoint URL"},
-	gcpBucket:           StringFlagDef{Name: "gcp-bucket", EnvKey: "GCP_BUCKET", Usage: "GCP storage bucket name"},
-	gcpCredsFile:        StringFlagDef{Name: "gcp-creds-file", EnvKey: "GCP_CREDS_FILE", Usage: "GCP service account's credentials file"},
-	gcpProjectID:        StringFlagDef{Name: "gcp-project-id", EnvKey: "GCP_PROJECT_ID", Usage: "GCP service account's project id"},
-	gcpPrivateKeyID:     StringFlagDef{Name: "gcp-private-key-id", EnvKey: "GCP_PRIVATE_KEY_ID", Usage: "GCP service account's private key id"},
-	gcpPrivateKey:       StringFlagDef{Name: "gcp-private-key", EnvKey: "GCP_PRIVATE_KEY", Usage: "GCP service account's private key"},
-	gcpClientEmail:      StringFlagDef{Name: "gcp-client-email", EnvKey: "GCP_CLIENT_EMAIL", Usage: "GCP service account's client email"},
-	gcpClientID:         StringFlagDef{Name: "gcp-client-id", EnvKey: "GCP_CLIENT_ID", Usage: "GCP service account's client id"},
-	localPath:           StringFlagDef{Name: "local-path", EnvKey: "LOCAL_PATH", Usage: "Local directory path to store backups"},
-	backupPrefix:        StringFlagDef{Name: "backup-prefix", EnvKey: "BACKUP_PREFIX", Usage: "Prefix/namespace used for managed backup objects", Defaults: []string{storage.DefaultBackupPrefix}},
-	storageBackend:      StringFlagDef{Name: "storage-backend", EnvKey: "STORAGE_BACKEND", Usage: "Storage backend to use for restore when multiple backends are configured (azure, aws, gcp, local)"},
+	backupPrefix:      StringFlagDef{Name: "backup-prefix", EnvKey: "BACKUP_PREFIX", Usage: "Prefix/namespace used for managed backup objects", Defaults: []string{storage.DefaultBackupPrefix}},
+	backendPrefixes:   StringFlagDef{Name: "backend-prefixes", EnvKey: "BACKEND_PREFIXES", Usage: "Comma-separated per-backend backup prefix overrides as <backend>=<prefix>, e.g. local=nightly,aws=archive"},
+	nameTemplate:      StringFlagDef{Name: "backup-name-template", EnvKey: "BACKUP_NAME_TEMPLATE", Usage: "Template for backup names under the backup prefix, built from {db}, {cluster}, {label}, {utc} and {seq}, e.g. {cluster}/{db}/{utc}-{seq}; / creates sub-directories and .tar.gz is appended (empty for the legacy <reverse-timestamp>-<utc>.tar.gz names)"},
+	storageBackend:    StringFlagDef{Name: "storage-backend", EnvKey: "STORAGE_BACKEND", Usage: "Storage instance name or backend type (azure, aws, gcp, local) to use for restore when multiple backends are configured"},
+	uploadRateLimit:   StringFlagDef{Name: "upload-rate-limit", EnvKey: "UPLOAD_RATE_LIMIT", Usage: "Maximum upload rate in bytes per second; accepts KB, MB, GB, KiB, MiB, and GiB suffixes (empty or 0 for unlimited)"},
+	downloadRateLimit: StringFlagDef{Name: "download-rate-limit", EnvKey: "DOWNLOAD_RATE_LIMIT", Usage: "Maximum download rate in bytes per second; accepts KB, MB, GB, KiB, MiB, and GiB suffixes (empty or 0 for unlimited)"},
+	backendRateLimits: StringFlagDef{Name: "backend-rate-limits", EnvKey: "BACKEND_RATE_LIMITS", Usage: "Comma-separated per-backend rate limit overrides as <backend>[.upload|.download]=<rate>, e.g. aws=10MiB,local.download=0"},
+	rateLimitSchedule: StringFlagDef{Name: "rate-limit-schedule", EnvKey: "RATE_LIMIT_SCHEDULE", Usage: "Comma-separated daily HH:MM-HH:MM windows, in local time, during which rate limits apply (empty to always apply)"},
+	storageInstances:  StringFlagDef{Name: "storage-instances", EnvKey: "STORAGE_INSTANCES", Usage: "Comma-separated named storage instances as <name>=<backend>, e.g. minio=aws,aws-west=aws; each instance reads its settings from STORAGE__<NAME>__<KEY> environment variables"},
 }
 
+// BindStorageFlags binds the flags of every registered storage backend
+// followed by the flags shared by all of them.
 func BindStorageFlags(fs FlagBinder, env EnvReader) StorageFlagBindings {
-	return StorageFlagBindings{
-		AZEndpoint:          storageFlagDefs.azEndpoint.Bind(fs, env),
-		AZAccountName:       storageFlagDefs.azAccountName.Bind(fs, env),
-		AZAccountKey:        storageFlagDefs.azAccountKey.Bind(fs, env),
-		AZContainerName:     storageFlagDefs.azContainerName.Bind(fs, env),
-		AWSEndpoint:         storageFlagDefs.awsEndpoint.Bind(fs, env),
-		AWSAccessKeyID:      storageFlagDefs.awsAccessKeyID.Bind(fs, env),
-		AWSSecretAccessKey:  storageFlagDefs.awsSecretAccessKey.Bind(fs, env),
-		AWSRegion:           storageFlagDefs.awsRegion.Bind(fs, env),
-		AWSBucket:           storageFlagDefs.awsBucket.Bind(fs, env),
-		AWSS3ForcePathStyle: storageFlagDefs.awsS3ForcePathStyle.Bind(fs, env),
-		GCPEndpoint:         storageFlagDefs.gcpEndpoint.Bind(fs, env),
-		GCPBucket:           storageFlagDefs.gcpBucket.Bind(fs, env),
-		GCPCredsFile:        storageFlagDefs.gcpCredsFile.Bind(fs, env),
-		GCPProjectID:        storageFlagDefs.gcpProjectID.Bind(fs, env),
-		GCPPrivateKeyID:     storageFlagDefs.gcpPrivateKeyID.Bind(fs, env),
-		GCPPrivateKey:       storageFlagDefs.gcpPrivateKey.Bind(fs, env),
-		GCPClientEmail:      storageFlagDefs.gcpClientEmail.Bind(fs, env),
-		GCPClientID:         storageFlagDefs.gcpClientID.Bind(fs, env),
-		LocalPath:           storageFlagDefs.localPath.Bind(fs, env),
-		BackupPrefix:        storageFlagDefs.backupPrefix.Bind(fs, env),
-		StorageBackend:      storageFlagDefs.storageBackend.Bind(fs, env),
+	bindings := StorageFlagBindings{
+		BackendStrings: map[string]*string{},
+		BackendBools:   map[string]*bool{},
 	}
+	for _, backendType := range storage.Backends() {
+		for _, def := range backendType.StringFlags {
+			bindings.BackendStrings[def.Name] = def.Bind(fs, env)
+		}
+		for _, def := range backendType.BoolFlags {
+			bindings.BackendBools[def.Name] = def.Bind(fs, env)
+		}
+	}
+
+	bindings.BackupPrefix = storageFlagDefs.backupPrefix.Bind(fs, env)
+	bindings.BackendPrefixes = storageFlagDefs.backendPrefixes.Bind(fs, env)
+	bindings.NameTemplate = storageFlagDefs.nameTemplate.Bind(fs, env)
+	bindings.StorageBackend = storageFlagDefs.storageBackend.Bind(fs, env)
+	bindings.UploadRateLimit = storageFlagDefs.uploadRateLimit.Bind(fs, env)
+	bindings.DownloadRateLimit = storageFlagDefs.downloadRateLimit.Bind(fs, env)
+	bindings.BackendRateLimits = storageFlagDefs.backendRateLimits.Bind(fs, env)
+	bindings.RateLimitSchedule = storageFlagDefs.rateLimitSchedule.Bind(fs, env)
+	bindings.StorageInstances = storageFlagDefs.storageInstances.Bind(fs, env)
+	bindings.env = env
+	return bindings
 }
 
 func StorageFlagDocs(envPrefix string) []FlagDoc {
-	return []FlagDoc{
-		storageFlagDefs.azEndpoint.Doc(envPrefix),
-		storageFlagDefs.azAccountName.Doc(envPrefix),
-		storageFlagDefs.azAccountKey.Doc(envPrefix),
-		storageFlagDefs.azContainerName.Doc(envPrefix),
-		storageFlagDefs.awsEndpoint.Doc(envPrefix),
-		storageFlagDefs.awsAccessKeyID.Doc(envPrefix),
-		storageFlagDefs.awsSecretAccessKey.Doc(envPrefix),
-		storageFlagDefs.awsRegion.Doc(envPrefix),
-		storageFlagDefs.awsBucket.Doc(envPrefix),
-		storageFlagDefs.awsS3ForcePathStyle.Doc(envPrefix),
-		storageFlagDefs.gcpEndpoint.Doc(envPrefix),
-		storageFlagDefs.gcpBucket.Doc(envPrefix),
-		storageFlagDefs.gcpCredsFile.Doc(envPrefix),
-		storageFlagDefs.gcpProjectID.Doc(envPrefix),
-		storageFlagDefs.gcpPrivateKeyID.Doc(envPrefix),
-		storageFlagDefs.gcpPrivateKey.Doc(envPrefix),
-		storageFlagDefs.gcpClientEmail.Doc(envPrefix),
-		storageFlagDefs.gcpClientID.Doc(envPrefix),
-		storageFlagDefs.localPath.Doc(envPrefix),
+	docs := make([]FlagDoc, 0)
+	for _, backendType := range storage.Backends() {
+		for _, def := range backendType.StringFlags {
+			docs = append(docs, def.Doc(envPrefix))
+		}
+		for _, def := range backendType.BoolFlags {
+			docs = append(docs, def.Doc(envPrefix))
+		}
+	}
+
+	return append(docs,
 		storageFlagDefs.backupPrefix.Doc(envPrefix),
+		storageFlagDefs.backendPrefixes.Doc(envPrefix),
+		storageFlagDefs.nameTemplate.Doc(envPrefix),
 		storageFlagDefs.storageBackend.Doc(envPrefix),
-	}
+		storageFlagDefs.uploadRateLimit.Doc(envPrefix),
+		storageFlagDefs.downloadRateLimit.Doc(envPrefix),
+		storageFlagDefs.backendRateLimits.Doc(envPrefix),
+		storageFlagDefs.rateLimitSchedule.Doc(envPrefix),
+		storageFlagDefs.storageInstances.Doc(envPrefix),
+	)
 }
 
 func (b StorageFlagBindings) Apply(target *StorageOptions) {
-	target.AZEndpoint = *b.AZEndpoint
-	target.AZAccountName = *b.AZAccountName
-	target.AZAccountKey = *b.AZAccountKey
-	target.AZContainerName = *b.AZContainerName
-	target.AWSEndpoint = *b.AWSEndpoint
-	target.AWSAccessKeyID = *b.AWSAccessKeyID
-	target.AWSSecretAccessKey = *b.AWSSecretAccessKey
-	target.AWSRegion = *b.AWSRegion
-	target.AWSBucket = *b.AWSBucket
-	target.AWSS3ForcePathStyle = *b.AWSS3ForcePathStyle
-	target.GCPEndpoint = *b.GCPEndpoint
-	target.GCPBucket = *b.GCPBucket
-	target.GCPCredsFile = *b.GCPCredsFile
-	target.GCPProjectID = *b.GCPProjectID
-	target.GCPPrivateKeyID = *b.GCPPrivateKeyID
-	target.GCPPrivateKey = *b.GCPPrivateKey
-	target.GCPClientEmail = *b.GCPClientEmail
-	target.GCPClientID = *b.GCPClientID
-	target.LocalPath = *b.LocalPath
+	target.Settings = storage.BackendSettings{}
+	for name, value := range b.BackendStrings {
+		target.Settings[name] = *value
+	}
+	for name, value := range b.BackendBools {
+		target.Settings.SetBool(name, *value)
+	}
 	target.BackupPrefix = *b.BackupPrefix
+	target.BackendPrefixes = *b.BackendPrefixes
+	target.BackupNameTemplate = *b.NameTemplate
 	target.StorageBackend = *b.StorageBackend
+	target.UploadRateLimit = *b.UploadRateLimit
+	target.DownloadRateLimit = *b.DownloadRateLimit
+	target.BackendRateLimits = *b.BackendRateLimits
+	target.RateLimitSchedule = *b.RateLimitSchedule
+	target.StorageInstances = *b.StorageInstances
+	target.env = b.env
 }
 
 type MongoOptions struct {
@@ -510,58 +476,58 @@ func (m MongoOptions) MongoClientOptions() (*mongooptions.ClientOptions, error)
 	return mongooptions.Client().ApplyURI(parsedURI.String()), nil
 }
 
+// StorageOptions configures the storage backends. Settings holds the values
+// of the registered backends' flags, keyed by flag name. BackendExpiryDays
+// and BackupTier are set by tools that apply retention, and
+// RateLimitLocation by tools that run in a configured time zone.
 type StorageOptions struct {
-	AZEndpoint          string
-	AZAccountName       string
-	AZAccountKey        string
-	AZContainerName     string
-	AWSEndpoint         string
-	AWSAccessKeyID      string
-	AWSSecretAccessKey  string
-	AWSRegion           string
-	AWSBucket           string
-	AWSS3ForcePathStyle bool
-	GCPEndpoint         string
-	GCPBucket           string
-	GCPCredsFile        string
-	GCPProjectID        string
-	GCPPrivateKeyID     string
-	GCPPrivateKey       string
-	GCPClientEmail      string
-	GCPClientID         string
-	LocalPath           string
-	BackupPrefix        string
-	StorageBackend      string
+	Settings           storage.BackendSettings
+	BackupPrefix       string
+	BackendPrefixes    string
+	BackupNameTemplate string
+	BackendExpiryDays  string
+	StorageBackend     string
+	UploadRateLimit    string
+	DownloadRateLimit  string
+	BackendRateLimits  string
+	RateLimitSchedule  string
+	RateLimitLocation  *time.Location
+	StorageInstances   string
+	StorageURLs        string
+	BackupTier         string
+	Transfers          *storage.TransferStateStore
+
+	env EnvReader
 }
 
 func (s StorageOptions) GetStorages(ctx context.Context, expiryDays int) ([]storage.Storage, error) {
-	type option struct {
-		name    string
-		enabled func() bool
-		getter  func() (storage.Storage, error)
+	instances, err := s.Instances()
+	if err != nil {
+		return nil, err
 	}
-
-	options := []option{
-		{"Local", s.useLocal, func() (storage.Storage, error) { return s.getLocalStorage(expiryDays) }},
-		{"Azure", s.useAzure, func() (storage.Storage, error) { return s.getAzBlobStorage(expiryDays) }},
-		{"AWS", s.useAWS, func() (storage.Storage, error) { return s.getAwsS3Storage(expiryDays) }},
-		{"GCP", s.useGCP, func() (storage.Storage, error) { return s.getGcpStorage(ctx, expiryDays) }},
+	nameTemplate, err := s.NameTemplate()
+	if err != nil {
+		return nil, err
 	}
 
 	storages := make([]storage.Storage, 0)
 	foundNames := make([]string, 0)
 	initErrors := make([]error, 0)
-	for _, opt := range options {
-		if opt.enabled() {
-			storageBackend, err := opt.getter()
-			if err != nil {
-				initErrors = append(initErrors, fmt.Errorf("%s storage initialization failed: %w", opt.name, err))
-				continue
-			}
-			if storageBackend != nil {
-				storages = append(storages, storageBackend)
-				foundNames = append(foundNames, opt.name)
-			}
+	for _, instance := range instances {
+		instanceExpiryDays, err := s.InstanceExpiryDays(instance, expiryDays)
+		if err != nil {
+			initErrors = append(initErrors, err)
+			continue
+		}
+
+		storageBackend, err := s.newStorage(ctx, instance, instanceExpiryDays, nameTemplate)
+		if err != nil {
+			initErrors = append(initErrors, fmt.Errorf("%s storage initialization failed: %w", instance.label(), err))
+			continue
+		}
+		if storageBackend != nil {
+			storages = append(storages, storageBackend)
+			foundNames = append(foundNames, fmt.Sprintf("%s: prefix %s, %s", instance.label(), storage.NormalizeBackupPrefix(instance.BackupPrefix), describeExpiry(instanceExpiryDays)))
 		}
 	}
 
@@ -579,50 +545,31 @@ func (s StorageOptions) GetStorages(ctx context.Context, expiryDays int) ([]stor
 	return storages, nil
 }
 
-func (s StorageOptions) getAzBlobStorage(expiryDays int) (storage.Storage, error) {
-	az := new(storage.AzBlob)
-	if err := az.Init(s.AZAccountName, s.AZAccountKey, s.AZContainerName, s.AZEndpoint, expiryDays, s.BackupPrefix); err != nil {
-		return nil, err
+func describeExpiry(expiryDays int) string {
+	if expiryDays == 0 {
+		return "backups do not expire"
 	}
-	return az, nil
+	return fmt.Sprintf("backups expire after %d days", expiryDays)
 }
 
-func (s StorageOptions) getAwsS3Storage(expiryDays int) (storage.Storage, error) {
-	s3 := new(storage.AwsS3)
-	if err := s3.Init(s.AWSEndpoint, s.AWSAccessKeyID, s.AWSSecretAccessKey, s.AWSRegion, s.AWSBucket, s.AWSS3ForcePathStyle, expiryDays, s.BackupPrefix); err != nil {
-		return nil, err
+func (s StorageOptions) newStorage(ctx context.Context, instance StorageInstance, expiryDays int, nameTemplate *storage.NameTemplate) (storage.Storage, error) {
+	backendType, ok := storage.LookupBackend(instance.Backend)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage backend %q", instance.Backend)
 	}
-	return s3, nil
-}
-
-func (s StorageOptions) getGcpStorage(ctx context.Context, expiryDays int) (storage.Storage, error) {
-	gcpStorage := new(storage.GcpStorage)
-	if err := gcpStorage.Init(ctx, s.GCPEndpoint, s.GCPBucket, s.GCPCredsFile, s.GCPProjectID, s.GCPPrivateKeyID, s.GCPPrivateKey, s.GCPClientEmail, s.GCPClientID, expiryDays, s.BackupPrefix); err != nil {
-		return nil, err
-	}
-	return gcpStorage, nil
-}
 
-func (s StorageOptions) getLocalStorage(expiryDays int) (storage.Storage, error) {
-	localStorage := new(storage.LocalStorage)
-	if err := localStorage.Init(s.LocalPath, expiryDays, s.BackupPrefix); err != nil {
+	bandwidth, err := s.Bandwidth(instance.Backend, instance.Name)
+	if err != nil {
 		return nil, err
 	}
-	return localStorage, nil
-}
-
-func (s StorageOptions) useAzure() bool {
-	return s.AZAccountName != "" && s.AZAccountKey != "" && s.AZContainerName != ""
-}
-
-func (s StorageOptions) useAWS() bool {
-	return s.AWSAccessKeyID != "" && s.AWSSecretAccessKey != "" && s.AWSBucket != ""
-}
-
-func (s StorageOptions) useGCP() bool {
-	return s.GCPBucket != ""
-}
 
-func (s StorageOptions) useLocal() bool {
-	return s.LocalPath != ""
+	return backendType.New(ctx, storage.BackendConfig{
+		InstanceName: instance.Name,
+		Settings:     instance.Settings,
+		ExpiryDays:   expiryDays,
+		BackupPrefix: instance.BackupPrefix,
+		NameTemplate: nameTemplate,
+		Transfers:    s.Transfers,
+		Bandwidth:    bandwidth,
+	})
 }
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"flag"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -14,11 +15,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/egose/database-tools/flagdef"
 	"github.com/egose/database-tools/storage"
 )
 
 func TestGetStoragesReturnsConfiguredLocalBackend(t *testing.T) {
-	options := StorageOptions{LocalPath: t.TempDir()}
+	options := StorageOptions{Settings: storage.BackendSettings{"local-path": t.TempDir()}}
 
 	storages, err := options.GetStorages(context.Background(), 0)
 	if err != nil {
@@ -34,9 +36,11 @@ func TestGetStoragesReturnsConfiguredLocalBackend(t *testing.T) {
 
 func TestGetStoragesFailsClosedOnMixedValidAndInvalidBackends(t *testing.T) {
 	options := StorageOptions{
-		LocalPath:    t.TempDir(),
-		GCPBucket:    "test-bucket",
-		GCPCredsFile: "/tmp/does-not-exist.json",
+		Settings: storage.BackendSettings{
+			"local-path":     t.TempDir(),
+			"gcp-bucket":     "test-bucket",
+			"gcp-creds-file": "/tmp/does-not-exist.json",
+		},
 		BackupPrefix: storage.DefaultBackupPrefix,
 	}
 
@@ -178,3 +182,289 @@ func writeMongoTLSFiles(t *testing.T) (string, string, string) {
 
 	return caFile, clientPEMFile, password
 }
+
+func TestStorageOptionsBandwidthAppliesBackendOverrides(t *testing.T) {
+	options := StorageOptions{
+		UploadRateLimit:   "10MiB",
+		DownloadRateLimit: "20MiB",
+		BackendRateLimits: "aws=1MB,local.download=0,gcp.upload=0",
+		RateLimitSchedule: "22:00-06:00",
+	}
+
+	tests := []struct {
+		backend      string
+		wantUpload   int64
+		wantDownload int64
+	}{
+		{backend: storage.BackendAzure, wantUpload: 10 << 20, wantDownload: 20 << 20},
+		{backend: storage.BackendAWS, wantUpload: 1_000_000, wantDownload: 1_000_000},
+		{backend: storage.BackendLocal, wantUpload: 10 << 20, wantDownload: 0},
+		{backend: storage.BackendGCP, wantUpload: 0, wantDownload: 20 << 20},
+	}
+	for _, tt := range tests {
+		bandwidth, err := options.Bandwidth(tt.backend, tt.backend)
+		if err != nil {
+			t.Fatalf("Bandwidth(%q) error = %v", tt.backend, err)
+		}
+		if bandwidth.UploadRate != tt.wantUpload || bandwidth.DownloadRate != tt.wantDownload || len(bandwidth.Schedule) != 1 {
+			t.Fatalf("Bandwidth(%q) = %+v", tt.backend, bandwidth)
+		}
+	}
+
+	if bandwidth, err := (StorageOptions{BackendRateLimits: "local=0"}).Bandwidth(storage.BackendLocal, storage.BackendLocal); err != nil || bandwidth != nil {
+		t.Fatalf("Bandwidth() = %+v, %v, want unlimited", bandwidth, err)
+	}
+
+	for _, invalid := range []StorageOptions{
+		{UploadRateLimit: "fast"},
+		{BackendRateLimits: "ftp=1MB"},
+		{BackendRateLimits: "aws.sideways=1MB"},
+		{BackendRateLimits: "aws"},
+		{RateLimitSchedule: "night"},
+	} {
+		if err := invalid.ValidateBandwidth(); err == nil {
+			t.Fatalf("ValidateBandwidth(%+v) expected error", invalid)
+		}
+	}
+}
+
+func TestStorageOptionsInstancesRejectsInvalidDefinitions(t *testing.T) {
+	env := instanceEnv{"STORAGE__MINIO__AWS_BUCKET": "archives"}
+	tests := []struct {
+		options StorageOptions
+		want    string
+	}{
+		{options: StorageOptions{StorageInstances: "minio"}, want: "expected <name>=<backend>"},
+		{options: StorageOptions{StorageInstances: "MinIO=aws"}, want: "invalid instance name"},
+		{options: StorageOptions{StorageInstances: "minio=ftp"}, want: "unknown backend"},
+		{options: StorageOptions{StorageInstances: "local=local", Settings: storage.BackendSettings{"local-path": t.TempDir()}}, want: "already in use"},
+		{options: StorageOptions{StorageInstances: "minio=aws", env: env}, want: "aws requires STORAGE__MINIO__AWS_ACCESS_KEY_ID, STORAGE__MINIO__AWS_SECRET_ACCESS_KEY"},
+	}
+	for _, tt := range tests {
+		_, err := tt.options.Instances()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("Instances(%q) error = %v, want %q", tt.options.StorageInstances, err, tt.want)
+		}
+	}
+}
+
+func TestStorageOptionsBandwidthPrefersInstanceOverrides(t *testing.T) {
+	options := StorageOptions{
+		BackendRateLimits: "minio.upload=1MB,aws=5MB",
+		StorageInstances:  "minio=aws",
+		env: instanceEnv{
+			"STORAGE__MINIO__AWS_ACCESS_KEY_ID":     "key",
+			"STORAGE__MINIO__AWS_SECRET_ACCESS_KEY": "secret",
+			"STORAGE__MINIO__AWS_BUCKET":            "archives",
+		},
+	}
+	if err := options.ValidateBandwidth(); err != nil {
+		t.Fatalf("ValidateBandwidth() error = %v", err)
+	}
+
+	bandwidth, err := options.Bandwidth(storage.BackendAWS, "minio")
+	if err != nil {
+		t.Fatalf("Bandwidth() error = %v", err)
+	}
+	if bandwidth.UploadRate != 1_000_000 || bandwidth.DownloadRate != 5_000_000 {
+		t.Fatalf("Bandwidth() = %+v, want instance upload override over aws limits", bandwidth)
+	}
+
+	options.BackendRateLimits = "west=1MB"
+	if err := options.ValidateBandwidth(); err == nil {
+		t.Fatal("ValidateBandwidth() expected error for unknown storage instance")
+	}
+}
+
+type instanceEnv map[string]string
+
+func (e instanceEnv) GetValue(key string, defaults ...string) string {
+	if value := e[key]; value != "" {
+		return value
+	}
+	for _, fallback := range defaults {
+		if fallback != "" {
+			return fallback
+		}
+	}
+	return ""
+}
+
+func TestParseStorageURLMatchesDiscreteFlags(t *testing.T) {
+	options := StorageOptions{
+		Settings: storage.BackendSettings{
+			"az-account-name":       "account",
+			"az-account-key":        "az-key",
+			"aws-access-key-id":     "key",
+			"aws-secret-access-key": "secret",
+			"aws-region":            "us-east-1",
+		},
+		BackupPrefix: storage.DefaultBackupPrefix,
+	}
+
+	tests := []struct {
+		raw   string
+		name  string
+		check func(StorageInstance) bool
+	}{
+		{
+			raw:  "s3://archives/nightly/?region=ca-central-1&endpoint=http://minio:9000&force-path-style=true",
+			name: "aws",
+			check: func(o StorageInstance) bool {
+				return o.Settings.Get("aws-bucket") == "archives" && o.BackupPrefix == "nightly" && o.Settings.Get("aws-region") == "ca-central-1" &&
+					o.Settings.Get("aws-endpoint") == "http://minio:9000" && o.Settings.Bool("aws-s3-force-path-style") && o.Settings.Get("aws-access-key-id") == "key"
+			},
+		},
+		{
+			raw:  "s3://offsite?name=aws-west",
+			name: "aws-west",
+			check: func(o StorageInstance) bool {
+				return o.Settings.Get("aws-bucket") == "offsite" && o.BackupPrefix == storage.DefaultBackupPrefix && o.Settings.Get("aws-region") == "us-east-1"
+			},
+		},
+		{
+			raw:  "gs://bucket/mongo",
+			name: "gcp",
+			check: func(o StorageInstance) bool {
+				return o.Settings.Get("gcp-bucket") == "bucket" && o.BackupPrefix == "mongo"
+			},
+		},
+		{
+			raw:  "az://container?account=other",
+			name: "azure",
+			check: func(o StorageInstance) bool {
+				return o.Settings.Get("az-container-name") == "container" && o.Settings.Get("az-account-name") == "other" && o.Settings.Get("az-account-key") == "az-key"
+			},
+		},
+		{
+			raw:  "file://./dist/backup?prefix=local-prefix",
+			name: "local",
+			check: func(o StorageInstance) bool {
+				return o.Settings.Get("local-path") == "./dist/backup" && o.BackupPrefix == "local-prefix"
+			},
+		},
+		{
+			raw:   "file:///var/backups",
+			name:  "local",
+			check: func(o StorageInstance) bool { return o.Settings.Get("local-path") == "/var/backups" },
+		},
+	}
+	for _, tt := range tests {
+		instance, err := options.ParseStorageURL(tt.raw)
+		if err != nil {
+			t.Fatalf("ParseStorageURL(%q) error = %v", tt.raw, err)
+		}
+		if instance.Name != tt.name || !tt.check(instance) {
+			t.Fatalf("ParseStorageURL(%q) = %+v", tt.raw, instance)
+		}
+	}
+
+	for raw, want := range map[string]string{
+		"ftp://host/path":                "unsupported scheme",
+		"s3://key:secret@bucket":         "credentials are not accepted",
+		"s3://bucket?colour=blue":        "unknown parameter",
+		"s3:///prefix":                   "missing bucket name",
+		"gs://bucket?name=Not_Valid":     "invalid instance name",
+		"s3://bucket?force-path-style=x": "force-path-style must be true or false",
+	} {
+		if _, err := options.ParseStorageURL(raw); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("ParseStorageURL(%q) error = %v, want %q", raw, err, want)
+		}
+	}
+
+	if _, err := (StorageOptions{}).ParseStorageURL("s3://bucket"); err == nil || !strings.Contains(err.Error(), "--aws-access-key-id, --aws-secret-access-key") {
+		t.Fatalf("ParseStorageURL() error = %v, want missing credential flags", err)
+	}
+	if _, err := (StorageOptions{Settings: storage.BackendSettings{"local-path": t.TempDir()}, StorageURLs: "file:///tmp/a"}).Instances(); err == nil || !strings.Contains(err.Error(), "add ?name=") {
+		t.Fatalf("Instances() error = %v, want duplicate name error", err)
+	}
+}
+
+func TestStorageOptionsInstancesKeepCommasInsideURLs(t *testing.T) {
+	options := StorageOptions{
+		Settings: storage.BackendSettings{
+			"aws-access-key-id":     "key",
+			"aws-secret-access-key": "secret",
+		},
+		BackupPrefix: storage.DefaultBackupPrefix,
+		StorageURLs:  "s3://archives/mongo?region=ca-central-1&endpoint=http://minio:9000/tenant,eu, file:///mnt/nas/daily,weekly?name=nas,",
+	}
+
+	instances, err := options.Instances()
+	if err != nil {
+		t.Fatalf("Instances() error = %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Instances() = %+v, want two instances", instances)
+	}
+	if got := instances[0].Settings.Get("aws-endpoint"); got != "http://minio:9000/tenant,eu" {
+		t.Fatalf("aws-endpoint = %q, want the comma kept in the query value", got)
+	}
+	if got := instances[1].Settings.Get("local-path"); instances[1].Name != "nas" || got != "/mnt/nas/daily,weekly" {
+		t.Fatalf("instance %s local-path = %q, want nas with the comma kept in the path", instances[1].Name, got)
+	}
+}
+
+type scratchStorage struct {
+	storage.Storage
+	instanceName string
+	dir          string
+}
+
+func init() {
+	storage.RegisterBackend(storage.BackendType{
+		Name:        "scratch",
+		Label:       "Scratch",
+		StringFlags: []flagdef.StringFlagDef{{Name: "scratch-dir", EnvKey: "SCRATCH_DIR", Usage: "scratch directory"}},
+		Missing:     storage.RequireSettings("scratch-dir"),
+		New: func(_ context.Context, config storage.BackendConfig) (storage.Storage, error) {
+			return &scratchStorage{instanceName: config.InstanceName, dir: config.Settings.Get("scratch-dir")}, nil
+		},
+		Instance: func(s storage.Storage) (string, bool) {
+			scratch, ok := s.(*scratchStorage)
+			if !ok {
+				return "", false
+			}
+			return scratch.instanceName, true
+		},
+	})
+}
+
+func TestRegisteredBackendIsBoundAndConstructed(t *testing.T) {
+	env := instanceEnv{
+		"SCRATCH_DIR":                 "/tmp/scratch",
+		"STORAGE__SPARE__SCRATCH_DIR": "/tmp/spare",
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	bindings := BindStorageFlags(fs, env)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	options := StorageOptions{}
+	bindings.Apply(&options)
+	options.StorageInstances = "spare=scratch"
+	options.env = env
+
+	storages, err := options.GetStorages(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("GetStorages() error = %v", err)
+	}
+	if len(storages) != 2 {
+		t.Fatalf("GetStorages() len = %d, want 2", len(storages))
+	}
+	for i, want := range []scratchStorage{{instanceName: "scratch", dir: "/tmp/scratch"}, {instanceName: "spare", dir: "/tmp/spare"}} {
+		got, ok := storages[i].(*scratchStorage)
+		if !ok || got.instanceName != want.instanceName || got.dir != want.dir {
+			t.Fatalf("GetStorages()[%d] = %+v, want %+v", i, storages[i], want)
+		}
+	}
+
+	documented := false
+	for _, doc := range StorageFlagDocs("MONGOARCHIVE__") {
+		documented = documented || doc.Flag == "`--scratch-dir`"
+	}
+	if !documented {
+		t.Fatal("StorageFlagDocs() does not document --scratch-dir")
+	}
+}
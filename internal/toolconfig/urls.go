@@ -0,0 +1,103 @@
+package toolconfig
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/egose/database-tools/storage"
+)
+
+// storageURLStart matches the scheme that begins a storage URL.
+var storageURLStart = regexp.MustCompile(`^\s*[A-Za-z][A-Za-z0-9+.-]*://`)
+
+// ParseStorageURL turns a destination URL into the storage instance the
+// discrete flags would configure for the same location, for example
+// s3://<bucket>/<prefix>?region=ca-central-1. The registered backend whose
+// URLScheme matches interprets the URL. It names the location only:
+// credentials, and any setting the URL leaves out, come from s. The instance
+// is named after its backend type unless the URL sets name.
+func (s StorageOptions) ParseStorageURL(raw string) (StorageInstance, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return StorageInstance{}, fmt.Errorf("invalid storage URL %q: %w", raw, err)
+	}
+
+	backendType, ok := storage.LookupBackendScheme(parsed.Scheme)
+	if !ok {
+		schemes := make([]string, 0)
+		for _, registered := range storage.Backends() {
+			if registered.URLScheme != "" {
+				schemes = append(schemes, registered.URLScheme+"://")
+			}
+		}
+		return StorageInstance{}, fmt.Errorf("invalid storage URL %q: unsupported scheme (expected one of %s)", raw, strings.Join(schemes, ", "))
+	}
+	if parsed.User != nil {
+		return StorageInstance{}, fmt.Errorf("invalid storage URL %q: credentials are not accepted in storage URLs; set them with the %s flags or environment variables", parsed.Redacted(), backendType.Name)
+	}
+
+	query := parsed.Query()
+	name := query.Get("name")
+	if name == "" {
+		name = backendType.Name
+	}
+	if !storageInstanceNamePattern.MatchString(name) {
+		return StorageInstance{}, fmt.Errorf("invalid storage URL %q: invalid instance name %q: use lowercase letters, digits, and dashes", raw, name)
+	}
+	query.Del("name")
+	location := *parsed
+	location.RawQuery = query.Encode()
+
+	settings := s.Settings.Clone()
+	backupPrefix, err := backendType.ParseURL(&location, settings)
+	if err != nil {
+		return StorageInstance{}, fmt.Errorf("invalid storage URL %q: %w", raw, err)
+	}
+	if backupPrefix == "" {
+		if backupPrefix, err = s.backupPrefix(backendType.Name, name); err != nil {
+			return StorageInstance{}, err
+		}
+	}
+
+	if missing := backendType.Missing(settings); len(missing) > 0 {
+		flags := make([]string, 0, len(missing))
+		for _, flagName := range missing {
+			flags = append(flags, "--"+flagName)
+		}
+		return StorageInstance{}, fmt.Errorf("storage URL %q needs %s, set by flag or environment variable", raw, strings.Join(flags, ", "))
+	}
+
+	return StorageInstance{Name: name, Backend: backendType.Name, Settings: settings, BackupPrefix: backupPrefix}, nil
+}
+
+func (s StorageOptions) urlInstances() ([]StorageInstance, error) {
+	instances := make([]StorageInstance, 0)
+	for _, raw := range splitStorageURLs(s.StorageURLs) {
+		instance, err := s.ParseStorageURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// splitStorageURLs splits a comma-separated list of storage URLs. Only a
+// comma followed by a scheme:// starts a new URL, so that commas in a path or
+// a query value, such as a SAS token, stay in their URL. Blank entries are
+// skipped.
+func splitStorageURLs(raw string) []string {
+	urls := make([]string, 0)
+	for _, part := range strings.Split(raw, ",") {
+		switch {
+		case strings.TrimSpace(part) == "":
+		case len(urls) > 0 && !storageURLStart.MatchString(part):
+			urls[len(urls)-1] += "," + part
+		default:
+			urls = append(urls, part)
+		}
+	}
+	return urls
+}
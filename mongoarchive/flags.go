@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/egose/database-tools/internal/toolconfig"
@@ -21,14 +26,56 @@ const (
 	defaultCronExpr   = "0 2 * * *"
 )
 
+// CommandJanitor runs a cleanup pass instead of the regular task.
+const CommandJanitor = "janitor"
+
+// CommandCopy copies backups from one storage backend to others instead of
+// taking a new backup.
+const CommandCopy = "copy"
+
+// CommandMigrate moves legacy backups held outside the backup prefix to
+// managed names instead of taking a new backup.
+const CommandMigrate = "migrate"
+
+// CommandAudit compares the backups held by every configured backend instead
+// of taking a new backup.
+const CommandAudit = "audit"
+
+// CommandPin pins backups so that retention and tiering keep them.
+const CommandPin = "pin"
+
+// CommandUnpin removes the pin from backups.
+const CommandUnpin = "unpin"
+
+// CommandList lists the backups held by every configured backend and whether
+// each is pinned.
+const CommandList = "list"
+
 type Config struct {
 	toolconfig.MongoOptions
 	toolconfig.StorageOptions
 	ArchiveQueryOptions
 	RetentionOptions
+	TieringOptions
 	NotificationOptions
 	ScheduleOptions
-	Keep bool
+	RetryOptions
+	RunLimitOptions
+	ControlOptions
+	MetricsOptions
+	CopyOptions
+	MigrateOptions
+	AuditOptions
+	PinOptions
+	NamingOptions
+	LockOptions
+	Keep    bool
+	Command string
+	// JobName names the job of --jobs-file this configuration belongs to.
+	JobName string
+	// Jobs holds the jobs of --jobs-file, each parsed into a configuration of
+	// its own.
+	Jobs []*Config
 }
 
 type ArchiveQueryOptions struct {
@@ -42,6 +89,15 @@ type RetentionOptions struct {
 	ExpiryDays int
 }
 
+// TieringOptions moves backups older than TierAfterDays from the TierSource
+// backend to the TierTarget backend after each backup run. The tier target
+// only receives backups through tiering.
+type TieringOptions struct {
+	TierSource    string
+	TierTarget    string
+	TierAfterDays int
+}
+
 type NotificationOptions struct {
 	RocketChatWebhookURL                       string
 	RocketChatWebhookPrefix                    string
@@ -69,10 +125,82 @@ type NotificationOptions struct {
 	NotificationAllowInsecureHTTPInDevelopment bool
 }
 
+type CopyOptions struct {
+	CopySource  string
+	CopyTargets string
+	CopyObjects string
+}
+
+type MigrateOptions struct {
+	MigratePattern string
+	MigrateMove    bool
+	DryRun         bool
+}
+
+type AuditOptions struct {
+	AuditChecksums bool
+	Repair         bool
+}
+
+// PinOptions pins the backup a run uploads when Pin is set, and names the
+// backups the pin and unpin commands act on.
+type PinOptions struct {
+	Pin        bool
+	PinReason  string
+	PinObjects string
+}
+
+// ControlOptions serve the health endpoints of a --cron process on
+// HTTPListen, and its control API when HTTPToken is set. Requests to the
+// control API must carry HTTPToken as a bearer token.
+type ControlOptions struct {
+	HTTPListen string
+	HTTPToken  string
+	// StaleBackupThreshold is the age past which the job's last successful
+	// backup counts as stale; zero never does.
+	StaleBackupThreshold time.Duration
+}
+
+// MetricsOptions push the metrics of a run without --cron to the Prometheus
+// Pushgateway at PushgatewayURL once the run ends.
+type MetricsOptions struct {
+	PushgatewayURL string
+}
+
+// LockOptions makes a run hold a lease on LockBackend, so that replicas of a
+// deployment never run the same job at the same time.
+type LockOptions struct {
+	Lock        bool
+	LockBackend string
+	LockTTL     time.Duration
+}
+
+// NamingOptions fills in the placeholders of the backup name template that
+// do not come from the MongoDB connection.
+type NamingOptions struct {
+	BackupLabel string
+}
+
 type ScheduleOptions struct {
-	Cron           bool
+	Cron              bool
+	CronExpression    string
+	Location          *time.Location
+	Schedules         []Schedule
+	JobsFile          string
+	MaxConcurrentJobs int
+	StartupRun        string
+	// ShutdownGracePeriod is how long runs in flight may go on after a
+	// termination signal before they are aborted.
+	ShutdownGracePeriod time.Duration
+}
+
+// Schedule is one of several named schedules of a job. Its backups carry its
+// name in the {tier} placeholder of the backup name template, and retention
+// keeps them for ExpiryDays.
+type Schedule struct {
+	Name           string
 	CronExpression string
-	Location       *time.Location
+	ExpiryDays     int
 }
 
 var archiveFlagDefs = struct {
@@ -80,7 +208,12 @@ var archiveFlagDefs = struct {
 	queryFile                                  toolconfig.StringFlagDef
 	readPreference                             toolconfig.StringFlagDef
 	forceTableScan                             toolconfig.BoolFlagDef
+	to                                         toolconfig.StringFlagDef
 	expiryDays                                 toolconfig.StringFlagDef
+	backendExpiryDays                          toolconfig.StringFlagDef
+	tierSource                                 toolconfig.StringFlagDef
+	tierTarget                                 toolconfig.StringFlagDef
+	tierAfterDays                              toolconfig.StringFlagDef
 	rocketChatWebhookURL                       toolconfig.StringFlagDef
 	rocketChatWebhookPrefix                    toolconfig.StringFlagDef
 	rocketChatNotifyOnFailureOnly              toolconfig.BoolFlagDef
@@ -108,6 +241,38 @@ var archiveFlagDefs = struct {
 	cron                                       toolconfig.BoolFlagDef
 	cronExpression                             toolconfig.StringFlagDef
 	tz                                         toolconfig.StringFlagDef
+	schedules                                  toolconfig.StringFlagDef
+	scheduleExp                                toolconfig.StringFlagDef
+	jobsFile                                   toolconfig.StringFlagDef
+	maxJobs                                    toolconfig.StringFlagDef
+	startupRun                                 toolconfig.StringFlagDef
+	shutdownGrace                              toolconfig.StringFlagDef
+	httpListen                                 toolconfig.StringFlagDef
+	httpToken                                  toolconfig.StringFlagDef
+	httpTokenFile                              toolconfig.StringFlagDef
+	staleBackup                                toolconfig.StringFlagDef
+	pushgatewayURL                             toolconfig.StringFlagDef
+	maxRunDuration                             toolconfig.StringFlagDef
+	runWindow                                  toolconfig.StringFlagDef
+	retryMax                                   toolconfig.StringFlagDef
+	retryBackoff                               toolconfig.StringFlagDef
+	retryDeadline                              toolconfig.StringFlagDef
+	lock                                       toolconfig.BoolFlagDef
+	lockBackend                                toolconfig.StringFlagDef
+	lockTTL                                    toolconfig.StringFlagDef
+	copySource                                 toolconfig.StringFlagDef
+	copyTargets                                toolconfig.StringFlagDef
+	copyObjects                                toolconfig.StringFlagDef
+	migratePattern                             toolconfig.StringFlagDef
+	migrateMove                                toolconfig.BoolFlagDef
+	dryRun                                     toolconfig.BoolFlagDef
+	auditChecksums                             toolconfig.BoolFlagDef
+	repair                                     toolconfig.BoolFlagDef
+	pin                                        toolconfig.BoolFlagDef
+	pinReason                                  toolconfig.StringFlagDef
+	pinObjects                                 toolconfig.StringFlagDef
+	backupLabel                                toolconfig.StringFlagDef
+	backupTier                                 toolconfig.StringFlagDef
 	keep                                       toolconfig.BoolFlagDef
 	version                                    toolconfig.BoolFlagDef
 }{
@@ -115,7 +280,12 @@ var archiveFlagDefs = struct {
 	queryFile:                           toolconfig.StringFlagDef{Name: "query-file", EnvKey: "QUERY_FILE", Usage: "path to a file containing a query filter (v2 Extended JSON)"},
 	readPreference:                      toolconfig.StringFlagDef{Name: "read-preference", EnvKey: "READ_PREFERENCE", Usage: "specify either a preference mode (e.g. 'nearest') or a preference json object"},
 	forceTableScan:                      toolconfig.BoolFlagDef{Name: "force-table-scan", EnvKey: "FORCE_TABLE_SCAN", Usage: "force a table scan"},
+	to:                                  toolconfig.StringFlagDef{Name: "to", EnvKey: "TO", Usage: "Comma-separated destination URLs such as s3://bucket/prefix?region=ca-central-1, gs://bucket/prefix, az://container/prefix, or file:///path; credentials still come from the backend flags"},
 	expiryDays:                          toolconfig.StringFlagDef{Name: "expiry-days", EnvKey: "EXPIRY_DAYS", Usage: "The maximum age, in days, for archives to be retained"},
+	backendExpiryDays:                   toolconfig.StringFlagDef{Name: "backend-expiry-days", EnvKey: "BACKEND_EXPIRY_DAYS", Usage: "Comma-separated per-backend retention overrides as <backend>=<days>, e.g. local=7,aws=90 (0 keeps archives forever)"},
+	tierSource:                          toolconfig.StringFlagDef{Name: "tier-source", EnvKey: "TIER_SOURCE", Usage: "Storage instance or backend type holding recent backups; backups older than --tier-after-days move to --tier-target"},
+	tierTarget:                          toolconfig.StringFlagDef{Name: "tier-target", EnvKey: "TIER_TARGET", Usage: "Storage instance or backend type that receives aging backups from --tier-source instead of new uploads"},
+	tierAfterDays:                       toolconfig.StringFlagDef{Name: "tier-after-days", EnvKey: "TIER_AFTER_DAYS", Usage: "The age, in days, at which backups move from --tier-source to --tier-target"},
 	rocketChatWebhookURL:                toolconfig.StringFlagDef{Name: "rocketchat-webhook-url", EnvKey: "ROCKETCHAT_WEBHOOK_URL", Usage: "Rocket Chat Webhook URL"},
 	rocketChatWebhookPrefix:             toolconfig.StringFlagDef{Name: "rocketchat-webhook-prefix", EnvKey: "ROCKETCHAT_WEBHOOK_PREFIX", Usage: "Rocket Chat Webhook Prefix"},
 	rocketChatNotifyOnFailureOnly:       toolconfig.BoolFlagDef{Name: "rocketchat-notify-on-failure-only", EnvKey: "ROCKETCHAT_NOTIFY_ON_FAILURE_ONLY", Usage: "Send Rocket Chat notifications only when something goes wrong during the execution"},
@@ -143,6 +313,38 @@ var archiveFlagDefs = struct {
 	cron:           toolconfig.BoolFlagDef{Name: "cron", EnvKey: "CRON", Usage: "run a cron schedular and block current execution path"},
 	cronExpression: toolconfig.StringFlagDef{Name: "cron-expression", EnvKey: "CRON_EXPRESSION", Usage: "a string describes individual details of the cron schedule"},
 	tz:             toolconfig.StringFlagDef{Name: "tz", EnvKey: "TZ", Usage: "user-specified time zone"},
+	schedules:      toolconfig.StringFlagDef{Name: "schedules", EnvKey: "SCHEDULES", Usage: "Semicolon-separated named schedules as <name>=<cron expression>, e.g. hourly=0 * * * *;daily=0 2 * * *; each tags its backups with its name in {tier}"},
+	scheduleExp:    toolconfig.StringFlagDef{Name: "schedule-expiry-days", EnvKey: "SCHEDULE_EXPIRY_DAYS", Usage: "Comma-separated per-schedule retention as <name>=<days>, e.g. hourly=2,daily=60; schedules without an entry use --expiry-days"},
+	jobsFile:       toolconfig.StringFlagDef{Name: "jobs-file", EnvKey: "JOBS_FILE", Usage: "Path to a JSON file listing backup jobs, each with a name and flags that override the command line for that job"},
+	maxJobs:        toolconfig.StringFlagDef{Name: "max-concurrent-jobs", EnvKey: "MAX_CONCURRENT_JOBS", Usage: "The maximum number of --jobs-file jobs that run at the same time", Defaults: []string{"1"}},
+	startupRun:     toolconfig.StringFlagDef{Name: "startup-run", EnvKey: "STARTUP_RUN", Usage: "When --cron runs a job at startup: never, missed (when a scheduled run was missed since its last success), or always", Defaults: []string{StartupRunNever}},
+	shutdownGrace:  toolconfig.StringFlagDef{Name: "shutdown-grace-period", EnvKey: "SHUTDOWN_GRACE_PERIOD", Usage: "How long --cron lets runs in flight finish after a termination signal before it aborts them; no new runs start meanwhile", Defaults: []string{"0s"}},
+	httpListen:     toolconfig.StringFlagDef{Name: "http-listen", EnvKey: "HTTP_LISTEN", Usage: "Address, e.g. :8080, on which --cron serves the HTTP control API to trigger, inspect, pause, and resume jobs"},
+	httpToken:      toolconfig.StringFlagDef{Name: "http-token", EnvKey: "HTTP_TOKEN", Usage: "Bearer token that requests to the HTTP control API must present; without it, --http-listen serves only the health endpoints"},
+	httpTokenFile:  toolconfig.StringFlagDef{Name: "http-token-file", EnvKey: "HTTP_TOKEN_FILE", Usage: "Path to a file, such as a mounted secret, holding the --http-token bearer token; cannot be combined with --http-token"},
+	staleBackup:    toolconfig.StringFlagDef{Name: "stale-backup-threshold", EnvKey: "STALE_BACKUP_THRESHOLD", Usage: "Age of a job's last successful backup past which the /status endpoint reports it stale; 0 disables the check", Defaults: []string{"0s"}},
+	pushgatewayURL: toolconfig.StringFlagDef{Name: "pushgateway-url", EnvKey: "PUSHGATEWAY_URL", Usage: "Prometheus Pushgateway URL that a run without --cron pushes its metrics to when it ends"},
+	maxRunDuration: toolconfig.StringFlagDef{Name: "max-run-duration", EnvKey: "MAX_RUN_DURATION", Usage: "Abort a backup run that takes longer than this duration, e.g. 2h; 0 leaves runs unbounded"},
+	runWindow:      toolconfig.StringFlagDef{Name: "run-window", EnvKey: "RUN_WINDOW", Usage: "Daily window in --tz as HH:MM-HH:MM, e.g. 01:00-05:00; runs outside it are refused, and runs still going at its end are aborted"},
+	retryMax:       toolconfig.StringFlagDef{Name: "retry-max-attempts", EnvKey: "RETRY_MAX_ATTEMPTS", Usage: "The maximum number of attempts of a failed --cron run, counting the first; 1 disables retries", Defaults: []string{"1"}},
+	retryBackoff:   toolconfig.StringFlagDef{Name: "retry-backoff", EnvKey: "RETRY_BACKOFF", Usage: "How long to wait before the first retry of a failed --cron run; each later retry waits twice as long", Defaults: []string{defaultRetryBackoff.String()}},
+	retryDeadline:  toolconfig.StringFlagDef{Name: "retry-deadline", EnvKey: "RETRY_DEADLINE", Usage: "How long before the next scheduled run of a job its retries stop", Defaults: []string{defaultRetryDeadline.String()}},
+	lock:           toolconfig.BoolFlagDef{Name: "lock", EnvKey: "LOCK", Usage: "Hold a lease on a storage backend while a backup runs, so that replicas and overlapping runs of the same job skip instead of running twice"},
+	lockBackend:    toolconfig.StringFlagDef{Name: "lock-backend", EnvKey: "LOCK_BACKEND", Usage: "Storage instance or backend type that holds the --lock lease; defaults to the first configured backend"},
+	lockTTL:        toolconfig.StringFlagDef{Name: "lock-ttl", EnvKey: "LOCK_TTL", Usage: "How long a --lock lease lasts without renewal; a crashed holder's lease is taken over once it expires", Defaults: []string{storage.DefaultLockTTL.String()}},
+	copySource:     toolconfig.StringFlagDef{Name: "copy-source", EnvKey: "COPY_SOURCE", Usage: "Storage instance or backend type the copy command reads backups from"},
+	copyTargets:    toolconfig.StringFlagDef{Name: "copy-targets", EnvKey: "COPY_TARGETS", Usage: "Comma-separated storage instances or backend types the copy command writes to; defaults to every other configured backend"},
+	copyObjects:    toolconfig.StringFlagDef{Name: "copy-objects", EnvKey: "COPY_OBJECTS", Usage: "Comma-separated backup filenames or object names to copy; defaults to every backup missing from a target"},
+	migratePattern: toolconfig.StringFlagDef{Name: "migrate-pattern", EnvKey: "MIGRATE_PATTERN", Usage: "Regular expression matching the full names of the legacy objects the migrate command migrates; defaults to generated backup filenames at the root"},
+	migrateMove:    toolconfig.BoolFlagDef{Name: "migrate-move", EnvKey: "MIGRATE_MOVE", Usage: "Delete each legacy object once its managed copy is verified"},
+	dryRun:         toolconfig.BoolFlagDef{Name: "dry-run", EnvKey: "DRY_RUN", Usage: "Report what the migrate command would do without changing storage"},
+	auditChecksums: toolconfig.BoolFlagDef{Name: "audit-checksums", EnvKey: "AUDIT_CHECKSUMS", Usage: "Download every copy of a backup held by more than one backend during an audit and compare SHA-256 checksums"},
+	repair:         toolconfig.BoolFlagDef{Name: "repair", EnvKey: "REPAIR", Usage: "Copy backups the audit command finds missing on a backend from a backend that holds them"},
+	pin:            toolconfig.BoolFlagDef{Name: "pin", EnvKey: "PIN", Usage: "Pin the uploaded backup on every backend so that retention and tiering keep it until it is unpinned"},
+	pinReason:      toolconfig.StringFlagDef{Name: "pin-reason", EnvKey: "PIN_REASON", Usage: "Why backups are pinned by --pin or the pin command, shown by the list command; up to 256 letters, digits, spaces, and + - . / : = _"},
+	pinObjects:     toolconfig.StringFlagDef{Name: "pin-objects", EnvKey: "PIN_OBJECTS", Usage: "Comma-separated backup filenames or object names the pin and unpin commands act on"},
+	backupLabel:    toolconfig.StringFlagDef{Name: "backup-label", EnvKey: "BACKUP_LABEL", Usage: "Value of the {label} placeholder in --backup-name-template, e.g. nightly"},
+	backupTier:     toolconfig.StringFlagDef{Name: "backup-tier", EnvKey: "BACKUP_TIER", Usage: "Value of the {tier} placeholder in --backup-name-template; without --cron, names the entry of --schedules to run, by default the one that keeps its backups longest"},
 	keep:           toolconfig.BoolFlagDef{Name: "keep", EnvKey: "KEEP", Usage: "keep data dump"},
 	version:        toolconfig.BoolFlagDef{Name: "version", Usage: "Show the version"},
 }
@@ -153,7 +355,31 @@ func ParseFlags() (*Config, bool, error) {
 }
 
 func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string) (*Config, bool, error) {
+	cfg, args, showVersion, err := parseConfig(flagSet, env, args)
+	if err != nil || showVersion {
+		return cfg, showVersion, err
+	}
+
+	if cfg.JobsFile == "" {
+		if err := cfg.Validate(); err != nil {
+			return nil, false, err
+		}
+		return cfg, false, nil
+	}
+	if cfg.Command != "" {
+		return nil, false, fmt.Errorf("--jobs-file cannot be combined with the %s command", cfg.Command)
+	}
+	if cfg.Jobs, err = loadJobs(cfg.JobsFile, env, args); err != nil {
+		return nil, false, err
+	}
+	return cfg, false, nil
+}
+
+// parseConfig parses args, with env, into a configuration without validating
+// it. It also returns the args that follow the command.
+func parseConfig(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string) (*Config, []string, bool, error) {
 	cfg := &Config{}
+	cfg.Command, args = toolconfig.SplitCommand(args, CommandJanitor, CommandCopy, CommandMigrate, CommandAudit, CommandPin, CommandUnpin, CommandList)
 
 	mongoBindings := toolconfig.BindMongoFlags(flagSet, env)
 	query := archiveFlagDefs.query.Bind(flagSet, env)
@@ -161,7 +387,12 @@ func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string)
 	readPreference := archiveFlagDefs.readPreference.Bind(flagSet, env)
 	forceTableScan := archiveFlagDefs.forceTableScan.Bind(flagSet, env)
 	storageBindings := toolconfig.BindStorageFlags(flagSet, env)
+	to := archiveFlagDefs.to.Bind(flagSet, env)
 	expiryDays := archiveFlagDefs.expiryDays.Bind(flagSet, env)
+	backendExpiryDays := archiveFlagDefs.backendExpiryDays.Bind(flagSet, env)
+	tierSource := archiveFlagDefs.tierSource.Bind(flagSet, env)
+	tierTarget := archiveFlagDefs.tierTarget.Bind(flagSet, env)
+	tierAfterDays := archiveFlagDefs.tierAfterDays.Bind(flagSet, env)
 	rocketChatWebhookURL := archiveFlagDefs.rocketChatWebhookURL.Bind(flagSet, env)
 	rocketChatWebhookPrefix := archiveFlagDefs.rocketChatWebhookPrefix.Bind(flagSet, env)
 	rocketChatNotifyOnFailureOnly := archiveFlagDefs.rocketChatNotifyOnFailureOnly.Bind(flagSet, env)
@@ -189,11 +420,43 @@ func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string)
 	cron := archiveFlagDefs.cron.Bind(flagSet, env)
 	cronExpression := archiveFlagDefs.cronExpression.Bind(flagSet, env)
 	tz := archiveFlagDefs.tz.Bind(flagSet, env)
+	schedules := archiveFlagDefs.schedules.Bind(flagSet, env)
+	scheduleExpiryDays := archiveFlagDefs.scheduleExp.Bind(flagSet, env)
+	jobsFile := archiveFlagDefs.jobsFile.Bind(flagSet, env)
+	maxJobs := archiveFlagDefs.maxJobs.Bind(flagSet, env)
+	startupRun := archiveFlagDefs.startupRun.Bind(flagSet, env)
+	shutdownGrace := archiveFlagDefs.shutdownGrace.Bind(flagSet, env)
+	httpListen := archiveFlagDefs.httpListen.Bind(flagSet, env)
+	httpToken := archiveFlagDefs.httpToken.Bind(flagSet, env)
+	httpTokenFile := archiveFlagDefs.httpTokenFile.Bind(flagSet, env)
+	staleBackup := archiveFlagDefs.staleBackup.Bind(flagSet, env)
+	pushgatewayURL := archiveFlagDefs.pushgatewayURL.Bind(flagSet, env)
+	maxRunDuration := archiveFlagDefs.maxRunDuration.Bind(flagSet, env)
+	runWindow := archiveFlagDefs.runWindow.Bind(flagSet, env)
+	retryMax := archiveFlagDefs.retryMax.Bind(flagSet, env)
+	retryBackoff := archiveFlagDefs.retryBackoff.Bind(flagSet, env)
+	retryDeadline := archiveFlagDefs.retryDeadline.Bind(flagSet, env)
+	lock := archiveFlagDefs.lock.Bind(flagSet, env)
+	lockBackend := archiveFlagDefs.lockBackend.Bind(flagSet, env)
+	lockTTL := archiveFlagDefs.lockTTL.Bind(flagSet, env)
+	copySource := archiveFlagDefs.copySource.Bind(flagSet, env)
+	copyTargets := archiveFlagDefs.copyTargets.Bind(flagSet, env)
+	copyObjects := archiveFlagDefs.copyObjects.Bind(flagSet, env)
+	migratePattern := archiveFlagDefs.migratePattern.Bind(flagSet, env)
+	migrateMove := archiveFlagDefs.migrateMove.Bind(flagSet, env)
+	dryRun := archiveFlagDefs.dryRun.Bind(flagSet, env)
+	auditChecksums := archiveFlagDefs.auditChecksums.Bind(flagSet, env)
+	repair := archiveFlagDefs.repair.Bind(flagSet, env)
+	pin := archiveFlagDefs.pin.Bind(flagSet, env)
+	pinReason := archiveFlagDefs.pinReason.Bind(flagSet, env)
+	pinObjects := archiveFlagDefs.pinObjects.Bind(flagSet, env)
+	backupLabel := archiveFlagDefs.backupLabel.Bind(flagSet, env)
+	backupTier := archiveFlagDefs.backupTier.Bind(flagSet, env)
 	keep := archiveFlagDefs.keep.Bind(flagSet, env)
 	showVersion := archiveFlagDefs.version.Bind(flagSet, env)
 
 	if err := flagSet.Parse(args); err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
 	mongoBindings.Apply(&cfg.MongoOptions)
@@ -204,15 +467,26 @@ func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string)
 		ForceTableScan: *forceTableScan,
 	}
 	storageBindings.Apply(&cfg.StorageOptions)
+	cfg.StorageURLs = *to
+	cfg.BackendExpiryDays = *backendExpiryDays
 	parsedExpiryDays, err := parseExpiryDays(*expiryDays)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 	parsedLocation, err := parseLocation(*tz)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 	cfg.RetentionOptions = RetentionOptions{ExpiryDays: parsedExpiryDays}
+	parsedTierAfterDays, err := parseTierAfterDays(*tierAfterDays)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cfg.TieringOptions = TieringOptions{
+		TierSource:    *tierSource,
+		TierTarget:    *tierTarget,
+		TierAfterDays: parsedTierAfterDays,
+	}
 	cfg.NotificationOptions = NotificationOptions{
 		RocketChatWebhookURL:                *rocketChatWebhookURL,
 		RocketChatWebhookPrefix:             *rocketChatWebhookPrefix,
@@ -239,22 +513,112 @@ func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string)
 		SESNotifyOnFailureOnly:              *sesNotifyOnFailureOnly,
 		NotificationAllowInsecureHTTPInDevelopment: *notificationAllowInsecureHTTPInDevelopment,
 	}
+	parsedMaxJobs, err := parseMaxConcurrentJobs(*maxJobs)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	parsedStartupRun, err := parseStartupRun(*startupRun)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	parsedShutdownGrace, err := parseShutdownGracePeriod(*shutdownGrace)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	parsedSchedules, err := parseSchedules(*schedules, *scheduleExpiryDays, parsedExpiryDays)
+	if err != nil {
+		return nil, nil, false, err
+	}
 	cfg.ScheduleOptions = ScheduleOptions{
-		Cron:           *cron,
-		CronExpression: parseCronExpression(*cronExpression),
-		Location:       parsedLocation,
+		Cron:                *cron,
+		CronExpression:      parseCronExpression(*cronExpression),
+		Location:            parsedLocation,
+		Schedules:           parsedSchedules,
+		JobsFile:            *jobsFile,
+		MaxConcurrentJobs:   parsedMaxJobs,
+		StartupRun:          parsedStartupRun,
+		ShutdownGracePeriod: parsedShutdownGrace,
 	}
-	cfg.Keep = *keep
-
-	if showVersion != nil && *showVersion {
-		return cfg, true, nil
+	// Rate limit windows follow the job's time zone, as its schedule does.
+	cfg.RateLimitLocation = parsedLocation
+	parsedStaleBackup, err := parseStaleBackupThreshold(*staleBackup)
+	if err != nil {
+		return nil, nil, false, err
 	}
-
-	if err := cfg.Validate(); err != nil {
-		return nil, false, err
+	parsedHTTPToken, err := parseHTTPToken(*httpToken, *httpTokenFile)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cfg.ControlOptions = ControlOptions{
+		HTTPListen:           strings.TrimSpace(*httpListen),
+		HTTPToken:            parsedHTTPToken,
+		StaleBackupThreshold: parsedStaleBackup,
 	}
+	cfg.PushgatewayURL = strings.TrimSpace(*pushgatewayURL)
+	parsedMaxRunDuration, err := parseMaxRunDuration(*maxRunDuration)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	parsedRunWindow, err := parseRunWindow(*runWindow)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cfg.RunLimitOptions = RunLimitOptions{
+		MaxRunDuration: parsedMaxRunDuration,
+		RunWindow:      parsedRunWindow,
+	}
+	parsedRetryMax, err := parseRetryMaxAttempts(*retryMax)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	parsedRetryBackoff, err := parseRetryDuration("retry-backoff", *retryBackoff, defaultRetryBackoff)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	parsedRetryDeadline, err := parseRetryDuration("retry-deadline", *retryDeadline, defaultRetryDeadline)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cfg.RetryOptions = RetryOptions{
+		RetryMaxAttempts: parsedRetryMax,
+		RetryBackoff:     parsedRetryBackoff,
+		RetryDeadline:    parsedRetryDeadline,
+	}
+	parsedLockTTL, err := parseLockTTL(*lockTTL)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cfg.LockOptions = LockOptions{
+		Lock:        *lock,
+		LockBackend: *lockBackend,
+		LockTTL:     parsedLockTTL,
+	}
+	cfg.CopyOptions = CopyOptions{
+		CopySource:  *copySource,
+		CopyTargets: *copyTargets,
+		CopyObjects: *copyObjects,
+	}
+	cfg.MigrateOptions = MigrateOptions{
+		MigratePattern: *migratePattern,
+		MigrateMove:    *migrateMove,
+		DryRun:         *dryRun,
+	}
+	cfg.AuditOptions = AuditOptions{
+		AuditChecksums: *auditChecksums,
+		Repair:         *repair,
+	}
+	cfg.PinOptions = PinOptions{
+		Pin:        *pin,
+		PinReason:  *pinReason,
+		PinObjects: *pinObjects,
+	}
+	cfg.NamingOptions = NamingOptions{
+		BackupLabel: *backupLabel,
+	}
+	cfg.BackupTier = *backupTier
+	cfg.Keep = *keep
 
-	return cfg, false, nil
+	return cfg, args, showVersion != nil && *showVersion, nil
 }
 
 func parseLocation(tz string) (*time.Location, error) {
@@ -287,6 +651,18 @@ func parseExpiryDays(raw string) (int, error) {
 	return expiryDays, nil
 }
 
+func parseTierAfterDays(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	afterDays, err := strconv.Atoi(raw)
+	if err != nil || afterDays <= 0 {
+		return 0, errors.New("tier-after-days must be a positive integer")
+	}
+	return afterDays, nil
+}
+
 func parseCronExpression(raw string) string {
 	if raw != "" {
 		return raw
@@ -322,10 +698,216 @@ func (c *Config) GetStorages(ctx context.Context) ([]storage.Storage, error) {
 }
 
 func (c *Config) Validate() error {
+	if _, err := c.Instances(); err != nil {
+		return err
+	}
+	if c.Command == CommandCopy && c.CopySource == "" {
+		return errors.New("copy requires --copy-source")
+	}
+	if (c.Command == CommandPin || c.Command == CommandUnpin) && c.PinObjects == "" {
+		return fmt.Errorf("%s requires --pin-objects", c.Command)
+	}
+	if err := storage.ValidatePinReason(c.PinReason); err != nil {
+		return err
+	}
+	if _, err := c.GetMigratePattern(); err != nil {
+		return err
+	}
+	if err := c.ValidateBandwidth(); err != nil {
+		return err
+	}
+	if err := c.ValidateBackendPolicies(); err != nil {
+		return err
+	}
+	if err := c.validateSchedules(); err != nil {
+		return err
+	}
+	for _, run := range c.GetSchedules() {
+		if err := run.validateNaming(); err != nil {
+			return err
+		}
+	}
+	if err := c.validateTiering(); err != nil {
+		return err
+	}
+	if err := c.validateLock(); err != nil {
+		return err
+	}
+	if err := c.validateControl(); err != nil {
+		return err
+	}
+	if err := c.validateMetrics(); err != nil {
+		return err
+	}
 	_, err := c.GetNotifications()
 	return err
 }
 
+// validateControl checks that the HTTP endpoints serve a --cron process.
+func (c *Config) validateControl() error {
+	if c.HTTPListen != "" && !c.Cron {
+		return errors.New("--http-listen requires --cron")
+	}
+	return nil
+}
+
+// validateMetrics checks the Pushgateway URL. A --cron process serves its
+// metrics on --http-listen instead.
+func (c *Config) validateMetrics() error {
+	if c.PushgatewayURL == "" {
+		return nil
+	}
+	if c.Cron {
+		return errors.New("--pushgateway-url does not apply to --cron; scrape /metrics on --http-listen instead")
+	}
+	parsed, err := url.Parse(c.PushgatewayURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("pushgateway-url must be an http or https URL")
+	}
+	return nil
+}
+
+// parseHTTPToken reads the control API token from --http-token or, so that it
+// need not appear in the process's arguments or environment, from the file
+// named by --http-token-file.
+func parseHTTPToken(raw string, path string) (string, error) {
+	token, path := strings.TrimSpace(raw), strings.TrimSpace(path)
+	if path == "" {
+		return token, nil
+	}
+	if token != "" {
+		return "", errors.New("--http-token and --http-token-file cannot be combined")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read http-token-file: %w", err)
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("http-token-file %s is empty", path)
+	}
+	return token, nil
+}
+
+func parseStaleBackupThreshold(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	threshold, err := time.ParseDuration(raw)
+	if err != nil || threshold < 0 {
+		return 0, errors.New("stale-backup-threshold must be a non-negative duration")
+	}
+	return threshold, nil
+}
+
+// validateNaming checks that the backup name template parses and that every
+// placeholder it uses has a value.
+func (c *Config) validateNaming() error {
+	template, err := c.NameTemplate()
+	if err != nil {
+		return err
+	}
+	if template.Uses("label") && strings.TrimSpace(c.BackupLabel) == "" {
+		return errors.New("backup-name-template uses {label}, which requires --backup-label")
+	}
+	if template.Uses("tier") && c.BackupTier == "" {
+		return errors.New("backup-name-template uses {tier}, which requires --schedules or --backup-tier")
+	}
+	_, err = template.Name(c.BackupNameValues(time.Now(), 1))
+	return err
+}
+
+// BackupNameValues returns the placeholder values for a backup taken at now
+// with sequence number seq. {db} is the dumped database, or "all" when every
+// database is dumped, and {cluster} is the replica set name, or else the first
+// host of the connection.
+func (c *Config) BackupNameValues(now time.Time, seq int) storage.NameValues {
+	hosts, database, replicaSet := c.Host, "", ""
+	if c.URI != "" {
+		hosts, database, replicaSet = splitMongoURI(c.URI)
+	}
+	if c.DB != "" {
+		database = c.DB
+	}
+	if database == "" {
+		database = "all"
+	}
+	return storage.NameValues{DB: database, Cluster: clusterName(hosts, replicaSet), Label: c.BackupLabel, Tier: c.BackupTier, Time: now, Seq: seq}
+}
+
+// splitMongoURI returns the hosts, database and replica set named by a
+// mongodb:// or mongodb+srv:// connection string.
+func splitMongoURI(uri string) (string, string, string) {
+	rest, query, _ := strings.Cut(uri, "?")
+	replicaSet := ""
+	if values, err := url.ParseQuery(query); err == nil {
+		replicaSet = values.Get("replicaSet")
+	}
+	_, rest, _ = strings.Cut(rest, "://")
+	hosts, database, _ := strings.Cut(rest, "/")
+	if at := strings.LastIndex(hosts, "@"); at >= 0 {
+		hosts = hosts[at+1:]
+	}
+	return hosts, database, replicaSet
+}
+
+// clusterName returns replicaSet, the set name of a --host value of the form
+// <replica set>/<host1>,<host2>, or else the first host without its port.
+func clusterName(hosts string, replicaSet string) string {
+	if replicaSet != "" {
+		return replicaSet
+	}
+	if set, _, ok := strings.Cut(hosts, "/"); ok && set != "" {
+		return set
+	}
+	host, _, _ := strings.Cut(hosts, ",")
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	if host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+// HasTiering reports whether backups move between a hot and a cold backend.
+func (c *Config) HasTiering() bool {
+	return c.TierTarget != ""
+}
+
+// validateTiering checks that tiering is fully configured and that the tier
+// source keeps backups long enough for them to be tiered.
+func (c *Config) validateTiering() error {
+	if c.TierSource == "" && c.TierTarget == "" && c.TierAfterDays == 0 {
+		return nil
+	}
+	if c.TierSource == "" || c.TierTarget == "" || c.TierAfterDays == 0 {
+		return errors.New("tiering requires --tier-source, --tier-target, and --tier-after-days")
+	}
+	if c.TierSource == c.TierTarget {
+		return errors.New("--tier-target must differ from --tier-source")
+	}
+
+	instances, err := c.Instances()
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if instance.Name != c.TierSource && instance.Backend != c.TierSource {
+			continue
+		}
+		expiryDays, err := c.InstanceExpiryDays(instance, c.ExpiryDays)
+		if err != nil {
+			return err
+		}
+		if expiryDays > 0 && expiryDays <= c.TierAfterDays {
+			return fmt.Errorf("tier source %s expires backups after %d days, before they are tiered after %d days", instance.Name, expiryDays, c.TierAfterDays)
+		}
+	}
+	return nil
+}
+
 func (c *Config) getRocketChat() (*notification.RocketChat, error) {
 	rc := new(notification.RocketChat)
 	err := rc.Init(c.RocketChatWebhookURL, c.RocketChatWebhookPrefix, c.RocketChatNotifyOnFailureOnly, c.NotificationAllowInsecureHTTPInDevelopment)
@@ -412,6 +994,43 @@ func (c *Config) HasCron() bool {
 	return c.Cron
 }
 
+// GetCopyTargets returns the requested copy targets, or nil to copy to every
+// backend other than the source.
+func (c *Config) GetCopyTargets() []string {
+	return splitList(c.CopyTargets)
+}
+
+func (c *Config) GetCopyObjects() []string {
+	return splitList(c.CopyObjects)
+}
+
+func (c *Config) GetPinObjects() []string {
+	return splitList(c.PinObjects)
+}
+
+// GetMigratePattern returns the compiled --migrate-pattern, or nil for the
+// default legacy naming.
+func (c *Config) GetMigratePattern() (*regexp.Regexp, error) {
+	if c.MigratePattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(c.MigratePattern)
+	if err != nil {
+		return nil, fmt.Errorf("migrate-pattern must be a valid regular expression: %w", err)
+	}
+	return pattern, nil
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func (c *Config) HasKeep() bool {
 	return c.Keep
 }
@@ -426,7 +1045,12 @@ func FlagDocumentation() toolconfig.CommandDoc {
 	)
 	flags = append(flags, toolconfig.StorageFlagDocs(envPrefix)...)
 	flags = append(flags,
+		archiveFlagDefs.to.Doc(envPrefix),
 		archiveFlagDefs.expiryDays.Doc(envPrefix),
+		archiveFlagDefs.backendExpiryDays.Doc(envPrefix),
+		archiveFlagDefs.tierSource.Doc(envPrefix),
+		archiveFlagDefs.tierTarget.Doc(envPrefix),
+		archiveFlagDefs.tierAfterDays.Doc(envPrefix),
 		archiveFlagDefs.rocketChatWebhookURL.Doc(envPrefix),
 		archiveFlagDefs.rocketChatWebhookPrefix.Doc(envPrefix),
 		archiveFlagDefs.rocketChatNotifyOnFailureOnly.Doc(envPrefix),
@@ -454,6 +1078,38 @@ func FlagDocumentation() toolconfig.CommandDoc {
 		archiveFlagDefs.cron.Doc(envPrefix),
 		archiveFlagDefs.cronExpression.Doc(envPrefix),
 		archiveFlagDefs.tz.Doc(envPrefix),
+		archiveFlagDefs.schedules.Doc(envPrefix),
+		archiveFlagDefs.scheduleExp.Doc(envPrefix),
+		archiveFlagDefs.jobsFile.Doc(envPrefix),
+		archiveFlagDefs.maxJobs.Doc(envPrefix),
+		archiveFlagDefs.startupRun.Doc(envPrefix),
+		archiveFlagDefs.shutdownGrace.Doc(envPrefix),
+		archiveFlagDefs.httpListen.Doc(envPrefix),
+		archiveFlagDefs.httpToken.Doc(envPrefix),
+		archiveFlagDefs.httpTokenFile.Doc(envPrefix),
+		archiveFlagDefs.staleBackup.Doc(envPrefix),
+		archiveFlagDefs.pushgatewayURL.Doc(envPrefix),
+		archiveFlagDefs.maxRunDuration.Doc(envPrefix),
+		archiveFlagDefs.runWindow.Doc(envPrefix),
+		archiveFlagDefs.retryMax.Doc(envPrefix),
+		archiveFlagDefs.retryBackoff.Doc(envPrefix),
+		archiveFlagDefs.retryDeadline.Doc(envPrefix),
+		archiveFlagDefs.lock.Doc(envPrefix),
+		archiveFlagDefs.lockBackend.Doc(envPrefix),
+		archiveFlagDefs.lockTTL.Doc(envPrefix),
+		archiveFlagDefs.copySource.Doc(envPrefix),
+		archiveFlagDefs.copyTargets.Doc(envPrefix),
+		archiveFlagDefs.copyObjects.Doc(envPrefix),
+		archiveFlagDefs.migratePattern.Doc(envPrefix),
+		archiveFlagDefs.migrateMove.Doc(envPrefix),
+		archiveFlagDefs.dryRun.Doc(envPrefix),
+		archiveFlagDefs.auditChecksums.Doc(envPrefix),
+		archiveFlagDefs.repair.Doc(envPrefix),
+		archiveFlagDefs.pin.Doc(envPrefix),
+		archiveFlagDefs.pinReason.Doc(envPrefix),
+		archiveFlagDefs.pinObjects.Doc(envPrefix),
+		archiveFlagDefs.backupLabel.Doc(envPrefix),
+		archiveFlagDefs.backupTier.Doc(envPrefix),
 		archiveFlagDefs.keep.Doc(envPrefix),
 		archiveFlagDefs.version.Doc(envPrefix),
 	)
@@ -464,6 +1120,9 @@ func FlagDocumentation() toolconfig.CommandDoc {
 		EnvVars: []toolconfig.EnvDoc{
 			{EnvVar: envPrefix + "DUMP_PATH", Description: "Base directory for per-run dump workspaces before uploads"},
 			{EnvVar: envPrefix + "STORAGE_OPERATION_TIMEOUT", Description: "Optional timeout applied to storage lookup, upload, and retention operations"},
+			{EnvVar: envPrefix + "TRANSFER_RESUME_WINDOW", DefaultValue: storage.DefaultTransferResumeWindow.String(), Description: "How long an interrupted upload and its kept archive stay resumable before they are discarded"},
+			{EnvVar: envPrefix + "JANITOR_MIN_AGE", DefaultValue: utils.DefaultJanitorMinAge.String(), Description: "Minimum age before the janitor reclaims incomplete uploads and workspaces whose owner cannot be checked"},
+			{EnvVar: envPrefix + "STORAGE__<NAME>__<KEY>", Description: "Setting KEY for the named storage instance NAME; KEY is a storage flag's environment key such as AWS_BUCKET or BACKUP_PREFIX, or EXPIRY_DAYS to override retention"},
 			{EnvVar: envPrefix + "NOTIFICATION_TIMEOUT", Description: "Optional timeout applied to outbound notification sends"},
 		},
 	}
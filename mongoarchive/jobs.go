@@ -0,0 +1,212 @@
+package mongoarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egose/database-tools/internal/toolconfig"
+	"github.com/egose/database-tools/storage"
+)
+
+// defaultJobName names the job of the command line outside --jobs-file.
+const defaultJobName = "mongo-archive"
+
+// jobNamePattern keeps job names usable in log lines and directory names. A
+// name starts with a letter or digit, so it is never . or ..
+var jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// processFlags configure the process rather than a backup, so a job cannot set
+// them.
+var processFlags = []string{"jobs-file", "max-concurrent-jobs", "shutdown-grace-period", "http-listen", "http-token", "http-token-file", "cron", "version"}
+
+// jobsFile is the format of --jobs-file.
+type jobsFile struct {
+	Jobs []jobEntry `json:"jobs"`
+}
+
+// jobEntry names a job and the flags that set it apart from the command line.
+// Flag values may be JSON strings, numbers or booleans.
+type jobEntry struct {
+	Name  string                     `json:"name"`
+	Flags map[string]json.RawMessage `json:"flags"`
+}
+
+// Name returns the name of the job: its name in --jobs-file, or mongo-archive
+// for the job of the command line.
+func (c *Config) Name() string {
+	if c.JobName != "" {
+		return c.JobName
+	}
+	return defaultJobName
+}
+
+// GetJobs returns the jobs the process runs: the jobs of --jobs-file, or the
+// configuration itself when no jobs file is set.
+func (c *Config) GetJobs() []*Config {
+	if len(c.Jobs) == 0 {
+		return []*Config{c}
+	}
+	return c.Jobs
+}
+
+// loadJobs reads the jobs file and parses each job as the command line args,
+// with env, followed by the job's flags. Every job starts from the command
+// line and environment, so shared settings need to be given only once.
+func loadJobs(path string, env toolconfig.EnvReader, args []string) ([]*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var file jobsFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse jobs file %s: %w", path, err)
+	}
+	if len(file.Jobs) == 0 {
+		return nil, fmt.Errorf("jobs file %s defines no jobs", path)
+	}
+
+	jobs := make([]*Config, 0, len(file.Jobs))
+	seen := map[string]struct{}{}
+	for i, entry := range file.Jobs {
+		if !jobNamePattern.MatchString(entry.Name) {
+			return nil, fmt.Errorf("jobs file %s: job %d: invalid name %q: use 1 to 64 letters, digits, and . _ -, starting with a letter or digit", path, i+1, entry.Name)
+		}
+		if _, ok := seen[entry.Name]; ok {
+			return nil, fmt.Errorf("jobs file %s: job %q is defined twice", path, entry.Name)
+		}
+		seen[entry.Name] = struct{}{}
+
+		job, err := parseJob(entry, env, args)
+		if err != nil {
+			return nil, fmt.Errorf("jobs file %s: job %q: %w", path, entry.Name, err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := checkSharedStorage(jobs); err != nil {
+		return nil, fmt.Errorf("jobs file %s: %w", path, err)
+	}
+	return jobs, nil
+}
+
+// checkSharedStorage rejects jobs that keep their backups in the same place.
+// Retention and selection act on every managed backup under an instance's
+// prefix, whichever job uploaded it, so such jobs would expire each other's
+// backups.
+func checkSharedStorage(jobs []*Config) error {
+	type owner struct {
+		job      string
+		instance string
+	}
+	owners := map[string]owner{}
+	for _, job := range jobs {
+		instances, err := job.Instances()
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.JobName, err)
+		}
+		for _, instance := range instances {
+			backendType, ok := storage.LookupBackend(instance.Backend)
+			if !ok {
+				continue
+			}
+			prefix := storage.NormalizeBackupPrefix(instance.BackupPrefix)
+			key := instance.Backend + "\x00" + backendType.StorageLocation(instance.Settings) + "\x00" + prefix
+			if other, ok := owners[key]; ok && other.job != job.JobName {
+				return fmt.Errorf("jobs %q and %q keep backups in the same place (storage %q and %q, prefix %q); give them different --backup-prefix values", other.job, job.JobName, other.instance, instance.Name, prefix)
+			}
+			owners[key] = owner{job: job.JobName, instance: instance.Name}
+		}
+	}
+	return nil
+}
+
+func parseJob(entry jobEntry, env toolconfig.EnvReader, args []string) (*Config, error) {
+	names := make([]string, 0, len(entry.Flags))
+	for name := range entry.Flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	jobArgs := slices.Clone(args)
+	for _, name := range names {
+		if slices.Contains(processFlags, name) {
+			return nil, fmt.Errorf("--%s applies to the whole process and cannot be set per job", name)
+		}
+		value, err := jobFlagValue(entry.Flags[name])
+		if err != nil {
+			return nil, fmt.Errorf("flag %q: %w", name, err)
+		}
+		jobArgs = append(jobArgs, "--"+name+"="+value)
+	}
+
+	flagSet := flag.NewFlagSet("mongo-archive job "+entry.Name, flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	job, _, _, err := parseConfig(flagSet, env, jobArgs)
+	if err != nil {
+		return nil, err
+	}
+	job.JobName = entry.Name
+	job.JobsFile = ""
+	if err := job.Validate(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func jobFlagValue(raw json.RawMessage) (string, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	default:
+		return "", errors.New("value must be a string, number, or boolean")
+	}
+}
+
+// parseMaxConcurrentJobs reads --max-concurrent-jobs, which defaults to one
+// job at a time.
+func parseMaxConcurrentJobs(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 1, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("max-concurrent-jobs must be a positive integer")
+	}
+	return limit, nil
+}
+
+// parseShutdownGracePeriod reads --shutdown-grace-period, which defaults to
+// aborting runs in flight at once.
+func parseShutdownGracePeriod(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	grace, err := time.ParseDuration(raw)
+	if err != nil || grace < 0 {
+		return 0, errors.New("shutdown-grace-period must be a non-negative duration")
+	}
+	return grace, nil
+}
@@ -0,0 +1,54 @@
+package mongoarchive
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+)
+
+// minLockTTL leaves room for the renewals, which run every third of the TTL,
+// to reach the backend before the lease expires.
+const minLockTTL = 30 * time.Second
+
+// parseLockTTL reads --lock-ttl, which defaults to storage.DefaultLockTTL.
+func parseLockTTL(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return storage.DefaultLockTTL, nil
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl < minLockTTL {
+		return 0, fmt.Errorf("lock-ttl must be a duration of at least %s", minLockTTL)
+	}
+	return ttl, nil
+}
+
+// LockName returns the name of the lease a run of the job holds: the job name
+// under --jobs-file, so that different jobs run side by side, or a fixed name
+// otherwise. Schedules of a job share its lock.
+func (c *Config) LockName() string {
+	return c.Name()
+}
+
+// validateLock checks that the lock backend is one of the configured backends.
+func (c *Config) validateLock() error {
+	if c.LockBackend == "" {
+		return nil
+	}
+	if !c.Lock {
+		return errors.New("--lock-backend requires --lock")
+	}
+	instances, err := c.Instances()
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if instance.Name == c.LockBackend || instance.Backend == c.LockBackend {
+			return nil
+		}
+	}
+	return fmt.Errorf("lock backend %q is not a configured storage instance or backend type", c.LockBackend)
+}
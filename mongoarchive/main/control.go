@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/egose/database-tools/mongoarchive"
+	"github.com/egose/database-tools/notification"
+	mlog "github.com/mongodb/mongo-tools/common/log"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	cronTriggerSchedule = "schedule"
+	cronTriggerManual   = "manual"
+
+	controlShutdownTimeout = 5 * time.Second
+)
+
+var (
+	errCronRunInProgress = errors.New("a run of this schedule is already in progress")
+	errCronShuttingDown  = errors.New("the scheduler is shutting down")
+)
+
+// cronController runs the jobs of a cron runtime, on their schedule or on
+// demand through the HTTP control API.
+type cronController struct {
+	runtime   cronRuntime
+	runCtx    context.Context
+	notifyCtx context.Context
+	inFlight  *cronDrain
+	slots     chan struct{}
+	loc       *time.Location
+	jobs      []*cronJob
+	health    cronHealth
+}
+
+// cronJob is a job with its schedules. A paused job skips its scheduled runs
+// until it is resumed; it can still be run on demand.
+type cronJob struct {
+	name       string
+	tiers      *tierSchedules
+	schedules  []*cronSchedule
+	staleAfter time.Duration
+
+	mu     sync.Mutex
+	paused bool
+}
+
+// cronSchedule is one schedule of a job, with its run in progress and its
+// last finished run. A schedule runs once at a time, whatever triggered it.
+type cronSchedule struct {
+	run        *mongoarchive.Config
+	expression string
+	schedule   cron.Schedule
+
+	mu      sync.Mutex
+	running *cronRunStatus
+	last    *cronRunStatus
+}
+
+type cronRunStatus struct {
+	Trigger    string     `json:"trigger"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Attempts   int        `json:"attempts"`
+	Success    bool       `json:"success"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type cronJobStatus struct {
+	Name      string               `json:"name"`
+	Paused    bool                 `json:"paused"`
+	Schedules []cronScheduleStatus `json:"schedules"`
+}
+
+type cronScheduleStatus struct {
+	Name       string         `json:"name,omitempty"`
+	Cron       string         `json:"cron"`
+	ExpiryDays int            `json:"expiryDays"`
+	NextRun    time.Time      `json:"nextRun"`
+	Running    *cronRunStatus `json:"running,omitempty"`
+	LastRun    *cronRunStatus `json:"lastRun,omitempty"`
+}
+
+// addJob registers job with the runs of its schedules.
+func (c *cronController) addJob(job *mongoarchive.Config, runs []*mongoarchive.Config) (*cronJob, error) {
+	tiers, err := newTierSchedules(runs)
+	if err != nil {
+		return nil, err
+	}
+	j := &cronJob{name: job.Name(), tiers: tiers, staleAfter: job.StaleBackupThreshold}
+	for _, run := range runs {
+		exp, err := jobCronExpression(run, c.loc)
+		if err != nil {
+			return nil, err
+		}
+		j.schedules = append(j.schedules, &cronSchedule{run: run, expression: exp})
+	}
+	c.jobs = append(c.jobs, j)
+	return j, nil
+}
+
+// runScheduled runs schedule i of job when the scheduler fires it.
+func (c *cronController) runScheduled(job *cronJob, i int) {
+	if !c.inFlight.enter() {
+		return
+	}
+	defer c.inFlight.leave()
+	sched := job.schedules[i]
+	if job.isPaused() {
+		mlog.Logvf(mlog.Always, "%s skipped: the job is paused", taskName(sched.run))
+		return
+	}
+	if other := job.tiers.supersededBy(i, c.runtime.now()); other != nil {
+		mlog.Logvf(mlog.Always, "%s skipped: %s runs at the same time and keeps its backups longer", taskName(sched.run), taskName(other))
+		return
+	}
+	if !sched.begin(cronTriggerSchedule, c.runtime.now()) {
+		mlog.Logvf(mlog.Always, "%s skipped: %v", taskName(sched.run), errCronRunInProgress)
+		return
+	}
+	c.execute(sched)
+}
+
+// trigger starts a run of sched at once, in the background.
+func (c *cronController) trigger(sched *cronSchedule) error {
+	if !c.inFlight.enter() {
+		return errCronShuttingDown
+	}
+	if !sched.begin(cronTriggerManual, c.runtime.now()) {
+		c.inFlight.leave()
+		return errCronRunInProgress
+	}
+	mlog.Logvf(mlog.Always, "%s: run requested through the control API", taskName(sched.run))
+	go func() {
+		defer c.inFlight.leave()
+		c.execute(sched)
+	}()
+	return nil
+}
+
+// execute runs sched, with its retries, and records the outcome.
+func (c *cronController) execute(sched *cronSchedule) {
+	attempts, err := c.attempts(sched)
+	sched.finish(c.runtime.now(), attempts, err)
+}
+
+func (c *cronController) attempts(sched *cronSchedule) (int, error) {
+	r, run := c.runtime, sched.run
+	var deadline time.Time
+	if run.Retries() {
+		// Retries stop in time for the next scheduled run.
+		deadline = sched.schedule.Next(r.now().In(c.loc)).Add(-run.RetryDeadline)
+	}
+	for attempt := 1; ; attempt++ {
+		sched.setAttempts(attempt)
+		err := r.attempt(c.runCtx, run, c.slots, c.inFlight.stopping)
+		if err == nil {
+			return attempt, nil
+		}
+		if !run.Retries() || c.runCtx.Err() != nil || c.inFlight.draining() {
+			r.notify(c.notifyCtx, run, false, err.Error())
+			return attempt, err
+		}
+		retryAt := r.now().Add(run.RetryDelay(attempt))
+		if attempt >= run.RetryMaxAttempts || retryAt.After(deadline) {
+			mlog.Logvf(mlog.Always, "%s failed permanently after %d attempt(s)", taskName(run), attempt)
+			r.notify(c.notifyCtx, run, false, fmt.Sprintf("failed permanently after %d attempt(s): %v", attempt, err))
+			return attempt, err
+		}
+		mlog.Logvf(mlog.Always, "%s will retry at %v (attempt %d of %d)", taskName(run), retryAt, attempt+1, run.RetryMaxAttempts)
+		r.notify(c.notifyCtx, run, false, fmt.Sprintf("failed, will retry (attempt %d of %d, next attempt at %s): %v", attempt, run.RetryMaxAttempts, retryAt.In(c.loc).Format(time.RFC3339), err))
+		select {
+		case <-r.after(retryAt.Sub(r.now())):
+		case <-c.inFlight.stopping:
+			mlog.Logvf(mlog.Always, "%s: retry cancelled by shutdown", taskName(run))
+			return attempt, err
+		}
+	}
+}
+
+func (c *cronController) job(name string) *cronJob {
+	for _, job := range c.jobs {
+		if job.name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+func (c *cronController) status(job *cronJob) cronJobStatus {
+	status := cronJobStatus{Name: job.name, Paused: job.isPaused(), Schedules: []cronScheduleStatus{}}
+	now := c.runtime.now().In(c.loc)
+	for _, sched := range job.schedules {
+		running, last := sched.status()
+		status.Schedules = append(status.Schedules, cronScheduleStatus{
+			Name:       sched.run.BackupTier,
+			Cron:       sched.expression,
+			ExpiryDays: sched.run.ExpiryDays,
+			NextRun:    sched.schedule.Next(now),
+			Running:    running,
+			LastRun:    last,
+		})
+	}
+	return status
+}
+
+// schedule returns the schedule of job named name. An empty name picks the
+// schedule that keeps its backups longest, or the first listed among equals.
+func (j *cronJob) schedule(name string) *cronSchedule {
+	var found *cronSchedule
+	for _, sched := range j.schedules {
+		if name != "" {
+			if sched.run.BackupTier == name {
+				return sched
+			}
+			continue
+		}
+		if found == nil || mongoarchive.KeepsLonger(sched.run.ExpiryDays, found.run.ExpiryDays) {
+			found = sched
+		}
+	}
+	return found
+}
+
+func (j *cronJob) isPaused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.paused
+}
+
+func (j *cronJob) setPaused(paused bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = paused
+}
+
+// begin marks a run of s as started, unless one is in progress.
+func (s *cronSchedule) begin(trigger string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		return false
+	}
+	s.running = &cronRunStatus{Trigger: trigger, StartedAt: now}
+	return true
+}
+
+func (s *cronSchedule) setAttempts(attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running.Attempts = attempts
+}
+
+func (s *cronSchedule) finish(now time.Time, attempts int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := *s.running
+	last.FinishedAt = &now
+	last.Attempts = attempts
+	last.Success = err == nil
+	if err != nil {
+		last.Error = notification.RedactSensitiveText(err.Error())
+	}
+	s.running = nil
+	s.last = &last
+}
+
+// status returns copies of the run in progress and the last finished run.
+func (s *cronSchedule) status() (*cronRunStatus, *cronRunStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var running, last *cronRunStatus
+	if s.running != nil {
+		copied := *s.running
+		running = &copied
+	}
+	if s.last != nil {
+		copied := *s.last
+		last = &copied
+	}
+	return running, last
+}
+
+// handler serves the health endpoints, the metrics, and the control API
+// under /v1/ when token is set.
+func (c *cronController) handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", c.serveHealthz)
+	mux.HandleFunc("GET /readyz", c.serveReadyz)
+	mux.HandleFunc("GET /status", c.serveStatus)
+	if c.runtime.metrics != nil {
+		mux.Handle("GET /metrics", c.runtime.metrics.handler())
+	}
+	if token != "" {
+		mux.Handle("/v1/", c.controlHandler(token))
+	}
+	return mux
+}
+
+// controlHandler serves the control API. Every request must carry token as a
+// bearer token.
+func (c *cronController) controlHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		jobs := []cronJobStatus{}
+		for _, job := range c.jobs {
+			jobs = append(jobs, c.status(job))
+		}
+		writeControlJSON(w, http.StatusOK, map[string]any{"jobs": jobs})
+	})
+	mux.HandleFunc("GET /v1/jobs/{job}", c.withJob(func(w http.ResponseWriter, r *http.Request, job *cronJob) {
+		writeControlJSON(w, http.StatusOK, c.status(job))
+	}))
+	mux.HandleFunc("POST /v1/jobs/{job}/run", c.withJob(func(w http.ResponseWriter, r *http.Request, job *cronJob) {
+		name := r.URL.Query().Get("schedule")
+		sched := job.schedule(name)
+		if sched == nil {
+			writeControlError(w, http.StatusNotFound, fmt.Sprintf("job %s has no schedule %q", job.name, name))
+			return
+		}
+		switch err := c.trigger(sched); {
+		case errors.Is(err, errCronRunInProgress):
+			writeControlError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, errCronShuttingDown):
+			writeControlError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			writeControlJSON(w, http.StatusAccepted, c.status(job))
+		}
+	}))
+	mux.HandleFunc("POST /v1/jobs/{job}/pause", c.withJob(func(w http.ResponseWriter, r *http.Request, job *cronJob) {
+		job.setPaused(true)
+		mlog.Logvf(mlog.Always, "Job %s paused through the control API", job.name)
+		writeControlJSON(w, http.StatusOK, c.status(job))
+	}))
+	mux.HandleFunc("POST /v1/jobs/{job}/resume", c.withJob(func(w http.ResponseWriter, r *http.Request, job *cronJob) {
+		job.setPaused(false)
+		mlog.Logvf(mlog.Always, "Job %s resumed through the control API", job.name)
+		writeControlJSON(w, http.StatusOK, c.status(job))
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeControlError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (c *cronController) withJob(handle func(http.ResponseWriter, *http.Request, *cronJob)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job := c.job(r.PathValue("job"))
+		if job == nil {
+			writeControlError(w, http.StatusNotFound, fmt.Sprintf("no job named %q", r.PathValue("job")))
+			return
+		}
+		handle(w, r, job)
+	}
+}
+
+// serveControl serves the health endpoints and the control API on addr
+// until the returned function shuts them down.
+func (c *cronController) serveControl(addr string, token string) (func(), error) {
+	listener, err := c.runtime.listen(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: c.handler(token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			mlog.Logvf(mlog.Always, "HTTP server stopped: %v", err)
+		}
+	}()
+	mlog.Logvf(mlog.Always, "HTTP endpoints listening on %s", listener.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			mlog.Logvf(mlog.Always, "Failed to shut down HTTP server: %v", err)
+		}
+	}, nil
+}
+
+func writeControlJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		mlog.Logvf(mlog.Always, "Failed to write control API response: %v", err)
+	}
+}
+
+func writeControlError(w http.ResponseWriter, status int, message string) {
+	writeControlJSON(w, status, map[string]string{"error": message})
+}
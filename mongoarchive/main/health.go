@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/egose/database-tools/mongoarchive"
+	"github.com/egose/database-tools/notification"
+	"github.com/egose/database-tools/storage"
+	mlog "github.com/mongodb/mongo-tools/common/log"
+)
+
+const (
+	// The scheduler beats every minute; /healthz fails once it missed a few
+	// beats in a row.
+	heartbeatExpression = "* * * * *"
+	heartbeatTimeout    = 3 * time.Minute
+
+	readinessRetryInterval = time.Minute
+	readinessCheckTimeout  = 2 * time.Minute
+)
+
+// cronHealth is what the health endpoints report: whether the scheduler
+// still fires, and whether the storage backends were validated.
+type cronHealth struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	heartbeat time.Time
+	ready     bool
+	readyErr  error
+}
+
+type cronBackupStatus struct {
+	Name        string     `json:"name"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	StaleAfter  string     `json:"staleAfter,omitempty"`
+	Stale       bool       `json:"stale"`
+}
+
+func (h *cronHealth) start(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startedAt = now
+	h.heartbeat = now
+}
+
+func (h *cronHealth) beat(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeat = now
+}
+
+func (h *cronHealth) lastBeat() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.heartbeat
+}
+
+func (h *cronHealth) setReady(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = err == nil
+	h.readyErr = err
+}
+
+func (h *cronHealth) readiness() (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready, h.readyErr
+}
+
+// checkReadiness validates the storage backends of every job, and tries again
+// every readinessRetryInterval until they pass or the shutdown starts.
+func (c *cronController) checkReadiness(cfg *mongoarchive.Config) {
+	for {
+		err := c.checkStorages(cfg)
+		c.health.setReady(err)
+		if err == nil {
+			mlog.Logvf(mlog.Always, "Storage backends validated.")
+			return
+		}
+		mlog.Logvf(mlog.Always, "Storage backends not ready: %v", err)
+		select {
+		case <-c.runtime.after(readinessRetryInterval):
+		case <-c.inFlight.stopping:
+			return
+		}
+	}
+}
+
+func (c *cronController) checkStorages(cfg *mongoarchive.Config) error {
+	for _, job := range cfg.GetJobs() {
+		ctx, cancel := context.WithTimeout(c.runCtx, readinessCheckTimeout)
+		err := c.runtime.checkStorages(ctx, job)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("job %s: %w", job.Name(), err)
+		}
+	}
+	return nil
+}
+
+// checkCronStorages connects to the storage backends of job and lists its
+// backups, so that bad credentials or a missing bucket show before the first
+// run does.
+func checkCronStorages(ctx context.Context, job *mongoarchive.Config) (retErr error) {
+	storages, err := job.GetStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = joinPrimaryAndCleanupErrors(retErr, closeStorages(storages))
+	}()
+
+	for i, storageBackend := range storages {
+		lister, ok := storageBackend.(storage.BackupLister)
+		if !ok {
+			continue
+		}
+		if _, err := lister.ListBackups(ctx); err != nil {
+			return fmt.Errorf("failed to list backups on %s: %w", describeStorageBackend(i, storageBackend), err)
+		}
+	}
+	return nil
+}
+
+// serveHealthz reports whether the scheduler still fires.
+func (c *cronController) serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	heartbeat := c.health.lastBeat()
+	body := map[string]any{"status": "ok", "lastHeartbeat": heartbeat}
+	if c.runtime.now().Sub(heartbeat) > heartbeatTimeout {
+		body["status"] = "unhealthy"
+		body["error"] = fmt.Sprintf("the scheduler has not fired since %s", heartbeat.Format(time.RFC3339))
+		writeControlJSON(w, http.StatusServiceUnavailable, body)
+		return
+	}
+	writeControlJSON(w, http.StatusOK, body)
+}
+
+// serveReadyz reports whether the storage backends of every job were
+// validated. The configuration was validated before the process started.
+func (c *cronController) serveReadyz(w http.ResponseWriter, _ *http.Request) {
+	ready, err := c.health.readiness()
+	switch {
+	case ready:
+		writeControlJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	case err != nil:
+		writeControlJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "error": notification.RedactSensitiveText(err.Error())})
+	default:
+		writeControlJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "error": "storage backends not validated yet"})
+	}
+}
+
+// serveStatus reports when each job last backed up successfully, and fails
+// when a job's last success is older than its stale backup threshold. A job
+// that has not succeeded yet is judged from the time the process started.
+func (c *cronController) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	now := c.runtime.now()
+	c.health.mu.Lock()
+	startedAt := c.health.startedAt
+	c.health.mu.Unlock()
+
+	status, code := "ok", http.StatusOK
+	jobs := []cronBackupStatus{}
+	for _, job := range c.jobs {
+		backup := cronBackupStatus{Name: job.name}
+		since := startedAt
+		if lastSuccess := c.lastSuccess(job); !lastSuccess.IsZero() {
+			backup.LastSuccess = &lastSuccess
+			since = lastSuccess
+		}
+		if job.staleAfter > 0 {
+			backup.StaleAfter = job.staleAfter.String()
+			backup.Stale = now.Sub(since) > job.staleAfter
+		}
+		if backup.Stale {
+			status, code = "stale", http.StatusServiceUnavailable
+		}
+		jobs = append(jobs, backup)
+	}
+	writeControlJSON(w, code, map[string]any{"status": status, "jobs": jobs})
+}
+
+// lastSuccess returns the latest recorded success of any schedule of job.
+func (c *cronController) lastSuccess(job *cronJob) time.Time {
+	var latest time.Time
+	for _, sched := range job.schedules {
+		lastSuccess, err := c.runtime.state.LastSuccess(sched.run)
+		if err != nil {
+			mlog.Logvf(mlog.Always, "%s: %v", taskName(sched.run), err)
+			continue
+		}
+		if lastSuccess.After(latest) {
+			latest = lastSuccess
+		}
+	}
+	return latest
+}
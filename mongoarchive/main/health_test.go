@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/mongoarchive"
+)
+
+func TestCronRuntimeServesHealthEndpoints(t *testing.T) {
+	scheduler := &fakeCronScheduler{}
+	cfg := &mongoarchive.Config{
+		ScheduleOptions: mongoarchive.ScheduleOptions{Cron: true, Location: time.UTC, CronExpression: "0 1 * * *"},
+		ControlOptions:  mongoarchive.ControlOptions{HTTPListen: "127.0.0.1:0", StaleBackupThreshold: 26 * time.Hour},
+	}
+	start := time.Date(2026, 1, 2, 1, 30, 0, 0, time.UTC)
+	var clock atomic.Int64
+	clock.Store(start.UnixNano())
+	state := mongoarchive.NewRunStateStore(t.TempDir())
+	if err := state.RecordSuccess(cfg, start.Add(-time.Hour)); err != nil {
+		t.Fatalf("RecordSuccess() error = %v", err)
+	}
+
+	var checks atomic.Int32
+	retry := make(chan time.Time)
+	var baseURL string
+	get := func(path string) (int, map[string]any) {
+		t.Helper()
+		resp, err := http.Get(baseURL + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		defer resp.Body.Close()
+		body := map[string]any{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("GET %s decode error = %v", path, err)
+		}
+		return resp.StatusCode, body
+	}
+	waitFor := func(path string, code int) map[string]any {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got, body := get(path)
+			if got == code {
+				return body
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET %s = %d %v, want %d", path, got, body, code)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	runtime := cronRuntime{
+		newScheduler: func(*time.Location) (cronScheduler, error) {
+			return scheduler, nil
+		},
+		runTask: func(context.Context, *mongoarchive.Config) error { return nil },
+		notify:  func(context.Context, *mongoarchive.Config, bool, string) {},
+		now:     func() time.Time { return time.Unix(0, clock.Load()).UTC() },
+		after: func(d time.Duration) <-chan time.Time {
+			if d == readinessRetryInterval {
+				return retry
+			}
+			return time.After(d)
+		},
+		state:   state,
+		metrics: newArchiveMetrics(),
+		checkStorages: func(context.Context, *mongoarchive.Config) error {
+			if checks.Add(1) == 1 {
+				return errors.New("failed to list backups on backend #1 (s3): s3://key:hunter2@bucket unreachable")
+			}
+			return nil
+		},
+		listen: func(addr string) (net.Listener, error) {
+			listener, err := net.Listen("tcp", addr)
+			if err == nil {
+				baseURL = "http://" + listener.Addr().String()
+			}
+			return listener, err
+		},
+		waitForShutdown: func() {
+			// Without a token, only the health endpoints are served.
+			if code, _ := get("/v1/jobs"); code != http.StatusNotFound {
+				t.Fatalf("GET /v1/jobs without --http-token = %d, want %d", code, http.StatusNotFound)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for checks.Load() == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			body := waitFor("/readyz", http.StatusServiceUnavailable)
+			if message, _ := body["error"].(string); !strings.Contains(message, "unreachable") || strings.Contains(message, "hunter2") {
+				t.Fatalf("GET /readyz error = %q, want the redacted storage failure", message)
+			}
+			retry <- time.Now()
+			waitFor("/readyz", http.StatusOK)
+
+			waitFor("/healthz", http.StatusOK)
+			clock.Store(start.Add(heartbeatTimeout + time.Minute).UnixNano())
+			waitFor("/healthz", http.StatusServiceUnavailable)
+			scheduler.jobs[1].task()
+			waitFor("/healthz", http.StatusOK)
+
+			body = waitFor("/status", http.StatusOK)
+			jobs, _ := body["jobs"].([]any)
+			if len(jobs) != 1 || jobs[0].(map[string]any)["lastSuccess"] != "2026-01-02T00:30:00Z" {
+				t.Fatalf("GET /status = %v, want the recorded success", body)
+			}
+			clock.Store(start.Add(26 * time.Hour).UnixNano())
+			if body := waitFor("/status", http.StatusServiceUnavailable); body["status"] != "stale" {
+				t.Fatalf("GET /status = %v, want a stale backup", body)
+			}
+
+			// The metrics restore the recorded success too.
+			resp, err := http.Get(baseURL + "/metrics")
+			if err != nil {
+				t.Fatalf("GET /metrics error = %v", err)
+			}
+			defer resp.Body.Close()
+			metrics, _ := io.ReadAll(resp.Body)
+			if want := `mongo_archive_last_success_timestamp_seconds{job_name="mongo-archive",schedule=""} 1.7673138e+09`; !strings.Contains(string(metrics), want) {
+				t.Fatalf("GET /metrics = %s, want %s", metrics, want)
+			}
+		},
+	}
+
+	if err := runtime.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if got := scheduler.jobs[1].expression; got != heartbeatExpression {
+		t.Fatalf("heartbeat expression = %q, want %q", got, heartbeatExpression)
+	}
+}
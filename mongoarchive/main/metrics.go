@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/egose/database-tools/mongoarchive"
+	"github.com/egose/database-tools/storage"
+	mlog "github.com/mongodb/mongo-tools/common/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const (
+	metricsNamespace = "mongo_archive"
+	pushgatewayJob   = "mongo-archive"
+	pushTimeout      = 30 * time.Second
+
+	stageDump      = "dump"
+	stageTar       = "tar"
+	stageUpload    = "upload"
+	stageRetention = "retention"
+	// stageOther counts failures outside the stages, such as a storage
+	// backend that cannot be reached or a run refused by its window.
+	stageOther = "other"
+)
+
+// archiveMetrics are the Prometheus metrics of backup runs. The labels name
+// the job with job_name rather than job, which Prometheus sets to the scrape
+// job. A nil *archiveMetrics records nothing.
+type archiveMetrics struct {
+	registry           *prometheus.Registry
+	runs               *prometheus.CounterVec
+	stageDuration      *prometheus.HistogramVec
+	archiveSize        *prometheus.GaugeVec
+	uploadBytes        *prometheus.CounterVec
+	errors             *prometheus.CounterVec
+	retentionDeletions *prometheus.CounterVec
+	lastSuccess        *prometheus.GaugeVec
+	backendLastSuccess *prometheus.GaugeVec
+}
+
+// runMetrics records the metrics of one backup run. A nil *runMetrics
+// records nothing.
+type runMetrics struct {
+	metrics     *archiveMetrics
+	job         string
+	schedule    string
+	skipped     bool
+	failedStage string
+}
+
+type runMetricsKey struct{}
+
+func newArchiveMetrics() *archiveMetrics {
+	m := &archiveMetrics{
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "runs_total",
+			Help:      "Backup runs by result: success, failure, or skipped when another process held the lock.",
+		}, []string{"job_name", "schedule", "result"}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "stage_duration_seconds",
+			Help:      "Duration of the dump, tar, upload, and retention stages of backup runs.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}, []string{"job_name", "schedule", "stage"}),
+		archiveSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "archive_size_bytes",
+			Help:      "Size of the last archive a backup run created.",
+		}, []string{"job_name", "schedule"}),
+		uploadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_bytes_total",
+			Help:      "Archive bytes uploaded to each storage backend.",
+		}, []string{"job_name", "backend"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "errors_total",
+			Help:      "Failed backup runs by the stage they failed in.",
+		}, []string{"job_name", "stage"}),
+		retentionDeletions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retention_deletions_total",
+			Help:      "Expired backups that retention deleted from each storage backend.",
+		}, []string{"job_name", "backend"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time at which a backup run of the job and schedule last succeeded.",
+		}, []string{"job_name", "schedule"}),
+		backendLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "backend_last_success_timestamp_seconds",
+			Help:      "Unix time at which an archive of the job was last uploaded to the storage backend.",
+		}, []string{"job_name", "backend"}),
+	}
+	m.registry.MustRegister(m.runs, m.stageDuration, m.archiveSize, m.uploadBytes, m.errors, m.retentionDeletions, m.lastSuccess, m.backendLastSuccess)
+	return m
+}
+
+// startRun returns the recorder of a run of cfg.
+func (m *archiveMetrics) startRun(cfg *mongoarchive.Config) *runMetrics {
+	if m == nil {
+		return nil
+	}
+	return &runMetrics{metrics: m, job: cfg.Name(), schedule: cfg.BackupTier}
+}
+
+// restoreLastSuccess sets the last success of cfg from the run state, so
+// that a restarted process does not report it missing.
+func (m *archiveMetrics) restoreLastSuccess(cfg *mongoarchive.Config, at time.Time) {
+	if m == nil || at.IsZero() {
+		return
+	}
+	m.lastSuccess.WithLabelValues(cfg.Name(), cfg.BackupTier).Set(float64(at.Unix()))
+}
+
+// handler serves the metrics to Prometheus.
+func (m *archiveMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// push adds the metrics to the Pushgateway group of cfg's job and schedule,
+// whose instance label reads <job> or <job>:<schedule>. Metrics that a run
+// did not record, such as the last success of a failed run, keep the values
+// pushed before.
+func (m *archiveMetrics) push(ctx context.Context, cfg *mongoarchive.Config) {
+	if m == nil || cfg.PushgatewayURL == "" {
+		return
+	}
+	pushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pushTimeout)
+	defer cancel()
+
+	instance := cfg.Name()
+	if cfg.BackupTier != "" {
+		instance += ":" + cfg.BackupTier
+	}
+	pusher := push.New(cfg.PushgatewayURL, pushgatewayJob).Gatherer(m.registry).Grouping("instance", instance)
+	if err := pusher.AddContext(pushCtx); err != nil {
+		mlog.Logvf(mlog.Always, "%s: failed to push metrics: %v", taskName(cfg), err)
+	}
+}
+
+func withRunMetrics(ctx context.Context, r *runMetrics) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, runMetricsKey{}, r)
+}
+
+func runMetricsFrom(ctx context.Context) *runMetrics {
+	r, _ := ctx.Value(runMetricsKey{}).(*runMetrics)
+	return r
+}
+
+// stage starts timing stage. The returned function ends it with the stage's
+// error.
+func (r *runMetrics) stage(stage string) func(error) {
+	if r == nil {
+		return func(error) {}
+	}
+	started := time.Now()
+	return func(err error) {
+		r.metrics.stageDuration.WithLabelValues(r.job, r.schedule, stage).Observe(time.Since(started).Seconds())
+		if err != nil && r.failedStage == "" {
+			r.failedStage = stage
+		}
+	}
+}
+
+func (r *runMetrics) archived(tarfilePath string) {
+	if r == nil {
+		return
+	}
+	if info, err := os.Stat(tarfilePath); err == nil {
+		r.metrics.archiveSize.WithLabelValues(r.job, r.schedule).Set(float64(info.Size()))
+	}
+}
+
+func (r *runMetrics) uploaded(backend storage.Storage, tarfilePath string) {
+	if r == nil {
+		return
+	}
+	name := storage.StorageName(backend)
+	if info, err := os.Stat(tarfilePath); err == nil {
+		r.metrics.uploadBytes.WithLabelValues(r.job, name).Add(float64(info.Size()))
+	}
+	r.metrics.backendLastSuccess.WithLabelValues(r.job, name).SetToCurrentTime()
+}
+
+// retention returns a context under which the retention of backend counts
+// its deletions.
+func (r *runMetrics) retention(ctx context.Context, backend storage.Storage) context.Context {
+	if r == nil {
+		return ctx
+	}
+	deletions := r.metrics.retentionDeletions.WithLabelValues(r.job, storage.StorageName(backend))
+	return storage.WithRetentionObserver(ctx, func(string) { deletions.Inc() })
+}
+
+// skip marks a run that another process holds the lock for.
+func (r *runMetrics) skip() {
+	if r != nil {
+		r.skipped = true
+	}
+}
+
+func (r *runMetrics) finish(err error) {
+	if r == nil {
+		return
+	}
+	switch {
+	case err != nil:
+		stage := r.failedStage
+		if stage == "" {
+			stage = stageOther
+		}
+		r.metrics.runs.WithLabelValues(r.job, r.schedule, "failure").Inc()
+		r.metrics.errors.WithLabelValues(r.job, stage).Inc()
+	case r.skipped:
+		r.metrics.runs.WithLabelValues(r.job, r.schedule, "skipped").Inc()
+	default:
+		r.metrics.runs.WithLabelValues(r.job, r.schedule, "success").Inc()
+		r.metrics.lastSuccess.WithLabelValues(r.job, r.schedule).SetToCurrentTime()
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/mongoarchive"
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestArchivePipelineRecordsMetrics(t *testing.T) {
+	backupDir := t.TempDir()
+	expired := filepath.Join(backupDir, "backups", "9987654321000-2026-08-10T010203.456Z.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(expired), 0o700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(expired, []byte("old"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.Chtimes(expired, time.Now().Add(-72*time.Hour), time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	backend := &storage.LocalStorage{LocalPath: backupDir, BackupPrefix: "backups", ExpiryDays: 1, InstanceName: "primary"}
+
+	tarErr := errors.New("archive failed")
+	var failTar bool
+	metrics := newArchiveMetrics()
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return t.TempDir(), nil },
+		newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+			return "backup.tar.gz", nil
+		},
+		newDump: func([]string) (archiveDump, func(), error) {
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{backend}, nil
+		},
+		tar: func(_ string, destination string) error {
+			if failTar {
+				return tarErr
+			}
+			return os.WriteFile(destination, make([]byte, 1234), 0o600)
+		},
+		buildObjectName: func(string, *storage.NameTemplate, string) (string, error) {
+			return "backups/9987654320000-2026-08-13T010203.456Z.tar.gz", nil
+		},
+		upload:          uploadBackupToStorages,
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+		metrics:         metrics,
+	}
+	cfg := &mongoarchive.Config{JobName: "orders"}
+	cfg.BackupTier = "daily"
+
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	failTar = true
+	if err := pipeline.run(context.Background(), cfg); !errors.Is(err, tarErr) {
+		t.Fatalf("run() error = %v, want %v", err, tarErr)
+	}
+
+	for _, tt := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"runs_total{result=success}", testutil.ToFloat64(metrics.runs.WithLabelValues("orders", "daily", "success")), 1},
+		{"runs_total{result=failure}", testutil.ToFloat64(metrics.runs.WithLabelValues("orders", "daily", "failure")), 1},
+		{"errors_total{stage=tar}", testutil.ToFloat64(metrics.errors.WithLabelValues("orders", stageTar)), 1},
+		{"archive_size_bytes", testutil.ToFloat64(metrics.archiveSize.WithLabelValues("orders", "daily")), 1234},
+		{"upload_bytes_total", testutil.ToFloat64(metrics.uploadBytes.WithLabelValues("orders", "primary")), 1234},
+		{"retention_deletions_total", testutil.ToFloat64(metrics.retentionDeletions.WithLabelValues("orders", "primary")), 1},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.lastSuccess.WithLabelValues("orders", "daily")); got < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("last_success_timestamp_seconds = %v, want the time of the successful run", got)
+	}
+	if got := testutil.ToFloat64(metrics.backendLastSuccess.WithLabelValues("orders", "primary")); got < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("backend_last_success_timestamp_seconds = %v, want the time of the upload", got)
+	}
+	// The successful run went through every stage, the failed one through
+	// dump and tar.
+	if got := testutil.CollectAndCount(metrics.stageDuration); got != 4 {
+		t.Errorf("stage_duration_seconds series = %d, want 4", got)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("Stat(expired) error = %v, want the expired backup deleted", err)
+	}
+}
+
+func TestArchiveMetricsPushToThePushgateway(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(buf)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := &mongoarchive.Config{JobName: "orders", MetricsOptions: mongoarchive.MetricsOptions{PushgatewayURL: server.URL}}
+	cfg.BackupTier = "daily"
+	metrics := newArchiveMetrics()
+	metrics.startRun(cfg).finish(nil)
+	metrics.push(context.Background(), cfg)
+
+	if method != http.MethodPost || path != "/metrics/job/mongo-archive/instance/orders:daily" {
+		t.Fatalf("push request = %s %s, want POST to the group of the job's schedule", method, path)
+	}
+	if !strings.Contains(body, "mongo_archive_runs_total") {
+		t.Fatalf("push body does not hold mongo_archive_runs_total")
+	}
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,6 +24,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/mongodump"
+	"github.com/robfig/cron/v3"
 )
 
 var version string
@@ -28,6 +34,9 @@ const (
 	progressBarWaitTime = time.Second * 3
 	envPrefix           = "MONGOARCHIVE__"
 	defaultWorkspaceDir = "mongoarchive"
+	workspacePattern    = "run-"
+	// abortCleanupTimeout bounds the wait for aborted runs at shutdown.
+	abortCleanupTimeout = 30 * time.Second
 )
 
 type archiveDump interface {
@@ -38,16 +47,19 @@ type archiveDump interface {
 
 type archivePipeline struct {
 	createWorkspace func() (string, error)
-	newFilename     func() (string, string)
+	newFilename     func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error)
 	newDump         func([]string) (archiveDump, func(), error)
 	getStorages     func(context.Context, *mongoarchive.Config) ([]storage.Storage, error)
 	tar             func(string, string) error
-	buildObjectName func(string, string) (string, error)
+	buildObjectName func(string, *storage.NameTemplate, string) (string, error)
 	upload          func(context.Context, []storage.Storage, string, string) error
 	deleteDirectory func(string) error
 	deleteFile      func(string) error
 	handleInterrupt func(func()) chan struct{}
 	notify          func(context.Context, *mongoarchive.Config, bool, string)
+	pending         *mongoarchive.PendingArchiveStore
+	reclaimUploads  func(context.Context, []storage.Storage)
+	metrics         *archiveMetrics
 }
 
 type cleanupEntry struct {
@@ -64,12 +76,37 @@ type multiBackendArchiveError struct {
 	cause   error
 }
 
+// runAbortError is the cause of a run's context once the run is aborted: it
+// exceeded its maximum duration, its run window closed, or it was still
+// going when the shutdown grace period ran out.
+type runAbortError struct {
+	reason string
+}
+
+// archiveUploadError marks a failure during the upload phase, before any
+// retention ran, together with the backends that already hold the archive.
+type archiveUploadError struct {
+	uploaded []storage.Storage
+	err      error
+}
+
 type cronOverlapPolicy string
 
+// cronDrain tracks the runs in flight, so that the shutdown can wait for
+// them. Once it drains, no new run starts.
+type cronDrain struct {
+	mu       sync.Mutex
+	stopped  bool
+	stopping chan struct{}
+	runs     sync.WaitGroup
+}
+
 const cronSkipOverlappingRuns cronOverlapPolicy = "skip"
 
 type cronScheduler interface {
-	Schedule(string, func(), cronOverlapPolicy) error
+	// Schedule adds a job; a job that starts immediately also runs once as
+	// soon as the scheduler starts.
+	Schedule(expression string, task func(), overlap cronOverlapPolicy, startImmediately bool) error
 	Start()
 	Shutdown() error
 }
@@ -80,6 +117,11 @@ type cronRuntime struct {
 	notify          func(context.Context, *mongoarchive.Config, bool, string)
 	waitForShutdown func()
 	now             func() time.Time
+	after           func(time.Duration) <-chan time.Time
+	state           *mongoarchive.RunStateStore
+	metrics         *archiveMetrics
+	listen          func(addr string) (net.Listener, error)
+	checkStorages   func(context.Context, *mongoarchive.Config) error
 }
 
 type gocronScheduler struct {
@@ -100,13 +142,38 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if cfg.HasCron() {
+	if err := configureTransfers(cfg); err != nil {
+		mlog.Logvf(mlog.Always, "Failed: %v", err)
+		os.Exit(1)
+	}
+
+	janitorMinAge, err := readPositiveDurationEnv(envPrefix+"JANITOR_MIN_AGE", utils.DefaultJanitorMinAge)
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Failed: %v", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case cfg.Command == mongoarchive.CommandJanitor:
+		err = runJanitor(ctx, cfg, janitorMinAge)
+	case cfg.Command == mongoarchive.CommandCopy:
+		err = runCopy(ctx, cfg)
+	case cfg.Command == mongoarchive.CommandMigrate:
+		err = runMigrate(ctx, cfg)
+	case cfg.Command == mongoarchive.CommandAudit:
+		err = runAudit(ctx, cfg)
+	case cfg.Command == mongoarchive.CommandPin:
+		err = runPin(ctx, cfg, true)
+	case cfg.Command == mongoarchive.CommandUnpin:
+		err = runPin(ctx, cfg, false)
+	case cfg.Command == mongoarchive.CommandList:
+		err = runList(ctx, cfg)
+	case cfg.HasCron():
+		cleanStaleWorkspaces(archiveBasePath(), janitorMinAge)
 		err = runCronJob(ctx, cfg)
-	} else {
-		err = runTask(ctx, cfg)
-		if err != nil {
-			sendNotification(ctx, cfg, false, err.Error())
-		}
+	default:
+		cleanStaleWorkspaces(archiveBasePath(), janitorMinAge)
+		err = runJobs(ctx, cfg, runTask, sendNotification)
 	}
 
 	if err != nil {
@@ -120,14 +187,84 @@ func runCronJob(ctx context.Context, cfg *mongoarchive.Config) error {
 	return newCronRuntime().run(ctx, cfg)
 }
 
+// runTask runs a backup once, and pushes its metrics when --pushgateway-url
+// is set.
 func runTask(ctx context.Context, cfg *mongoarchive.Config) error {
-	return newArchivePipeline().run(ctx, cfg)
+	pipeline := newConfiguredArchivePipeline(cfg)
+	if cfg.PushgatewayURL != "" {
+		pipeline.metrics = newArchiveMetrics()
+		defer pipeline.metrics.push(ctx, cfg)
+	}
+	return pipeline.run(ctx, cfg)
+}
+
+// newCronTask returns the task that runs a backup under --cron and records
+// its metrics. The cron runtime handles termination signals so that runs in
+// flight can drain, and it aborts a run through its context instead.
+func newCronTask(metrics *archiveMetrics) func(context.Context, *mongoarchive.Config) error {
+	return func(ctx context.Context, cfg *mongoarchive.Config) error {
+		pipeline := newConfiguredArchivePipeline(cfg)
+		pipeline.handleInterrupt = func(func()) chan struct{} { return nil }
+		pipeline.metrics = metrics
+		return pipeline.run(ctx, cfg)
+	}
+}
+
+func runJanitor(ctx context.Context, cfg *mongoarchive.Config, minAge time.Duration) error {
+	return newConfiguredArchivePipeline(cfg).janitor(ctx, cfg, archiveBasePath(), minAge)
+}
+
+func runCopy(ctx context.Context, cfg *mongoarchive.Config) error {
+	return newConfiguredArchivePipeline(cfg).copy(ctx, cfg)
+}
+
+func runMigrate(ctx context.Context, cfg *mongoarchive.Config) error {
+	return newConfiguredArchivePipeline(cfg).migrate(ctx, cfg)
+}
+
+func runAudit(ctx context.Context, cfg *mongoarchive.Config) error {
+	return newConfiguredArchivePipeline(cfg).audit(ctx, cfg)
+}
+
+func runPin(ctx context.Context, cfg *mongoarchive.Config, pinned bool) error {
+	return newConfiguredArchivePipeline(cfg).pin(ctx, cfg, pinned)
+}
+
+func runList(ctx context.Context, cfg *mongoarchive.Config) error {
+	return newConfiguredArchivePipeline(cfg).list(ctx, cfg)
+}
+
+func newConfiguredArchivePipeline(cfg *mongoarchive.Config) archivePipeline {
+	pipeline := newArchivePipeline()
+	if cfg.Transfers != nil {
+		pipeline.pending = mongoarchive.NewPendingArchiveStore(filepath.Join(archiveBasePath(), "pending", cfg.JobName), cfg.Transfers.MaxAge)
+	}
+	return pipeline
+}
+
+// configureTransfers persists multipart and download progress under the dump
+// base path so that interrupted transfers can be resumed by a later run.
+func configureTransfers(cfg *mongoarchive.Config) error {
+	window, err := readPositiveDurationEnv(envPrefix+"TRANSFER_RESUME_WINDOW", storage.DefaultTransferResumeWindow)
+	if err != nil {
+		return err
+	}
+
+	transfers, err := storage.NewTransferStateStore(filepath.Join(archiveBasePath(), "transfers"), window)
+	if err != nil {
+		return err
+	}
+	cfg.Transfers = transfers
+	for _, job := range cfg.Jobs {
+		job.Transfers = transfers
+	}
+	return nil
 }
 
 func newArchivePipeline() archivePipeline {
 	return archivePipeline{
 		createWorkspace: createArchiveWorkspace,
-		newFilename:     utils.GetNewFilename,
+		newFilename:     newBackupName,
 		newDump:         newMongoDumpRunner,
 		getStorages: func(ctx context.Context, cfg *mongoarchive.Config) ([]storage.Storage, error) {
 			return cfg.GetStorages(ctx)
@@ -139,13 +276,15 @@ func newArchivePipeline() archivePipeline {
 		deleteFile:      utils.DeleteFile,
 		handleInterrupt: signals.HandleWithInterrupt,
 		notify:          sendNotification,
+		reclaimUploads:  reclaimUploadsBeforeRun,
 	}
 }
 
 func newCronRuntime() cronRuntime {
+	metrics := newArchiveMetrics()
 	return cronRuntime{
 		newScheduler: newGocronScheduler,
-		runTask:      runTask,
+		runTask:      newCronTask(metrics),
 		notify:       sendNotification,
 		waitForShutdown: func() {
 			sigChan := make(chan os.Signal, 1)
@@ -153,89 +292,822 @@ func newCronRuntime() cronRuntime {
 			defer signal.Stop(sigChan)
 			<-sigChan
 		},
-		now: time.Now,
+		now:     time.Now,
+		after:   time.After,
+		state:   mongoarchive.NewRunStateStore(filepath.Join(archiveBasePath(), "state")),
+		metrics: metrics,
+		listen: func(addr string) (net.Listener, error) {
+			return net.Listen("tcp", addr)
+		},
+		checkStorages: checkCronStorages,
 	}
 }
 
 func (p archivePipeline) run(ctx context.Context, cfg *mongoarchive.Config) (retErr error) {
+	metrics := p.metrics.startRun(cfg)
+	ctx = withRunMetrics(ctx, metrics)
+	defer func() {
+		metrics.finish(retErr)
+	}()
 	filename := ""
 	dumpDirName := ""
-	defer func() {
+	defer func(ctx context.Context) {
 		if retErr == nil && filename != "" {
 			p.notify(ctx, cfg, true, filename)
 		}
-	}()
+	}(ctx)
+	defer func() {
+		var abortErr *runAbortError
+		if retErr != nil && errors.As(context.Cause(ctx), &abortErr) && !errors.Is(retErr, abortErr) {
+			retErr = fmt.Errorf("%w: %w", abortErr, retErr)
+		}
+	}()
+
+	limit, err := cfg.RunLimit(time.Now())
+	if err != nil {
+		return err
+	}
+	if !limit.Deadline.IsZero() {
+		limitCtx, cancel := context.WithDeadlineCause(ctx, limit.Deadline, &runAbortError{reason: limit.Reason})
+		defer cancel()
+		ctx = limitCtx
+	}
+
+	storageBackends, err := p.getStorages(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if len(storageBackends) == 0 {
+		return fmt.Errorf("no storage backends configured")
+	}
+	defer func() {
+		if closeErr := closeStorages(storageBackends); closeErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
+		}
+	}()
+
+	if cfg.Lock {
+		lock, err := acquireRunLock(ctx, cfg, storageBackends)
+		var held *storage.LockHeldError
+		if errors.As(err, &held) {
+			mlog.Logvf(mlog.Always, "Skipping %s: %v", taskName(cfg), held)
+			metrics.skip()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		parent := ctx
+		lockCtx, stopRenewing := lock.KeepAlive(parent)
+		defer func() {
+			// The lease was lost when the renewals stopped the run on their own.
+			if lockCtx.Err() != nil && parent.Err() == nil {
+				retErr = errors.Join(retErr, context.Cause(lockCtx))
+			}
+			stopRenewing()
+			if releaseErr := lock.Release(context.WithoutCancel(parent)); releaseErr != nil {
+				retErr = joinPrimaryAndCleanupErrors(retErr, releaseErr)
+			}
+		}()
+		ctx = lockCtx
+	}
+
+	if p.reclaimUploads != nil {
+		p.reclaimUploads(ctx, storageBackends)
+	}
+
+	uploadBackends, tierSource, tierTarget, err := selectTierStorages(storageBackends, cfg)
+	if err != nil {
+		return err
+	}
+
+	// A pending archive that still cannot be uploaded must not hold back
+	// fresh backups; it stays kept for the next run.
+	if err := p.resumePendingArchive(ctx, cfg, uploadBackends); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		mlog.Logvf(mlog.Always, "%v; continuing with a new dump", err)
+	}
+
+	workspace, err := p.createWorkspace()
+	if err != nil {
+		return err
+	}
+
+	cleanup := cleanupStack{}
+	cleanup.addDirectory(workspace, p.deleteDirectory)
+	defer func() {
+		if cleanupErr := cleanup.run(cfg.HasKeep()); cleanupErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, cleanupErr)
+		}
+	}()
+
+	nameTemplate, err := cfg.NameTemplate()
+	if err != nil {
+		return err
+	}
+	filename, err = p.newFilename(ctx, cfg, uploadBackends)
+	if err != nil {
+		return err
+	}
+	// The name may place the backup in sub-directories of the prefix; only
+	// its last segment names the local files.
+	dumpDirName = strings.TrimSuffix(path.Base(filename), ".tar.gz")
+	destPath := filepath.Join(workspace, dumpDirName)
+	tarfilePath := filepath.Join(workspace, path.Base(filename))
+
+	options := cfg.GetMongodumpOptions()
+	options = append(options, "--out="+destPath)
+
+	dump, stopProgress, err := p.newDump(options)
+	if err != nil {
+		return err
+	}
+	defer stopProgress()
+
+	finishedChan := p.handleInterrupt(dump.HandleInterrupt)
+	defer func() {
+		if finishedChan != nil {
+			close(finishedChan)
+		}
+	}()
+	// The dump does not watch ctx, so an aborted run interrupts it the way a
+	// signal would. Signals reach it through handleInterrupt already.
+	stopAbortInterrupt := context.AfterFunc(ctx, func() {
+		var abortErr *runAbortError
+		if errors.As(context.Cause(ctx), &abortErr) {
+			mlog.Logvf(mlog.Always, "%s; interrupting the dump", abortErr)
+			dump.HandleInterrupt()
+		}
+	})
+	defer stopAbortInterrupt()
+
+	endDump := metrics.stage(stageDump)
+	if err := dump.Init(); err != nil {
+		endDump(err)
+		return err
+	}
+
+	err = dump.Dump()
+	stopAbortInterrupt()
+	endDump(errors.Join(err, ctx.Err()))
+	if err != nil {
+		return err
+	}
+	cleanup.addDirectory(destPath, p.deleteDirectory)
+	if ctx.Err() != nil {
+		// An interrupted dump may be incomplete.
+		return context.Cause(ctx)
+	}
+
+	endTar := metrics.stage(stageTar)
+	err = p.tar(destPath, tarfilePath)
+	endTar(err)
+	if err != nil {
+		return err
+	}
+	cleanup.addFile(tarfilePath, p.deleteFile)
+	metrics.archived(tarfilePath)
+
+	objectName, err := p.buildObjectName(cfg.BackupPrefix, nameTemplate, filename)
+	if err != nil {
+		return err
+	}
+
+	if err := p.upload(ctx, uploadBackends, objectName, tarfilePath); err != nil {
+		if keepErr := p.keepPendingArchive(cfg, uploadBackends, mongoarchive.PendingArchive{ObjectName: objectName, Filename: filename}, tarfilePath, err); keepErr != nil {
+			return errors.Join(err, keepErr)
+		}
+		return err
+	}
+
+	if cfg.Pin {
+		if err := pinUploadedBackup(ctx, uploadBackends, objectName, cfg.PinReason); err != nil {
+			return err
+		}
+	}
+
+	if tierTarget != nil {
+		return p.tier(ctx, cfg, tierSource, tierTarget, storage.BackendObjectName(tierSource, objectName), workspace)
+	}
+	return nil
+}
+
+// acquireRunLock takes the job's lease on the lock backend, by default the
+// first backend. It returns a *storage.LockHeldError when another process
+// runs the job.
+func acquireRunLock(ctx context.Context, cfg *mongoarchive.Config, storages []storage.Storage) (*storage.Lock, error) {
+	backend := storages[0]
+	if cfg.LockBackend != "" {
+		selected, err := storage.SelectRestoreStorage(storages, cfg.LockBackend)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select lock backend: %w", err)
+		}
+		backend = selected
+	}
+	lock, err := storage.AcquireLock(ctx, backend, cfg.LockName(), storage.LockOptions{Holder: lockHolder(), TTL: cfg.LockTTL})
+	if err != nil {
+		return nil, err
+	}
+	mlog.Logvf(mlog.Always, "Acquired lock %s on %s for %s", lock.Name(), storage.StorageName(backend), lock.TTL())
+	return lock, nil
+}
+
+// lockHolder identifies one acquisition of a lock by host, process, and a
+// random suffix, so that two runs in the same process never share a lease.
+func lockHolder() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), rand.Text()[:8])
+}
+
+// newBackupName names a new backup with the configured template. A {seq}
+// placeholder continues from the highest sequence number on any backend.
+func newBackupName(ctx context.Context, cfg *mongoarchive.Config, storages []storage.Storage) (string, error) {
+	nameTemplate, err := cfg.NameTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	seq := 0
+	if nameTemplate.UsesSeq() {
+		for _, s := range storages {
+			lister, ok := s.(storage.BackupLister)
+			if !ok {
+				return "", fmt.Errorf("storage backend %s cannot list its backups to number the next one", storage.StorageName(s))
+			}
+			backups, err := lister.ListBackups(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to list backups on %s: %w", storage.StorageName(s), err)
+			}
+			seq = max(seq, nameTemplate.NextBackupSeq(backups))
+		}
+	}
+	return nameTemplate.Name(cfg.BackupNameValues(time.Now(), seq))
+}
+
+// pinUploadedBackup pins the just-uploaded archive on every backend it was
+// uploaded to.
+func pinUploadedBackup(ctx context.Context, storages []storage.Storage, objectName string, reason string) error {
+	if reason == "" {
+		reason = storage.DefaultPinReason
+	}
+	for _, s := range storages {
+		pinner, ok := s.(storage.Pinner)
+		if !ok {
+			return fmt.Errorf("failed to pin the uploaded archive: storage backend %s cannot pin backups", storage.StorageName(s))
+		}
+		backendObjectName := storage.BackendObjectName(s, objectName)
+		if err := pinner.PinObject(ctx, backendObjectName, reason); err != nil {
+			return fmt.Errorf("failed to pin the uploaded archive on %s: %w", storage.StorageName(s), err)
+		}
+		mlog.Logvf(mlog.Always, "Pinned %s on %s: %s", backendObjectName, storage.StorageName(s), reason)
+	}
+	return nil
+}
+
+// selectTierStorages splits off the tier target, which receives backups only
+// through tiering, from the backends new archives are uploaded to. Without
+// tiering every backend receives uploads.
+func selectTierStorages(storages []storage.Storage, cfg *mongoarchive.Config) ([]storage.Storage, storage.Storage, storage.Storage, error) {
+	if !cfg.HasTiering() {
+		return storages, nil, nil, nil
+	}
+
+	source, err := storage.SelectRestoreStorage(storages, cfg.TierSource)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to select tier source: %w", err)
+	}
+	target, err := storage.SelectRestoreStorage(storages, cfg.TierTarget)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to select tier target: %w", err)
+	}
+	if target == source {
+		return nil, nil, nil, fmt.Errorf("tier target %q is the tier source", cfg.TierTarget)
+	}
+
+	uploads := make([]storage.Storage, 0, len(storages)-1)
+	for _, s := range storages {
+		if s != target {
+			uploads = append(uploads, s)
+		}
+	}
+	return uploads, source, target, nil
+}
+
+// tier moves backups that have aged out of the tier source to the tier
+// target, then applies the tier target's retention, which the upload phase
+// does not reach. The just-uploaded archive, named preserve on the source,
+// always stays on the source.
+func (p archivePipeline) tier(ctx context.Context, cfg *mongoarchive.Config, source storage.Storage, target storage.Storage, preserve string, stagingDir string) error {
+	sourceName, targetName := storage.StorageName(source), storage.StorageName(target)
+	results, err := storage.TierBackups(ctx, source, target, storage.TierOptions{
+		AfterDays:  cfg.TierAfterDays,
+		Preserve:   preserve,
+		StagingDir: stagingDir,
+	})
+	for _, result := range results {
+		mlog.Logvf(mlog.Always, "Tiered %s from %s to %s as %s", result.Source, sourceName, targetName, result.Copy.Object)
+	}
+	if err != nil {
+		return fmt.Errorf("tiering failed after the archive upload completed; %d backup(s) were tiered: %w", len(results), err)
+	}
+	mlog.Logvf(mlog.Always, "Tiered %d backup(s) older than %d days from %s to %s", len(results), cfg.TierAfterDays, sourceName, targetName)
+
+	deleteCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if err := target.DeleteOldObjects(deleteCtx, ""); err != nil {
+		return fmt.Errorf("failed to delete old objects in %s: %w", targetName, err)
+	}
+	return nil
+}
+
+// resumePendingArchive finishes the upload of an archive left behind by an
+// earlier failed run before a new dump is taken. Backends that already hold
+// the archive are skipped; they are matched by name, so that a reordered
+// storage list does not confuse them.
+func (p archivePipeline) resumePendingArchive(ctx context.Context, cfg *mongoarchive.Config, storages []storage.Storage) error {
+	pending, err := p.pending.Load()
+	if err != nil {
+		return err
+	}
+	if pending == nil {
+		return nil
+	}
+
+	if p.pending.Expired(pending) {
+		mlog.Logvf(mlog.Always, "Discarding pending archive %s; it is older than the transfer resume window", pending.ObjectName)
+		return p.pending.Clear()
+	}
+
+	uploaded := make(map[string]bool, len(pending.Uploaded))
+	for _, name := range pending.Uploaded {
+		uploaded[name] = true
+	}
+	remaining := make([]storage.Storage, 0, len(storages))
+	for _, s := range storages {
+		if !uploaded[storage.StorageName(s)] {
+			remaining = append(remaining, s)
+		}
+	}
+
+	mlog.Logvf(mlog.Always, "Resuming upload of pending archive %s to %d storage backend(s)", pending.ObjectName, len(remaining))
+	if len(remaining) > 0 {
+		if err := p.upload(ctx, remaining, pending.ObjectName, pending.Path); err != nil {
+			err = fmt.Errorf("failed to resume pending archive %s: %w", pending.ObjectName, err)
+			if keepErr := p.keepPendingArchive(cfg, storages, *pending, pending.Path, err); keepErr != nil {
+				return errors.Join(err, keepErr)
+			}
+			return err
+		}
+	}
+
+	if err := p.pending.Clear(); err != nil {
+		return fmt.Errorf("failed to clear pending archive: %w", err)
+	}
+	p.notify(ctx, cfg, true, pending.Filename)
+	return nil
+}
+
+// keepPendingArchive moves the archive aside after an upload-phase failure so
+// that the next run resumes its upload. Retention failures happen after every
+// backend holds the archive and need no retry. It returns an error when the
+// archive could not be kept, so that the run's failure reports it.
+func (p archivePipeline) keepPendingArchive(cfg *mongoarchive.Config, storages []storage.Storage, pending mongoarchive.PendingArchive, archivePath string, uploadErr error) error {
+	var archiveErr *archiveUploadError
+	if p.pending == nil || cfg.HasKeep() || !errors.As(uploadErr, &archiveErr) {
+		return nil
+	}
+
+	for _, s := range storages {
+		for _, done := range archiveErr.uploaded {
+			if done == s {
+				pending.Uploaded = append(pending.Uploaded, storage.StorageName(s))
+			}
+		}
+	}
+
+	saved, err := p.pending.Save(pending, archivePath)
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Failed to keep archive %s for retry: %v", pending.ObjectName, err)
+		return fmt.Errorf("archive %s was discarded: %w", pending.ObjectName, err)
+	}
+	mlog.Logvf(mlog.Always, "Kept archive %s at %s; the next run resumes its upload", saved.ObjectName, saved.Path)
+	return nil
+}
+
+// janitor reclaims what crashed runs left behind: workspaces of dead
+// processes, incomplete uploads on every backend, and a kept archive whose
+// resume window has passed.
+func (p archivePipeline) janitor(ctx context.Context, cfg *mongoarchive.Config, basePath string, minAge time.Duration) (retErr error) {
+	var janitorErrors []error
+
+	workspaces, err := utils.CleanStaleWorkspaces(basePath, workspacePattern, minAge, time.Now())
+	logReclaimedWorkspaces(workspaces)
+	if err != nil {
+		janitorErrors = append(janitorErrors, fmt.Errorf("failed to clean stale workspaces: %w", err))
+	}
+
+	storageBackends, err := p.getStorages(ctx, cfg)
+	if err != nil {
+		return errors.Join(append(janitorErrors, err)...)
+	}
+	defer func() {
+		if closeErr := closeStorages(storageBackends); closeErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
+		}
+	}()
+
+	uploads, err := reclaimAbandonedUploads(ctx, storageBackends, minAge)
+	if err != nil {
+		janitorErrors = append(janitorErrors, err)
+	}
+
+	if expired, err := p.discardExpiredPendingArchive(); err != nil {
+		janitorErrors = append(janitorErrors, err)
+	} else if expired != nil {
+		uploads = append(uploads, *expired)
+	}
+
+	var workspaceBytes, uploadBytes int64
+	for _, workspace := range workspaces {
+		workspaceBytes += workspace.Bytes
+	}
+	for _, upload := range uploads {
+		uploadBytes += upload.Bytes
+	}
+	mlog.Logvf(mlog.Always, "Janitor reclaimed %d workspace(s) (%d bytes) and %d upload(s) (%d bytes)", len(workspaces), workspaceBytes, len(uploads), uploadBytes)
+
+	return errors.Join(janitorErrors...)
+}
+
+// copy replicates backups from the copy source to the copy targets, staging
+// each archive in a run workspace between its download and its uploads.
+func (p archivePipeline) copy(ctx context.Context, cfg *mongoarchive.Config) (retErr error) {
+	storageBackends, err := p.getStorages(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeStorages(storageBackends); closeErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
+		}
+	}()
+
+	source, targets, err := selectCopyStorages(storageBackends, cfg.CopySource, cfg.GetCopyTargets())
+	if err != nil {
+		return err
+	}
+
+	workspace, err := p.createWorkspace()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cleanupErr := p.deleteDirectory(workspace); cleanupErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, fmt.Errorf("cleanup %q: %w", workspace, cleanupErr))
+		}
+	}()
+
+	results, err := storage.CopyBackups(ctx, source, targets, storage.CopyOptions{Objects: cfg.GetCopyObjects(), StagingDir: workspace})
+	var copied, skipped int
+	var copiedBytes int64
+	for _, result := range results {
+		if result.Skipped {
+			skipped++
+			continue
+		}
+		copied++
+		copiedBytes += result.Bytes
+	}
+	mlog.Logvf(mlog.Always, "Copied %d backup(s) (%d bytes) from %s to %d target(s); %d already present", copied, copiedBytes, storage.StorageName(source), len(targets), skipped)
+	return err
+}
+
+// selectCopyStorages resolves the copy source and targets. Without explicit
+// targets every other configured backend is a target.
+func selectCopyStorages(storages []storage.Storage, sourceName string, targetNames []string) (storage.Storage, []storage.Storage, error) {
+	source, err := storage.SelectRestoreStorage(storages, sourceName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to select copy source: %w", err)
+	}
+
+	targets := make([]storage.Storage, 0, len(storages))
+	if len(targetNames) == 0 {
+		for _, s := range storages {
+			if s != source {
+				targets = append(targets, s)
+			}
+		}
+	}
+	for _, targetName := range targetNames {
+		target, err := storage.SelectRestoreStorage(storages, targetName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to select copy target: %w", err)
+		}
+		if target == source {
+			return nil, nil, fmt.Errorf("copy target %q is the copy source", targetName)
+		}
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("no copy targets configured besides %s", storage.StorageName(source))
+	}
+	return source, targets, nil
+}
+
+// migrate moves legacy backups to managed names on every configured backend
+// and logs the mapping from each legacy object to its managed name. With
+// --schedules, the backups are migrated into the tier that a run without
+// --cron would back up to.
+func (p archivePipeline) migrate(ctx context.Context, cfg *mongoarchive.Config) (retErr error) {
+	pattern, err := cfg.GetMigratePattern()
+	if err != nil {
+		return err
+	}
+	run := cfg.OneShotRun()
+	if run == nil {
+		return fmt.Errorf("backup tier %q is not one of the schedules", cfg.BackupTier)
+	}
+
+	storageBackends, err := p.getStorages(ctx, run)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeStorages(storageBackends); closeErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
+		}
+	}()
+
+	workspace, err := p.createWorkspace()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cleanupErr := p.deleteDirectory(workspace); cleanupErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, fmt.Errorf("cleanup %q: %w", workspace, cleanupErr))
+		}
+	}()
+
+	options := storage.MigrationOptions{Pattern: pattern, Move: cfg.MigrateMove, DryRun: cfg.DryRun, StagingDir: workspace, Values: run.BackupNameValues(time.Time{}, 0)}
+	var migrateErrors []error
+	for i, s := range storageBackends {
+		backendName := describeStorageBackend(i, s)
+		entries, err := storage.MigrateBackups(ctx, s, options)
+		logMigrationReport(backendName, entries, cfg.DryRun)
+		if err != nil {
+			migrateErrors = append(migrateErrors, fmt.Errorf("failed to migrate legacy backups on %s: %w", backendName, err))
+		}
+	}
+	return errors.Join(migrateErrors...)
+}
+
+func logMigrationReport(backendName string, entries []storage.MigrationEntry, dryRun bool) {
+	migrated := 0
+	for _, entry := range entries {
+		status := "not done"
+		switch {
+		case dryRun:
+			status = "dry run"
+		case entry.Done:
+			status = "done"
+			migrated++
+		case entry.Action == storage.MigrationSkip || entry.Action == storage.MigrationConflict:
+			status = "left in place"
+		}
+		mlog.Logvf(mlog.Always, "Migration on %s: %s %s -> %s (%d bytes, %s)", backendName, entry.Action, entry.Source, entry.Target, entry.Size, status)
+	}
+	mlog.Logvf(mlog.Always, "Migration on %s: %d legacy object(s) found, %d migrated", backendName, len(entries), migrated)
+}
 
+// audit compares the backups on every configured backend, optionally repairs
+// gaps, and fails while any inconsistency remains.
+func (p archivePipeline) audit(ctx context.Context, cfg *mongoarchive.Config) (retErr error) {
 	storageBackends, err := p.getStorages(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	if len(storageBackends) == 0 {
-		return fmt.Errorf("no storage backends configured")
-	}
 	defer func() {
 		if closeErr := closeStorages(storageBackends); closeErr != nil {
 			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
 		}
 	}()
+	// The tier target holds only backups that have aged out of the tier
+	// source, so it is not compared with the backends that receive uploads.
+	auditBackends, tierSource, _, err := selectTierStorages(storageBackends, cfg)
+	if err != nil {
+		return err
+	}
+	if len(auditBackends) < 2 {
+		return fmt.Errorf("audit needs at least two storage backends, found %d", len(auditBackends))
+	}
+	keepDays, err := backendKeepDays(cfg, tierSource)
+	if err != nil {
+		return err
+	}
 
 	workspace, err := p.createWorkspace()
 	if err != nil {
 		return err
 	}
-
-	cleanup := cleanupStack{}
-	cleanup.addDirectory(workspace, p.deleteDirectory)
 	defer func() {
-		if cleanupErr := cleanup.run(cfg.HasKeep()); cleanupErr != nil {
-			retErr = joinPrimaryAndCleanupErrors(retErr, cleanupErr)
+		if cleanupErr := p.deleteDirectory(workspace); cleanupErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, fmt.Errorf("cleanup %q: %w", workspace, cleanupErr))
 		}
 	}()
 
-	filename, dumpDirName = p.newFilename()
-	destPath := filepath.Join(workspace, dumpDirName)
-	tarfilePath := filepath.Join(workspace, filename)
-
-	options := cfg.GetMongodumpOptions()
-	options = append(options, "--out="+destPath)
+	names := make(map[storage.Storage]string, len(auditBackends))
+	for i, s := range auditBackends {
+		names[s] = describeStorageBackend(i, s)
+	}
 
-	dump, stopProgress, err := p.newDump(options)
+	options := storage.AuditOptions{Checksums: cfg.AuditChecksums, StagingDir: workspace, KeepDays: keepDays}
+	entries, err := storage.AuditBackups(ctx, auditBackends, options)
 	if err != nil {
 		return err
 	}
-	defer stopProgress()
+	inconsistent := logAuditReport(entries, names)
 
-	finishedChan := p.handleInterrupt(dump.HandleInterrupt)
-	defer func() {
-		if finishedChan != nil {
-			close(finishedChan)
+	if cfg.Repair && inconsistent > 0 {
+		if _, err := storage.RepairBackups(ctx, entries, workspace); err != nil {
+			return fmt.Errorf("failed to repair backups: %w", err)
 		}
-	}()
+		options.Checksums = false
+		if entries, err = storage.AuditBackups(ctx, auditBackends, options); err != nil {
+			return err
+		}
+		mlog.Logvf(mlog.Always, "Audit after repair:")
+		inconsistent = logAuditReport(entries, names)
+	}
 
-	if err := dump.Init(); err != nil {
-		return err
+	if inconsistent > 0 {
+		return fmt.Errorf("audit found %d inconsistent backup(s)", inconsistent)
 	}
+	return nil
+}
 
-	if err := dump.Dump(); err != nil {
-		return err
+// backendKeepDays returns how many days each backend keeps backups: its
+// retention, or on the tier source the age at which backups are tiered away.
+func backendKeepDays(cfg *mongoarchive.Config, tierSource storage.Storage) (func(storage.Storage) int, error) {
+	instances, err := cfg.Instances()
+	if err != nil {
+		return nil, err
+	}
+	expiryDays := make(map[string]int, len(instances))
+	for _, instance := range instances {
+		if expiryDays[instance.Name], err = cfg.InstanceExpiryDays(instance, cfg.ExpiryDays); err != nil {
+			return nil, err
+		}
 	}
-	cleanup.addDirectory(destPath, p.deleteDirectory)
 
-	if err := p.tar(destPath, tarfilePath); err != nil {
-		return err
+	return func(s storage.Storage) int {
+		if s == tierSource {
+			return cfg.TierAfterDays
+		}
+		return expiryDays[storage.StorageName(s)]
+	}, nil
+}
+
+// logAuditReport logs every inconsistent backup and a summary, and returns how
+// many backups are inconsistent.
+func logAuditReport(entries []storage.AuditEntry, names map[storage.Storage]string) int {
+	var gaps, sizeMismatches, checksumMismatches int
+	for _, entry := range entries {
+		if entry.Consistent() {
+			continue
+		}
+
+		problems := make([]string, 0, 3)
+		if len(entry.Missing) > 0 {
+			gaps++
+			missing := make([]string, 0, len(entry.Missing))
+			for _, s := range entry.Missing {
+				missing = append(missing, names[s])
+			}
+			problems = append(problems, "missing on "+strings.Join(missing, ", "))
+		}
+		if entry.SizeMismatch || entry.ChecksumMismatch {
+			copies := make([]string, 0, len(entry.Copies))
+			for _, backupCopy := range entry.Copies {
+				detail := fmt.Sprintf("%s: %d bytes", names[backupCopy.Storage], backupCopy.Size)
+				if backupCopy.SHA256 != "" {
+					detail += ", sha256 " + backupCopy.SHA256
+				}
+				copies = append(copies, detail)
+			}
+			kind := "size mismatch"
+			if entry.SizeMismatch {
+				sizeMismatches++
+			} else {
+				kind = "checksum mismatch"
+				checksumMismatches++
+			}
+			problems = append(problems, fmt.Sprintf("%s (%s)", kind, strings.Join(copies, "; ")))
+		}
+		mlog.Logvf(mlog.Always, "Audit: %s %s", entry.Filename, strings.Join(problems, "; "))
 	}
-	cleanup.addFile(tarfilePath, p.deleteFile)
 
-	objectName, err := p.buildObjectName(cfg.BackupPrefix, filename)
+	inconsistent := 0
+	for _, entry := range entries {
+		if !entry.Consistent() {
+			inconsistent++
+		}
+	}
+	mlog.Logvf(mlog.Always, "Audited %d backup(s) across %d backend(s): %d gap(s), %d size mismatch(es), %d checksum mismatch(es)", len(entries), len(names), gaps, sizeMismatches, checksumMismatches)
+	return inconsistent
+}
+
+// pin pins or unpins every copy of the backups named by --pin-objects.
+func (p archivePipeline) pin(ctx context.Context, cfg *mongoarchive.Config, pinned bool) (retErr error) {
+	storageBackends, err := p.getStorages(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if closeErr := closeStorages(storageBackends); closeErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
+		}
+	}()
+
+	names := make(map[storage.Storage]string, len(storageBackends))
+	for i, s := range storageBackends {
+		names[s] = describeStorageBackend(i, s)
+	}
+
+	var results []storage.PinResult
+	action := "Unpinned"
+	if pinned {
+		action = "Pinned"
+		results, err = storage.PinBackups(ctx, storageBackends, cfg.GetPinObjects(), cfg.PinReason)
+	} else {
+		results, err = storage.UnpinBackups(ctx, storageBackends, cfg.GetPinObjects())
+	}
+	for _, result := range results {
+		mlog.Logvf(mlog.Always, "%s %s on %s", action, result.Object, names[result.Storage])
+	}
+	return err
+}
 
-	if err := p.upload(ctx, storageBackends, objectName, tarfilePath); err != nil {
+// list logs the backups held by every configured backend, newest first, and
+// why each pinned backup is pinned.
+func (p archivePipeline) list(ctx context.Context, cfg *mongoarchive.Config) (retErr error) {
+	storageBackends, err := p.getStorages(ctx, cfg)
+	if err != nil {
 		return err
 	}
+	defer func() {
+		if closeErr := closeStorages(storageBackends); closeErr != nil {
+			retErr = joinPrimaryAndCleanupErrors(retErr, closeErr)
+		}
+	}()
+
+	var listErrors []error
+	for i, s := range storageBackends {
+		backendName := describeStorageBackend(i, s)
+		backups, err := storage.ListPinnedBackups(ctx, s)
+		if err != nil {
+			listErrors = append(listErrors, err)
+			continue
+		}
+
+		pinned := 0
+		for _, backup := range backups {
+			detail := ""
+			if backup.Pinned {
+				pinned++
+				detail = ", pinned: " + backup.PinReason
+			}
+			mlog.Logvf(mlog.Always, "Backup on %s: %s (%d bytes, modified %s%s)", backendName, backup.Name, backup.Size, backup.ModifiedAt.UTC().Format(time.RFC3339), detail)
+		}
+		mlog.Logvf(mlog.Always, "Found %d backup(s) on %s, %d pinned", len(backups), backendName, pinned)
+	}
+	return errors.Join(listErrors...)
+}
 
-	return nil
+func (p archivePipeline) discardExpiredPendingArchive() (*storage.ReclaimedUpload, error) {
+	pending, err := p.pending.Load()
+	if err != nil || pending == nil || !p.pending.Expired(pending) {
+		return nil, err
+	}
+
+	reclaimed := &storage.ReclaimedUpload{Object: pending.ObjectName, Detail: "expired pending archive " + pending.Path}
+	if info, err := os.Stat(pending.Path); err == nil {
+		reclaimed.Bytes = info.Size()
+	}
+	if err := p.pending.Clear(); err != nil {
+		return nil, fmt.Errorf("failed to discard expired pending archive: %w", err)
+	}
+	mlog.Logvf(mlog.Always, "Janitor discarded %s (%d bytes)", reclaimed.Detail, reclaimed.Bytes)
+	return reclaimed, nil
 }
 
 func (r cronRuntime) run(ctx context.Context, cfg *mongoarchive.Config) error {
@@ -244,13 +1116,6 @@ func (r cronRuntime) run(ctx context.Context, cfg *mongoarchive.Config) error {
 		return fmt.Errorf("invalid timezone location")
 	}
 
-	exp := cfg.GetCronExpression()
-	if exp == "" {
-		return fmt.Errorf("empty cron expression")
-	}
-
-	mlog.Logvf(mlog.Always, "Using Cron Expression: %v", exp)
-
 	s, err := r.newScheduler(loc)
 	if err != nil {
 		return fmt.Errorf("failed to create scheduler: %w", err)
@@ -261,19 +1126,58 @@ func (r cronRuntime) run(ctx context.Context, cfg *mongoarchive.Config) error {
 		}
 	}()
 
-	err = s.Schedule(exp, func() {
-		startTime := r.now()
-		mlog.Logvf(mlog.Always, "Task started at: %v", startTime)
+	// Runs outlive the termination signal by up to the grace period, so they
+	// get a context that only the shutdown cancels.
+	runCtx, abort := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer abort(nil)
+	controller := &cronController{
+		runtime:   r,
+		runCtx:    runCtx,
+		notifyCtx: context.WithoutCancel(ctx),
+		inFlight:  newCronDrain(),
+		// slots limits how many jobs run at the same time; a job waits for a
+		// free slot rather than skipping its run.
+		slots: make(chan struct{}, max(cfg.MaxConcurrentJobs, 1)),
+		loc:   loc,
+	}
+	for _, job := range cfg.GetJobs() {
+		runs := job.GetSchedules()
+		j, err := controller.addJob(job, runs)
+		if err != nil {
+			return err
+		}
+		startup, err := r.startupRun(job, runs, loc)
+		if err != nil {
+			return err
+		}
+		for i, sched := range j.schedules {
+			run := sched.run
+			mlog.Logvf(mlog.Always, "%s: using Cron Expression: %v", taskName(run), sched.expression)
+			if lastSuccess, err := r.state.LastSuccess(run); err == nil {
+				r.metrics.restoreLastSuccess(run, lastSuccess)
+			}
+
+			err := s.Schedule(sched.expression, func() { controller.runScheduled(j, i) }, cronSkipOverlappingRuns, run == startup)
+			if err != nil {
+				return fmt.Errorf("failed to schedule %s: %w", strings.ToLower(taskName(run)), err)
+			}
+			if sched.schedule, err = cron.ParseStandard(sched.expression); err != nil {
+				return fmt.Errorf("failed to schedule %s: %w", strings.ToLower(taskName(run)), err)
+			}
+		}
+	}
 
-		if err := r.runTask(ctx, cfg); err != nil {
-			mlog.Logvf(mlog.Always, "Task failed: %v", err)
-			r.notify(ctx, cfg, false, err.Error())
-		} else {
-			mlog.Logvf(mlog.Always, "Task completed successfully at: %v (Duration: %v)", r.now(), r.now().Sub(startTime))
+	controller.health.start(r.now())
+	if cfg.HTTPListen != "" {
+		if err := s.Schedule(heartbeatExpression, func() { controller.health.beat(r.now()) }, cronSkipOverlappingRuns, false); err != nil {
+			return fmt.Errorf("failed to schedule the scheduler heartbeat: %w", err)
 		}
-	}, cronSkipOverlappingRuns)
-	if err != nil {
-		return fmt.Errorf("failed to schedule job: %w", err)
+		stopControl, err := controller.serveControl(cfg.HTTPListen, cfg.HTTPToken)
+		if err != nil {
+			return err
+		}
+		defer stopControl()
+		go controller.checkReadiness(cfg)
 	}
 
 	s.Start()
@@ -282,20 +1186,281 @@ func (r cronRuntime) run(ctx context.Context, cfg *mongoarchive.Config) error {
 
 	r.waitForShutdown()
 	mlog.Logvf(mlog.Always, "Shutting down scheduler...")
+	r.drain(controller.inFlight, abort, cfg.ShutdownGracePeriod)
+	return nil
+}
+
+// drain stops new runs and waits for the runs in flight. Runs still going
+// after the grace period are aborted, and get abortCleanupTimeout to clean up
+// and report their partial state.
+func (r cronRuntime) drain(inFlight *cronDrain, abort context.CancelCauseFunc, grace time.Duration) {
+	done := inFlight.drain()
+	select {
+	case <-done:
+		return
+	default:
+	}
+
+	mlog.Logvf(mlog.Always, "Waiting up to %v for runs in flight to finish...", grace)
+	select {
+	case <-done:
+		mlog.Logvf(mlog.Always, "Runs in flight finished.")
+		return
+	case <-r.after(grace):
+	}
+
+	mlog.Logvf(mlog.Always, "Shutdown grace period of %v elapsed; aborting runs in flight.", grace)
+	abort(&runAbortError{reason: fmt.Sprintf("run aborted at shutdown after the grace period of %v", grace)})
+	select {
+	case <-done:
+		mlog.Logvf(mlog.Always, "Aborted runs cleaned up.")
+	case <-r.after(abortCleanupTimeout):
+		mlog.Logvf(mlog.Always, "Runs still in flight %v after they were aborted; exiting without their cleanup.", abortCleanupTimeout)
+	}
+}
+
+// attempt runs one attempt of a scheduled run once a slot is free, or nothing
+// when the shutdown starts first. The slot is held only while the attempt
+// runs, not while a retry waits.
+func (r cronRuntime) attempt(ctx context.Context, run *mongoarchive.Config, slots chan struct{}, stopping <-chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+	case <-stopping:
+		return nil
+	}
+	defer func() { <-slots }()
+
+	startTime := r.now()
+	mlog.Logvf(mlog.Always, "%s started at: %v", taskName(run), startTime)
+
+	if err := r.runTask(ctx, run); err != nil {
+		mlog.Logvf(mlog.Always, "%s failed: %v", taskName(run), err)
+		return err
+	}
+	mlog.Logvf(mlog.Always, "%s completed successfully at: %v (Duration: %v)", taskName(run), r.now(), r.now().Sub(startTime))
+	if err := r.state.RecordSuccess(run, startTime); err != nil {
+		mlog.Logvf(mlog.Always, "%s: %v", taskName(run), err)
+	}
+	return nil
+}
+
+// startupRun returns the run of job that starts as soon as the scheduler
+// starts, or nil. Under the missed policy, a run is due when its schedule
+// fired since its last recorded success, or when no success is recorded. Of
+// several due runs, only the one that keeps its backups longest starts, as
+// when schedules coincide.
+func (r cronRuntime) startupRun(job *mongoarchive.Config, runs []*mongoarchive.Config, loc *time.Location) (*mongoarchive.Config, error) {
+	var startup *mongoarchive.Config
+	for _, run := range runs {
+		switch job.StartupRun {
+		case mongoarchive.StartupRunAlways:
+		case mongoarchive.StartupRunMissed:
+			missed, err := r.missedRun(run, loc)
+			if err != nil {
+				return nil, err
+			}
+			if !missed {
+				continue
+			}
+		default:
+			return nil, nil
+		}
+		if startup == nil || mongoarchive.KeepsLonger(run.ExpiryDays, startup.ExpiryDays) {
+			startup = run
+		}
+	}
+	if startup != nil {
+		mlog.Logvf(mlog.Always, "%s: running at startup (startup-run=%s)", taskName(startup), job.StartupRun)
+	}
+	return startup, nil
+}
+
+func (r cronRuntime) missedRun(run *mongoarchive.Config, loc *time.Location) (bool, error) {
+	lastSuccess, err := r.state.LastSuccess(run)
+	if err != nil {
+		// A damaged record must not keep the scheduler from starting.
+		mlog.Logvf(mlog.Always, "%s: %v", taskName(run), err)
+		return false, nil
+	}
+	if lastSuccess.IsZero() {
+		return true, nil
+	}
+	exp, err := jobCronExpression(run, loc)
+	if err != nil {
+		return false, err
+	}
+	schedule, err := cron.ParseStandard(exp)
+	if err != nil {
+		return false, fmt.Errorf("failed to schedule %s: %w", strings.ToLower(taskName(run)), err)
+	}
+	return !schedule.Next(lastSuccess.In(loc)).After(r.now()), nil
+}
+
+// jobCronExpression returns the cron expression of job. A job whose time zone
+// differs from the scheduler's, or any job when schedulerLoc is nil, gets a
+// CRON_TZ prefix so that it still fires in its own time zone.
+func jobCronExpression(job *mongoarchive.Config, schedulerLoc *time.Location) (string, error) {
+	exp := job.GetCronExpression()
+	if exp == "" {
+		return "", fmt.Errorf("empty cron expression")
+	}
+	loc := job.GetLocation()
+	if loc == nil {
+		return "", fmt.Errorf("invalid timezone location")
+	}
+	if (schedulerLoc == nil || loc.String() != schedulerLoc.String()) && !strings.HasPrefix(exp, "CRON_TZ=") && !strings.HasPrefix(exp, "TZ=") {
+		exp = "CRON_TZ=" + loc.String() + " " + exp
+	}
+	return exp, nil
+}
+
+// taskName names a run in log lines: "Task" for a single configuration, or
+// the job's name for a job of --jobs-file, followed by the backup tier.
+func taskName(cfg *mongoarchive.Config) string {
+	name := "Task"
+	if cfg.JobName != "" {
+		name = "Job " + cfg.JobName
+	}
+	if cfg.BackupTier != "" {
+		name += " (" + cfg.BackupTier + ")"
+	}
+	return name
+}
+
+// tierSchedules decides which of a job's schedules runs when several are due
+// in the same minute: the one that keeps its backups longest, or the first
+// listed among equals. The others skip that minute, because running them
+// would dump the same source twice at once.
+type tierSchedules struct {
+	runs      []*mongoarchive.Config
+	schedules []cron.Schedule
+}
+
+func newTierSchedules(runs []*mongoarchive.Config) (*tierSchedules, error) {
+	tiers := &tierSchedules{runs: runs}
+	if len(runs) < 2 {
+		return tiers, nil
+	}
+	for _, run := range runs {
+		exp, err := jobCronExpression(run, nil)
+		if err != nil {
+			return nil, err
+		}
+		schedule, err := cron.ParseStandard(exp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to schedule %s: %w", strings.ToLower(taskName(run)), err)
+		}
+		tiers.schedules = append(tiers.schedules, schedule)
+	}
+	return tiers, nil
+}
+
+// supersededBy returns the run that takes the place of run i at now, or nil
+// when run i should go ahead.
+func (t *tierSchedules) supersededBy(i int, now time.Time) *mongoarchive.Config {
+	if t.schedules == nil {
+		return nil
+	}
+	minute := now.Truncate(time.Minute)
+	for j, other := range t.runs {
+		if j == i || !t.schedules[j].Next(minute.Add(-time.Second)).Equal(minute) {
+			continue
+		}
+		if mongoarchive.KeepsLonger(other.ExpiryDays, t.runs[i].ExpiryDays) || (other.ExpiryDays == t.runs[i].ExpiryDays && j < i) {
+			return other
+		}
+	}
 	return nil
 }
 
+// runJobs runs every job once, one after another, taking one schedule of each
+// as OneShotRun picks it. A failed job is reported and does not stop the jobs
+// after it.
+func runJobs(ctx context.Context, cfg *mongoarchive.Config, run func(context.Context, *mongoarchive.Config) error, notify func(context.Context, *mongoarchive.Config, bool, string)) error {
+	var errs []error
+	for _, job := range cfg.GetJobs() {
+		scheduled := job.OneShotRun()
+		if scheduled == nil {
+			continue
+		}
+		if err := run(ctx, scheduled); err != nil {
+			notify(ctx, scheduled, false, err.Error())
+			if scheduled.JobName != "" {
+				err = fmt.Errorf("job %s: %w", scheduled.JobName, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func createArchiveWorkspace() (string, error) {
+	return utils.CreateOwnedWorkspace(archiveBasePath(), workspacePattern)
+}
+
+func archiveBasePath() string {
 	basePath := os.Getenv(envPrefix + "DUMP_PATH")
 	if basePath == "" {
 		basePath = filepath.Join(os.TempDir(), defaultWorkspaceDir)
 	}
+	return basePath
+}
 
-	if err := os.MkdirAll(basePath, 0o700); err != nil {
-		return "", err
+// cleanStaleWorkspaces runs at startup; failures are logged so that a
+// leftover directory never blocks a backup.
+func cleanStaleWorkspaces(basePath string, minAge time.Duration) {
+	workspaces, err := utils.CleanStaleWorkspaces(basePath, workspacePattern, minAge, time.Now())
+	logReclaimedWorkspaces(workspaces)
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Failed to clean stale workspaces: %v", err)
+	}
+}
+
+func logReclaimedWorkspaces(workspaces []utils.ReclaimedWorkspace) {
+	for _, workspace := range workspaces {
+		mlog.Logvf(mlog.Always, "Janitor removed workspace %s (%d bytes): %s", workspace.Path, workspace.Bytes, workspace.Reason)
+	}
+}
+
+func reclaimUploadsBeforeRun(ctx context.Context, storages []storage.Storage) {
+	minAge, err := readPositiveDurationEnv(envPrefix+"JANITOR_MIN_AGE", utils.DefaultJanitorMinAge)
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Skipping abandoned upload cleanup: %v", err)
+		return
+	}
+	if _, err := reclaimAbandonedUploads(ctx, storages, minAge); err != nil {
+		mlog.Logvf(mlog.Always, "Failed to reclaim abandoned uploads: %v", err)
+	}
+}
+
+// reclaimAbandonedUploads aborts incomplete uploads under the backup prefix on
+// every backend that can hold them.
+func reclaimAbandonedUploads(ctx context.Context, storages []storage.Storage, minAge time.Duration) ([]storage.ReclaimedUpload, error) {
+	reclaimed := make([]storage.ReclaimedUpload, 0)
+	var reclaimErrors []error
+	for i, s := range storages {
+		janitor, ok := s.(storage.UploadJanitor)
+		if !ok {
+			continue
+		}
+
+		backendName := describeStorageBackend(i, s)
+		opCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+		if err != nil {
+			return reclaimed, err
+		}
+		uploads, err := janitor.ReclaimAbandonedUploads(opCtx, minAge)
+		cancel()
+		for _, upload := range uploads {
+			mlog.Logvf(mlog.Always, "Janitor reclaimed %s on %s (%d bytes): %s", upload.Object, backendName, upload.Bytes, upload.Detail)
+		}
+		reclaimed = append(reclaimed, uploads...)
+		if err != nil {
+			reclaimErrors = append(reclaimErrors, fmt.Errorf("failed to reclaim abandoned uploads on %s: %w", backendName, err))
+		}
 	}
 
-	return os.MkdirTemp(basePath, "run-")
+	return reclaimed, errors.Join(reclaimErrors...)
 }
 
 func newMongoDumpRunner(options []string) (archiveDump, func(), error) {
@@ -329,11 +1494,14 @@ func newGocronScheduler(loc *time.Location) (cronScheduler, error) {
 	return &gocronScheduler{scheduler: scheduler}, nil
 }
 
-func (s *gocronScheduler) Schedule(expression string, task func(), overlap cronOverlapPolicy) error {
+func (s *gocronScheduler) Schedule(expression string, task func(), overlap cronOverlapPolicy, startImmediately bool) error {
 	jobOptions := []gocron.JobOption{}
 	if overlap == cronSkipOverlappingRuns {
 		jobOptions = append(jobOptions, gocron.WithSingletonMode(gocron.LimitModeReschedule))
 	}
+	if startImmediately {
+		jobOptions = append(jobOptions, gocron.WithStartAt(gocron.WithStartImmediately()))
+	}
 
 	_, err := s.scheduler.NewJob(gocron.CronJob(expression, false), gocron.NewTask(task), jobOptions...)
 	return err
@@ -379,11 +1547,66 @@ func (e *multiBackendArchiveError) Unwrap() error {
 	return e.cause
 }
 
+func newCronDrain() *cronDrain {
+	return &cronDrain{stopping: make(chan struct{})}
+}
+
+// enter registers a run, unless the drain has started.
+func (d *cronDrain) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return false
+	}
+	d.runs.Add(1)
+	return true
+}
+
+func (d *cronDrain) leave() {
+	d.runs.Done()
+}
+
+func (d *cronDrain) draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopped
+}
+
+// drain stops new runs and returns a channel that is closed once the runs in
+// flight have finished.
+func (d *cronDrain) drain() <-chan struct{} {
+	d.mu.Lock()
+	if !d.stopped {
+		d.stopped = true
+		close(d.stopping)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.runs.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (e *runAbortError) Error() string {
+	return e.reason
+}
+
+func (e *archiveUploadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *archiveUploadError) Unwrap() error {
+	return e.err
+}
+
 func closeStorages(storages []storage.Storage) error {
 	var closeErrors []error
 	for _, storageBackend := range storages {
 		if err := storageBackend.Close(); err != nil {
-			closeErrors = append(closeErrors, fmt.Errorf("close %T: %w", storageBackend, err))
+			closeErrors = append(closeErrors, fmt.Errorf("close %s: %w", storage.StorageName(storageBackend), err))
 		}
 	}
 
@@ -405,46 +1628,58 @@ func uploadBackupToStorages(ctx context.Context, storages []storage.Storage, obj
 		return uploadBackupToSingleStorage(ctx, storages, objectName, tarfilePath)
 	}
 
+	metrics := runMetricsFrom(ctx)
+	endUpload := metrics.stage(stageUpload)
 	uploadedBackends := make([]string, 0, len(storages))
+	uploadedStorages := make([]storage.Storage, 0, len(storages))
 	for i, s := range storages {
 		backendName := describeStorageBackend(i, s)
 		uploadCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
 		if err != nil {
 			return err
 		}
-		result, err := s.Upload(uploadCtx, objectName, tarfilePath)
+		result, err := s.Upload(uploadCtx, storage.BackendObjectName(s, objectName), tarfilePath)
 		cancel()
 		if err != nil {
+			endUpload(err)
 			partialState := "before any backend upload completed"
 			if len(uploadedBackends) > 0 {
 				partialState = "after successful uploads to " + formatCompletedBackends(uploadedBackends, "none")
 			}
-			return &multiBackendArchiveError{
-				message: fmt.Sprintf(
-					"archive upload failed %s; retention was not run on any backend: failed to upload to %s: %v",
-					partialState,
-					backendName,
-					err,
-				),
-				cause: err,
+			return &archiveUploadError{
+				uploaded: uploadedStorages,
+				err: &multiBackendArchiveError{
+					message: fmt.Sprintf(
+						"archive upload failed %s; retention was not run on any backend: failed to upload to %s: %v",
+						partialState,
+						backendName,
+						err,
+					),
+					cause: err,
+				},
 			}
 		}
 		uploadedBackends = append(uploadedBackends, backendName)
+		uploadedStorages = append(uploadedStorages, s)
+		metrics.uploaded(s, tarfilePath)
 		mlog.Logvf(mlog.Always, "Successfully uploaded backup to %s: %v", backendName, result)
 	}
+	endUpload(nil)
 
 	mlog.Logvf(mlog.Always, "Verified archive upload across %d storage backends; starting retention.", len(uploadedBackends))
 
+	endRetention := metrics.stage(stageRetention)
 	retainedBackends := make([]string, 0, len(storages))
 	for i, s := range storages {
 		backendName := describeStorageBackend(i, s)
-		deleteCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+		deleteCtx, cancel, err := operationContext(metrics.retention(ctx, s), envPrefix+"STORAGE_OPERATION_TIMEOUT")
 		if err != nil {
 			return err
 		}
-		err = s.DeleteOldObjects(deleteCtx, objectName)
+		err = s.DeleteOldObjects(deleteCtx, storage.BackendObjectName(s, objectName))
 		cancel()
 		if err != nil {
+			endRetention(err)
 			return &multiBackendArchiveError{
 				message: fmt.Sprintf(
 					"archive retention failed after successful retention on %s; archive upload completed on all configured backends: failed to delete old objects in %s: %v",
@@ -457,31 +1692,38 @@ func uploadBackupToStorages(ctx context.Context, storages []storage.Storage, obj
 		}
 		retainedBackends = append(retainedBackends, backendName)
 	}
+	endRetention(nil)
 
 	return nil
 }
 
 func uploadBackupToSingleStorage(ctx context.Context, storages []storage.Storage, objectName string, tarfilePath string) error {
+	metrics := runMetricsFrom(ctx)
 	for _, s := range storages {
 		uploadCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
 		if err != nil {
 			return err
 		}
-		result, err := s.Upload(uploadCtx, objectName, tarfilePath)
+		endUpload := metrics.stage(stageUpload)
+		result, err := s.Upload(uploadCtx, storage.BackendObjectName(s, objectName), tarfilePath)
 		cancel()
+		endUpload(err)
 		if err != nil {
-			return fmt.Errorf("failed to upload to %T: %w", s, err)
+			return &archiveUploadError{err: fmt.Errorf("failed to upload to %s: %w", storage.StorageName(s), err)}
 		}
-		mlog.Logvf(mlog.Always, "Successfully uploaded backup to %T: %v", s, result)
+		metrics.uploaded(s, tarfilePath)
+		mlog.Logvf(mlog.Always, "Successfully uploaded backup to %s: %v", storage.StorageName(s), result)
 
-		deleteCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+		deleteCtx, cancel, err := operationContext(metrics.retention(ctx, s), envPrefix+"STORAGE_OPERATION_TIMEOUT")
 		if err != nil {
 			return err
 		}
-		err = s.DeleteOldObjects(deleteCtx, objectName)
+		endRetention := metrics.stage(stageRetention)
+		err = s.DeleteOldObjects(deleteCtx, storage.BackendObjectName(s, objectName))
 		cancel()
+		endRetention(err)
 		if err != nil {
-			return fmt.Errorf("failed to delete old objects in %T: %w", s, err)
+			return fmt.Errorf("failed to delete old objects in %s: %w", storage.StorageName(s), err)
 		}
 	}
 
@@ -489,7 +1731,7 @@ func uploadBackupToSingleStorage(ctx context.Context, storages []storage.Storage
 }
 
 func describeStorageBackend(index int, storageBackend storage.Storage) string {
-	return fmt.Sprintf("backend #%d (%T)", index+1, storageBackend)
+	return fmt.Sprintf("backend #%d (%s)", index+1, storage.StorageName(storageBackend))
 }
 
 func formatCompletedBackends(backends []string, empty string) string {
@@ -539,6 +1781,22 @@ func operationContext(ctx context.Context, envKey string) (context.Context, cont
 	return opCtx, cancel, nil
 }
 
+func readPositiveDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a valid duration: %w", key, err)
+	}
+	if parsed <= 0 {
+		return 0, fmt.Errorf("%s must be greater than zero", key)
+	}
+	return parsed, nil
+}
+
 func storageContextOrBackground(ctx context.Context) context.Context {
 	if ctx != nil {
 		return ctx
@@ -7,11 +7,14 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/egose/database-tools/internal/toolconfig"
 	"github.com/egose/database-tools/mongoarchive"
 	"github.com/egose/database-tools/storage"
 	"github.com/egose/database-tools/utils"
@@ -83,9 +86,10 @@ func (s *blockingArchiveStorage) DeleteOldObjects(context.Context, string) error
 func (s *blockingArchiveStorage) Close() error { return nil }
 
 type fakeArchiveDump struct {
-	initErr error
-	dumpErr error
-	onDump  func()
+	initErr     error
+	dumpErr     error
+	onDump      func()
+	interrupted chan struct{}
 }
 
 func (d *fakeArchiveDump) Init() error {
@@ -99,20 +103,27 @@ func (d *fakeArchiveDump) Dump() error {
 	return d.dumpErr
 }
 
-func (d *fakeArchiveDump) HandleInterrupt() {}
+func (d *fakeArchiveDump) HandleInterrupt() {
+	if d.interrupted != nil {
+		close(d.interrupted)
+	}
+}
 
 type fakeCronScheduler struct {
-	expression  string
-	overlap     cronOverlapPolicy
-	task        func()
-	running     atomic.Bool
+	jobs        []*fakeCronJob
 	scheduleErr error
 }
 
-func (s *fakeCronScheduler) Schedule(expression string, task func(), overlap cronOverlapPolicy) error {
-	s.expression = expression
-	s.task = task
-	s.overlap = overlap
+type fakeCronJob struct {
+	expression       string
+	overlap          cronOverlapPolicy
+	startImmediately bool
+	task             func()
+	running          atomic.Bool
+}
+
+func (s *fakeCronScheduler) Schedule(expression string, task func(), overlap cronOverlapPolicy, startImmediately bool) error {
+	s.jobs = append(s.jobs, &fakeCronJob{expression: expression, task: task, overlap: overlap, startImmediately: startImmediately})
 	return s.scheduleErr
 }
 
@@ -123,6 +134,10 @@ func (s *fakeCronScheduler) Shutdown() error {
 }
 
 func (s *fakeCronScheduler) trigger() {
+	s.jobs[0].trigger()
+}
+
+func (s *fakeCronJob) trigger() {
 	if s.task == nil {
 		return
 	}
@@ -153,6 +168,35 @@ func TestUploadBackupToStoragesUploadsBeforeRetention(t *testing.T) {
 	}
 }
 
+func TestUploadBackupToStoragesUsesEachBackendPrefix(t *testing.T) {
+	fast, cold := &storage.LocalStorage{InstanceName: "fast"}, &storage.LocalStorage{InstanceName: "cold"}
+	if err := fast.Init(t.TempDir(), 0, "fast"); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if err := cold.Init(t.TempDir(), 0, "cold"); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	filename, _ := utils.GetNewFilename()
+	archivePath := filepath.Join(t.TempDir(), filename)
+	if err := os.WriteFile(archivePath, []byte("archive"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := uploadBackupToStorages(context.Background(), []storage.Storage{fast, cold}, storage.DefaultBackupPrefix+filename, archivePath); err != nil {
+		t.Fatalf("uploadBackupToStorages() error = %v", err)
+	}
+
+	for _, s := range []*storage.LocalStorage{fast, cold} {
+		latest, err := s.GetTargetObjectName(context.Background(), "")
+		if err != nil {
+			t.Fatalf("%s GetTargetObjectName() error = %v", s.InstanceName, err)
+		}
+		if want := s.ManagedPrefix() + filename; latest != want {
+			t.Fatalf("%s latest backup = %q, want %q", s.InstanceName, latest, want)
+		}
+	}
+}
+
 func TestUploadBackupToStoragesSkipsRetentionAfterUploadFailure(t *testing.T) {
 	backend := &recordingStorage{uploadErr: errors.New("upload failed")}
 	objectName := "mongo-archive/9987654320999-2026-08-12T010203.456Z.tar.gz"
@@ -268,7 +312,9 @@ func TestArchivePipelinePropagatesCancellationToUpload(t *testing.T) {
 	started := make(chan struct{}, 1)
 	pipeline := archivePipeline{
 		createWorkspace: func() (string, error) { return t.TempDir(), nil },
-		newFilename:     func() (string, string) { return "backup.tar.gz", "dumpdir" },
+		newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+			return "backup.tar.gz", nil
+		},
 		newDump: func([]string) (archiveDump, func(), error) {
 			return &fakeArchiveDump{}, func() {}, nil
 		},
@@ -276,7 +322,7 @@ func TestArchivePipelinePropagatesCancellationToUpload(t *testing.T) {
 			return []storage.Storage{&recordingStorage{}}, nil
 		},
 		tar:             func(string, string) error { return nil },
-		buildObjectName: func(string, string) (string, error) { return "backup.tar.gz", nil },
+		buildObjectName: func(string, *storage.NameTemplate, string) (string, error) { return "backup.tar.gz", nil },
 		upload: func(ctx context.Context, _ []storage.Storage, _ string, _ string) error {
 			started <- struct{}{}
 			<-ctx.Done()
@@ -364,8 +410,8 @@ func TestArchivePipelineCleanupByStage(t *testing.T) {
 					workspace, err = os.MkdirTemp(root, "run-")
 					return workspace, err
 				},
-				newFilename: func() (string, string) {
-					return "backup.tar.gz", "dumpdir"
+				newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+					return "backup.tar.gz", nil
 				},
 				newDump: func(options []string) (archiveDump, func(), error) {
 					dumpDir = archiveOutPath(t, options)
@@ -395,7 +441,7 @@ func TestArchivePipelineCleanupByStage(t *testing.T) {
 					}
 					return tt.tarErr
 				},
-				buildObjectName: func(string, string) (string, error) {
+				buildObjectName: func(string, *storage.NameTemplate, string) (string, error) {
 					return "backup.tar.gz", nil
 				},
 				upload: func(context.Context, []storage.Storage, string, string) error {
@@ -423,6 +469,749 @@ func TestArchivePipelineCleanupByStage(t *testing.T) {
 	}
 }
 
+func TestArchivePipelineTiersAgingBackupsAfterUpload(t *testing.T) {
+	newLocal := func(name string, prefix string, expiryDays int) *storage.LocalStorage {
+		s := &storage.LocalStorage{InstanceName: name}
+		if err := s.Init(t.TempDir(), expiryDays, prefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	}
+	hot, cold := newLocal("hot", "hot", 0), newLocal("cold", "cold", 30)
+
+	aging, _ := utils.GetFilenameAt(time.Now().Add(-10 * 24 * time.Hour))
+	expired, _ := utils.GetFilenameAt(time.Now().Add(-40 * 24 * time.Hour))
+	for _, upload := range []struct {
+		s    *storage.LocalStorage
+		name string
+		age  time.Duration
+	}{
+		{s: hot, name: "hot/" + aging, age: 10 * 24 * time.Hour},
+		{s: cold, name: "cold/" + expired, age: 40 * 24 * time.Hour},
+	} {
+		archivePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+		if err := os.WriteFile(archivePath, []byte("archive"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		objectPath, err := upload.s.Upload(context.Background(), upload.name, archivePath)
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		modifiedAt := time.Now().Add(-upload.age)
+		if err := os.Chtimes(objectPath, modifiedAt, modifiedAt); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+
+	filename, _ := utils.GetNewFilename()
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(t.TempDir(), "run-") },
+		newFilename:     func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) { return filename, nil },
+		newDump: func([]string) (archiveDump, func(), error) {
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{hot, cold}, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: storage.BuildBackupObjectName,
+		upload:          uploadBackupToStorages,
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+	}
+	cfg := &mongoarchive.Config{TieringOptions: mongoarchive.TieringOptions{TierSource: "hot", TierTarget: "cold", TierAfterDays: 7}}
+
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		s    *storage.LocalStorage
+		want []string
+	}{
+		{s: hot, want: []string{"hot/" + filename}},
+		{s: cold, want: []string{"cold/" + aging}},
+	} {
+		backups, err := tt.s.ListBackups(context.Background())
+		if err != nil {
+			t.Fatalf("%s ListBackups() error = %v", tt.s.InstanceName, err)
+		}
+		got := make([]string, 0, len(backups))
+		for _, backup := range backups {
+			got = append(got, backup.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s backups = %v, want %v", tt.s.InstanceName, got, tt.want)
+		}
+	}
+}
+
+func TestArchivePipelinePinsBackupsAgainstRetention(t *testing.T) {
+	newLocal := func(name string, prefix string) *storage.LocalStorage {
+		s := &storage.LocalStorage{InstanceName: name}
+		if err := s.Init(t.TempDir(), 1, prefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	}
+	primary, offsite := newLocal("primary", "nightly"), newLocal("offsite", "replica")
+
+	expired, _ := utils.GetFilenameAt(time.Now().Add(-10 * 24 * time.Hour))
+	for _, upload := range []struct {
+		s    *storage.LocalStorage
+		name string
+	}{
+		{s: primary, name: "nightly/" + expired},
+		{s: offsite, name: "replica/" + expired},
+	} {
+		archivePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+		if err := os.WriteFile(archivePath, []byte("archive"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		objectPath, err := upload.s.Upload(context.Background(), upload.name, archivePath)
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		modifiedAt := time.Now().Add(-10 * 24 * time.Hour)
+		if err := os.Chtimes(objectPath, modifiedAt, modifiedAt); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+
+	filename, _ := utils.GetNewFilename()
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(t.TempDir(), "run-") },
+		newFilename:     func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) { return filename, nil },
+		newDump: func([]string) (archiveDump, func(), error) {
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{primary, offsite}, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: storage.BuildBackupObjectName,
+		upload:          uploadBackupToStorages,
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+	}
+
+	cfg := &mongoarchive.Config{PinOptions: mongoarchive.PinOptions{PinObjects: expired, PinReason: "before migration"}}
+	if err := pipeline.pin(context.Background(), cfg, true); err != nil {
+		t.Fatalf("pin() error = %v", err)
+	}
+	cfg = &mongoarchive.Config{PinOptions: mongoarchive.PinOptions{Pin: true, PinReason: "release 1.2"}}
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		s      *storage.LocalStorage
+		object string
+		reason string
+	}{
+		{s: primary, object: "nightly/" + expired, reason: "before migration"},
+		{s: offsite, object: "replica/" + expired, reason: "before migration"},
+		{s: primary, object: "nightly/" + filename, reason: "release 1.2"},
+		{s: offsite, object: "replica/" + filename, reason: "release 1.2"},
+	} {
+		if reason, ok, err := tt.s.ObjectPin(context.Background(), tt.object); err != nil || !ok || reason != tt.reason {
+			t.Fatalf("ObjectPin(%q) = %q, %v, %v, want %q, true, nil", tt.object, reason, ok, err, tt.reason)
+		}
+	}
+	if err := pipeline.list(context.Background(), cfg); err != nil {
+		t.Fatalf("list() error = %v", err)
+	}
+
+	cfg = &mongoarchive.Config{PinOptions: mongoarchive.PinOptions{PinObjects: expired}}
+	if err := pipeline.pin(context.Background(), cfg, false); err != nil {
+		t.Fatalf("pin() unpin error = %v", err)
+	}
+	if err := primary.DeleteOldObjects(context.Background(), ""); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	backups, err := primary.ListBackups(context.Background())
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != 1 || backups[0].Name != "nightly/"+filename {
+		t.Fatalf("primary backups after unpinning = %+v, want only nightly/%s", backups, filename)
+	}
+}
+
+func TestArchivePipelineNamesBackupsWithTemplate(t *testing.T) {
+	cfg := &mongoarchive.Config{
+		MongoOptions:   toolconfig.MongoOptions{DB: "app"},
+		StorageOptions: toolconfig.StorageOptions{BackupPrefix: "nightly", BackupNameTemplate: "{db}/{utc}-{seq}"},
+	}
+	nameTemplate, err := cfg.NameTemplate()
+	if err != nil {
+		t.Fatalf("NameTemplate() error = %v", err)
+	}
+	local := &storage.LocalStorage{NameTemplate: nameTemplate}
+	if err := local.Init(t.TempDir(), 0, "nightly"); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	legacy, _ := utils.GetFilenameAt(time.Now().Add(-48 * time.Hour))
+	previous, err := nameTemplate.Name(storage.NameValues{DB: "app", Time: time.Now().Add(-24 * time.Hour), Seq: 4})
+	if err != nil {
+		t.Fatalf("Name() error = %v", err)
+	}
+	for _, name := range []string{legacy, previous} {
+		archivePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+		if err := os.WriteFile(archivePath, []byte("archive"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		if _, err := local.Upload(context.Background(), "nightly/"+name, archivePath); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+	}
+
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(t.TempDir(), "run-") },
+		newFilename:     newBackupName,
+		newDump: func([]string) (archiveDump, func(), error) {
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{local}, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: storage.BuildBackupObjectName,
+		upload:          uploadBackupToStorages,
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+	}
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	latest, err := local.GetTargetObjectName(context.Background(), "")
+	if err != nil {
+		t.Fatalf("GetTargetObjectName() error = %v", err)
+	}
+	if !strings.HasPrefix(latest, "nightly/app/") || !strings.HasSuffix(latest, "-000005.tar.gz") {
+		t.Fatalf("GetTargetObjectName() = %q, want nightly/app/<utc>-000005.tar.gz", latest)
+	}
+	backups, err := local.ListBackups(context.Background())
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("ListBackups() = %+v, want the legacy, previous and new backups", backups)
+	}
+}
+
+func TestArchivePipelineSkipsRunWhileAnotherProcessHoldsTheLock(t *testing.T) {
+	local := &storage.LocalStorage{}
+	if err := local.Init(t.TempDir(), 0, "nightly"); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	cfg := &mongoarchive.Config{JobName: "app", LockOptions: mongoarchive.LockOptions{Lock: true, LockTTL: time.Minute}}
+	held, err := storage.AcquireLock(context.Background(), local, cfg.LockName(), storage.LockOptions{Holder: "other-replica", TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	filename, _ := utils.GetNewFilename()
+	dumps := 0
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(t.TempDir(), "run-") },
+		newFilename:     func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) { return filename, nil },
+		newDump: func([]string) (archiveDump, func(), error) {
+			dumps++
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{local}, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: storage.BuildBackupObjectName,
+		upload:          uploadBackupToStorages,
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+	}
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() while locked error = %v", err)
+	}
+	if dumps != 0 {
+		t.Fatalf("dumps while locked = %d, want 0", dumps)
+	}
+
+	if err := held.Release(context.Background()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if dumps != 1 {
+		t.Fatalf("dumps after release = %d, want 1", dumps)
+	}
+	// The run released its lease, so the next process takes the lock at once.
+	next, err := storage.AcquireLock(context.Background(), local, cfg.LockName(), storage.LockOptions{Holder: "other-replica", TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("AcquireLock() after run error = %v", err)
+	}
+	if err := next.Release(context.Background()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestArchivePipelineAbortsRunsThatExceedTheirLimit(t *testing.T) {
+	local := &storage.LocalStorage{}
+	if err := local.Init(t.TempDir(), 0, "nightly"); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	filename, _ := utils.GetNewFilename()
+	uploads := 0
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(t.TempDir(), "run-") },
+		newFilename:     func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) { return filename, nil },
+		newDump: func([]string) (archiveDump, func(), error) {
+			dump := &fakeArchiveDump{interrupted: make(chan struct{}), dumpErr: errors.New("dump interrupted")}
+			dump.onDump = func() {
+				select {
+				case <-dump.interrupted:
+				case <-time.After(5 * time.Second):
+				}
+			}
+			return dump, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{local}, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: storage.BuildBackupObjectName,
+		upload: func(context.Context, []storage.Storage, string, string) error {
+			uploads++
+			return nil
+		},
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+	}
+
+	cfg := &mongoarchive.Config{RunLimitOptions: mongoarchive.RunLimitOptions{MaxRunDuration: 50 * time.Millisecond}}
+	err := pipeline.run(context.Background(), cfg)
+	var abortErr *runAbortError
+	if !errors.As(err, &abortErr) || !strings.Contains(err.Error(), "run aborted after the maximum run duration of 50ms: dump interrupted") {
+		t.Fatalf("run() error = %v, want the run limit and the dump error", err)
+	}
+	if uploads != 0 {
+		t.Fatalf("uploads = %d, want 0", uploads)
+	}
+
+	// A run window that is closed now refuses the run before it dumps.
+	closed := time.Now().UTC().Add(2 * time.Hour)
+	window := &mongoarchive.RunWindow{Start: closed.Hour()*60 + closed.Minute(), End: (closed.Hour()*60 + closed.Minute() + 60) % (24 * 60)}
+	cfg = &mongoarchive.Config{
+		ScheduleOptions: mongoarchive.ScheduleOptions{Location: time.UTC},
+		RunLimitOptions: mongoarchive.RunLimitOptions{RunWindow: window},
+	}
+	if err := pipeline.run(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "outside the run window") {
+		t.Fatalf("run() outside the window error = %v, want a refusal", err)
+	}
+}
+
+// otherRecordingStorage is a recordingStorage with a storage name of its own.
+type otherRecordingStorage struct {
+	recordingStorage
+}
+
+func TestArchivePipelineResumesPendingArchiveAfterUploadFailure(t *testing.T) {
+	root := t.TempDir()
+	callLog := []string{}
+	first := &recordingStorage{name: "first", callLog: &callLog}
+	second := &otherRecordingStorage{recordingStorage{name: "second", callLog: &callLog, uploadErr: errors.New("connection reset")}}
+	storages := []storage.Storage{first, second}
+	filenames := []string{"first.tar.gz", "second.tar.gz"}
+	notified := []string{}
+
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(root, "run-") },
+		newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+			filename := filenames[0]
+			filenames = filenames[1:]
+			return filename, nil
+		},
+		newDump: func([]string) (archiveDump, func(), error) {
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return storages, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: func(_ string, _ *storage.NameTemplate, filename string) (string, error) { return filename, nil },
+		upload:          uploadBackupToStorages,
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify: func(_ context.Context, _ *mongoarchive.Config, success bool, filename string) {
+			if success {
+				notified = append(notified, filename)
+			}
+		},
+		pending: mongoarchive.NewPendingArchiveStore(filepath.Join(root, "pending"), time.Hour),
+	}
+
+	if err := pipeline.run(context.Background(), &mongoarchive.Config{}); err == nil {
+		t.Fatal("run() expected upload failure")
+	}
+	pending, err := pipeline.pending.Load()
+	if err != nil || pending == nil {
+		t.Fatalf("Load() = %v, %v, want pending archive", pending, err)
+	}
+	if want := []string{"*main.recordingStorage"}; !reflect.DeepEqual(pending.Uploaded, want) {
+		t.Fatalf("pending.Uploaded = %#v, want %#v", pending.Uploaded, want)
+	}
+	assertPathState(t, pending.Path, true)
+
+	// The resume matches the backends by name, not by their position.
+	second.uploadErr = nil
+	storages = []storage.Storage{second, first}
+	callLog = nil
+	if err := pipeline.run(context.Background(), &mongoarchive.Config{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	want := []string{
+		"second:upload:first.tar.gz",
+		"second:delete:first.tar.gz",
+		"second:upload:second.tar.gz",
+		"first:upload:second.tar.gz",
+		"second:delete:second.tar.gz",
+		"first:delete:second.tar.gz",
+	}
+	if !reflect.DeepEqual(callLog, want) {
+		t.Fatalf("run() call log = %#v, want %#v", callLog, want)
+	}
+	if want := []string{"first.tar.gz", "second.tar.gz"}; !reflect.DeepEqual(notified, want) {
+		t.Fatalf("notified = %#v, want %#v", notified, want)
+	}
+	assertPathState(t, filepath.Join(root, "pending"), false)
+}
+
+func TestArchivePipelineDumpsWhenThePendingArchiveCannotBeResumed(t *testing.T) {
+	root := t.TempDir()
+	store := mongoarchive.NewPendingArchiveStore(filepath.Join(root, "pending"), time.Hour)
+	archivePath := filepath.Join(root, "stuck.tar.gz")
+	if err := os.WriteFile(archivePath, []byte("tar"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := store.Save(mongoarchive.PendingArchive{ObjectName: "stuck.tar.gz", Filename: "stuck.tar.gz"}, archivePath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	uploaded := []string{}
+	var uploadErr error
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(root, "run-") },
+		newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+			return "fresh.tar.gz", nil
+		},
+		newDump: func([]string) (archiveDump, func(), error) {
+			return &fakeArchiveDump{}, func() {}, nil
+		},
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{&recordingStorage{}}, nil
+		},
+		tar: func(_ string, destination string) error {
+			return os.WriteFile(destination, []byte("tar"), 0o600)
+		},
+		buildObjectName: func(_ string, _ *storage.NameTemplate, filename string) (string, error) { return filename, nil },
+		upload: func(_ context.Context, _ []storage.Storage, objectName string, _ string) error {
+			if objectName == "stuck.tar.gz" {
+				return &archiveUploadError{err: errors.New("backend unreachable")}
+			}
+			if uploadErr != nil {
+				return uploadErr
+			}
+			uploaded = append(uploaded, objectName)
+			return nil
+		},
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+		notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
+		pending:         store,
+	}
+
+	if err := pipeline.run(context.Background(), &mongoarchive.Config{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if want := []string{"fresh.tar.gz"}; !reflect.DeepEqual(uploaded, want) {
+		t.Fatalf("uploaded = %#v, want %#v", uploaded, want)
+	}
+	pending, err := store.Load()
+	if err != nil || pending == nil || pending.ObjectName != "stuck.tar.gz" {
+		t.Fatalf("Load() = %+v, %v, want the pending archive kept", pending, err)
+	}
+	assertPathState(t, pending.Path, true)
+
+	// A new archive that fails to upload does not replace the one kept
+	// before; the run's failure reports that it was discarded instead.
+	stuckPath := pending.Path
+	uploadErr = &archiveUploadError{err: errors.New("backend unreachable")}
+	err = pipeline.run(context.Background(), &mongoarchive.Config{})
+	if err == nil || !strings.Contains(err.Error(), "archive fresh.tar.gz was discarded: pending archive stuck.tar.gz still awaits upload") {
+		t.Fatalf("run() error = %v, want the new archive reported as discarded", err)
+	}
+	pending, err = store.Load()
+	if err != nil || pending == nil || pending.ObjectName != "stuck.tar.gz" || pending.Path != stuckPath {
+		t.Fatalf("Load() = %+v, %v, want the earlier archive kept", pending, err)
+	}
+	assertPathState(t, stuckPath, true)
+	assertPathState(t, filepath.Join(store.Dir, "fresh.tar.gz"), false)
+
+	// Once the earlier archive has expired, a new one takes its place.
+	store.MaxAge = time.Nanosecond
+	if err := pipeline.run(context.Background(), &mongoarchive.Config{}); err == nil {
+		t.Fatal("run() expected upload failure")
+	}
+	pending, err = store.Load()
+	if err != nil || pending == nil || pending.ObjectName != "fresh.tar.gz" {
+		t.Fatalf("Load() = %+v, %v, want the new archive kept", pending, err)
+	}
+	assertPathState(t, pending.Path, true)
+	assertPathState(t, stuckPath, false)
+}
+
+func TestArchivePipelineDiscardsExpiredPendingArchive(t *testing.T) {
+	root := t.TempDir()
+	store := mongoarchive.NewPendingArchiveStore(filepath.Join(root, "pending"), time.Hour)
+	archivePath := filepath.Join(root, "stale.tar.gz")
+	if err := os.WriteFile(archivePath, []byte("tar"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := store.Save(mongoarchive.PendingArchive{ObjectName: "stale.tar.gz", CreatedAt: time.Now().Add(-2 * time.Hour)}, archivePath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	backend := &recordingStorage{}
+	pipeline := archivePipeline{pending: store, upload: uploadBackupToStorages}
+	if err := pipeline.resumePendingArchive(context.Background(), &mongoarchive.Config{}, []storage.Storage{backend}); err != nil {
+		t.Fatalf("resumePendingArchive() error = %v", err)
+	}
+
+	if len(backend.calls) != 0 {
+		t.Fatalf("resumePendingArchive() calls = %#v, want none", backend.calls)
+	}
+	assertPathState(t, filepath.Join(root, "pending"), false)
+}
+
+type janitorStorage struct {
+	recordingStorage
+	olderThan time.Duration
+	reclaimed []storage.ReclaimedUpload
+}
+
+func (s *janitorStorage) ReclaimAbandonedUploads(_ context.Context, olderThan time.Duration) ([]storage.ReclaimedUpload, error) {
+	s.olderThan = olderThan
+	return s.reclaimed, nil
+}
+
+func TestArchivePipelineJanitorReclaimsLeftovers(t *testing.T) {
+	root := t.TempDir()
+	live, err := utils.CreateOwnedWorkspace(root, workspacePattern)
+	if err != nil {
+		t.Fatalf("CreateOwnedWorkspace() error = %v", err)
+	}
+	stale := filepath.Join(root, "run-stale")
+	if err := os.MkdirAll(stale, 0o700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	store := mongoarchive.NewPendingArchiveStore(filepath.Join(root, "pending"), time.Hour)
+	archivePath := filepath.Join(root, "stale.tar.gz")
+	if err := os.WriteFile(archivePath, []byte("tar"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := store.Save(mongoarchive.PendingArchive{ObjectName: "stale.tar.gz", CreatedAt: old}, archivePath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	backend := &janitorStorage{reclaimed: []storage.ReclaimedUpload{{Object: "mongo-archive/abandoned.tar.gz", Bytes: 42}}}
+	plain := &recordingStorage{}
+	pipeline := archivePipeline{
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{backend, plain}, nil
+		},
+		pending: store,
+	}
+
+	if err := pipeline.janitor(context.Background(), &mongoarchive.Config{}, root, 24*time.Hour); err != nil {
+		t.Fatalf("janitor() error = %v", err)
+	}
+
+	if backend.olderThan != 24*time.Hour {
+		t.Fatalf("ReclaimAbandonedUploads() olderThan = %v, want 24h", backend.olderThan)
+	}
+	if len(plain.calls) != 0 {
+		t.Fatalf("janitor() calls = %#v, want none", plain.calls)
+	}
+	assertPathState(t, stale, false)
+	assertPathState(t, live, true)
+	assertPathState(t, filepath.Join(root, "pending"), false)
+}
+
+func TestArchivePipelineCopyReplicatesBackupsToOtherBackends(t *testing.T) {
+	newLocal := func(name string, prefix string) *storage.LocalStorage {
+		s := &storage.LocalStorage{InstanceName: name}
+		if err := s.Init(t.TempDir(), 0, prefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	}
+	primary := newLocal("primary", "nightly")
+	offsite := newLocal("offsite", "replica")
+	spare := newLocal("spare", "")
+
+	filename, _ := utils.GetNewFilename()
+	archivePath := filepath.Join(t.TempDir(), filename)
+	if err := os.WriteFile(archivePath, []byte("archive"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := primary.Upload(context.Background(), "nightly/"+filename, archivePath); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	workspace := filepath.Join(t.TempDir(), "run-copy")
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return workspace, os.MkdirAll(workspace, 0o700) },
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{primary, offsite, spare}, nil
+		},
+		deleteDirectory: utils.DeleteDirectory,
+	}
+	cfg := &mongoarchive.Config{CopyOptions: mongoarchive.CopyOptions{CopySource: "primary", CopyTargets: "offsite"}}
+
+	if err := pipeline.copy(context.Background(), cfg); err != nil {
+		t.Fatalf("copy() error = %v", err)
+	}
+	if got, err := offsite.GetTargetObjectName(context.Background(), ""); err != nil || got != "replica/"+filename {
+		t.Fatalf("GetTargetObjectName() on offsite = %q, %v, want replica/%s", got, err, filename)
+	}
+	if got, err := spare.GetTargetObjectName(context.Background(), ""); err == nil {
+		t.Fatalf("GetTargetObjectName() on spare = %q, want no copy on an unselected backend", got)
+	}
+	assertPathState(t, workspace, false)
+
+	cfg.CopyTargets = "primary"
+	if err := pipeline.copy(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "is the copy source") {
+		t.Fatalf("copy() error = %v, want the source rejected as a target", err)
+	}
+}
+
+func TestArchivePipelineMigrateMovesLegacyBackups(t *testing.T) {
+	root := t.TempDir()
+	backend := &storage.LocalStorage{}
+	if err := backend.Init(root, 0, ""); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	filename, _ := utils.GetNewFilename()
+	if err := os.WriteFile(filepath.Join(root, filename), []byte("legacy"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	workspace := filepath.Join(t.TempDir(), "run-migrate")
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return workspace, os.MkdirAll(workspace, 0o700) },
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{backend}, nil
+		},
+		deleteDirectory: utils.DeleteDirectory,
+	}
+	cfg := &mongoarchive.Config{MigrateOptions: mongoarchive.MigrateOptions{MigrateMove: true, DryRun: true}}
+
+	if err := pipeline.migrate(context.Background(), cfg); err != nil {
+		t.Fatalf("migrate() dry run error = %v", err)
+	}
+	assertPathState(t, filepath.Join(root, filename), true)
+	assertPathState(t, filepath.Join(root, "mongo-archive", filename), false)
+
+	cfg.DryRun = false
+	if err := pipeline.migrate(context.Background(), cfg); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+	assertPathState(t, filepath.Join(root, filename), false)
+	if got, err := backend.GetTargetObjectName(context.Background(), ""); err != nil || got != "mongo-archive/"+filename {
+		t.Fatalf("GetTargetObjectName() = %q, %v, want the migrated backup", got, err)
+	}
+	assertPathState(t, workspace, false)
+}
+
+func TestArchivePipelineAuditRepairsGaps(t *testing.T) {
+	newLocal := func(name string) *storage.LocalStorage {
+		s := &storage.LocalStorage{InstanceName: name}
+		if err := s.Init(t.TempDir(), 0, ""); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	}
+	primary, offsite := newLocal("primary"), newLocal("offsite")
+
+	filename, _ := utils.GetNewFilename()
+	archivePath := filepath.Join(t.TempDir(), filename)
+	if err := os.WriteFile(archivePath, []byte("archive"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := primary.Upload(context.Background(), "mongo-archive/"+filename, archivePath); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	workspace := filepath.Join(t.TempDir(), "run-audit")
+	pipeline := archivePipeline{
+		createWorkspace: func() (string, error) { return workspace, os.MkdirAll(workspace, 0o700) },
+		getStorages: func(context.Context, *mongoarchive.Config) ([]storage.Storage, error) {
+			return []storage.Storage{primary, offsite}, nil
+		},
+		deleteDirectory: utils.DeleteDirectory,
+	}
+	cfg := &mongoarchive.Config{AuditOptions: mongoarchive.AuditOptions{AuditChecksums: true}}
+
+	if err := pipeline.audit(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "1 inconsistent backup") {
+		t.Fatalf("audit() error = %v, want one inconsistent backup", err)
+	}
+
+	cfg.Repair = true
+	if err := pipeline.audit(context.Background(), cfg); err != nil {
+		t.Fatalf("audit() with repair error = %v", err)
+	}
+	if got, err := offsite.GetTargetObjectName(context.Background(), ""); err != nil || got != "mongo-archive/"+filename {
+		t.Fatalf("GetTargetObjectName() on offsite = %q, %v, want the repaired backup", got, err)
+	}
+
+	cfg.Repair = false
+	if err := pipeline.audit(context.Background(), cfg); err != nil {
+		t.Fatalf("audit() after repair error = %v", err)
+	}
+	assertPathState(t, workspace, false)
+}
+
 func TestArchivePipelineAggregatesCleanupFailure(t *testing.T) {
 	primaryErr := errors.New("upload failed")
 	cleanupErr := errors.New("remove tar failed")
@@ -433,8 +1222,8 @@ func TestArchivePipelineAggregatesCleanupFailure(t *testing.T) {
 		createWorkspace: func() (string, error) {
 			return os.MkdirTemp(root, "run-")
 		},
-		newFilename: func() (string, string) {
-			return "backup.tar.gz", "dumpdir"
+		newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+			return "backup.tar.gz", nil
 		},
 		newDump: func(options []string) (archiveDump, func(), error) {
 			dumpDir := archiveOutPath(t, options)
@@ -451,7 +1240,7 @@ func TestArchivePipelineAggregatesCleanupFailure(t *testing.T) {
 			tarFile = destination
 			return os.WriteFile(destination, []byte("tar"), 0o600)
 		},
-		buildObjectName: func(string, string) (string, error) {
+		buildObjectName: func(string, *storage.NameTemplate, string) (string, error) {
 			return "backup.tar.gz", nil
 		},
 		upload: func(context.Context, []storage.Storage, string, string) error {
@@ -490,8 +1279,8 @@ func TestArchivePipelineSkipsSuccessNotificationAfterCloseFailure(t *testing.T)
 		createWorkspace: func() (string, error) {
 			return os.MkdirTemp(root, "run-")
 		},
-		newFilename: func() (string, string) {
-			return "backup.tar.gz", "dumpdir"
+		newFilename: func(context.Context, *mongoarchive.Config, []storage.Storage) (string, error) {
+			return "backup.tar.gz", nil
 		},
 		newDump: func(options []string) (archiveDump, func(), error) {
 			dumpDir := archiveOutPath(t, options)
@@ -507,7 +1296,7 @@ func TestArchivePipelineSkipsSuccessNotificationAfterCloseFailure(t *testing.T)
 		tar: func(_ string, destination string) error {
 			return os.WriteFile(destination, []byte("tar"), 0o600)
 		},
-		buildObjectName: func(string, string) (string, error) {
+		buildObjectName: func(string, *storage.NameTemplate, string) (string, error) {
 			return "backup.tar.gz", nil
 		},
 		upload: func(context.Context, []storage.Storage, string, string) error {
@@ -582,6 +1371,7 @@ func TestCronRuntimeReturnsSetupErrors(t *testing.T) {
 			notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
 			waitForShutdown: func() {},
 			now:             time.Now,
+			after:           time.After,
 		}
 
 		err := runtime.run(context.Background(), &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{Location: nil, CronExpression: "* * * * *"}})
@@ -600,6 +1390,7 @@ func TestCronRuntimeReturnsSetupErrors(t *testing.T) {
 			notify:          func(context.Context, *mongoarchive.Config, bool, string) {},
 			waitForShutdown: func() {},
 			now:             time.Now,
+			after:           time.After,
 		}
 
 		err := runtime.run(context.Background(), &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{Location: time.UTC, CronExpression: "bad cron"}})
@@ -645,14 +1436,15 @@ func TestCronRuntimeSkipsOverlappingRuns(t *testing.T) {
 		now: func() time.Time {
 			return time.Unix(0, 0)
 		},
+		after: time.After,
 	}
 
 	err := runtime.run(context.Background(), &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{Location: time.UTC, CronExpression: "* * * * *"}})
 	if err != nil {
 		t.Fatalf("run() error = %v", err)
 	}
-	if scheduler.overlap != cronSkipOverlappingRuns {
-		t.Fatalf("overlap policy = %q, want %q", scheduler.overlap, cronSkipOverlappingRuns)
+	if scheduler.jobs[0].overlap != cronSkipOverlappingRuns {
+		t.Fatalf("overlap policy = %q, want %q", scheduler.jobs[0].overlap, cronSkipOverlappingRuns)
 	}
 	if runs.Load() != 1 {
 		t.Fatalf("run count = %d, want 1", runs.Load())
@@ -662,6 +1454,426 @@ func TestCronRuntimeSkipsOverlappingRuns(t *testing.T) {
 	}
 }
 
+func TestCronRuntimeSchedulesEveryJobWithinTheConcurrencyLimit(t *testing.T) {
+	scheduler := &fakeCronScheduler{}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+	cfg := &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{Location: time.UTC, MaxConcurrentJobs: 2}}
+	for _, job := range []struct {
+		name string
+		loc  *time.Location
+	}{{name: "orders", loc: time.UTC}, {name: "users", loc: berlin}, {name: "events", loc: time.UTC}} {
+		cfg.Jobs = append(cfg.Jobs, &mongoarchive.Config{
+			JobName:         job.name,
+			ScheduleOptions: mongoarchive.ScheduleOptions{Location: job.loc, CronExpression: "0 1 * * *"},
+		})
+	}
+
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	var concurrent atomic.Int32
+	var maxConcurrent atomic.Int32
+	runtime := cronRuntime{
+		newScheduler: func(*time.Location) (cronScheduler, error) {
+			return scheduler, nil
+		},
+		runTask: func(_ context.Context, job *mongoarchive.Config) error {
+			current := concurrent.Add(1)
+			if current > maxConcurrent.Load() {
+				maxConcurrent.Store(current)
+			}
+			started <- job.JobName
+			<-release
+			concurrent.Add(-1)
+			return nil
+		},
+		notify: func(context.Context, *mongoarchive.Config, bool, string) {},
+		waitForShutdown: func() {
+			for _, job := range scheduler.jobs {
+				job.trigger()
+			}
+			<-started
+			<-started
+			select {
+			case name := <-started:
+				t.Errorf("job %s started while two jobs were running", name)
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+			<-started
+		},
+		now:   time.Now,
+		after: time.After,
+	}
+
+	if err := runtime.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	expressions := make([]string, 0, len(scheduler.jobs))
+	for _, job := range scheduler.jobs {
+		expressions = append(expressions, job.expression)
+	}
+	if want := []string{"0 1 * * *", "CRON_TZ=Europe/Berlin 0 1 * * *", "0 1 * * *"}; !slices.Equal(expressions, want) {
+		t.Fatalf("scheduled expressions = %v, want %v", expressions, want)
+	}
+	if maxConcurrent.Load() != 2 {
+		t.Fatalf("max concurrent jobs = %d, want 2", maxConcurrent.Load())
+	}
+}
+
+func TestCronRuntimeRunsTheLongestKeptTierWhenSchedulesCoincide(t *testing.T) {
+	scheduler := &fakeCronScheduler{}
+	cfg := &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{
+		Cron:     true,
+		Location: time.UTC,
+		Schedules: []mongoarchive.Schedule{
+			{Name: "hourly", CronExpression: "0 * * * *", ExpiryDays: 2},
+			{Name: "daily", CronExpression: "0 2 * * *", ExpiryDays: 60},
+		},
+	}}
+	now := time.Date(2026, 1, 2, 2, 0, 0, 500000000, time.UTC)
+
+	ran := make(chan string, 4)
+	runtime := cronRuntime{
+		newScheduler: func(*time.Location) (cronScheduler, error) {
+			return scheduler, nil
+		},
+		runTask: func(_ context.Context, run *mongoarchive.Config) error {
+			ran <- fmt.Sprintf("%s:%d", run.BackupTier, run.ExpiryDays)
+			return nil
+		},
+		notify: func(context.Context, *mongoarchive.Config, bool, string) {},
+		waitForShutdown: func() {
+			// Both schedules are due at 02:00, only the hourly one at 03:00.
+			for _, phase := range []struct {
+				at   time.Time
+				jobs []*fakeCronJob
+			}{{at: now, jobs: scheduler.jobs}, {at: now.Add(time.Hour), jobs: scheduler.jobs[:1]}} {
+				now = phase.at
+				for _, job := range phase.jobs {
+					job.trigger()
+				}
+				for _, job := range phase.jobs {
+					for job.running.Load() {
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}
+		},
+		now: func() time.Time {
+			return now
+		},
+		after: time.After,
+	}
+
+	if err := runtime.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	close(ran)
+	var runs []string
+	for run := range ran {
+		runs = append(runs, run)
+	}
+	if want := []string{"daily:60", "hourly:2"}; !slices.Equal(runs, want) {
+		t.Fatalf("runs = %v, want %v", runs, want)
+	}
+	if len(scheduler.jobs) != 2 || scheduler.jobs[0].expression != "0 * * * *" || scheduler.jobs[1].expression != "0 2 * * *" {
+		t.Fatalf("scheduled jobs = %+v, want one per schedule", scheduler.jobs)
+	}
+}
+
+func TestCronRuntimeRetriesFailedRunsBeforeTheNextRun(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		failures  int
+		wantRuns  int
+		wantFinal string
+	}{
+		{name: "recovers", failures: 1, wantRuns: 2},
+		// Retries at 10:10 and 10:30; one at 11:10 would pass the 10:45 deadline.
+		{name: "gives up at the deadline", failures: 5, wantRuns: 3, wantFinal: "failed permanently after 3 attempt(s): dump failed"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := &fakeCronScheduler{}
+			var mu sync.Mutex
+			clock := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+			now := func() time.Time {
+				mu.Lock()
+				defer mu.Unlock()
+				return clock
+			}
+			var runs int
+			var messages []string
+			done := make(chan struct{})
+			runtime := cronRuntime{
+				newScheduler: func(*time.Location) (cronScheduler, error) {
+					return scheduler, nil
+				},
+				runTask: func(context.Context, *mongoarchive.Config) error {
+					if runs++; runs <= tt.failures {
+						return errors.New("dump failed")
+					}
+					close(done)
+					return nil
+				},
+				notify: func(_ context.Context, _ *mongoarchive.Config, success bool, message string) {
+					messages = append(messages, message)
+					if strings.HasPrefix(message, "failed permanently") {
+						close(done)
+					}
+				},
+				waitForShutdown: func() {
+					scheduler.trigger()
+					<-done
+				},
+				now: now,
+				after: func(d time.Duration) <-chan time.Time {
+					mu.Lock()
+					defer mu.Unlock()
+					clock = clock.Add(d)
+					ready := make(chan time.Time, 1)
+					ready <- clock
+					return ready
+				},
+			}
+
+			cfg := &mongoarchive.Config{
+				ScheduleOptions: mongoarchive.ScheduleOptions{Location: time.UTC, CronExpression: "0 * * * *"},
+				RetryOptions:    mongoarchive.RetryOptions{RetryMaxAttempts: 5, RetryBackoff: 10 * time.Minute, RetryDeadline: 15 * time.Minute},
+			}
+			if err := runtime.run(context.Background(), cfg); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if runs != tt.wantRuns {
+				t.Fatalf("runs = %d, want %d", runs, tt.wantRuns)
+			}
+			retries := tt.wantRuns - 1
+			if tt.wantFinal != "" {
+				if last := messages[len(messages)-1]; last != tt.wantFinal {
+					t.Fatalf("final notification = %q, want %q", last, tt.wantFinal)
+				}
+				messages = messages[:len(messages)-1]
+			}
+			if len(messages) != retries {
+				t.Fatalf("notifications = %q, want %d retry notices", messages, retries)
+			}
+			if want := "failed, will retry (attempt 1 of 5, next attempt at 2026-01-01T10:10:00Z): dump failed"; messages[0] != want {
+				t.Fatalf("first notification = %q, want %q", messages[0], want)
+			}
+		})
+	}
+}
+
+func TestCronRuntimeRunsMissedSchedulesAtStartup(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 5, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name        string
+		policy      string
+		lastHourly  time.Time
+		lastDaily   time.Time
+		wantStartup string
+	}{
+		{name: "never", policy: mongoarchive.StartupRunNever, wantStartup: ""},
+		{name: "always", policy: mongoarchive.StartupRunAlways, lastHourly: now, lastDaily: now, wantStartup: "daily"},
+		{name: "nothing recorded", policy: mongoarchive.StartupRunMissed, wantStartup: "daily"},
+		{name: "both missed", policy: mongoarchive.StartupRunMissed, lastHourly: now.Add(-2 * time.Hour), lastDaily: now.Add(-32 * time.Hour), wantStartup: "daily"},
+		{name: "hourly missed", policy: mongoarchive.StartupRunMissed, lastHourly: now.Add(-65 * time.Minute), lastDaily: now.Add(-8 * time.Hour), wantStartup: "hourly"},
+		{name: "nothing missed", policy: mongoarchive.StartupRunMissed, lastHourly: now.Add(-5 * time.Minute), lastDaily: now.Add(-8 * time.Hour), wantStartup: ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{
+				Cron:       true,
+				Location:   time.UTC,
+				StartupRun: tt.policy,
+				Schedules: []mongoarchive.Schedule{
+					{Name: "hourly", CronExpression: "0 * * * *", ExpiryDays: 2},
+					{Name: "daily", CronExpression: "0 2 * * *", ExpiryDays: 60},
+				},
+			}}
+			state := mongoarchive.NewRunStateStore(t.TempDir())
+			runs := cfg.GetSchedules()
+			for i, last := range []time.Time{tt.lastHourly, tt.lastDaily} {
+				if last.IsZero() {
+					continue
+				}
+				if err := state.RecordSuccess(runs[i], last); err != nil {
+					t.Fatalf("RecordSuccess() error = %v", err)
+				}
+			}
+
+			scheduler := &fakeCronScheduler{}
+			var ran []string
+			runtime := cronRuntime{
+				newScheduler: func(*time.Location) (cronScheduler, error) {
+					return scheduler, nil
+				},
+				runTask: func(_ context.Context, run *mongoarchive.Config) error {
+					ran = append(ran, run.BackupTier)
+					return nil
+				},
+				notify: func(context.Context, *mongoarchive.Config, bool, string) {},
+				waitForShutdown: func() {
+					for _, job := range scheduler.jobs {
+						if job.startImmediately {
+							job.task()
+						}
+					}
+				},
+				now:   func() time.Time { return now },
+				state: state,
+				after: time.After,
+			}
+			if err := runtime.run(context.Background(), cfg); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			startup := ""
+			for i, job := range scheduler.jobs {
+				if job.startImmediately {
+					if startup != "" {
+						t.Fatalf("both schedules start immediately")
+					}
+					startup = runs[i].BackupTier
+				}
+			}
+			if startup != tt.wantStartup {
+				t.Fatalf("startup run = %q, want %q", startup, tt.wantStartup)
+			}
+			if startup == "" {
+				return
+			}
+			if !reflect.DeepEqual(ran, []string{startup}) {
+				t.Fatalf("runs = %q, want %q", ran, startup)
+			}
+			run := runs[slices.IndexFunc(runs, func(run *mongoarchive.Config) bool { return run.BackupTier == startup })]
+			if last, err := state.LastSuccess(run); err != nil || !last.Equal(now) {
+				t.Fatalf("LastSuccess(%s) = %v, %v, want %v", startup, last, err, now)
+			}
+		})
+	}
+}
+
+func TestCronRuntimeDrainsRunsInFlightAtShutdown(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		graceExpiry bool
+		wantNotice  string
+	}{
+		{name: "run finishes within the grace period"},
+		{name: "grace period runs out", graceExpiry: true, wantNotice: "run aborted at shutdown after the grace period of 1m0s: upload cancelled"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := &fakeCronScheduler{}
+			started := make(chan struct{})
+			release := make(chan struct{})
+			var runs atomic.Int32
+			var finished atomic.Bool
+			var notices []string
+			var runErr error
+			runtime := cronRuntime{
+				newScheduler: func(*time.Location) (cronScheduler, error) {
+					return scheduler, nil
+				},
+				runTask: func(ctx context.Context, _ *mongoarchive.Config) error {
+					defer finished.Store(true)
+					runs.Add(1)
+					close(started)
+					select {
+					case <-release:
+						return nil
+					case <-ctx.Done():
+						runErr = context.Cause(ctx)
+						return fmt.Errorf("%w: upload cancelled", runErr)
+					}
+				},
+				notify: func(ctx context.Context, _ *mongoarchive.Config, _ bool, message string) {
+					if ctx.Err() != nil {
+						t.Errorf("notify() context error = %v, want a live context", ctx.Err())
+					}
+					notices = append(notices, message)
+				},
+				waitForShutdown: func() {
+					scheduler.trigger()
+					<-started
+					if !tt.graceExpiry {
+						close(release)
+					}
+				},
+				now: time.Now,
+				after: func(d time.Duration) <-chan time.Time {
+					fired := make(chan time.Time, 1)
+					if d == time.Minute && tt.graceExpiry {
+						fired <- time.Now()
+					}
+					return fired
+				},
+			}
+
+			// The process context is cancelled by the termination signal, but
+			// runs in flight keep going until the grace period runs out.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			cfg := &mongoarchive.Config{ScheduleOptions: mongoarchive.ScheduleOptions{Location: time.UTC, CronExpression: "* * * * *", ShutdownGracePeriod: time.Minute}}
+			if err := runtime.run(ctx, cfg); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if !finished.Load() {
+				t.Fatal("run() returned while a run was in flight")
+			}
+
+			scheduler.jobs[0].task()
+			if runs.Load() != 1 {
+				t.Fatalf("runs = %d, want 1; no run may start after the shutdown", runs.Load())
+			}
+			if tt.wantNotice == "" {
+				if len(notices) != 0 || runErr != nil {
+					t.Fatalf("notices = %q, run error = %v, want a clean finish", notices, runErr)
+				}
+				return
+			}
+			var abortErr *runAbortError
+			if !errors.As(runErr, &abortErr) || !reflect.DeepEqual(notices, []string{tt.wantNotice}) {
+				t.Fatalf("notices = %q, run error = %v, want %q", notices, runErr, tt.wantNotice)
+			}
+		})
+	}
+}
+
+func TestRunJobsRunsEveryJobAndReportsFailures(t *testing.T) {
+	// A job with several schedules still dumps once, for the schedule that
+	// keeps its backups longest.
+	orders := &mongoarchive.Config{JobName: "orders"}
+	orders.Schedules = []mongoarchive.Schedule{
+		{Name: "hourly", CronExpression: "0 * * * *", ExpiryDays: 2},
+		{Name: "daily", CronExpression: "0 2 * * *", ExpiryDays: 60},
+	}
+	cfg := &mongoarchive.Config{Jobs: []*mongoarchive.Config{orders, {JobName: "users"}, {JobName: "events"}}}
+	var ran, failed []string
+	err := runJobs(context.Background(), cfg, func(_ context.Context, job *mongoarchive.Config) error {
+		if job.BackupTier != "" {
+			ran = append(ran, job.JobName+":"+job.BackupTier)
+			return nil
+		}
+		ran = append(ran, job.JobName)
+		if job.JobName == "users" {
+			return errors.New("dump failed")
+		}
+		return nil
+	}, func(_ context.Context, job *mongoarchive.Config, success bool, _ string) {
+		if !success {
+			failed = append(failed, job.JobName)
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "job users: dump failed") {
+		t.Fatalf("runJobs() error = %v, want the users failure", err)
+	}
+	if !slices.Equal(ran, []string{"orders:daily", "users", "events"}) || !slices.Equal(failed, []string{"users"}) {
+		t.Fatalf("ran %v and notified failures for %v, want every job run and users notified", ran, failed)
+	}
+}
+
 func archiveOutPath(t *testing.T, options []string) string {
 	t.Helper()
 	for _, option := range options {
@@ -0,0 +1,129 @@
+package mongoarchive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/egose/database-tools/utils"
+)
+
+const pendingArchiveManifest = "pending.json"
+
+// PendingArchive describes an archive whose upload did not finish. It is kept
+// on disk so that the next run can resume the upload instead of taking a new
+// dump and transferring it from the beginning.
+type PendingArchive struct {
+	ObjectName string    `json:"objectName"`
+	Filename   string    `json:"filename"`
+	Path       string    `json:"path"`
+	Uploaded   []string  `json:"uploaded,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// PendingArchiveStore holds at most one pending archive. Archives older than
+// MaxAge are discarded instead of resumed.
+type PendingArchiveStore struct {
+	Dir    string
+	MaxAge time.Duration
+	now    func() time.Time
+}
+
+func NewPendingArchiveStore(dir string, maxAge time.Duration) *PendingArchiveStore {
+	return &PendingArchiveStore{Dir: dir, MaxAge: maxAge}
+}
+
+func (s *PendingArchiveStore) currentTime() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// Load returns the pending archive, or nil when there is none or the store is
+// not configured.
+func (s *PendingArchiveStore) Load() (*PendingArchive, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	buf, err := os.ReadFile(filepath.Join(s.Dir, pendingArchiveManifest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read pending archive: %w", err)
+	}
+
+	pending := &PendingArchive{}
+	if err := json.Unmarshal(buf, pending); err != nil {
+		return nil, fmt.Errorf("failed to decode pending archive: %w", err)
+	}
+	if pending.ObjectName == "" || pending.Path == "" {
+		return nil, errors.New("pending archive is missing its object name or path")
+	}
+
+	return pending, nil
+}
+
+// Expired reports whether pending is older than the resume window.
+func (s *PendingArchiveStore) Expired(pending *PendingArchive) bool {
+	return s.MaxAge > 0 && s.currentTime().Sub(pending.CreatedAt) > s.MaxAge
+}
+
+// Save moves the archive at archivePath into the store, unless it is already
+// there, and records pending alongside it. An archive kept before is replaced
+// only once it has expired; until then Save fails and leaves it in place.
+func (s *PendingArchiveStore) Save(pending PendingArchive, archivePath string) (*PendingArchive, error) {
+	if s == nil {
+		return nil, errors.New("pending archive store is not configured")
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create pending archive directory: %w", err)
+	}
+
+	previous, _ := s.Load()
+	target := filepath.Join(s.Dir, filepath.Base(archivePath))
+	if previous != nil && filepath.Clean(previous.Path) != target && !s.Expired(previous) {
+		return nil, fmt.Errorf("pending archive %s still awaits upload", previous.ObjectName)
+	}
+	if filepath.Clean(archivePath) != target {
+		if err := os.Rename(archivePath, target); err != nil {
+			return nil, fmt.Errorf("failed to keep archive for retry: %w", err)
+		}
+	}
+
+	pending.Path = target
+	if pending.CreatedAt.IsZero() {
+		pending.CreatedAt = s.currentTime()
+	}
+
+	buf, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pending archive: %w", err)
+	}
+	if err := utils.WriteFileAtomically(filepath.Join(s.Dir, pendingArchiveManifest), func(dest *os.File) error {
+		_, err := dest.Write(buf)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record pending archive: %w", err)
+	}
+	if previous != nil && filepath.Clean(previous.Path) != target && filepath.Dir(filepath.Clean(previous.Path)) == filepath.Clean(s.Dir) {
+		if err := utils.DeleteFile(previous.Path); err != nil {
+			return nil, fmt.Errorf("failed to remove expired pending archive: %w", err)
+		}
+	}
+
+	return &pending, nil
+}
+
+// Clear removes the pending archive and its manifest.
+func (s *PendingArchiveStore) Clear() error {
+	if s == nil {
+		return nil
+	}
+	return utils.DeleteDirectory(s.Dir)
+}
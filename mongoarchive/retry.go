@@ -0,0 +1,68 @@
+package mongoarchive
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryBackoff  = time.Minute
+	defaultRetryDeadline = 5 * time.Minute
+	// maxRetryBackoff caps the doubling delay between retries.
+	maxRetryBackoff = 24 * time.Hour
+)
+
+// RetryOptions retries a failed cron run up to RetryMaxAttempts times in all.
+// The first retry waits RetryBackoff, and each later one twice as long as the
+// one before. No retry starts later than RetryDeadline before the next
+// scheduled run.
+type RetryOptions struct {
+	RetryMaxAttempts int
+	RetryBackoff     time.Duration
+	RetryDeadline    time.Duration
+}
+
+// parseRetryMaxAttempts reads --retry-max-attempts, which defaults to a single
+// attempt.
+func parseRetryMaxAttempts(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 1, nil
+	}
+	attempts, err := strconv.Atoi(raw)
+	if err != nil || attempts <= 0 {
+		return 0, errors.New("retry-max-attempts must be a positive integer")
+	}
+	return attempts, nil
+}
+
+// parseRetryDuration reads a non-negative duration flag, which defaults to
+// fallback.
+func parseRetryDuration(name string, raw string, fallback time.Duration) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration < 0 {
+		return 0, errors.New(name + " must be a non-negative duration")
+	}
+	return duration, nil
+}
+
+// Retries reports whether a failed cron run is retried.
+func (c *Config) Retries() bool {
+	return c.RetryMaxAttempts > 1
+}
+
+// RetryDelay returns how long to wait after the failed attempt before the
+// next one.
+func (c *Config) RetryDelay(attempt int) time.Duration {
+	delay := c.RetryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
@@ -0,0 +1,113 @@
+package mongoarchive
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunLimitOptions bound how long a backup run may take and when it may run.
+// Zero values leave runs unbounded.
+type RunLimitOptions struct {
+	MaxRunDuration time.Duration
+	RunWindow      *RunWindow
+}
+
+// RunWindow is a daily window, in the job's time zone, in which backups may
+// run. A window whose end precedes its start spans midnight.
+type RunWindow struct {
+	// Start and End are minutes since midnight.
+	Start int
+	End   int
+}
+
+// RunLimit is the deadline of a run and why the run stops there.
+type RunLimit struct {
+	Deadline time.Time
+	Reason   string
+}
+
+func parseMaxRunDuration(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration < 0 {
+		return 0, errors.New("max-run-duration must be a non-negative duration")
+	}
+	return duration, nil
+}
+
+// parseRunWindow reads --run-window as HH:MM-HH:MM.
+func parseRunWindow(raw string) (*RunWindow, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("run-window %q must be HH:MM-HH:MM, e.g. 01:00-05:00", raw)
+	rawStart, rawEnd, ok := strings.Cut(raw, "-")
+	if !ok {
+		return nil, invalid
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(rawStart))
+	if err != nil {
+		return nil, invalid
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(rawEnd))
+	if err != nil {
+		return nil, invalid
+	}
+	window := &RunWindow{Start: start.Hour()*60 + start.Minute(), End: end.Hour()*60 + end.Minute()}
+	if window.Start == window.End {
+		return nil, fmt.Errorf("run-window %q must not start and end at the same time", raw)
+	}
+	return window, nil
+}
+
+func (w *RunWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// end returns when the window that holds now closes, or false when now is
+// outside the window.
+func (w *RunWindow) end(now time.Time) (time.Time, bool) {
+	minute := now.Hour()*60 + now.Minute()
+	day := now
+	switch {
+	case w.Start < w.End:
+		if minute < w.Start || minute >= w.End {
+			return time.Time{}, false
+		}
+	case minute >= w.Start:
+		day = now.AddDate(0, 0, 1)
+	case minute >= w.End:
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), w.End/60, w.End%60, 0, 0, now.Location()), true
+}
+
+// RunLimit returns the limit of a run that starts at now: the end of the run
+// window or the maximum run duration, whichever comes first. The deadline is
+// zero for unbounded runs. It fails when now is outside the run window.
+func (c *Config) RunLimit(now time.Time) (RunLimit, error) {
+	limit := RunLimit{}
+	if c.RunWindow != nil {
+		if c.Location != nil {
+			now = now.In(c.Location)
+		}
+		end, ok := c.RunWindow.end(now)
+		if !ok {
+			return RunLimit{}, fmt.Errorf("run refused: %s is outside the run window %s", now.Format("15:04 MST"), c.RunWindow)
+		}
+		limit = RunLimit{Deadline: end, Reason: fmt.Sprintf("run aborted at the end of the run window %s", c.RunWindow)}
+	}
+	if c.MaxRunDuration > 0 {
+		deadline := now.Add(c.MaxRunDuration)
+		if limit.Deadline.IsZero() || deadline.Before(limit.Deadline) {
+			limit = RunLimit{Deadline: deadline, Reason: fmt.Sprintf("run aborted after the maximum run duration of %s", c.MaxRunDuration)}
+		}
+	}
+	return limit, nil
+}
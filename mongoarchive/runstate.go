@@ -0,0 +1,103 @@
+package mongoarchive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/egose/database-tools/utils"
+)
+
+const (
+	// StartupRunNever runs jobs only on their schedule.
+	StartupRunNever = "never"
+	// StartupRunMissed runs a job at startup when a scheduled run was missed
+	// since its last successful run.
+	StartupRunMissed = "missed"
+	// StartupRunAlways runs every job once at startup.
+	StartupRunAlways = "always"
+)
+
+// parseStartupRun reads --startup-run, which defaults to StartupRunNever.
+func parseStartupRun(raw string) (string, error) {
+	switch raw {
+	case "":
+		return StartupRunNever, nil
+	case StartupRunNever, StartupRunMissed, StartupRunAlways:
+		return raw, nil
+	default:
+		return "", fmt.Errorf("startup-run must be one of %s, %s, or %s", StartupRunNever, StartupRunMissed, StartupRunAlways)
+	}
+}
+
+// runState is the content of a run state file.
+type runState struct {
+	LastSuccess time.Time `json:"lastSuccess"`
+}
+
+// RunStateStore records when each job, and each schedule of a job, last ran
+// successfully, so that a restarted process can tell which runs it missed.
+type RunStateStore struct {
+	Dir string
+}
+
+func NewRunStateStore(dir string) *RunStateStore {
+	return &RunStateStore{Dir: dir}
+}
+
+// LastSuccess returns when the run described by cfg last succeeded, or the
+// zero time when no success is recorded or the store is not configured.
+func (s *RunStateStore) LastSuccess(cfg *Config) (time.Time, error) {
+	if s == nil {
+		return time.Time{}, nil
+	}
+
+	buf, err := os.ReadFile(s.path(cfg))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to read run state: %w", err)
+	}
+	state := runState{}
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode run state: %w", err)
+	}
+	return state.LastSuccess, nil
+}
+
+// RecordSuccess records that the run described by cfg succeeded at.
+func (s *RunStateStore) RecordSuccess(cfg *Config, at time.Time) error {
+	if s == nil {
+		return nil
+	}
+
+	path := s.path(cfg)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create run state directory: %w", err)
+	}
+	buf, err := json.MarshalIndent(runState{LastSuccess: at.UTC()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run state: %w", err)
+	}
+	if err := utils.WriteFileAtomically(path, func(dest *os.File) error {
+		_, err := dest.Write(buf)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to record run state: %w", err)
+	}
+	return nil
+}
+
+// path keeps a file per job and schedule. Job and schedule names start with a
+// letter or digit and never hold a path separator, so they stay inside Dir.
+func (s *RunStateStore) path(cfg *Config) string {
+	name := "last-success.json"
+	if cfg.BackupTier != "" {
+		name = "last-success-" + cfg.BackupTier + ".json"
+	}
+	return filepath.Join(s.Dir, cfg.JobName, name)
+}
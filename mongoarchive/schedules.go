@@ -0,0 +1,155 @@
+package mongoarchive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tierNamePattern accepts schedule and tier names that appear unchanged in
+// backup names, so that retention can tell the tiers apart.
+var tierNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,62}[A-Za-z0-9])?$`)
+
+// parseSchedules reads --schedules and --schedule-expiry-days. Schedules
+// without a retention entry keep their backups for expiryDays.
+func parseSchedules(raw string, rawExpiryDays string, expiryDays int) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, entry := range strings.Split(raw, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, expression, ok := strings.Cut(entry, "=")
+		name, expression = strings.TrimSpace(name), strings.TrimSpace(expression)
+		if !ok || expression == "" {
+			return nil, fmt.Errorf("schedules: invalid entry %q (expected <name>=<cron expression>)", entry)
+		}
+		if !tierNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("schedules: invalid name %q: use up to 64 letters, digits, and . _ -, starting and ending with a letter or digit", name)
+		}
+		if slices.ContainsFunc(schedules, func(s Schedule) bool { return s.Name == name }) {
+			return nil, fmt.Errorf("schedules: schedule %q is defined twice", name)
+		}
+		schedules = append(schedules, Schedule{Name: name, CronExpression: expression, ExpiryDays: expiryDays})
+	}
+
+	for _, entry := range splitList(rawExpiryDays) {
+		name, rawDays, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("schedule-expiry-days: invalid entry %q (expected <name>=<days>)", entry)
+		}
+		index := slices.IndexFunc(schedules, func(s Schedule) bool { return s.Name == name })
+		if index < 0 {
+			return nil, fmt.Errorf("schedule-expiry-days: unknown schedule %q", name)
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(rawDays))
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("schedule-expiry-days: %s must be a non-negative integer", name)
+		}
+		schedules[index].ExpiryDays = days
+	}
+	return schedules, nil
+}
+
+// GetSchedules returns the configuration of each run the job takes: one per
+// schedule under --cron, or the single run of OneShotRun otherwise.
+func (c *Config) GetSchedules() []*Config {
+	if !c.Cron {
+		if run := c.OneShotRun(); run != nil {
+			return []*Config{run}
+		}
+		return nil
+	}
+	if len(c.Schedules) == 0 {
+		return []*Config{c}
+	}
+
+	runs := make([]*Config, 0, len(c.Schedules))
+	for _, schedule := range c.Schedules {
+		runs = append(runs, c.scheduleRun(schedule))
+	}
+	return runs
+}
+
+// OneShotRun returns the configuration of the one run that the job takes
+// without --cron, so that a single invocation never dumps the same source for
+// several tiers: the schedule named by --backup-tier, the schedule that keeps
+// its backups longest when --backup-tier is unset, or the configuration
+// itself when no schedules are set. It returns nil when --backup-tier names
+// none of the schedules.
+func (c *Config) OneShotRun() *Config {
+	if len(c.Schedules) == 0 {
+		return c
+	}
+
+	var found *Schedule
+	for i, schedule := range c.Schedules {
+		if c.BackupTier != "" {
+			if schedule.Name == c.BackupTier {
+				return c.scheduleRun(schedule)
+			}
+			continue
+		}
+		if found == nil || KeepsLonger(schedule.ExpiryDays, found.ExpiryDays) {
+			found = &c.Schedules[i]
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return c.scheduleRun(*found)
+}
+
+func (c *Config) scheduleRun(schedule Schedule) *Config {
+	run := *c
+	run.BackupTier = schedule.Name
+	run.CronExpression = schedule.CronExpression
+	run.ExpiryDays = schedule.ExpiryDays
+	run.Schedules = nil
+	return &run
+}
+
+// KeepsLonger reports whether retention a keeps backups longer than b. Zero
+// keeps them forever.
+func KeepsLonger(a int, b int) bool {
+	if a == 0 || b == 0 {
+		return a == 0 && b != 0
+	}
+	return a > b
+}
+
+// validateSchedules checks that backups of every schedule or tier can be told
+// apart by their names, and that a single run knows which schedule it takes.
+func (c *Config) validateSchedules() error {
+	if len(c.Schedules) == 0 && c.BackupTier == "" {
+		return nil
+	}
+	if c.BackupTier != "" && !tierNamePattern.MatchString(c.BackupTier) {
+		return fmt.Errorf("invalid backup-tier %q: use up to 64 letters, digits, and . _ -, starting and ending with a letter or digit", c.BackupTier)
+	}
+	template, err := c.NameTemplate()
+	if err != nil {
+		return err
+	}
+	if !template.Uses("tier") {
+		return errors.New("--schedules and --backup-tier require a --backup-name-template with {tier}")
+	}
+	if len(c.Schedules) == 0 {
+		return nil
+	}
+
+	if c.Cron && c.BackupTier != "" {
+		return errors.New("--backup-tier cannot be combined with --schedules and --cron; each schedule tags its own backups")
+	}
+	if !c.Cron && c.OneShotRun() == nil {
+		names := make([]string, 0, len(c.Schedules))
+		for _, schedule := range c.Schedules {
+			names = append(names, schedule.Name)
+		}
+		return fmt.Errorf("without --cron, --backup-tier must name one of the schedules (%s)", strings.Join(names, ", "))
+	}
+	return nil
+}
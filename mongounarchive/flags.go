@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/egose/database-tools/internal/toolconfig"
 	"github.com/egose/database-tools/storage"
@@ -22,6 +23,9 @@ const (
 	defaultUpdateMaxBytes int64 = 1 << 20
 )
 
+// CommandJanitor runs a cleanup pass instead of the regular task.
+const CommandJanitor = "janitor"
+
 type Config struct {
 	toolconfig.MongoOptions
 	toolconfig.StorageOptions
@@ -29,7 +33,8 @@ type Config struct {
 	RestoreExecutionOptions
 	RestoreSourceOptions
 	UpdateOptions
-	Keep bool
+	Keep    bool
+	Command string
 }
 
 type RestoreNamespaceOptions struct {
@@ -55,8 +60,10 @@ type RestoreExecutionOptions struct {
 }
 
 type RestoreSourceOptions struct {
-	ObjectName string
-	Dir        string
+	ObjectName      string
+	Dir             string
+	RestoreFallback bool
+	RestorePriority string
 }
 
 type UpdateOptions struct {
@@ -81,8 +88,11 @@ var restoreFlagDefs = struct {
 	stopOnError                      toolconfig.BoolFlagDef
 	bypassDocumentValidation         toolconfig.BoolFlagDef
 	preserveUUID                     toolconfig.BoolFlagDef
+	from                             toolconfig.StringFlagDef
 	objectName                       toolconfig.StringFlagDef
 	dir                              toolconfig.StringFlagDef
+	restoreFallback                  toolconfig.BoolFlagDef
+	restorePriority                  toolconfig.StringFlagDef
 	updates                          toolconfig.StringFlagDef
 	updatesFile                      toolconfig.StringFlagDef
 	keep                             toolconfig.BoolFlagDef
@@ -104,8 +114,11 @@ var restoreFlagDefs = struct {
 	stopOnError:                      toolconfig.BoolFlagDef{Name: "stop-on-error", EnvKey: "STOP_ON_ERROR", Usage: "halt after encountering any error during insertion. By default, mongorestore will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"},
 	bypassDocumentValidation:         toolconfig.BoolFlagDef{Name: "bypass-document-validation", EnvKey: "BYPASS_DOCUMENT_VALIDATION", Usage: "bypass document validation"},
 	preserveUUID:                     toolconfig.BoolFlagDef{Name: "preserve-uuid", EnvKey: "PRESERVE_UUID", Usage: "preserve original collection UUIDs (off by default, requires drop)"},
+	from:                             toolconfig.StringFlagDef{Name: "from", EnvKey: "FROM", Usage: "Comma-separated source URLs such as s3://bucket/prefix?region=ca-central-1, gs://bucket/prefix, az://container/prefix, or file:///path; credentials still come from the backend flags"},
 	objectName:                       toolconfig.StringFlagDef{Name: "object-name", EnvKey: "OBJECT_NAME", Usage: "Object name of the archived file in the storage (optional)"},
 	dir:                              toolconfig.StringFlagDef{Name: "dir", EnvKey: "DIR", Usage: "directory name that contains the dumped files"},
+	restoreFallback:                  toolconfig.BoolFlagDef{Name: "restore-fallback", EnvKey: "RESTORE_FALLBACK", Usage: "Restore from any configured backend: the newest backup, or --object-name, from the first backend in priority order that can supply it"},
+	restorePriority:                  toolconfig.StringFlagDef{Name: "restore-priority", EnvKey: "RESTORE_PRIORITY", Usage: "Comma-separated storage instances or backend types to try first with --restore-fallback; other backends follow in configuration order"},
 	updates:                          toolconfig.StringFlagDef{Name: "updates", EnvKey: "UPDATES", Usage: "array of update specifications in JSON string"},
 	updatesFile:                      toolconfig.StringFlagDef{Name: "updates-file", EnvKey: "UPDATES_FILE", Usage: "path to a file containing an array of update specifications"},
 	keep:                             toolconfig.BoolFlagDef{Name: "keep", EnvKey: "KEEP", Usage: "keep data dump"},
@@ -119,6 +132,7 @@ func ParseFlags() (*Config, bool, error) {
 
 func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string) (*Config, bool, error) {
 	cfg := &Config{}
+	cfg.Command, args = toolconfig.SplitCommand(args, CommandJanitor)
 
 	mongoBindings := toolconfig.BindMongoFlags(flagSet, env)
 	nsExclude := restoreFlagDefs.nsExclude.Bind(flagSet, env)
@@ -138,8 +152,11 @@ func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string)
 	bypassDocumentValidation := restoreFlagDefs.bypassDocumentValidation.Bind(flagSet, env)
 	preserveUUID := restoreFlagDefs.preserveUUID.Bind(flagSet, env)
 	storageBindings := toolconfig.BindStorageFlags(flagSet, env)
+	from := restoreFlagDefs.from.Bind(flagSet, env)
 	objectName := restoreFlagDefs.objectName.Bind(flagSet, env)
 	dir := restoreFlagDefs.dir.Bind(flagSet, env)
+	restoreFallback := restoreFlagDefs.restoreFallback.Bind(flagSet, env)
+	restorePriority := restoreFlagDefs.restorePriority.Bind(flagSet, env)
 	updates := restoreFlagDefs.updates.Bind(flagSet, env)
 	updatesFile := restoreFlagDefs.updatesFile.Bind(flagSet, env)
 	keep := restoreFlagDefs.keep.Bind(flagSet, env)
@@ -171,7 +188,13 @@ func parseFlags(flagSet *flag.FlagSet, env toolconfig.EnvReader, args []string)
 		PreserveUUID:                     *preserveUUID,
 	}
 	storageBindings.Apply(&cfg.StorageOptions)
-	cfg.RestoreSourceOptions = RestoreSourceOptions{ObjectName: *objectName, Dir: *dir}
+	cfg.StorageURLs = *from
+	cfg.RestoreSourceOptions = RestoreSourceOptions{
+		ObjectName:      *objectName,
+		Dir:             *dir,
+		RestoreFallback: *restoreFallback,
+		RestorePriority: *restorePriority,
+	}
 	cfg.UpdateOptions = UpdateOptions{Updates: *updates, UpdatesFile: *updatesFile}
 	cfg.Keep = *keep
 
@@ -258,6 +281,17 @@ func (c *Config) GetObjectName() string {
 	return c.ObjectName
 }
 
+// GetRestorePriority returns the backends --restore-fallback tries first.
+func (c *Config) GetRestorePriority() []string {
+	var priority []string
+	for _, name := range strings.Split(c.RestorePriority, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			priority = append(priority, name)
+		}
+	}
+	return priority
+}
+
 func (c *Config) GetMongoClient(ctx context.Context) (*mongo.Client, *mongo.Database, error) {
 	clientOptions, err := c.MongoOptions.MongoClientOptions()
 	if err != nil {
@@ -303,6 +337,24 @@ func (c *Config) HasKeep() bool {
 }
 
 func (c *Config) Validate() error {
+	if _, err := c.Instances(); err != nil {
+		return err
+	}
+	if err := c.ValidateBandwidth(); err != nil {
+		return err
+	}
+	if err := c.ValidateBackendPolicies(); err != nil {
+		return err
+	}
+	if _, err := c.NameTemplate(); err != nil {
+		return err
+	}
+	if c.RestoreFallback && c.StorageBackend != "" {
+		return errors.New("--storage-backend cannot be combined with --restore-fallback; use --restore-priority")
+	}
+	if c.RestorePriority != "" && !c.RestoreFallback {
+		return errors.New("--restore-priority requires --restore-fallback")
+	}
 	if c.DryRun && c.HasUpdates() {
 		return errors.New("--dry-run cannot be combined with --updates or --updates-file")
 	}
@@ -335,8 +387,11 @@ func FlagDocumentation() toolconfig.CommandDoc {
 	)
 	flags = append(flags, toolconfig.StorageFlagDocs(envPrefix)...)
 	flags = append(flags,
+		restoreFlagDefs.from.Doc(envPrefix),
 		restoreFlagDefs.objectName.Doc(envPrefix),
 		restoreFlagDefs.dir.Doc(envPrefix),
+		restoreFlagDefs.restoreFallback.Doc(envPrefix),
+		restoreFlagDefs.restorePriority.Doc(envPrefix),
 		restoreFlagDefs.updates.Doc(envPrefix),
 		restoreFlagDefs.updatesFile.Doc(envPrefix),
 		restoreFlagDefs.keep.Doc(envPrefix),
@@ -350,6 +405,9 @@ func FlagDocumentation() toolconfig.CommandDoc {
 			{EnvVar: envPrefix + "RESTORE_PATH", Description: "Base directory for per-run restore workspaces before extraction"},
 			{EnvVar: envPrefix + "UPDATE_MAX_BYTES", DefaultValue: strconv.FormatInt(defaultUpdateMaxBytes, 10), Description: "Maximum size in bytes allowed for inline or file-based update specifications"},
 			{EnvVar: envPrefix + "STORAGE_OPERATION_TIMEOUT", Description: "Optional timeout applied to storage lookup and download operations"},
+			{EnvVar: envPrefix + "TRANSFER_RESUME_WINDOW", DefaultValue: storage.DefaultTransferResumeWindow.String(), Description: "How long an interrupted download stays resumable before its partial file is discarded"},
+			{EnvVar: envPrefix + "JANITOR_MIN_AGE", DefaultValue: utils.DefaultJanitorMinAge.String(), Description: "Minimum age before the janitor reclaims workspaces whose owner cannot be checked"},
+			{EnvVar: envPrefix + "STORAGE__<NAME>__<KEY>", Description: "Setting KEY for the named storage instance NAME; KEY is a storage flag's environment key such as AWS_BUCKET or BACKUP_PREFIX"},
 			{EnvVar: envPrefix + "UPDATE_TIMEOUT", Description: "Optional timeout applied to MongoDB update connections and update operations"},
 		},
 	}
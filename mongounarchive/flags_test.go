@@ -60,7 +60,7 @@ func TestGetMongoConnectionURIBuildsFromFlags(t *testing.T) {
 }
 
 func TestGetStoragesUsesConfiguredLocalBackend(t *testing.T) {
-	cfg := &Config{StorageOptions: toolconfig.StorageOptions{LocalPath: t.TempDir()}}
+	cfg := &Config{StorageOptions: toolconfig.StorageOptions{Settings: storage.BackendSettings{"local-path": t.TempDir()}}}
 
 	storages, err := cfg.GetStorages(context.Background())
 	if err != nil {
@@ -106,6 +106,25 @@ func TestParseFlagsRejectsDryRunWithUpdates(t *testing.T) {
 	}
 }
 
+func TestParseFlagsValidatesRestoreFallback(t *testing.T) {
+	cfg, _, err := parseFlags(newRestoreTestFlagSet("mongo-unarchive"), restoreMapEnv{"RESTORE_PRIORITY": "offsite, gcp"}, []string{"--restore-fallback"})
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if !cfg.RestoreFallback || strings.Join(cfg.GetRestorePriority(), "|") != "offsite|gcp" {
+		t.Fatalf("parseFlags() = fallback %v, priority %v", cfg.RestoreFallback, cfg.GetRestorePriority())
+	}
+
+	for _, args := range [][]string{
+		{"--restore-fallback", "--storage-backend=local"},
+		{"--restore-priority=local"},
+	} {
+		if _, _, err := parseFlags(newRestoreTestFlagSet("mongo-unarchive"), restoreMapEnv{}, args); err == nil {
+			t.Fatalf("parseFlags(%v) error = nil, want a validation failure", args)
+		}
+	}
+}
+
 func TestParseFlagsRunsInParallelWithoutGlobalState(t *testing.T) {
 	t.Parallel()
 
@@ -33,6 +33,7 @@ const (
 	progressBarWaitTime = time.Second * 3
 	envPrefix           = "MONGOUNARCHIVE__"
 	defaultWorkspaceDir = "mongounarchive"
+	workspacePattern    = "run-"
 )
 
 type restoreExecutionResult struct {
@@ -111,7 +112,24 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if err := runTask(ctx, cfg); err != nil {
+	if err := configureTransfers(cfg); err != nil {
+		mlog.Logvf(mlog.Always, "Failed: %v", err)
+		os.Exit(1)
+	}
+
+	janitorMinAge, err := readPositiveDurationEnv(envPrefix+"JANITOR_MIN_AGE", utils.DefaultJanitorMinAge)
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Failed: %v", err)
+		os.Exit(1)
+	}
+
+	if cfg.Command == mongounarchive.CommandJanitor {
+		err = runJanitor(restoreBasePath(), cfg.Transfers, janitorMinAge)
+	} else {
+		cleanStaleWorkspaces(restoreBasePath(), janitorMinAge)
+		err = runTask(ctx, cfg)
+	}
+	if err != nil {
 		mlog.Logvf(mlog.Always, "Failed: %v", err)
 		os.Exit(1)
 	}
@@ -121,6 +139,69 @@ func runTask(ctx context.Context, cfg *mongounarchive.Config) error {
 	return newRestorePipeline().run(ctx, cfg)
 }
 
+// runJanitor reclaims what crashed restores left behind: workspaces of dead
+// processes and partial downloads whose resume window has passed.
+func runJanitor(basePath string, transfers *projectstorage.TransferStateStore, minAge time.Duration) error {
+	var janitorErrors []error
+
+	workspaces, err := utils.CleanStaleWorkspaces(basePath, workspacePattern, minAge, time.Now())
+	logReclaimedWorkspaces(workspaces)
+	if err != nil {
+		janitorErrors = append(janitorErrors, fmt.Errorf("failed to clean stale workspaces: %w", err))
+	}
+
+	downloads, err := transfers.PruneExpired()
+	for _, download := range downloads {
+		mlog.Logvf(mlog.Always, "Janitor removed %s (%d bytes): %s", download.Object, download.Bytes, download.Detail)
+	}
+	if err != nil {
+		janitorErrors = append(janitorErrors, fmt.Errorf("failed to prune expired downloads: %w", err))
+	}
+
+	var workspaceBytes, downloadBytes int64
+	for _, workspace := range workspaces {
+		workspaceBytes += workspace.Bytes
+	}
+	for _, download := range downloads {
+		downloadBytes += download.Bytes
+	}
+	mlog.Logvf(mlog.Always, "Janitor reclaimed %d workspace(s) (%d bytes) and %d partial download(s) (%d bytes)", len(workspaces), workspaceBytes, len(downloads), downloadBytes)
+
+	return errors.Join(janitorErrors...)
+}
+
+// cleanStaleWorkspaces runs at startup; failures are logged so that a
+// leftover directory never blocks a restore.
+func cleanStaleWorkspaces(basePath string, minAge time.Duration) {
+	workspaces, err := utils.CleanStaleWorkspaces(basePath, workspacePattern, minAge, time.Now())
+	logReclaimedWorkspaces(workspaces)
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Failed to clean stale workspaces: %v", err)
+	}
+}
+
+func logReclaimedWorkspaces(workspaces []utils.ReclaimedWorkspace) {
+	for _, workspace := range workspaces {
+		mlog.Logvf(mlog.Always, "Janitor removed workspace %s (%d bytes): %s", workspace.Path, workspace.Bytes, workspace.Reason)
+	}
+}
+
+// configureTransfers persists download progress under the restore base path
+// so that an interrupted download is resumed by the next run.
+func configureTransfers(cfg *mongounarchive.Config) error {
+	window, err := readPositiveDurationEnv(envPrefix+"TRANSFER_RESUME_WINDOW", projectstorage.DefaultTransferResumeWindow)
+	if err != nil {
+		return err
+	}
+
+	transfers, err := projectstorage.NewTransferStateStore(filepath.Join(restoreBasePath(), "transfers"), window)
+	if err != nil {
+		return err
+	}
+	cfg.Transfers = transfers
+	return nil
+}
+
 func newRestorePipeline() restorePipeline {
 	return restorePipeline{
 		createWorkspace: createRestoreWorkspace,
@@ -170,9 +251,12 @@ func (p restorePipeline) run(ctx context.Context, cfg *mongounarchive.Config) (r
 		}
 	}()
 
-	storage, err := p.selectStorage(storages, cfg.StorageBackend)
-	if err != nil {
-		return err
+	var storage projectstorage.Storage
+	if !cfg.RestoreFallback {
+		storage, err = p.selectStorage(storages, cfg.StorageBackend)
+		if err != nil {
+			return err
+		}
 	}
 
 	extractionLimits, err := p.getExtractionLimit()
@@ -180,35 +264,24 @@ func (p restorePipeline) run(ctx context.Context, cfg *mongounarchive.Config) (r
 		return err
 	}
 
-	lookupCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
-	if err != nil {
-		return err
+	var sources []projectstorage.RestoreSource
+	if cfg.RestoreFallback {
+		sources, err = findFallbackSources(ctx, cfg, storages)
+	} else {
+		sources, err = lookupRestoreSource(ctx, cfg, storage)
 	}
-	objectName, err := storage.GetTargetObjectName(lookupCtx, cfg.GetObjectName())
-	cancel()
 	if err != nil {
 		return err
 	}
 
-	tarfilePath, err := utils.ResolvePathWithinRoot(workspace, objectName)
+	tarfilePath, objectName, err := p.downloadArchive(ctx, sources, workspace)
 	if err != nil {
 		return err
 	}
+	cleanup.addFile(tarfilePath, p.deleteFile)
 
 	destPath := filepath.Join(workspace, utils.GetFileNameWithoutExtension(objectName))
 
-	mlog.Logvf(mlog.Always, "Downloading archive...")
-	downloadCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
-	if err != nil {
-		return err
-	}
-	err = p.download(downloadCtx, storage, objectName, tarfilePath)
-	cancel()
-	if err != nil {
-		return err
-	}
-	cleanup.addFile(tarfilePath, p.deleteFile)
-
 	mlog.Logvf(mlog.Always, "Extracting files...")
 	err = p.extract(tarfilePath, destPath, extractionLimits)
 	if err != nil {
@@ -258,17 +331,76 @@ func (p restorePipeline) run(ctx context.Context, cfg *mongounarchive.Config) (r
 	return nil
 }
 
+func lookupRestoreSource(ctx context.Context, cfg *mongounarchive.Config, storage projectstorage.Storage) ([]projectstorage.RestoreSource, error) {
+	lookupCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	objectName, err := storage.GetTargetObjectName(lookupCtx, cfg.GetObjectName())
+	if err != nil {
+		return nil, err
+	}
+	return []projectstorage.RestoreSource{{Storage: storage, ObjectName: objectName}}, nil
+}
+
+// findFallbackSources lists every backend that can supply the archive, in
+// --restore-priority order.
+func findFallbackSources(ctx context.Context, cfg *mongounarchive.Config, storages []projectstorage.Storage) ([]projectstorage.RestoreSource, error) {
+	ordered, err := projectstorage.OrderRestoreStorages(storages, cfg.GetRestorePriority())
+	if err != nil {
+		return nil, err
+	}
+
+	lookupCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	return projectstorage.FindRestoreSources(lookupCtx, ordered, cfg.GetObjectName())
+}
+
+// downloadArchive downloads the archive from the first source that supplies
+// it, falling back to the next source after a failed download.
+func (p restorePipeline) downloadArchive(ctx context.Context, sources []projectstorage.RestoreSource, workspace string) (string, string, error) {
+	var downloadErrors []error
+	for _, source := range sources {
+		tarfilePath, err := utils.ResolvePathWithinRoot(workspace, source.ObjectName)
+		if err != nil {
+			return "", "", err
+		}
+
+		mlog.Logvf(mlog.Always, "Downloading archive %s from %s...", source.ObjectName, projectstorage.StorageName(source.Storage))
+		downloadCtx, cancel, err := operationContext(ctx, envPrefix+"STORAGE_OPERATION_TIMEOUT")
+		if err != nil {
+			return "", "", err
+		}
+		err = p.download(downloadCtx, source.Storage, source.ObjectName, tarfilePath)
+		cancel()
+		if err == nil {
+			return tarfilePath, source.ObjectName, nil
+		}
+		if len(sources) == 1 {
+			return "", "", err
+		}
+		mlog.Logvf(mlog.Always, "Failed to download %s from %s: %v", source.ObjectName, projectstorage.StorageName(source.Storage), err)
+		downloadErrors = append(downloadErrors, fmt.Errorf("%s: %w", projectstorage.StorageName(source.Storage), err))
+	}
+	return "", "", fmt.Errorf("failed to download archive from any storage backend: %w", errors.Join(downloadErrors...))
+}
+
 func createRestoreWorkspace() (string, error) {
+	return utils.CreateOwnedWorkspace(restoreBasePath(), workspacePattern)
+}
+
+func restoreBasePath() string {
 	basePath := os.Getenv(envPrefix + "RESTORE_PATH")
 	if basePath == "" {
 		basePath = filepath.Join(os.TempDir(), defaultWorkspaceDir)
 	}
-
-	if err := os.MkdirAll(basePath, 0o700); err != nil {
-		return "", err
-	}
-
-	return os.MkdirTemp(basePath, "run-")
+	return basePath
 }
 
 func getArchiveExtractionLimits() (utils.ArchiveExtractionLimits, error) {
@@ -326,6 +458,23 @@ func readPositiveInt64Env(key string, fallback int64) (int64, error) {
 	return value, nil
 }
 
+func readPositiveDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a valid duration: %w", key, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("%s must be greater than zero", key)
+	}
+
+	return value, nil
+}
+
 func newMongoRestoreRunner(options []string) (restoreRunner, error) {
 	opts, err := mongorestore.ParseOptions(options, "", "")
 	if err != nil {
@@ -390,7 +539,7 @@ func closeStorages(storages []projectstorage.Storage) error {
 	var closeErrors []error
 	for _, storageBackend := range storages {
 		if err := storageBackend.Close(); err != nil {
-			closeErrors = append(closeErrors, fmt.Errorf("close %T: %w", storageBackend, err))
+			closeErrors = append(closeErrors, fmt.Errorf("close %s: %w", projectstorage.StorageName(storageBackend), err))
 		}
 	}
 
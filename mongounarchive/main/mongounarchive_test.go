@@ -18,6 +18,7 @@ import (
 
 type restoreStorageStub struct {
 	objectName string
+	lookupErr  error
 }
 
 func (s *restoreStorageStub) Upload(context.Context, string, string) (string, error) {
@@ -29,6 +30,9 @@ func (s *restoreStorageStub) Download(context.Context, string, string) error {
 }
 
 func (s *restoreStorageStub) GetTargetObjectName(_ context.Context, name string) (string, error) {
+	if s.lookupErr != nil {
+		return "", s.lookupErr
+	}
 	if s.objectName != "" {
 		return s.objectName, nil
 	}
@@ -261,6 +265,55 @@ func TestRestorePipelineCleanupByStage(t *testing.T) {
 	}
 }
 
+func TestRestorePipelineFallsBackAcrossBackends(t *testing.T) {
+	filename, _ := utils.GetNewFilename()
+	down := &restoreStorageStub{lookupErr: errors.New("backend unavailable")}
+	broken := &restoreStorageStub{objectName: "broken/" + filename}
+	healthy := &restoreStorageStub{objectName: "healthy/" + filename}
+
+	var downloaded []string
+	pipeline := restorePipeline{
+		createWorkspace: func() (string, error) { return os.MkdirTemp(t.TempDir(), "run-") },
+		getStorages: func(context.Context, *mongounarchive.Config) ([]projectstorage.Storage, error) {
+			return []projectstorage.Storage{down, broken, healthy}, nil
+		},
+		selectStorage: func([]projectstorage.Storage, string) (projectstorage.Storage, error) {
+			t.Fatal("selectStorage() called with --restore-fallback")
+			return nil, nil
+		},
+		getExtractionLimit: func() (utils.ArchiveExtractionLimits, error) {
+			return utils.DefaultArchiveExtractionLimits(), nil
+		},
+		download: func(_ context.Context, s projectstorage.Storage, objectName string, destination string) error {
+			downloaded = append(downloaded, objectName)
+			if s == broken {
+				return errors.New("connection reset")
+			}
+			if err := os.MkdirAll(filepath.Dir(destination), 0o700); err != nil {
+				return err
+			}
+			return os.WriteFile(destination, []byte("archive"), 0o600)
+		},
+		extract: func(_ string, destination string, _ utils.ArchiveExtractionLimits) error {
+			return os.MkdirAll(destination, 0o700)
+		},
+		newRestore: func([]string) (restoreRunner, error) {
+			return &fakeRestoreRunner{acknowledged: true}, nil
+		},
+		deleteDirectory: utils.DeleteDirectory,
+		deleteFile:      utils.DeleteFile,
+		handleInterrupt: func(func()) chan struct{} { return nil },
+	}
+
+	cfg := &mongounarchive.Config{RestoreSourceOptions: mongounarchive.RestoreSourceOptions{RestoreFallback: true}}
+	if err := pipeline.run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if want := []string{"broken/" + filename, "healthy/" + filename}; strings.Join(downloaded, ",") != strings.Join(want, ",") {
+		t.Fatalf("download() calls = %v, want %v", downloaded, want)
+	}
+}
+
 func TestRestorePipelineAggregatesCleanupFailure(t *testing.T) {
 	primaryErr := errors.New("restore failed")
 	cleanupErr := errors.New("remove archive failed")
@@ -24,7 +24,7 @@ func BuildMessage(success bool, loc *time.Location, prefix string, filenameOrErr
 	}
 
 	msg := Message{
-		FilenameOrError: redactSensitiveText(filenameOrError),
+		FilenameOrError: RedactSensitiveText(filenameOrError),
 		CurrentTime:     timestamp.Format("2006-01-02 15:04:05"),
 	}
 
@@ -57,7 +57,8 @@ func joinPrefix(prefix string, text string) string {
 
 var uriPattern = regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^\s]+`)
 
-func redactSensitiveText(raw string) string {
+// RedactSensitiveText removes credentials from the URIs in raw.
+func RedactSensitiveText(raw string) string {
 	return uriPattern.ReplaceAllStringFunc(raw, redactSensitiveURI)
 }
 
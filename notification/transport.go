@@ -103,7 +103,7 @@ func readErrorSnippet(r io.Reader) (string, error) {
 		data = data[:maxErrorSnippetBytes]
 	}
 
-	snippet := strings.TrimSpace(redactSensitiveText(string(data)))
+	snippet := strings.TrimSpace(RedactSensitiveText(string(data)))
 	if truncated {
 		snippet += "... (truncated)"
 	}
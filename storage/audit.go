@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AuditOptions selects how thoroughly AuditBackups compares backends.
+type AuditOptions struct {
+	// Checksums downloads every copy of a backup held by more than one
+	// backend and compares their SHA-256 digests. Without it only names and
+	// sizes are compared.
+	Checksums bool
+	// StagingDir holds each downloaded copy while its digest is computed.
+	StagingDir string
+	// KeepDays, when set, returns how many days a backend keeps backups,
+	// through retention or tiering; zero keeps them forever. A backup older
+	// than that is not reported missing on the backend.
+	KeepDays func(Storage) int
+	// Now returns the time against which backup age is judged; nil uses the
+	// wall clock.
+	Now func() time.Time
+}
+
+// AuditCopy is one backend's copy of a backup.
+type AuditCopy struct {
+	Storage    Storage
+	Object     string
+	Size       int64
+	ModifiedAt time.Time
+	// SHA256 is the hex digest of the copy, set when checksums were audited.
+	SHA256 string
+}
+
+// AuditEntry compares one backup, identified by its generated filename,
+// across backends.
+type AuditEntry struct {
+	Filename string
+	// CreatedAt is the creation time recorded in the backup's name.
+	CreatedAt time.Time
+	Copies    []AuditCopy
+	// Missing lists the backends that do not hold the backup.
+	Missing          []Storage
+	SizeMismatch     bool
+	ChecksumMismatch bool
+}
+
+// Consistent reports whether every backend holds an identical copy.
+func (e AuditEntry) Consistent() bool {
+	return len(e.Missing) == 0 && !e.SizeMismatch && !e.ChecksumMismatch
+}
+
+// Repairable reports whether the backup can be copied to the backends that
+// miss it: every existing copy agrees, so any of them is a valid source.
+func (e AuditEntry) Repairable() bool {
+	return len(e.Missing) > 0 && len(e.Copies) > 0 && !e.SizeMismatch && !e.ChecksumMismatch
+}
+
+// AuditBackups lists the managed backups on every backend and compares them
+// by generated filename, so copies under different backup prefixes match.
+// Entries are sorted newest first.
+func AuditBackups(ctx context.Context, storages []Storage, options AuditOptions) ([]AuditEntry, error) {
+	ctx = contextOrBackground(ctx)
+
+	byFilename := map[string]*AuditEntry{}
+	present := map[string]map[Storage]struct{}{}
+	for _, s := range storages {
+		lister, ok := s.(BackupLister)
+		if !ok {
+			return nil, fmt.Errorf("storage backend %s cannot list its backups", StorageName(s))
+		}
+		backups, err := lister.ListBackups(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups on %s: %w", StorageName(s), err)
+		}
+		for _, backup := range backups {
+			entry, ok := byFilename[backup.Filename()]
+			if !ok {
+				entry = &AuditEntry{Filename: backup.Filename(), CreatedAt: backup.CreatedAt}
+				byFilename[backup.Filename()] = entry
+				present[backup.Filename()] = map[Storage]struct{}{}
+			}
+			entry.Copies = append(entry.Copies, AuditCopy{Storage: s, Object: backup.Name, Size: backup.Size, ModifiedAt: backup.ModifiedAt})
+			present[backup.Filename()][s] = struct{}{}
+		}
+	}
+
+	now := currentTime(options.Now)
+	entries := make([]AuditEntry, 0, len(byFilename))
+	for filename, entry := range byFilename {
+		for _, s := range storages {
+			if _, ok := present[filename][s]; ok {
+				continue
+			}
+			// Retention ages a backup from the time in its name, on every
+			// backend alike.
+			if options.KeepDays != nil && isExpired(entry.CreatedAt, options.KeepDays(s), now) {
+				continue
+			}
+			entry.Missing = append(entry.Missing, s)
+		}
+		for _, backupCopy := range entry.Copies[1:] {
+			if backupCopy.Size != entry.Copies[0].Size {
+				entry.SizeMismatch = true
+			}
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].Filename < entries[j].Filename
+	})
+
+	if !options.Checksums {
+		return entries, nil
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if len(entry.Copies) < 2 || entry.SizeMismatch {
+			continue
+		}
+		for j := range entry.Copies {
+			digest, err := checksumBackup(ctx, entry.Copies[j], filepath.Join(options.StagingDir, entry.Filename))
+			if err != nil {
+				return entries, err
+			}
+			entry.Copies[j].SHA256 = digest
+			if digest != entry.Copies[0].SHA256 {
+				entry.ChecksumMismatch = true
+			}
+		}
+	}
+	return entries, nil
+}
+
+// RepairBackups copies every repairable backup from a backend that holds it to
+// the backends that miss it, using CopyBackups. Backups with mismatched copies
+// are left alone: there is no way to tell which copy is correct.
+func RepairBackups(ctx context.Context, entries []AuditEntry, stagingDir string) ([]CopyResult, error) {
+	type repairGroup struct {
+		source  Storage
+		targets []Storage
+		objects []string
+	}
+
+	ids := map[Storage]int{}
+	id := func(s Storage) string {
+		if _, ok := ids[s]; !ok {
+			ids[s] = len(ids)
+		}
+		return strconv.Itoa(ids[s])
+	}
+
+	groups := make([]*repairGroup, 0)
+	byKey := map[string]*repairGroup{}
+	for _, entry := range entries {
+		if !entry.Repairable() {
+			continue
+		}
+		// Group backups by source and target set, so each archive is
+		// downloaded once however many backends miss it.
+		source := entry.Copies[0].Storage
+		key := id(source)
+		for _, target := range entry.Missing {
+			key += "," + id(target)
+		}
+		group, ok := byKey[key]
+		if !ok {
+			group = &repairGroup{source: source, targets: entry.Missing}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.objects = append(group.objects, entry.Filename)
+	}
+
+	results := make([]CopyResult, 0)
+	var repairErrors []error
+	for _, group := range groups {
+		copied, err := CopyBackups(ctx, group.source, group.targets, CopyOptions{Objects: group.objects, StagingDir: stagingDir})
+		results = append(results, copied...)
+		if err != nil {
+			repairErrors = append(repairErrors, err)
+		}
+	}
+	return results, errors.Join(repairErrors...)
+}
+
+func checksumBackup(ctx context.Context, backupCopy AuditCopy, stagedPath string) (string, error) {
+	if err := backupCopy.Storage.Download(ctx, backupCopy.Object, stagedPath); err != nil {
+		return "", fmt.Errorf("failed to download %s from %s: %w", backupCopy.Object, StorageName(backupCopy.Storage), err)
+	}
+	defer os.Remove(stagedPath)
+
+	file, err := os.Open(stagedPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum %s: %w", backupCopy.Object, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to checksum %s: %w", backupCopy.Object, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
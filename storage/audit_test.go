@@ -0,0 +1,101 @@
+package storage_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+)
+
+func TestAuditBackupsReportsGapsAndMismatches(t *testing.T) {
+	complete, gap, resized, corrupted := backupFilename(t, 0), backupFilename(t, 10), backupFilename(t, 20), backupFilename(t, 30)
+	first := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "first"})
+	second := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "second"})
+	for _, s := range []*storagetest.MemoryStorage{first, second} {
+		prefix := s.ManagedPrefix()
+		uploadObject(t, s, prefix+complete, "complete")
+		uploadObject(t, s, prefix+resized, "resized "+prefix)
+	}
+	uploadObject(t, first, "first/"+gap, "gap")
+	uploadObject(t, first, "first/"+corrupted, "aaaa")
+	uploadObject(t, second, "second/"+corrupted, "bbbb")
+
+	storages := []storage.Storage{first, second}
+	entries, err := storage.AuditBackups(context.Background(), storages, storage.AuditOptions{Checksums: true, StagingDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("AuditBackups() error = %v", err)
+	}
+
+	got := map[string]storage.AuditEntry{}
+	filenames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		got[entry.Filename] = entry
+		filenames = append(filenames, entry.Filename)
+	}
+	if want := []string{complete, gap, resized, corrupted}; !slices.Equal(filenames, want) {
+		t.Fatalf("AuditBackups() filenames = %v, want newest first %v", filenames, want)
+	}
+	if entry := got[complete]; !entry.Consistent() || entry.Copies[0].SHA256 == "" {
+		t.Fatalf("complete entry = %+v, want consistent with checksums", entry)
+	}
+	if entry := got[gap]; !entry.Repairable() || len(entry.Missing) != 1 || entry.Missing[0] != second {
+		t.Fatalf("gap entry = %+v, want missing on second", entry)
+	}
+	if entry := got[resized]; !entry.SizeMismatch || entry.Repairable() {
+		t.Fatalf("resized entry = %+v, want a size mismatch", entry)
+	}
+	if entry := got[corrupted]; !entry.ChecksumMismatch || entry.SizeMismatch {
+		t.Fatalf("corrupted entry = %+v, want a checksum mismatch", entry)
+	}
+
+	results, err := storage.RepairBackups(context.Background(), entries, t.TempDir())
+	if err != nil {
+		t.Fatalf("RepairBackups() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Object != "second/"+gap || results[0].Skipped {
+		t.Fatalf("RepairBackups() = %+v, want one copy of the gap", results)
+	}
+
+	entries, err = storage.AuditBackups(context.Background(), storages, storage.AuditOptions{})
+	if err != nil {
+		t.Fatalf("AuditBackups() error = %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Filename == gap && !entry.Consistent() {
+			t.Fatalf("gap entry after repair = %+v, want consistent", entry)
+		}
+	}
+}
+
+func TestAuditBackupsIgnoresBackupsPastABackendsRetention(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	// Both copies were written an hour ago; the backups' age is read from
+	// their names, as retention reads it.
+	clock := func() time.Time { return now.Add(-time.Hour) }
+	short := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "short", Now: clock})
+	long := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "long", Now: clock})
+	expired, recent := backupFilename(t, 10*24*60), backupFilename(t, 0)
+	uploadObject(t, long, "long/"+expired, "expired")
+	uploadObject(t, long, "long/"+recent, "recent")
+
+	entries, err := storage.AuditBackups(context.Background(), []storage.Storage{short, long}, storage.AuditOptions{
+		KeepDays: func(s storage.Storage) int {
+			if s == short {
+				return 7
+			}
+			return 90
+		},
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("AuditBackups() error = %v", err)
+	}
+	for _, entry := range entries {
+		if want := entry.Filename == recent; entry.Repairable() != want {
+			t.Fatalf("entry %s = %+v, want repairable %v", entry.Filename, entry, want)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -13,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/egose/database-tools/flagdef"
 	"github.com/egose/database-tools/utils"
 	mlog "github.com/mongodb/mongo-tools/common/log"
 )
@@ -28,6 +36,88 @@ type AwsS3 struct {
 	Service          *s3.S3
 	ExpiryDays       int
 	BackupPrefix     string
+	NameTemplate     *NameTemplate
+	Transfers        *TransferStateStore
+	Bandwidth        *Bandwidth
+	InstanceName     string
+	Now              func() time.Time
+}
+
+type s3MultipartUpload struct {
+	storage    *AwsS3
+	objectName string
+}
+
+type s3RangedDownload struct {
+	storage    *AwsS3
+	objectName string
+}
+
+var awsBackendType = BackendType{
+	Name:  BackendAWS,
+	Label: "AWS",
+	StringFlags: []flagdef.StringFlagDef{
+		{Name: "aws-endpoint", EnvKey: "AWS_ENDPOINT", Usage: "AWS endpoint URL (hostname only or fully qualified URI)"},
+		{Name: "aws-access-key-id", EnvKey: "AWS_ACCESS_KEY_ID", Usage: "AWS access key associated with an IAM account"},
+		{Name: "aws-secret-access-key", EnvKey: "AWS_SECRET_ACCESS_KEY", Usage: "AWS secret key associated with the access key"},
+		{Name: "aws-region", EnvKey: "AWS_REGION", Usage: "AWS Region whose servers you want to send your requests to", Defaults: []string{"us-east-1"}},
+		{Name: "aws-bucket", EnvKey: "AWS_BUCKET", Usage: "AWS S3 bucket name"},
+	},
+	BoolFlags: []flagdef.BoolFlagDef{
+		{Name: "aws-s3-force-path-style", EnvKey: "AWS_S3_FORCE_PATH_STYLE", Usage: "force the request to use path-style addressing, i.e., `http://s3.amazonaws.com/BUCKET/KEY`. By default, the S3 client will use virtual hosted bucket addressing when possible (`http://BUCKET.s3.amazonaws.com/KEY`)"},
+	},
+	Missing:   RequireSettings("aws-access-key-id", "aws-secret-access-key", "aws-bucket"),
+	Location:  LocationSettings("aws-endpoint", "aws-bucket"),
+	New:       newAwsS3Backend,
+	URLScheme: "s3",
+	ParseURL:  parseAwsS3URL,
+	Instance: func(storageBackend Storage) (string, bool) {
+		s3, ok := storageBackend.(*AwsS3)
+		if !ok {
+			return "", false
+		}
+		return s3.InstanceName, true
+	},
+}
+
+func newAwsS3Backend(_ context.Context, config BackendConfig) (Storage, error) {
+	settings := config.Settings
+	s3 := new(AwsS3)
+	if err := s3.Init(settings.Get("aws-endpoint"), settings.Get("aws-access-key-id"), settings.Get("aws-secret-access-key"), settings.Get("aws-region"), settings.Get("aws-bucket"), settings.Bool("aws-s3-force-path-style"), config.ExpiryDays, config.BackupPrefix); err != nil {
+		return nil, err
+	}
+	s3.Transfers = config.Transfers
+	s3.Bandwidth = config.Bandwidth
+	s3.InstanceName = config.InstanceName
+	s3.NameTemplate = config.NameTemplate
+	return s3, nil
+}
+
+// parseAwsS3URL reads s3://<bucket>/<prefix>?region=&endpoint=&force-path-style=.
+func parseAwsS3URL(location *url.URL, settings BackendSettings) (string, error) {
+	if err := CheckURLParameters(location, "region", "endpoint", "force-path-style"); err != nil {
+		return "", err
+	}
+	if location.Host == "" {
+		return "", errors.New("missing bucket name")
+	}
+
+	query := location.Query()
+	settings["aws-bucket"] = location.Host
+	if region := query.Get("region"); region != "" {
+		settings["aws-region"] = region
+	}
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		settings["aws-endpoint"] = endpoint
+	}
+	if raw := query.Get("force-path-style"); raw != "" {
+		forcePathStyle, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", errors.New("force-path-style must be true or false")
+		}
+		settings.SetBool("aws-s3-force-path-style", forcePathStyle)
+	}
+	return strings.Trim(location.Path, "/"), nil
 }
 
 func (this *AwsS3) Init(endpoint string, accessKeyId string, secretAccessKey string, region string, bucket string, s3ForcePathStyle bool, expiryDays int, backupPrefix string) error {
@@ -65,7 +155,7 @@ func (this *AwsS3) GetTargetObjectName(ctx context.Context, objectKey string) (s
 		return this.getLastUpdatedObjectName(ctx)
 	}
 
-	resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, objectKey, func(candidate string) (bool, error) {
+	resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, this.NameTemplate, objectKey, func(candidate string) (bool, error) {
 		err := this.headObject(ctx, candidate)
 		if err == nil {
 			return true, nil
@@ -98,7 +188,7 @@ func (this *AwsS3) getLastUpdatedObjectName(ctx context.Context) (string, error)
 			candidates = append(candidates, objectTimestamp{Name: *obj.Key, ModifiedAt: *obj.LastModified})
 		}
 
-		pageLatest, ok := latestEligibleObject(candidates, this.BackupPrefix)
+		pageLatest, ok := latestEligibleObject(candidates, this.BackupPrefix, this.NameTemplate)
 		if ok {
 			latestPtr := chooseLaterObject(func() *objectTimestamp {
 				if !hasLatest {
@@ -135,11 +225,17 @@ func (this *AwsS3) Upload(ctx context.Context, blobName string, filePath string)
 	}
 	defer file.Close()
 
+	if info, err := file.Stat(); err == nil && this.Transfers.resumable(info.Size()) {
+		return uploadResumably(ctx, this.Transfers, this.transferTarget(), blobName, filePath, func(objectName string) multipartUpload {
+			return &s3MultipartUpload{storage: this, objectName: objectName}
+		})
+	}
+
 	uploader := s3manager.NewUploader(this.Session)
 	input := &s3manager.UploadInput{
 		Bucket: aws.String(this.Bucket),
 		Key:    aws.String(blobName),
-		Body:   file,
+		Body:   this.Bandwidth.reader(ctx, transferUpload, file),
 	}
 
 	output, err := uploader.UploadWithContext(ctx, input)
@@ -157,9 +253,19 @@ func (this *AwsS3) Upload(ctx context.Context, blobName string, filePath string)
 func (this *AwsS3) Download(ctx context.Context, objectName string, filePath string) error {
 	ctx = contextOrBackground(ctx)
 
+	if this.Transfers != nil {
+		return downloadResumably(ctx, this.Transfers, this.transferTarget(), objectName, filePath, &s3RangedDownload{storage: this, objectName: objectName}, func() error {
+			return this.download(ctx, objectName, filePath)
+		})
+	}
+
+	return this.download(ctx, objectName, filePath)
+}
+
+func (this *AwsS3) download(ctx context.Context, objectName string, filePath string) error {
 	downloader := s3manager.NewDownloader(this.Session)
 	return utils.WriteFileAtomically(filePath, func(dest *os.File) error {
-		_, err := downloader.DownloadWithContext(ctx, dest, &s3.GetObjectInput{
+		_, err := downloader.DownloadWithContext(ctx, this.Bandwidth.writerAt(ctx, transferDownload, dest), &s3.GetObjectInput{
 			Bucket: aws.String(this.Bucket),
 			Key:    aws.String(objectName),
 		})
@@ -181,7 +287,7 @@ func (this *AwsS3) DeleteOldObjects(ctx context.Context, currentObjectName strin
 	svc := this.Service
 	bucket := aws.String(this.Bucket)
 
-	now := time.Now()
+	now := currentTime(this.Now)
 	var pageErr error
 
 	err := svc.ListObjectsV2PagesWithContext(ctx, newS3ListObjectsInput(this.Bucket, this.BackupPrefix), func(page *s3.ListObjectsV2Output, lastPage bool) bool {
@@ -196,7 +302,7 @@ func (this *AwsS3) DeleteOldObjects(ctx context.Context, currentObjectName strin
 			candidates = append(candidates, objectTimestamp{Name: *obj.Key, ModifiedAt: *obj.LastModified})
 		}
 
-		pageErr = deleteExpiredObjects(candidates, this.BackupPrefix, this.ExpiryDays, now, currentObjectName, func(name string) error {
+		pageErr = deleteExpiredObjects(ctx, candidates, this.BackupPrefix, this.NameTemplate, this.ExpiryDays, now, currentObjectName, objectPinLookup(ctx, this), func(name string) error {
 			_, delErr := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 				Bucket: bucket,
 				Key:    aws.String(name),
@@ -223,10 +329,325 @@ func (this *AwsS3) DeleteOldObjects(ctx context.Context, currentObjectName strin
 	return nil
 }
 
+// ReclaimAbandonedUploads aborts multipart uploads under the backup prefix that
+// were started more than olderThan ago and are not being resumed.
+func (this *AwsS3) ReclaimAbandonedUploads(ctx context.Context, olderThan time.Duration) ([]ReclaimedUpload, error) {
+	ctx = contextOrBackground(ctx)
+	cutoff := time.Now().Add(-olderThan)
+
+	stale := make([]*s3.MultipartUpload, 0)
+	err := this.Service.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(this.Bucket),
+		Prefix: aws.String(this.BackupPrefix),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if upload == nil || upload.Key == nil || upload.UploadId == nil || upload.Initiated == nil {
+				continue
+			}
+			if upload.Initiated.After(cutoff) || this.Transfers.activeUpload(this.transferTarget(), *upload.Key, *upload.UploadId) {
+				continue
+			}
+			stale = append(stale, upload)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+	}
+
+	reclaimed := make([]ReclaimedUpload, 0, len(stale))
+	for _, upload := range stale {
+		session := &s3MultipartUpload{storage: this, objectName: *upload.Key}
+		var size int64
+		_ = this.Service.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+			Bucket:   aws.String(this.Bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+			for _, part := range page.Parts {
+				if part != nil {
+					size += aws.Int64Value(part.Size)
+				}
+			}
+			return true
+		})
+
+		if err := session.abort(ctx, *upload.UploadId, nil); err != nil {
+			return reclaimed, fmt.Errorf("failed to abort multipart upload for %s: %w", *upload.Key, err)
+		}
+		reclaimed = append(reclaimed, ReclaimedUpload{
+			Object: *upload.Key,
+			Detail: "multipart upload " + *upload.UploadId,
+			Bytes:  size,
+		})
+	}
+
+	return reclaimed, nil
+}
+
 func (this *AwsS3) Close() error {
 	return nil
 }
 
+func (this *AwsS3) ManagedPrefix() string {
+	return this.BackupPrefix
+}
+
+func (this *AwsS3) ManagedNameTemplate() *NameTemplate {
+	return this.NameTemplate
+}
+
+func (this *AwsS3) ListBackups(ctx context.Context) ([]BackupObject, error) {
+	ctx = contextOrBackground(ctx)
+
+	candidates := make([]objectTimestamp, 0)
+	err := this.Service.ListObjectsV2PagesWithContext(ctx, newS3ListObjectsInput(this.Bucket, this.BackupPrefix), func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if obj == nil || obj.Key == nil || obj.LastModified == nil {
+				continue
+			}
+			candidates = append(candidates, objectTimestamp{Name: *obj.Key, ModifiedAt: *obj.LastModified, Size: aws.Int64Value(obj.Size)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return backupObjects(candidates, this.BackupPrefix, this.NameTemplate), nil
+}
+
+func (this *AwsS3) ListObjects(ctx context.Context, prefix string) ([]BackupObject, error) {
+	ctx = contextOrBackground(ctx)
+
+	objects := make([]BackupObject, 0)
+	err := this.Service.ListObjectsV2PagesWithContext(ctx, newS3ListObjectsInput(this.Bucket, prefix), func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if obj == nil || obj.Key == nil || obj.LastModified == nil {
+				continue
+			}
+			objects = append(objects, BackupObject{Name: *obj.Key, ModifiedAt: *obj.LastModified, Size: aws.Int64Value(obj.Size)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (this *AwsS3) DeleteObject(ctx context.Context, objectName string) error {
+	_, err := this.Service.DeleteObjectWithContext(contextOrBackground(ctx), &s3.DeleteObjectInput{
+		Bucket: aws.String(this.Bucket),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+// PinObject records reason in the pinned object tag, keeping the object's other
+// tags. Tagging does not change the object's LastModified time.
+func (this *AwsS3) PinObject(ctx context.Context, objectName string, reason string) error {
+	ctx = contextOrBackground(ctx)
+
+	tags, err := this.objectTags(ctx, objectName)
+	if err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	tags = slices.DeleteFunc(tags, isS3PinTag)
+	tags = append(tags, &s3.Tag{Key: aws.String(pinTagKey), Value: aws.String(reason)})
+	if err := this.putObjectTags(ctx, objectName, tags); err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *AwsS3) UnpinObject(ctx context.Context, objectName string) error {
+	ctx = contextOrBackground(ctx)
+
+	tags, err := this.objectTags(ctx, objectName)
+	if err != nil {
+		return fmt.Errorf("failed to unpin object %q: %w", objectName, err)
+	}
+	if !slices.ContainsFunc(tags, isS3PinTag) {
+		return nil
+	}
+	if err := this.putObjectTags(ctx, objectName, slices.DeleteFunc(tags, isS3PinTag)); err != nil {
+		return fmt.Errorf("failed to unpin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *AwsS3) ObjectPin(ctx context.Context, objectName string) (string, bool, error) {
+	tags, err := this.objectTags(contextOrBackground(ctx), objectName)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the pin of object %q: %w", objectName, err)
+	}
+	for _, tag := range tags {
+		if isS3PinTag(tag) {
+			return aws.StringValue(tag.Value), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (this *AwsS3) objectTags(ctx context.Context, objectName string) ([]*s3.Tag, error) {
+	output, err := this.Service.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(this.Bucket),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.TagSet, nil
+}
+
+func (this *AwsS3) putObjectTags(ctx context.Context, objectName string, tags []*s3.Tag) error {
+	if len(tags) == 0 {
+		_, err := this.Service.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{
+			Bucket: aws.String(this.Bucket),
+			Key:    aws.String(objectName),
+		})
+		return err
+	}
+
+	_, err := this.Service.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(this.Bucket),
+		Key:     aws.String(objectName),
+		Tagging: &s3.Tagging{TagSet: tags},
+	})
+	return err
+}
+
+func isS3PinTag(tag *s3.Tag) bool {
+	return tag != nil && aws.StringValue(tag.Key) == pinTagKey
+}
+
+func (this *AwsS3) transferTarget() string {
+	return "aws:" + this.Endpoint + "/" + this.Bucket
+}
+
+func (this *s3MultipartUpload) begin(ctx context.Context) (string, error) {
+	output, err := this.storage.Service.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(this.storage.Bucket),
+		Key:    aws.String(this.objectName),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.UploadId), nil
+}
+
+func (this *s3MultipartUpload) resume(ctx context.Context, sessionID string, parts []TransferPart) ([]TransferPart, error) {
+	remote := map[int64]string{}
+	err := this.storage.Service.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(this.storage.Bucket),
+		Key:      aws.String(this.objectName),
+		UploadId: aws.String(sessionID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			if part != nil && part.PartNumber != nil {
+				remote[*part.PartNumber] = aws.StringValue(part.ETag)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		if isS3NoSuchUpload(err) {
+			return nil, errTransferSessionGone
+		}
+		return nil, err
+	}
+
+	confirmed := make([]TransferPart, 0, len(parts))
+	for _, part := range parts {
+		if etag, ok := remote[int64(part.Number)]; ok && etag == part.ETag {
+			confirmed = append(confirmed, part)
+		}
+	}
+	return confirmed, nil
+}
+
+func (this *s3MultipartUpload) uploadPart(ctx context.Context, sessionID string, part TransferPart, body io.ReadSeeker) (string, error) {
+	output, err := this.storage.Service.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(this.storage.Bucket),
+		Key:           aws.String(this.objectName),
+		UploadId:      aws.String(sessionID),
+		PartNumber:    aws.Int64(int64(part.Number)),
+		ContentLength: aws.Int64(part.Size),
+		Body:          this.storage.Bandwidth.readSeeker(ctx, transferUpload, body),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.ETag), nil
+}
+
+func (this *s3MultipartUpload) complete(ctx context.Context, sessionID string, parts []TransferPart) (string, error) {
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.Number)),
+		})
+	}
+
+	output, err := this.storage.Service.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(this.storage.Bucket),
+		Key:             aws.String(this.objectName),
+		UploadId:        aws.String(sessionID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := this.storage.headObject(ctx, this.objectName); err != nil {
+		return "", fmt.Errorf("failed to verify uploaded object: %w", err)
+	}
+
+	return aws.StringValue(output.ETag), nil
+}
+
+func (this *s3MultipartUpload) abort(ctx context.Context, sessionID string, parts []TransferPart) error {
+	_, err := this.storage.Service.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(this.storage.Bucket),
+		Key:      aws.String(this.objectName),
+		UploadId: aws.String(sessionID),
+	})
+	if err != nil && !isS3NoSuchUpload(err) {
+		return err
+	}
+	return nil
+}
+
+func (this *s3RangedDownload) stat(ctx context.Context) (string, int64, error) {
+	output, err := this.storage.Service.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(this.storage.Bucket),
+		Key:    aws.String(this.objectName),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return aws.StringValue(output.ETag), aws.Int64Value(output.ContentLength), nil
+}
+
+func (this *s3RangedDownload) readRange(ctx context.Context, version string, offset int64) (io.ReadCloser, error) {
+	output, err := this.storage.Service.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(this.storage.Bucket),
+		Key:     aws.String(this.objectName),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-", offset)),
+		IfMatch: aws.String(version),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.storage.Bandwidth.readCloser(ctx, transferDownload, output.Body), nil
+}
+
 func (this *AwsS3) headObject(ctx context.Context, objectKey string) error {
 	_, err := this.Service.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(this.Bucket),
@@ -248,3 +669,98 @@ func isS3NotFound(err error) bool {
 	var awsErr awserr.Error
 	return errors.As(err, &awsErr) && awsErr.Code() == "NotFound"
 }
+
+func isS3NoSuchUpload(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchUpload
+}
+
+// ReadLease returns the content of a lease object and its ETag as its
+// version.
+func (this *AwsS3) ReadLease(ctx context.Context, name string) ([]byte, string, error) {
+	output, err := this.Service.GetObjectWithContext(contextOrBackground(ctx), &s3.GetObjectInput{
+		Bucket: aws.String(this.Bucket),
+		Key:    aws.String(name),
+	})
+	if isS3NotFound(err) || isS3NoSuchKey(err) {
+		return nil, "", ErrLeaseNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	return data, aws.StringValue(output.ETag), nil
+}
+
+// WriteLease writes a lease object with an If-None-Match or If-Match
+// condition. The SDK has no fields for these conditions on PutObject, so they
+// are set as headers.
+func (this *AwsS3) WriteLease(ctx context.Context, name string, data []byte, version string) (string, error) {
+	request, output := this.Service.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(this.Bucket),
+		Key:         aws.String(name),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	request.SetContext(contextOrBackground(ctx))
+	setS3WriteCondition(request.HTTPRequest.Header, version)
+	if err := request.Send(); err != nil {
+		if isS3ConditionFailed(err) {
+			return "", ErrLeaseConflict
+		}
+		return "", fmt.Errorf("failed to write lease %q: %w", name, err)
+	}
+	return aws.StringValue(output.ETag), nil
+}
+
+// DeleteLease deletes a lease object with an If-Match condition.
+func (this *AwsS3) DeleteLease(ctx context.Context, name string, version string) error {
+	request, _ := this.Service.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(this.Bucket),
+		Key:    aws.String(name),
+	})
+	request.SetContext(contextOrBackground(ctx))
+	setS3WriteCondition(request.HTTPRequest.Header, version)
+	if err := request.Send(); err != nil {
+		if isS3ConditionFailed(err) {
+			return ErrLeaseConflict
+		}
+		return fmt.Errorf("failed to delete lease %q: %w", name, err)
+	}
+	return nil
+}
+
+// setS3WriteCondition requires that the object does not exist when version is
+// empty, and that it still has the ETag version otherwise.
+func setS3WriteCondition(header http.Header, version string) {
+	if version == "" {
+		header.Set("If-None-Match", "*")
+		return
+	}
+	header.Set("If-Match", version)
+}
+
+// isS3ConditionFailed reports whether a conditional write failed: the
+// condition did not hold, a concurrent conditional write won, or the object
+// to replace is gone.
+func isS3ConditionFailed(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if !errors.As(err, &requestFailure) {
+		return false
+	}
+	switch requestFailure.StatusCode() {
+	case http.StatusPreconditionFailed, http.StatusConflict, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+func isS3NoSuchKey(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey
+}
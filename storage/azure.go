@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -14,6 +19,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/egose/database-tools/flagdef"
 	"github.com/egose/database-tools/utils"
 	mlog "github.com/mongodb/mongo-tools/common/log"
 )
@@ -27,6 +33,77 @@ type AzBlob struct {
 	BlobContainerClient *container.Client
 	ExpiryDays          int
 	BackupPrefix        string
+	NameTemplate        *NameTemplate
+	Transfers           *TransferStateStore
+	Bandwidth           *Bandwidth
+	InstanceName        string
+	Now                 func() time.Time
+}
+
+var azureBackendType = BackendType{
+	Name:  BackendAzure,
+	Label: "Azure",
+	StringFlags: []flagdef.StringFlagDef{
+		{Name: "az-endpoint", EnvKey: "AZ_ENDPOINT", Usage: "specify the emulator hostname and Azure Blob Storage port"},
+		{Name: "az-account-name", EnvKey: "AZ_ACCOUNT_NAME", Usage: "Azure Blob Storage Account Name"},
+		{Name: "az-account-key", EnvKey: "AZ_ACCOUNT_KEY", Usage: "Azure Blob Storage Account Key"},
+		{Name: "az-container-name", EnvKey: "AZ_CONTAINER_NAME", Usage: "Azure Blob Storage Container Name"},
+	},
+	Missing:   RequireSettings("az-account-name", "az-account-key", "az-container-name"),
+	Location:  LocationSettings("az-endpoint", "az-account-name", "az-container-name"),
+	New:       newAzBlobBackend,
+	URLScheme: "az",
+	ParseURL:  parseAzBlobURL,
+	Instance: func(storageBackend Storage) (string, bool) {
+		az, ok := storageBackend.(*AzBlob)
+		if !ok {
+			return "", false
+		}
+		return az.InstanceName, true
+	},
+}
+
+type azureMultipartUpload struct {
+	storage  *AzBlob
+	blobName string
+}
+
+type azureRangedDownload struct {
+	storage  *AzBlob
+	blobName string
+}
+
+func newAzBlobBackend(_ context.Context, config BackendConfig) (Storage, error) {
+	settings := config.Settings
+	az := new(AzBlob)
+	if err := az.Init(settings.Get("az-account-name"), settings.Get("az-account-key"), settings.Get("az-container-name"), settings.Get("az-endpoint"), config.ExpiryDays, config.BackupPrefix); err != nil {
+		return nil, err
+	}
+	az.Transfers = config.Transfers
+	az.Bandwidth = config.Bandwidth
+	az.InstanceName = config.InstanceName
+	az.NameTemplate = config.NameTemplate
+	return az, nil
+}
+
+// parseAzBlobURL reads az://<container>/<prefix>?account=&endpoint=.
+func parseAzBlobURL(location *url.URL, settings BackendSettings) (string, error) {
+	if err := CheckURLParameters(location, "account", "endpoint"); err != nil {
+		return "", err
+	}
+	if location.Host == "" {
+		return "", errors.New("missing container name")
+	}
+
+	query := location.Query()
+	settings["az-container-name"] = location.Host
+	if account := query.Get("account"); account != "" {
+		settings["az-account-name"] = account
+	}
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		settings["az-endpoint"] = endpoint
+	}
+	return strings.Trim(location.Path, "/"), nil
 }
 
 func (this *AzBlob) Init(accountName string, accountKey string, containerName string, endpoint string, expiryDays int, backupPrefix string) error {
@@ -83,7 +160,7 @@ func (this *AzBlob) GetTargetObjectName(ctx context.Context, blobName string) (s
 	ctx = contextOrBackground(ctx)
 
 	if blobName != "" {
-		resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, blobName, func(candidate string) (bool, error) {
+		resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, this.NameTemplate, blobName, func(candidate string) (bool, error) {
 			_, err := this.getBlockBlobClient(candidate).GetProperties(ctx, &blob.GetPropertiesOptions{})
 			if err == nil {
 				return true, nil
@@ -124,7 +201,7 @@ func (this *AzBlob) GetTargetObjectName(ctx context.Context, blobName string) (s
 			})
 		}
 
-		pageLatest, ok := latestEligibleObject(candidates, this.BackupPrefix)
+		pageLatest, ok := latestEligibleObject(candidates, this.BackupPrefix, this.NameTemplate)
 		if ok {
 			latest = chooseLaterObject(latest, pageLatest)
 		}
@@ -146,12 +223,18 @@ func (this *AzBlob) Upload(ctx context.Context, blobName string, filePath string
 	}
 	defer file.Close()
 
+	if info, err := file.Stat(); err == nil && this.Transfers.resumable(info.Size()) {
+		return uploadResumably(ctx, this.Transfers, this.transferTarget(), blobName, filePath, func(objectName string) multipartUpload {
+			return &azureMultipartUpload{storage: this, blobName: objectName}
+		})
+	}
+
 	blockBlobClient := this.getBlockBlobClient(blobName)
 	blockBlobUploadOptions := blockblob.UploadOptions{
 		// Metadata: map[string]string{"meta": "value"},
 		// Tags:     map[string]string{"tag": "value"},
 	}
-	uploadResp, err := blockBlobClient.Upload(ctx, streaming.NopCloser(file), &blockBlobUploadOptions)
+	uploadResp, err := blockBlobClient.Upload(ctx, streaming.NopCloser(this.Bandwidth.readSeeker(ctx, transferUpload, file)), &blockBlobUploadOptions)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload object: %v", err)
 	}
@@ -175,7 +258,34 @@ func toGeneratedETagString(etag *azcore.ETag) *string {
 func (this *AzBlob) Download(ctx context.Context, blobName string, filePath string) error {
 	ctx = contextOrBackground(ctx)
 
+	if this.Transfers != nil {
+		return downloadResumably(ctx, this.Transfers, this.transferTarget(), blobName, filePath, &azureRangedDownload{storage: this, blobName: blobName}, func() error {
+			return this.download(ctx, blobName, filePath)
+		})
+	}
+
+	return this.download(ctx, blobName, filePath)
+}
+
+func (this *AzBlob) download(ctx context.Context, blobName string, filePath string) error {
 	blockBlobClient := this.getBlockBlobClient(blobName)
+	if this.Bandwidth.limited(transferDownload) {
+		// DownloadFile writes ranges straight into the file from parallel
+		// workers, so a throttled download streams the blob instead.
+		return utils.WriteFileAtomically(filePath, func(dest *os.File) error {
+			resp, err := blockBlobClient.DownloadStream(ctx, nil)
+			if err != nil {
+				return fmt.Errorf("failed to download object: %w", err)
+			}
+			body := this.Bandwidth.readCloser(ctx, transferDownload, resp.Body)
+			defer body.Close()
+			if _, err := io.Copy(dest, body); err != nil {
+				return fmt.Errorf("failed to download object: %w", err)
+			}
+			return nil
+		})
+	}
+
 	downloadOptions := &azblob.DownloadFileOptions{
 		Progress: func(bytesTransferred int64) {
 			mlog.Logvf(mlog.Info, "Downloaded %d bytes", bytesTransferred)
@@ -199,7 +309,7 @@ func (this *AzBlob) DeleteOldObjects(ctx context.Context, currentObjectName stri
 	}
 
 	pager := this.BlobContainerClient.NewListBlobsFlatPager(newAzureListBlobsFlatOptions(this.BackupPrefix))
-	now := time.Now()
+	now := currentTime(this.Now)
 
 	for pager.More() {
 		resp, err := pager.NextPage(ctx)
@@ -218,7 +328,7 @@ func (this *AzBlob) DeleteOldObjects(ctx context.Context, currentObjectName stri
 			candidates = append(candidates, objectTimestamp{Name: *item.Name, ModifiedAt: *item.Properties.LastModified})
 		}
 
-		if err := deleteExpiredObjects(candidates, this.BackupPrefix, this.ExpiryDays, now, currentObjectName, func(name string) error {
+		if err := deleteExpiredObjects(ctx, candidates, this.BackupPrefix, this.NameTemplate, this.ExpiryDays, now, currentObjectName, objectPinLookup(ctx, this), func(name string) error {
 			_, err := this.getBlockBlobClient(name).Delete(ctx, nil)
 			if err == nil {
 				mlog.Logvf(mlog.Info, "Deleted object: %s", name)
@@ -232,6 +342,376 @@ func (this *AzBlob) DeleteOldObjects(ctx context.Context, currentObjectName stri
 	return nil
 }
 
+// ReclaimAbandonedUploads discards blobs under the backup prefix that consist
+// only of uncommitted blocks older than olderThan. Blocks staged onto an
+// already committed blob cannot be discarded and expire on their own.
+func (this *AzBlob) ReclaimAbandonedUploads(ctx context.Context, olderThan time.Duration) ([]ReclaimedUpload, error) {
+	ctx = contextOrBackground(ctx)
+	cutoff := time.Now().Add(-olderThan)
+
+	options := newAzureListBlobsFlatOptions(this.BackupPrefix)
+	options.Include = container.ListBlobsInclude{UncommittedBlobs: true}
+	pager := this.BlobContainerClient.NewListBlobsFlatPager(options)
+
+	reclaimed := make([]ReclaimedUpload, 0)
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return reclaimed, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, item := range resp.Segment.BlobItems {
+			if item == nil || item.Name == nil || item.Properties == nil || item.Properties.LastModified == nil {
+				continue
+			}
+			if item.Properties.ContentLength != nil && *item.Properties.ContentLength > 0 {
+				continue
+			}
+			if item.Properties.LastModified.After(cutoff) || this.Transfers.activeUpload(this.transferTarget(), *item.Name, "") {
+				continue
+			}
+
+			blocks, err := this.getBlockBlobClient(*item.Name).GetBlockList(ctx, blockblob.BlockListTypeAll, nil)
+			if err != nil {
+				return reclaimed, fmt.Errorf("failed to list blocks of %s: %w", *item.Name, err)
+			}
+			if len(blocks.CommittedBlocks) > 0 || len(blocks.UncommittedBlocks) == 0 {
+				continue
+			}
+
+			var size int64
+			for _, block := range blocks.UncommittedBlocks {
+				if block != nil && block.Size != nil {
+					size += *block.Size
+				}
+			}
+
+			session := &azureMultipartUpload{storage: this, blobName: *item.Name}
+			if err := session.abort(ctx, "", nil); err != nil {
+				return reclaimed, fmt.Errorf("failed to discard uncommitted blocks of %s: %w", *item.Name, err)
+			}
+			reclaimed = append(reclaimed, ReclaimedUpload{
+				Object: *item.Name,
+				Detail: fmt.Sprintf("%d uncommitted block(s)", len(blocks.UncommittedBlocks)),
+				Bytes:  size,
+			})
+		}
+	}
+
+	return reclaimed, nil
+}
+
 func (this *AzBlob) Close() error {
 	return nil
 }
+
+func (this *AzBlob) ManagedPrefix() string {
+	return this.BackupPrefix
+}
+
+func (this *AzBlob) ManagedNameTemplate() *NameTemplate {
+	return this.NameTemplate
+}
+
+func (this *AzBlob) ListBackups(ctx context.Context) ([]BackupObject, error) {
+	ctx = contextOrBackground(ctx)
+
+	pager := this.BlobContainerClient.NewListBlobsFlatPager(newAzureListBlobsFlatOptions(this.BackupPrefix))
+	candidates := make([]objectTimestamp, 0)
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, item := range resp.Segment.BlobItems {
+			if item == nil || item.Name == nil || item.Properties == nil || item.Properties.LastModified == nil {
+				continue
+			}
+			var size int64
+			if item.Properties.ContentLength != nil {
+				size = *item.Properties.ContentLength
+			}
+			candidates = append(candidates, objectTimestamp{Name: *item.Name, ModifiedAt: *item.Properties.LastModified, Size: size})
+		}
+	}
+
+	return backupObjects(candidates, this.BackupPrefix, this.NameTemplate), nil
+}
+
+func (this *AzBlob) ListObjects(ctx context.Context, prefix string) ([]BackupObject, error) {
+	ctx = contextOrBackground(ctx)
+
+	pager := this.BlobContainerClient.NewListBlobsFlatPager(newAzureListBlobsFlatOptions(prefix))
+	objects := make([]BackupObject, 0)
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, item := range resp.Segment.BlobItems {
+			if item == nil || item.Name == nil || item.Properties == nil || item.Properties.LastModified == nil {
+				continue
+			}
+			var size int64
+			if item.Properties.ContentLength != nil {
+				size = *item.Properties.ContentLength
+			}
+			objects = append(objects, BackupObject{Name: *item.Name, ModifiedAt: *item.Properties.LastModified, Size: size})
+		}
+	}
+
+	return objects, nil
+}
+
+func (this *AzBlob) DeleteObject(ctx context.Context, objectName string) error {
+	if _, err := this.getBlockBlobClient(objectName).Delete(contextOrBackground(ctx), nil); err != nil {
+		return fmt.Errorf("failed to delete object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+// PinObject records reason in the pinned blob index tag, keeping the blob's
+// other tags. Index tags do not change the blob's Last-Modified time.
+func (this *AzBlob) PinObject(ctx context.Context, objectName string, reason string) error {
+	ctx = contextOrBackground(ctx)
+
+	tags, err := this.blobTags(ctx, objectName)
+	if err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	tags[pinTagKey] = reason
+	if _, err := this.getBlockBlobClient(objectName).SetTags(ctx, tags, nil); err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *AzBlob) UnpinObject(ctx context.Context, objectName string) error {
+	ctx = contextOrBackground(ctx)
+
+	tags, err := this.blobTags(ctx, objectName)
+	if err != nil {
+		return fmt.Errorf("failed to unpin object %q: %w", objectName, err)
+	}
+	if _, ok := tags[pinTagKey]; !ok {
+		return nil
+	}
+	delete(tags, pinTagKey)
+	if _, err := this.getBlockBlobClient(objectName).SetTags(ctx, tags, nil); err != nil {
+		return fmt.Errorf("failed to unpin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *AzBlob) ObjectPin(ctx context.Context, objectName string) (string, bool, error) {
+	tags, err := this.blobTags(contextOrBackground(ctx), objectName)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the pin of object %q: %w", objectName, err)
+	}
+	reason, ok := tags[pinTagKey]
+	return reason, ok, nil
+}
+
+func (this *AzBlob) blobTags(ctx context.Context, objectName string) (map[string]string, error) {
+	resp, err := this.getBlockBlobClient(objectName).GetTags(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(resp.BlobTagSet))
+	for _, tag := range resp.BlobTagSet {
+		if tag == nil || tag.Key == nil || tag.Value == nil {
+			continue
+		}
+		tags[*tag.Key] = *tag.Value
+	}
+	return tags, nil
+}
+
+func (this *AzBlob) transferTarget() string {
+	return "azure:" + this.Endpoint + "/" + this.AccountName + "/" + this.ContainerName
+}
+
+// Block IDs must all have the same length within a blob, so the part number is
+// zero-padded to the maximum part count.
+func azureBlockID(sessionID string, number int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%05d", sessionID, number)))
+}
+
+func (this *azureMultipartUpload) begin(ctx context.Context) (string, error) {
+	return newTransferSessionID()
+}
+
+func (this *azureMultipartUpload) resume(ctx context.Context, sessionID string, parts []TransferPart) ([]TransferPart, error) {
+	resp, err := this.storage.getBlockBlobClient(this.blobName).GetBlockList(ctx, blockblob.BlockListTypeUncommitted, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ResourceNotFound) {
+			return nil, errTransferSessionGone
+		}
+		return nil, err
+	}
+
+	staged := map[string]bool{}
+	for _, block := range resp.UncommittedBlocks {
+		if block != nil && block.Name != nil {
+			staged[*block.Name] = true
+		}
+	}
+	if len(staged) == 0 {
+		return nil, errTransferSessionGone
+	}
+
+	confirmed := make([]TransferPart, 0, len(parts))
+	for _, part := range parts {
+		if staged[part.ETag] {
+			confirmed = append(confirmed, part)
+		}
+	}
+	return confirmed, nil
+}
+
+func (this *azureMultipartUpload) uploadPart(ctx context.Context, sessionID string, part TransferPart, body io.ReadSeeker) (string, error) {
+	blockID := azureBlockID(sessionID, part.Number)
+	if _, err := this.storage.getBlockBlobClient(this.blobName).StageBlock(ctx, blockID, streaming.NopCloser(this.storage.Bandwidth.readSeeker(ctx, transferUpload, body)), nil); err != nil {
+		return "", err
+	}
+	return blockID, nil
+}
+
+func (this *azureMultipartUpload) complete(ctx context.Context, sessionID string, parts []TransferPart) (string, error) {
+	blockIDs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		blockIDs = append(blockIDs, part.ETag)
+	}
+
+	blockBlobClient := this.storage.getBlockBlobClient(this.blobName)
+	resp, err := blockBlobClient.CommitBlockList(ctx, blockIDs, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := blockBlobClient.GetProperties(ctx, &blob.GetPropertiesOptions{}); err != nil {
+		return "", fmt.Errorf("failed to verify uploaded object: %w", err)
+	}
+
+	return *toGeneratedETagString(resp.ETag), nil
+}
+
+// Azure has no API to discard staged blocks; they are garbage collected after
+// seven days. When the blob was never committed, committing an empty block
+// list and deleting the result discards them immediately.
+func (this *azureMultipartUpload) abort(ctx context.Context, sessionID string, parts []TransferPart) error {
+	blockBlobClient := this.storage.getBlockBlobClient(this.blobName)
+	resp, err := blockBlobClient.GetBlockList(ctx, blockblob.BlockListTypeCommitted, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ResourceNotFound) {
+			return nil
+		}
+		return err
+	}
+	if len(resp.CommittedBlocks) > 0 {
+		return nil
+	}
+
+	if _, err := blockBlobClient.CommitBlockList(ctx, []string{}, nil); err != nil {
+		return err
+	}
+	if _, err := blockBlobClient.Delete(ctx, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (this *azureRangedDownload) stat(ctx context.Context) (string, int64, error) {
+	props, err := this.storage.getBlockBlobClient(this.blobName).GetProperties(ctx, &blob.GetPropertiesOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if props.ETag == nil || props.ContentLength == nil {
+		return "", 0, errors.New("object properties are missing etag or content length")
+	}
+	return string(*props.ETag), *props.ContentLength, nil
+}
+
+func (this *azureRangedDownload) readRange(ctx context.Context, version string, offset int64) (io.ReadCloser, error) {
+	etag := azcore.ETag(version)
+	resp, err := this.storage.getBlockBlobClient(this.blobName).DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset},
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.storage.Bandwidth.readCloser(ctx, transferDownload, resp.Body), nil
+}
+
+// ReadLease returns the content of a lease blob and its ETag as its version.
+func (this *AzBlob) ReadLease(ctx context.Context, name string) ([]byte, string, error) {
+	resp, err := this.getBlockBlobClient(name).DownloadStream(contextOrBackground(ctx), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ResourceNotFound) {
+		return nil, "", ErrLeaseNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	if resp.ETag == nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: missing ETag", name)
+	}
+	return data, string(*resp.ETag), nil
+}
+
+// WriteLease writes a lease blob with an If-None-Match or If-Match condition.
+func (this *AzBlob) WriteLease(ctx context.Context, name string, data []byte, version string) (string, error) {
+	resp, err := this.getBlockBlobClient(name).Upload(contextOrBackground(ctx), streaming.NopCloser(bytes.NewReader(data)), &blockblob.UploadOptions{
+		AccessConditions: azureLeaseConditions(version),
+	})
+	if isAzureConditionFailed(err) {
+		return "", ErrLeaseConflict
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write lease %q: %w", name, err)
+	}
+	if resp.ETag == nil {
+		return "", fmt.Errorf("failed to write lease %q: missing ETag", name)
+	}
+	return string(*resp.ETag), nil
+}
+
+// DeleteLease deletes a lease blob with an If-Match condition.
+func (this *AzBlob) DeleteLease(ctx context.Context, name string, version string) error {
+	_, err := this.getBlockBlobClient(name).Delete(contextOrBackground(ctx), &blob.DeleteOptions{
+		AccessConditions: azureLeaseConditions(version),
+	})
+	if isAzureConditionFailed(err) {
+		return ErrLeaseConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete lease %q: %w", name, err)
+	}
+	return nil
+}
+
+// azureLeaseConditions requires that the blob does not exist when version is
+// empty, and that it still has the ETag version otherwise.
+func azureLeaseConditions(version string) *blob.AccessConditions {
+	etag := azcore.ETagAny
+	conditions := &blob.ModifiedAccessConditions{IfNoneMatch: &etag}
+	if version != "" {
+		etag = azcore.ETag(version)
+		conditions = &blob.ModifiedAccessConditions{IfMatch: &etag}
+	}
+	return &blob.AccessConditions{ModifiedAccessConditions: conditions}
+}
+
+func isAzureConditionFailed(err error) bool {
+	return bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists, bloberror.BlobNotFound)
+}
@@ -1,14 +1,19 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
 	"time"
+
+	mlog "github.com/mongodb/mongo-tools/common/log"
 )
 
 const DefaultBackupPrefix = "mongo-archive/"
 
+// backupObjectPattern matches legacy backup names, which NameTemplate accepts
+// whatever the configured template.
 var backupObjectPattern = regexp.MustCompile(`^\d{13}-\d{4}-\d{2}-\d{2}T\d{6}\.\d{3}Z\.tar\.gz$`)
 
 func NormalizeBackupPrefix(prefix string) string {
@@ -21,23 +26,45 @@ func NormalizeBackupPrefix(prefix string) string {
 	return prefix + "/"
 }
 
-func BuildBackupObjectName(prefix string, filename string) (string, error) {
+// BuildBackupObjectName places the backup name filename, as generated by
+// template or in the legacy naming, under prefix.
+func BuildBackupObjectName(prefix string, template *NameTemplate, filename string) (string, error) {
 	filename = strings.TrimSpace(filename)
-	if !backupObjectPattern.MatchString(filename) {
+	if _, ok := template.parse(filename); !ok {
 		return "", fmt.Errorf("invalid backup filename %q", filename)
 	}
 
 	return NormalizeBackupPrefix(prefix) + filename, nil
 }
 
-func lookupObjectCandidates(prefix string, objectName string) []string {
+// BackendObjectName returns the name under which s stores the managed backup
+// objectName. A generated backup name is placed under the backend's own
+// backup prefix, which may differ from the prefix objectName was built with.
+// Other names, and backends that do not expose their prefix, are unchanged.
+func BackendObjectName(s Storage, objectName string) string {
+	lister, ok := s.(BackupLister)
+	if !ok {
+		return objectName
+	}
+	filename, ok := lister.ManagedNameTemplate().relativeName(objectName)
+	if !ok {
+		return objectName
+	}
+	return lister.ManagedPrefix() + filename
+}
+
+// LookupObjectCandidates lists the object names an explicit --object-name may
+// refer to, in lookup order: a backup name relative to the prefix, as template
+// generates it or as a legacy filename, is tried under the managed prefix
+// first, then every name is tried as given.
+func LookupObjectCandidates(prefix string, template *NameTemplate, objectName string) []string {
 	objectName = strings.TrimSpace(objectName)
 	if objectName == "" {
 		return nil
 	}
 
 	candidates := make([]string, 0, 2)
-	if !strings.Contains(objectName, "/") && backupObjectPattern.MatchString(objectName) {
+	if _, ok := template.parse(objectName); ok {
 		candidates = append(candidates, NormalizeBackupPrefix(prefix)+objectName)
 	}
 	candidates = append(candidates, objectName)
@@ -58,51 +85,86 @@ func lookupObjectCandidates(prefix string, objectName string) []string {
 	return unique
 }
 
-func isEligibleBackupObject(name string, prefix string) bool {
+// IsEligibleBackupObject reports whether name is a managed backup: a name
+// generated by template, or a legacy backup filename directly, under prefix.
+// Only eligible objects are considered for latest-object selection and
+// retention.
+func IsEligibleBackupObject(name string, prefix string, template *NameTemplate) bool {
+	_, ok := parseManagedName(name, prefix, template)
+	return ok
+}
+
+// parseManagedName parses name when it is a managed backup under prefix.
+func parseManagedName(name string, prefix string, template *NameTemplate) (backupName, bool) {
 	prefix = NormalizeBackupPrefix(prefix)
 	if !strings.HasPrefix(name, prefix) {
-		return false
+		return backupName{}, false
 	}
-
-	remainder := strings.TrimPrefix(name, prefix)
-	if remainder == "" || strings.Contains(remainder, "/") {
-		return false
-	}
-
-	return backupObjectPattern.MatchString(remainder)
+	return template.parse(strings.TrimPrefix(name, prefix))
 }
 
-func latestEligibleObject(candidates []objectTimestamp, prefix string) (objectTimestamp, bool) {
+func latestEligibleObject(candidates []objectTimestamp, prefix string, template *NameTemplate) (objectTimestamp, bool) {
 	filtered := make([]objectTimestamp, 0, len(candidates))
 	for _, candidate := range candidates {
-		if !isEligibleBackupObject(candidate.Name, prefix) {
+		parsed, ok := parseManagedName(candidate.Name, prefix, template)
+		if !ok {
 			continue
 		}
+		candidate.CreatedAt = parsed.createdAt
 		filtered = append(filtered, candidate)
 	}
 
 	return latestObject(filtered)
 }
 
-func deleteExpiredObjects(candidates []objectTimestamp, prefix string, expiryDays int, now time.Time, preserveName string, deleteFn func(string) error) error {
+// deleteExpiredObjects deletes the expired candidates that pinReason, when
+// set, does not report as pinned, and reports each deletion to the retention
+// observer of ctx.
+func deleteExpiredObjects(ctx context.Context, candidates []objectTimestamp, prefix string, template *NameTemplate, expiryDays int, now time.Time, preserveName string, pinReason func(string) (string, bool, error), deleteFn func(string) error) error {
+	for _, name := range expiredObjects(candidates, prefix, template, expiryDays, now, preserveName) {
+		if pinReason != nil {
+			reason, pinned, err := pinReason(name)
+			if err != nil {
+				return fmt.Errorf("failed to check whether object %q is pinned: %w", name, err)
+			}
+			if pinned {
+				mlog.Logvf(mlog.Always, "Keeping pinned object %s: %s", name, reason)
+				continue
+			}
+		}
+		if err := deleteFn(name); err != nil {
+			return fmt.Errorf("failed to delete object %q: %w", name, err)
+		}
+		observeRetention(ctx, name)
+	}
+
+	return nil
+}
+
+// expiredObjects returns the names of the eligible candidates older than
+// expiryDays, except preserveName. Age counts from the creation time in the
+// backup's name, so that a backup rewritten by a copy or tiered to another
+// backend expires when the original would. Zero expiryDays expires nothing.
+func expiredObjects(candidates []objectTimestamp, prefix string, template *NameTemplate, expiryDays int, now time.Time, preserveName string) []string {
 	if expiryDays == 0 {
 		return nil
 	}
 
+	expired := make([]string, 0)
 	for _, candidate := range candidates {
-		if !isEligibleBackupObject(candidate.Name, prefix) {
+		parsed, ok := parseManagedName(candidate.Name, prefix, template)
+		if !ok {
 			continue
 		}
 		if candidate.Name == preserveName {
 			continue
 		}
-		if !isExpired(candidate.ModifiedAt, expiryDays, now) {
+		candidate.CreatedAt = parsed.createdAt
+		if !isExpired(candidate.backupTime(), expiryDays, now) {
 			continue
 		}
-		if err := deleteFn(candidate.Name); err != nil {
-			return fmt.Errorf("failed to delete object %q: %w", candidate.Name, err)
-		}
+		expired = append(expired, candidate.Name)
 	}
 
-	return nil
+	return expired
 }
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// bandwidthChunkSize bounds every throttled read or write so that a single
+// call never asks the limiter for more tokens than its burst.
+const bandwidthChunkSize = 64 << 10
+
+// Bandwidth caps the rate, in bytes per second, at which a backend reads
+// archive data for uploads and writes it for downloads. A zero rate leaves
+// that direction unlimited. When Schedule has windows, the limits only apply
+// inside them, read in Location or, when it is nil, in the process's local
+// time zone. One Bandwidth is shared by every transfer on a backend, so
+// concurrent parts split the configured rate between them.
+type Bandwidth struct {
+	UploadRate   int64
+	DownloadRate int64
+	Schedule     BandwidthSchedule
+	Location     *time.Location
+
+	now      func() time.Time
+	mu       sync.Mutex
+	limiters map[transferDirection]*rate.Limiter
+}
+
+// BandwidthSchedule lists the daily windows in which rate limits apply. An
+// empty schedule applies them all day.
+type BandwidthSchedule []BandwidthWindow
+
+// BandwidthWindow is a time-of-day range measured from midnight in the
+// Bandwidth's time zone. A window whose End is before its Start wraps past
+// midnight.
+type BandwidthWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+type throttledReader struct {
+	ctx       context.Context
+	bandwidth *Bandwidth
+	direction transferDirection
+	reader    io.Reader
+}
+
+type throttledReadCloser struct {
+	throttledReader
+	closer io.Closer
+}
+
+// throttledReadSeeker only charges bytes past the furthest offset read so far,
+// so SDK retries and checksum passes that rewind the body are not throttled
+// twice.
+type throttledReadSeeker struct {
+	ctx       context.Context
+	bandwidth *Bandwidth
+	direction transferDirection
+	reader    io.ReadSeeker
+	offset    int64
+	charged   int64
+}
+
+type throttledWriterAt struct {
+	ctx       context.Context
+	bandwidth *Bandwidth
+	direction transferDirection
+	writer    io.WriterAt
+}
+
+// ParseByteRate parses a rate in bytes per second such as "1048576", "500KB"
+// or "10MiB/s". Decimal suffixes (KB, MB, GB) use powers of 1000 and binary
+// suffixes (KiB, MiB, GiB) powers of 1024. An empty value or 0 means unlimited.
+func ParseByteRate(raw string) (int64, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return 0, nil
+	}
+	value = strings.TrimSpace(strings.TrimSuffix(value, "/s"))
+
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+		{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9},
+		{"k", 1e3}, {"m", 1e6}, {"g", 1e9},
+		{"b", 1},
+	}
+	multiplier := 1.0
+	lower := strings.ToLower(value)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			multiplier = unit.multiplier
+			value = strings.TrimSpace(value[:len(value)-len(unit.suffix)])
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 || math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, fmt.Errorf("invalid byte rate %q", raw)
+	}
+	bytes := number * multiplier
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid byte rate %q", raw)
+	}
+	if bytes > 0 && bytes < 1 {
+		return 0, fmt.Errorf("byte rate %q is below 1 byte per second", raw)
+	}
+
+	return int64(bytes), nil
+}
+
+// ParseBandwidthSchedule parses comma-separated HH:MM-HH:MM windows, for
+// example "08:00-18:00,22:00-06:00".
+func ParseBandwidthSchedule(raw string) (BandwidthSchedule, error) {
+	schedule := BandwidthSchedule{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		startRaw, endRaw, ok := strings.Cut(entry, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit window %q: expected HH:MM-HH:MM", entry)
+		}
+		start, err := parseTimeOfDay(startRaw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit window %q: %w", entry, err)
+		}
+		end, err := parseTimeOfDay(endRaw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit window %q: %w", entry, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid rate limit window %q: start and end are equal", entry)
+		}
+		schedule = append(schedule, BandwidthWindow{Start: start, End: end})
+	}
+
+	return schedule, nil
+}
+
+func parseTimeOfDay(raw string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", strings.TrimSpace(raw))
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// Active reports whether t falls inside one of the schedule's windows.
+func (s BandwidthSchedule) Active(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	for _, window := range s {
+		if window.Start < window.End {
+			if offset >= window.Start && offset < window.End {
+				return true
+			}
+		} else if offset >= window.Start || offset < window.End {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Bandwidth) currentTime() time.Time {
+	now := time.Now()
+	if this.now != nil {
+		now = this.now()
+	}
+	if this.Location != nil {
+		now = now.In(this.Location)
+	}
+	return now
+}
+
+func (this *Bandwidth) configuredRate(direction transferDirection) int64 {
+	if this == nil {
+		return 0
+	}
+	if direction == transferUpload {
+		return this.UploadRate
+	}
+	return this.DownloadRate
+}
+
+// limited reports whether direction has a limit at any time of day. Backends
+// use it to pick a streaming code path that can be throttled.
+func (this *Bandwidth) limited(direction transferDirection) bool {
+	return this.configuredRate(direction) > 0
+}
+
+func (this *Bandwidth) wait(ctx context.Context, direction transferDirection, n int) error {
+	limit := this.configuredRate(direction)
+	if limit <= 0 || n <= 0 || !this.Schedule.Active(this.currentTime()) {
+		return nil
+	}
+
+	this.mu.Lock()
+	if this.limiters == nil {
+		this.limiters = map[transferDirection]*rate.Limiter{}
+	}
+	limiter := this.limiters[direction]
+	if limiter == nil {
+		limiter = rate.NewLimiter(rate.Limit(limit), bandwidthChunkSize)
+		this.limiters[direction] = limiter
+	}
+	this.mu.Unlock()
+
+	return limiter.WaitN(contextOrBackground(ctx), n)
+}
+
+func (this *Bandwidth) reader(ctx context.Context, direction transferDirection, reader io.Reader) io.Reader {
+	if !this.limited(direction) {
+		return reader
+	}
+	return &throttledReader{ctx: ctx, bandwidth: this, direction: direction, reader: reader}
+}
+
+func (this *Bandwidth) readCloser(ctx context.Context, direction transferDirection, reader io.ReadCloser) io.ReadCloser {
+	if !this.limited(direction) {
+		return reader
+	}
+	return &throttledReadCloser{throttledReader: throttledReader{ctx: ctx, bandwidth: this, direction: direction, reader: reader}, closer: reader}
+}
+
+func (this *Bandwidth) readSeeker(ctx context.Context, direction transferDirection, reader io.ReadSeeker) io.ReadSeeker {
+	if !this.limited(direction) {
+		return reader
+	}
+	return &throttledReadSeeker{ctx: ctx, bandwidth: this, direction: direction, reader: reader}
+}
+
+func (this *Bandwidth) writerAt(ctx context.Context, direction transferDirection, writer io.WriterAt) io.WriterAt {
+	if !this.limited(direction) {
+		return writer
+	}
+	return &throttledWriterAt{ctx: ctx, bandwidth: this, direction: direction, writer: writer}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunkSize {
+		p = p[:bandwidthChunkSize]
+	}
+
+	n, err := r.reader.Read(p)
+	if waitErr := r.bandwidth.wait(r.ctx, r.direction, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+func (r *throttledReadCloser) Close() error {
+	return r.closer.Close()
+}
+
+func (r *throttledReadSeeker) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunkSize {
+		p = p[:bandwidthChunkSize]
+	}
+
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if r.offset > r.charged {
+		uncharged := min(r.offset-r.charged, int64(n))
+		r.charged = r.offset
+		if waitErr := r.bandwidth.wait(r.ctx, r.direction, int(uncharged)); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.reader.Seek(offset, whence)
+	if err == nil {
+		r.offset = position
+	}
+	return position, err
+}
+
+func (w *throttledWriterAt) WriteAt(p []byte, offset int64) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > bandwidthChunkSize {
+			chunk = chunk[:bandwidthChunkSize]
+		}
+		if err := w.bandwidth.wait(w.ctx, w.direction, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.writer.WriteAt(chunk, offset)
+		written += n
+		offset += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{raw: "", want: 0},
+		{raw: "0", want: 0},
+		{raw: "1048576", want: 1 << 20},
+		{raw: "500KB", want: 500_000},
+		{raw: "10MiB/s", want: 10 << 20},
+		{raw: "1.5 GiB", want: 3 << 29},
+		{raw: "2m", want: 2_000_000},
+		{raw: "-1", wantErr: true},
+		{raw: "fast", wantErr: true},
+		{raw: "0.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseByteRate(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteRate(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseByteRate(%q) = %d, want %d", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBandwidthScheduleActive(t *testing.T) {
+	schedule, err := ParseBandwidthSchedule("08:00-18:00, 22:00-06:00")
+	if err != nil {
+		t.Fatalf("ParseBandwidthSchedule() error = %v", err)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at   time.Duration
+		want bool
+	}{
+		{at: 7*time.Hour + 59*time.Minute, want: false},
+		{at: 8 * time.Hour, want: true},
+		{at: 18 * time.Hour, want: false},
+		{at: 23 * time.Hour, want: true},
+		{at: 5 * time.Hour, want: true},
+		{at: 6 * time.Hour, want: false},
+	}
+	for _, tt := range tests {
+		if got := schedule.Active(day.Add(tt.at)); got != tt.want {
+			t.Fatalf("Active(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	if !(BandwidthSchedule{}).Active(day) {
+		t.Fatal("empty schedule should always be active")
+	}
+	for _, raw := range []string{"08:00", "8-18", "08:00-08:00", "25:00-01:00"} {
+		if _, err := ParseBandwidthSchedule(raw); err == nil {
+			t.Fatalf("ParseBandwidthSchedule(%q) expected error", raw)
+		}
+	}
+}
+
+func TestBandwidthReaderWaitsForTokens(t *testing.T) {
+	bandwidth := &Bandwidth{UploadRate: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	reader := bandwidth.reader(ctx, transferUpload, bytes.NewReader(make([]byte, 2*bandwidthChunkSize)))
+	if _, err := io.Copy(io.Discard, reader); err == nil {
+		t.Fatal("io.Copy() expected the limiter to refuse a wait past the deadline")
+	}
+}
+
+func TestBandwidthOutsideScheduleIsUnthrottled(t *testing.T) {
+	bandwidth := &Bandwidth{
+		UploadRate: 1,
+		Schedule:   BandwidthSchedule{{Start: 8 * time.Hour, End: 18 * time.Hour}},
+		now:        func() time.Time { return time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC) },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	reader := bandwidth.reader(ctx, transferUpload, bytes.NewReader(make([]byte, 4*bandwidthChunkSize)))
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatalf("io.Copy() error = %v", err)
+	}
+}
+
+func TestBandwidthScheduleFollowsLocation(t *testing.T) {
+	// 02:00 UTC is 10:00 in a time zone eight hours ahead, inside the window.
+	bandwidth := &Bandwidth{
+		UploadRate: 1,
+		Schedule:   BandwidthSchedule{{Start: 8 * time.Hour, End: 18 * time.Hour}},
+		Location:   time.FixedZone("UTC+8", 8*60*60),
+		now:        func() time.Time { return time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC) },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	reader := bandwidth.reader(ctx, transferUpload, bytes.NewReader(make([]byte, 2*bandwidthChunkSize)))
+	if _, err := io.Copy(io.Discard, reader); err == nil {
+		t.Fatal("io.Copy() expected the limiter to throttle inside the window in Location")
+	}
+}
+
+func TestBandwidthReadSeekerChargesRereadsOnce(t *testing.T) {
+	bandwidth := &Bandwidth{UploadRate: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	reader := bandwidth.readSeeker(ctx, transferUpload, bytes.NewReader(make([]byte, bandwidthChunkSize+1)))
+	buf := make([]byte, bandwidthChunkSize)
+	for i := 0; i < 3; i++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatalf("ReadFull() pass %d error = %v", i, err)
+		}
+		if _, err := reader.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("Seek() error = %v", err)
+		}
+	}
+
+	if _, err := reader.Seek(int64(bandwidthChunkSize), io.SeekStart); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	if _, err := reader.Read(buf); err == nil {
+		t.Fatal("Read() past the charged offset expected throttling error")
+	}
+}
+
+func TestLocalStorageUploadHonorsBandwidth(t *testing.T) {
+	s := &LocalStorage{LocalPath: t.TempDir(), Bandwidth: &Bandwidth{UploadRate: 1}}
+	sourcePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := os.WriteFile(sourcePath, make([]byte, 2*bandwidthChunkSize), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := s.Upload(ctx, "archive.tar.gz", sourcePath); err == nil {
+		t.Fatal("Upload() expected throttling error")
+	}
+	if _, err := os.Stat(filepath.Join(s.LocalPath, "archive.tar.gz")); !os.IsNotExist(err) {
+		t.Fatalf("Stat() error = %v, want no partially copied object", err)
+	}
+
+	s.Bandwidth = &Bandwidth{DownloadRate: 1}
+	if _, err := s.Upload(ctx, "archive.tar.gz", sourcePath); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+}
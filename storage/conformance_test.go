@@ -0,0 +1,77 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+)
+
+// The emulator-backed suites run when the sandbox services from
+// sandbox/docker-compose.yml are up and .env.test is exported, as in
+// make test-storage, and are skipped otherwise.
+
+func TestLocalStorageConformance(t *testing.T) {
+	localPath := t.TempDir()
+	storagetest.Run(t, func(t *testing.T, config storagetest.Config) storage.Storage {
+		s := &storage.LocalStorage{Now: config.Now, NameTemplate: config.NameTemplate}
+		if err := s.Init(localPath, config.ExpiryDays, config.BackupPrefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestAwsS3Conformance(t *testing.T) {
+	env := emulatorEnv(t, "MINIO_URL", "MINIO_ACCESS_KEY", "MINIO_SECRET_KEY", "MINIO_BUCKET")
+	storagetest.Run(t, func(t *testing.T, config storagetest.Config) storage.Storage {
+		s := &storage.AwsS3{Now: config.Now, NameTemplate: config.NameTemplate}
+		if err := s.Init(env["MINIO_URL"], env["MINIO_ACCESS_KEY"], env["MINIO_SECRET_KEY"], "us-east-1", env["MINIO_BUCKET"], true, config.ExpiryDays, config.BackupPrefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestAzBlobConformance(t *testing.T) {
+	env := emulatorEnv(t, "AZURITE_URL", "AZURITE_ACCOUNT_NAME", "AZURITE_ACCOUNT_KEY", "AZURITE_CONTAINER")
+	storagetest.Run(t, func(t *testing.T, config storagetest.Config) storage.Storage {
+		s := &storage.AzBlob{Now: config.Now, NameTemplate: config.NameTemplate}
+		if err := s.Init(env["AZURITE_ACCOUNT_NAME"], env["AZURITE_ACCOUNT_KEY"], env["AZURITE_CONTAINER"], env["AZURITE_URL"], config.ExpiryDays, config.BackupPrefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestGcpStorageConformance(t *testing.T) {
+	env := emulatorEnv(t, "FAKE_GCP_PORT", "FAKE_GCP_BUCKET")
+	endpoint := fmt.Sprintf("http://localhost:%s/storage/v1/", env["FAKE_GCP_PORT"])
+	storagetest.Run(t, func(t *testing.T, config storagetest.Config) storage.Storage {
+		s := &storage.GcpStorage{Now: config.Now, NameTemplate: config.NameTemplate}
+		if err := s.Init(context.Background(), endpoint, env["FAKE_GCP_BUCKET"], "", "", "", "", "", "", config.ExpiryDays, config.BackupPrefix); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		return s
+	})
+}
+
+func emulatorEnv(t *testing.T, keys ...string) map[string]string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping emulator-backed conformance suite in short mode")
+	}
+
+	env := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value := os.Getenv(key)
+		if value == "" {
+			t.Skipf("%s is not set; start the sandbox emulators and export .env.test to run this suite", key)
+		}
+		env[key] = value
+	}
+	return env
+}
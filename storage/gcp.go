@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -14,9 +16,11 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/egose/database-tools/flagdef"
 	"github.com/egose/database-tools/utils"
 	mlog "github.com/mongodb/mongo-tools/common/log"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	iam "google.golang.org/api/iam/v1"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -27,10 +31,56 @@ type GcpStorage struct {
 	StorageClient *storage.Client
 	ExpiryDays    int
 	BackupPrefix  string
+	NameTemplate  *NameTemplate
+	Transfers     *TransferStateStore
+	Bandwidth     *Bandwidth
+	InstanceName  string
+	Now           func() time.Time
 	closeOnce     sync.Once
 	closeErr      error
 }
 
+var gcpBackendType = BackendType{
+	Name:  BackendGCP,
+	Label: "GCP",
+	StringFlags: []flagdef.StringFlagDef{
+		{Name: "gcp-endpoint", EnvKey: "GCP_ENDPOINT", Usage: "GCP endpoint URL"},
+		{Name: "gcp-bucket", EnvKey: "GCP_BUCKET", Usage: "GCP storage bucket name"},
+		{Name: "gcp-creds-file", EnvKey: "GCP_CREDS_FILE", Usage: "GCP service account's credentials file"},
+		{Name: "gcp-project-id", EnvKey: "GCP_PROJECT_ID", Usage: "GCP service account's project id"},
+		{Name: "gcp-private-key-id", EnvKey: "GCP_PRIVATE_KEY_ID", Usage: "GCP service account's private key id"},
+		{Name: "gcp-private-key", EnvKey: "GCP_PRIVATE_KEY", Usage: "GCP service account's private key"},
+		{Name: "gcp-client-email", EnvKey: "GCP_CLIENT_EMAIL", Usage: "GCP service account's client email"},
+		{Name: "gcp-client-id", EnvKey: "GCP_CLIENT_ID", Usage: "GCP service account's client id"},
+	},
+	Missing:   RequireSettings("gcp-bucket"),
+	Location:  LocationSettings("gcp-endpoint", "gcp-bucket"),
+	New:       newGcpBackend,
+	URLScheme: "gs",
+	ParseURL:  parseGcpURL,
+	Instance: func(storageBackend Storage) (string, bool) {
+		gcpStorage, ok := storageBackend.(*GcpStorage)
+		if !ok {
+			return "", false
+		}
+		return gcpStorage.InstanceName, true
+	},
+}
+
+type gcpMultipartUpload struct {
+	storage    *GcpStorage
+	objectName string
+}
+
+type gcpRangedDownload struct {
+	storage    *GcpStorage
+	objectName string
+}
+
+// gcpMaxComposeSources is the per-request limit on objects that can be
+// combined by a single compose call.
+const gcpMaxComposeSources = 32
+
 type GcpServiceAccountCreds struct {
 	Type                    string `json:"type"`
 	ProjectID               string `json:"project_id"`
@@ -44,6 +94,35 @@ type GcpServiceAccountCreds struct {
 	UniverseDomain          string `json:"universe_domain"`
 }
 
+func newGcpBackend(ctx context.Context, config BackendConfig) (Storage, error) {
+	settings := config.Settings
+	gcpStorage := new(GcpStorage)
+	if err := gcpStorage.Init(ctx, settings.Get("gcp-endpoint"), settings.Get("gcp-bucket"), settings.Get("gcp-creds-file"), settings.Get("gcp-project-id"), settings.Get("gcp-private-key-id"), settings.Get("gcp-private-key"), settings.Get("gcp-client-email"), settings.Get("gcp-client-id"), config.ExpiryDays, config.BackupPrefix); err != nil {
+		return nil, err
+	}
+	gcpStorage.Transfers = config.Transfers
+	gcpStorage.Bandwidth = config.Bandwidth
+	gcpStorage.InstanceName = config.InstanceName
+	gcpStorage.NameTemplate = config.NameTemplate
+	return gcpStorage, nil
+}
+
+// parseGcpURL reads gs://<bucket>/<prefix>?endpoint=.
+func parseGcpURL(location *url.URL, settings BackendSettings) (string, error) {
+	if err := CheckURLParameters(location, "endpoint"); err != nil {
+		return "", err
+	}
+	if location.Host == "" {
+		return "", errors.New("missing bucket name")
+	}
+
+	settings["gcp-bucket"] = location.Host
+	if endpoint := location.Query().Get("endpoint"); endpoint != "" {
+		settings["gcp-endpoint"] = endpoint
+	}
+	return strings.Trim(location.Path, "/"), nil
+}
+
 func (this *GcpStorage) Init(ctx context.Context, endpoint, bucket, credsPath, projectID, privateKeyId, privateKey, clientEmail, clientID string, expiryDays int, backupPrefix string) error {
 	this.Bucket = bucket
 	this.ExpiryDays = expiryDays
@@ -151,7 +230,7 @@ func (this *GcpStorage) GetTargetObjectName(ctx context.Context, objectName stri
 		return this.getLastUpdatedObjectName(ctx)
 	}
 
-	resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, objectName, func(candidate string) (bool, error) {
+	resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, this.NameTemplate, objectName, func(candidate string) (bool, error) {
 		if _, err := this.getMetadata(ctx, candidate); err != nil {
 			if errors.Is(err, storage.ErrObjectNotExist) {
 				return false, nil
@@ -188,10 +267,11 @@ func (this *GcpStorage) getLastUpdatedObjectName(ctx context.Context) (string, e
 			return "", err
 		}
 
-		if !isEligibleBackupObject(objAttrs.Name, this.BackupPrefix) {
+		parsed, ok := parseManagedName(objAttrs.Name, this.BackupPrefix, this.NameTemplate)
+		if !ok {
 			continue
 		}
-		latest = chooseLaterObject(latest, objectTimestamp{Name: objAttrs.Name, ModifiedAt: objAttrs.Updated})
+		latest = chooseLaterObject(latest, objectTimestamp{Name: objAttrs.Name, ModifiedAt: objAttrs.Updated, CreatedAt: parsed.createdAt})
 	}
 
 	if latest == nil {
@@ -238,9 +318,15 @@ func (this *GcpStorage) Upload(ctx context.Context, objectName string, filePath
 	}
 	defer reader.Close()
 
+	if info, err := reader.Stat(); err == nil && this.Transfers.resumable(info.Size()) {
+		return uploadResumably(ctx, this.Transfers, this.transferTarget(), objectName, filePath, func(objectName string) multipartUpload {
+			return &gcpMultipartUpload{storage: this, objectName: objectName}
+		})
+	}
+
 	wc := this.StorageClient.Bucket(this.Bucket).Object(objectName).NewWriter(ctx)
 
-	if _, err := io.Copy(wc, reader); err != nil {
+	if _, err := io.Copy(wc, this.Bandwidth.reader(ctx, transferUpload, reader)); err != nil {
 		_ = wc.Close()
 		return "", fmt.Errorf("failed to upload object: %v", err)
 	}
@@ -274,6 +360,16 @@ func (this *GcpStorage) getMetadata(ctx context.Context, objectName string) (*st
 func (this *GcpStorage) Download(ctx context.Context, objectName string, filePath string) error {
 	ctx = contextOrBackground(ctx)
 
+	if this.Transfers != nil {
+		return downloadResumably(ctx, this.Transfers, this.transferTarget(), objectName, filePath, &gcpRangedDownload{storage: this, objectName: objectName}, func() error {
+			return this.download(ctx, objectName, filePath)
+		})
+	}
+
+	return this.download(ctx, objectName, filePath)
+}
+
+func (this *GcpStorage) download(ctx context.Context, objectName string, filePath string) error {
 	obj := this.StorageClient.Bucket(this.Bucket).Object(objectName)
 
 	reader, err := obj.NewReader(ctx)
@@ -283,7 +379,7 @@ func (this *GcpStorage) Download(ctx context.Context, objectName string, filePat
 	defer reader.Close()
 
 	return utils.WriteFileAtomically(filePath, func(dest *os.File) error {
-		_, err := io.Copy(dest, reader)
+		_, err := io.Copy(dest, this.Bandwidth.reader(ctx, transferDownload, reader))
 		if err != nil {
 			return fmt.Errorf("failed to download object: %w", err)
 		}
@@ -302,7 +398,7 @@ func (this *GcpStorage) DeleteOldObjects(ctx context.Context, currentObjectName
 	listOptions := newGCPListObjectsOptions(this.BackupPrefix)
 	it := bucket.Objects(ctx, listOptions.Query)
 	it.PageInfo().MaxSize = listOptions.PageSize
-	now := time.Now()
+	now := currentTime(this.Now)
 
 	for {
 		candidates := make([]objectTimestamp, 0, 1)
@@ -318,7 +414,7 @@ func (this *GcpStorage) DeleteOldObjects(ctx context.Context, currentObjectName
 		mlog.Logvf(mlog.Info, "Checking object: %s (%.1f days old)", objAttrs.Name, daysOld)
 		candidates = append(candidates, objectTimestamp{Name: objAttrs.Name, ModifiedAt: objAttrs.Updated})
 
-		if err := deleteExpiredObjects(candidates, this.BackupPrefix, this.ExpiryDays, now, currentObjectName, func(name string) error {
+		if err := deleteExpiredObjects(ctx, candidates, this.BackupPrefix, this.NameTemplate, this.ExpiryDays, now, currentObjectName, objectPinLookup(ctx, this), func(name string) error {
 			err := bucket.Object(name).Delete(ctx)
 			if err == nil {
 				mlog.Logvf(mlog.Info, "Deleted object: %s", name)
@@ -331,3 +427,367 @@ func (this *GcpStorage) DeleteOldObjects(ctx context.Context, currentObjectName
 
 	return nil
 }
+
+func (this *GcpStorage) ManagedPrefix() string {
+	return this.BackupPrefix
+}
+
+func (this *GcpStorage) ManagedNameTemplate() *NameTemplate {
+	return this.NameTemplate
+}
+
+func (this *GcpStorage) ListBackups(ctx context.Context) ([]BackupObject, error) {
+	ctx = contextOrBackground(ctx)
+
+	listOptions := newGCPListObjectsOptions(this.BackupPrefix)
+	it := this.StorageClient.Bucket(this.Bucket).Objects(ctx, listOptions.Query)
+	it.PageInfo().MaxSize = listOptions.PageSize
+
+	candidates := make([]objectTimestamp, 0)
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		candidates = append(candidates, objectTimestamp{Name: objAttrs.Name, ModifiedAt: objAttrs.Updated, Size: objAttrs.Size})
+	}
+
+	return backupObjects(candidates, this.BackupPrefix, this.NameTemplate), nil
+}
+
+func (this *GcpStorage) ListObjects(ctx context.Context, prefix string) ([]BackupObject, error) {
+	ctx = contextOrBackground(ctx)
+
+	listOptions := newGCPListObjectsOptions(prefix)
+	it := this.StorageClient.Bucket(this.Bucket).Objects(ctx, listOptions.Query)
+	it.PageInfo().MaxSize = listOptions.PageSize
+
+	objects := make([]BackupObject, 0)
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		if isPinSidecar(objAttrs.Name) {
+			continue
+		}
+		objects = append(objects, BackupObject{Name: objAttrs.Name, ModifiedAt: objAttrs.Updated, Size: objAttrs.Size})
+	}
+
+	return objects, nil
+}
+
+func (this *GcpStorage) DeleteObject(ctx context.Context, objectName string) error {
+	ctx = contextOrBackground(ctx)
+
+	bucket := this.StorageClient.Bucket(this.Bucket)
+	if err := bucket.Object(objectName).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete object %q: %w", objectName, err)
+	}
+	if err := bucket.Object(objectName + pinSidecarSuffix).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete the pin of object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+// PinObject records reason in a sidecar object next to the backup. Updating the
+// backup's own metadata would change its Updated time, which orders backups
+// and drives retention.
+func (this *GcpStorage) PinObject(ctx context.Context, objectName string, reason string) error {
+	ctx = contextOrBackground(ctx)
+
+	if _, err := this.getMetadata(ctx, objectName); err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+
+	wc := this.StorageClient.Bucket(this.Bucket).Object(objectName + pinSidecarSuffix).NewWriter(ctx)
+	wc.ContentType = "text/plain"
+	if _, err := io.WriteString(wc, reason); err != nil {
+		_ = wc.Close()
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *GcpStorage) UnpinObject(ctx context.Context, objectName string) error {
+	err := this.StorageClient.Bucket(this.Bucket).Object(objectName + pinSidecarSuffix).Delete(contextOrBackground(ctx))
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to unpin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *GcpStorage) ObjectPin(ctx context.Context, objectName string) (string, bool, error) {
+	reader, err := this.StorageClient.Bucket(this.Bucket).Object(objectName + pinSidecarSuffix).NewReader(contextOrBackground(ctx))
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the pin of object %q: %w", objectName, err)
+	}
+	defer reader.Close()
+
+	reason, err := io.ReadAll(reader)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the pin of object %q: %w", objectName, err)
+	}
+	return string(reason), true, nil
+}
+
+func (this *GcpStorage) transferTarget() string {
+	return "gcp:" + this.Bucket
+}
+
+// Parts are uploaded as standalone component objects next to the target and
+// composed into it once every part is present.
+func gcpComponentPrefix(objectName string, sessionID string) string {
+	return fmt.Sprintf("%s.part-%s-", objectName, sessionID)
+}
+
+func (this *gcpMultipartUpload) begin(ctx context.Context) (string, error) {
+	return newTransferSessionID()
+}
+
+func (this *gcpMultipartUpload) resume(ctx context.Context, sessionID string, parts []TransferPart) ([]TransferPart, error) {
+	bucket := this.storage.StorageClient.Bucket(this.storage.Bucket)
+	confirmed := make([]TransferPart, 0, len(parts))
+	for _, part := range parts {
+		attrs, err := bucket.Object(gcpComponentPrefix(this.objectName, sessionID) + fmt.Sprintf("%05d", part.Number)).Attrs(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strconv.FormatInt(attrs.Generation, 10) == part.ETag {
+			confirmed = append(confirmed, part)
+		}
+	}
+	return confirmed, nil
+}
+
+func (this *gcpMultipartUpload) uploadPart(ctx context.Context, sessionID string, part TransferPart, body io.ReadSeeker) (string, error) {
+	name := gcpComponentPrefix(this.objectName, sessionID) + fmt.Sprintf("%05d", part.Number)
+	wc := this.storage.StorageClient.Bucket(this.storage.Bucket).Object(name).NewWriter(ctx)
+	if _, err := io.Copy(wc, this.storage.Bandwidth.reader(ctx, transferUpload, body)); err != nil {
+		_ = wc.Close()
+		return "", err
+	}
+	if err := wc.Close(); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(wc.Attrs().Generation, 10), nil
+}
+
+func (this *gcpMultipartUpload) complete(ctx context.Context, sessionID string, parts []TransferPart) (string, error) {
+	bucket := this.storage.StorageClient.Bucket(this.storage.Bucket)
+	prefix := gcpComponentPrefix(this.objectName, sessionID)
+
+	sources := make([]string, 0, len(parts))
+	for _, part := range parts {
+		sources = append(sources, prefix+fmt.Sprintf("%05d", part.Number))
+	}
+
+	// Compose accepts a limited number of sources, so large uploads are
+	// combined in rounds of intermediate objects first.
+	for round := 0; len(sources) > gcpMaxComposeSources; round++ {
+		next := make([]string, 0, len(sources)/gcpMaxComposeSources+1)
+		for start := 0; start < len(sources); start += gcpMaxComposeSources {
+			name := fmt.Sprintf("%sr%d-%05d", prefix, round, start/gcpMaxComposeSources)
+			if err := this.compose(ctx, name, sources[start:min(start+gcpMaxComposeSources, len(sources))]); err != nil {
+				return "", err
+			}
+			next = append(next, name)
+		}
+		sources = next
+	}
+
+	if err := this.compose(ctx, this.objectName, sources); err != nil {
+		return "", err
+	}
+
+	attrs, err := this.storage.getMetadata(ctx, this.objectName)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify uploaded object: %w", err)
+	}
+
+	if err := this.deleteComponents(ctx, bucket, prefix); err != nil {
+		mlog.Logvf(mlog.Always, "Failed to remove upload components for %s: %v", this.objectName, err)
+	}
+
+	return attrs.Etag, nil
+}
+
+func (this *gcpMultipartUpload) compose(ctx context.Context, destination string, sources []string) error {
+	bucket := this.storage.StorageClient.Bucket(this.storage.Bucket)
+	handles := make([]*storage.ObjectHandle, 0, len(sources))
+	for _, source := range sources {
+		handles = append(handles, bucket.Object(source))
+	}
+
+	if _, err := bucket.Object(destination).ComposerFrom(handles...).Run(ctx); err != nil {
+		return fmt.Errorf("failed to compose %s: %w", destination, err)
+	}
+	return nil
+}
+
+func (this *gcpMultipartUpload) abort(ctx context.Context, sessionID string, parts []TransferPart) error {
+	return this.deleteComponents(ctx, this.storage.StorageClient.Bucket(this.storage.Bucket), gcpComponentPrefix(this.objectName, sessionID))
+}
+
+func (this *gcpMultipartUpload) deleteComponents(ctx context.Context, bucket *storage.BucketHandle, prefix string) error {
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	var deleteErrors []error
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			deleteErrors = append(deleteErrors, err)
+		}
+	}
+	return errors.Join(deleteErrors...)
+}
+
+func (this *gcpRangedDownload) stat(ctx context.Context) (string, int64, error) {
+	attrs, err := this.storage.getMetadata(ctx, this.objectName)
+	if err != nil {
+		return "", 0, err
+	}
+	return strconv.FormatInt(attrs.Generation, 10), attrs.Size, nil
+}
+
+func (this *gcpRangedDownload) readRange(ctx context.Context, version string, offset int64) (io.ReadCloser, error) {
+	generation, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object generation %q: %w", version, err)
+	}
+	reader, err := this.storage.StorageClient.Bucket(this.storage.Bucket).Object(this.objectName).Generation(generation).NewRangeReader(ctx, offset, -1)
+	if err != nil {
+		return nil, err
+	}
+	return this.storage.Bandwidth.readCloser(ctx, transferDownload, reader), nil
+}
+
+// ReclaimAbandonedUploads deletes part objects of resumable uploads under the
+// backup prefix that are older than olderThan and are not being resumed.
+func (this *GcpStorage) ReclaimAbandonedUploads(ctx context.Context, olderThan time.Duration) ([]ReclaimedUpload, error) {
+	ctx = contextOrBackground(ctx)
+	cutoff := time.Now().Add(-olderThan)
+
+	bucket := this.StorageClient.Bucket(this.Bucket)
+	it := bucket.Objects(ctx, &storage.Query{Prefix: this.BackupPrefix})
+
+	reclaimed := make([]ReclaimedUpload, 0)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return reclaimed, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		match := gcpComponentPattern.FindStringSubmatch(attrs.Name)
+		if match == nil || attrs.Updated.After(cutoff) || this.Transfers.activeUpload(this.transferTarget(), match[1], match[2]) {
+			continue
+		}
+
+		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return reclaimed, fmt.Errorf("failed to delete upload component %s: %w", attrs.Name, err)
+		}
+		reclaimed = append(reclaimed, ReclaimedUpload{Object: match[1], Detail: "upload component " + attrs.Name, Bytes: attrs.Size})
+	}
+
+	return reclaimed, nil
+}
+
+// ReadLease returns the content of a lease object and its generation as its
+// version.
+func (this *GcpStorage) ReadLease(ctx context.Context, name string) ([]byte, string, error) {
+	reader, err := this.StorageClient.Bucket(this.Bucket).Object(name).NewReader(contextOrBackground(ctx))
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, "", ErrLeaseNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	return data, strconv.FormatInt(reader.Attrs.Generation, 10), nil
+}
+
+// WriteLease writes a lease object with a DoesNotExist or GenerationMatch
+// precondition.
+func (this *GcpStorage) WriteLease(ctx context.Context, name string, data []byte, version string) (string, error) {
+	conditions, err := gcpLeaseConditions(version)
+	if err != nil {
+		return "", err
+	}
+
+	wc := this.StorageClient.Bucket(this.Bucket).Object(name).If(conditions).NewWriter(contextOrBackground(ctx))
+	wc.ContentType = "application/json"
+	if _, err := wc.Write(data); err != nil {
+		_ = wc.Close()
+		return "", fmt.Errorf("failed to write lease %q: %w", name, err)
+	}
+	if err := wc.Close(); err != nil {
+		if isGcpConditionFailed(err) {
+			return "", ErrLeaseConflict
+		}
+		return "", fmt.Errorf("failed to write lease %q: %w", name, err)
+	}
+	return strconv.FormatInt(wc.Attrs().Generation, 10), nil
+}
+
+// DeleteLease deletes a lease object with a GenerationMatch precondition.
+func (this *GcpStorage) DeleteLease(ctx context.Context, name string, version string) error {
+	conditions, err := gcpLeaseConditions(version)
+	if err != nil {
+		return err
+	}
+
+	err = this.StorageClient.Bucket(this.Bucket).Object(name).If(conditions).Delete(contextOrBackground(ctx))
+	if errors.Is(err, storage.ErrObjectNotExist) || isGcpConditionFailed(err) {
+		return ErrLeaseConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete lease %q: %w", name, err)
+	}
+	return nil
+}
+
+// gcpLeaseConditions requires that the object does not exist when version is
+// empty, and that it still has the generation version otherwise.
+func gcpLeaseConditions(version string) (storage.Conditions, error) {
+	if version == "" {
+		return storage.Conditions{DoesNotExist: true}, nil
+	}
+	generation, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return storage.Conditions{}, fmt.Errorf("invalid lease version %q: %w", version, err)
+	}
+	return storage.Conditions{GenerationMatch: generation}, nil
+}
+
+func isGcpConditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
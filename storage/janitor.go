@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// UploadJanitor is implemented by backends that can be left holding
+// incomplete uploads after a crash. Such leftovers are billed by the provider
+// but never become visible backup objects.
+type UploadJanitor interface {
+	ReclaimAbandonedUploads(ctx context.Context, olderThan time.Duration) ([]ReclaimedUpload, error)
+}
+
+type ReclaimedUpload struct {
+	Object string
+	Detail string
+	Bytes  int64
+}
+
+var gcpComponentPattern = regexp.MustCompile(`^(.+)\.part-([0-9a-f]{16})-(?:r\d+-)?\d{5}$`)
+
+// activeUpload reports whether this process, or a previous run within the
+// resume window, still intends to resume sessionID for objectName on target.
+// An empty sessionID matches any session for the object.
+func (this *TransferStateStore) activeUpload(target string, objectName string, sessionID string) bool {
+	if this == nil {
+		return false
+	}
+
+	state, err := this.load(this.key(transferUpload, target, objectName))
+	if err != nil || state == nil || this.expired(state) {
+		return false
+	}
+	return sessionID == "" || state.SessionID == sessionID
+}
+
+// isPartialUploadFile matches the temporary files written by
+// utils.WriteFileAtomically next to their destination.
+func isPartialUploadFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".partial-")
+}
+
+// PruneExpired removes transfer state and partial downloads that are older
+// than the resume window. Remote multipart sessions referenced by expired
+// upload state are left to the backends' ReclaimAbandonedUploads.
+func (this *TransferStateStore) PruneExpired() ([]ReclaimedUpload, error) {
+	if this == nil {
+		return nil, nil
+	}
+
+	states, err := this.list()
+	if err != nil {
+		return nil, err
+	}
+
+	reclaimed := make([]ReclaimedUpload, 0)
+	var pruneErrors []error
+	for _, state := range states {
+		if !this.expired(state) {
+			continue
+		}
+
+		var size int64
+		if info, err := os.Stat(this.partialPath(state.Key)); err == nil {
+			size = info.Size()
+		}
+		if err := this.remove(state.Key); err != nil {
+			pruneErrors = append(pruneErrors, fmt.Errorf("failed to remove transfer state for %s: %w", state.Object, err))
+			continue
+		}
+		reclaimed = append(reclaimed, ReclaimedUpload{
+			Object: state.Object,
+			Detail: fmt.Sprintf("expired %s state for %s", state.Direction, state.Target),
+			Bytes:  size,
+		})
+	}
+
+	return reclaimed, errors.Join(pruneErrors...)
+}
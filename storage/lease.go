@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// leaseDirectory holds the lease objects below a backend's backup prefix.
+const leaseDirectory = ".locks/"
+
+// DefaultLockTTL is how long a lease lasts without being renewed.
+const DefaultLockTTL = 5 * time.Minute
+
+// ErrLeaseConflict is returned by a Leaser when a lease object is not in the
+// expected state: it exists when it should not, or it changed since it was
+// read.
+var ErrLeaseConflict = errors.New("lease object changed concurrently")
+
+// ErrLeaseNotFound is returned by Leaser.ReadLease when the lease object does
+// not exist.
+var ErrLeaseNotFound = errors.New("lease object not found")
+
+// lockNamePattern keeps lock names within one object name segment.
+var lockNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Leaser is implemented by backends that can hold leases. Every change is
+// conditional on the version the caller last read, so that two processes
+// never both believe they hold the same lease.
+type Leaser interface {
+	// ReadLease returns the content and version of the lease object name, or
+	// ErrLeaseNotFound.
+	ReadLease(ctx context.Context, name string) ([]byte, string, error)
+	// WriteLease writes data to name and returns the new version. An empty
+	// version creates name, which must not exist; otherwise name must still
+	// have version. It returns ErrLeaseConflict when the condition fails.
+	WriteLease(ctx context.Context, name string, data []byte, version string) (string, error)
+	// DeleteLease deletes name when it still has version. It returns
+	// ErrLeaseConflict when the condition fails.
+	DeleteLease(ctx context.Context, name string, version string) error
+}
+
+// LeaseRecord is the content of a lease object.
+type LeaseRecord struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// LockHeldError is returned by AcquireLock when another holder's lease has not
+// expired.
+type LockHeldError struct {
+	Name  string
+	Lease LeaseRecord
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Lease.Holder == "" {
+		return fmt.Sprintf("lock %s is held by another process", e.Name)
+	}
+	return fmt.Sprintf("lock %s is held by %s until %s", e.Name, e.Lease.Holder, e.Lease.ExpiresAt.Format(time.RFC3339))
+}
+
+// Lock is a lease held on a storage backend. It lasts for its TTL unless it is
+// renewed, so a crashed holder's lock is recovered once its lease expires.
+type Lock struct {
+	leaser  Leaser
+	object  string
+	name    string
+	holder  string
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	version string
+	record  LeaseRecord
+}
+
+// LockOptions configures AcquireLock.
+type LockOptions struct {
+	// Holder identifies the process in the lease, e.g. host name and process
+	// ID. It must be unique among the processes competing for the lock.
+	Holder string
+	// TTL is how long the lease lasts without renewal; DefaultLockTTL when zero.
+	TTL time.Duration
+	// Now returns the current time; time.Now when nil.
+	Now func() time.Time
+}
+
+// AcquireLock takes the lock name on s, a backend that implements Leaser. The
+// lease is stored below the backend's backup prefix. It returns a
+// *LockHeldError when another holder's lease has not expired, and takes over
+// an expired lease.
+func AcquireLock(ctx context.Context, s Storage, name string, options LockOptions) (*Lock, error) {
+	ctx = contextOrBackground(ctx)
+	leaser, ok := s.(Leaser)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s cannot hold locks", StorageName(s))
+	}
+	if !lockNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid lock name %q: use 1 to 128 letters, digits, and . _ -", name)
+	}
+	if options.Holder == "" {
+		return nil, errors.New("lock holder must not be empty")
+	}
+
+	prefix := ""
+	if lister, ok := s.(BackupLister); ok {
+		prefix = lister.ManagedPrefix()
+	}
+	lock := &Lock{
+		leaser: leaser,
+		object: prefix + leaseDirectory + name + ".json",
+		name:   name,
+		holder: options.Holder,
+		ttl:    options.TTL,
+		now:    options.Now,
+	}
+	if lock.ttl <= 0 {
+		lock.ttl = DefaultLockTTL
+	}
+	if lock.now == nil {
+		lock.now = time.Now
+	}
+
+	data, version, err := leaser.ReadLease(ctx, lock.object)
+	switch {
+	case errors.Is(err, ErrLeaseNotFound):
+		version = ""
+	case err != nil:
+		return nil, fmt.Errorf("failed to read lock %s: %w", name, err)
+	default:
+		var current LeaseRecord
+		if err := json.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to read lock %s: %w", name, err)
+		}
+		if current.Holder != lock.holder && lock.now().Before(current.ExpiresAt) {
+			return nil, &LockHeldError{Name: name, Lease: current}
+		}
+	}
+
+	if err := lock.write(ctx, version, lock.now()); err != nil {
+		if errors.Is(err, ErrLeaseConflict) {
+			// Another process created or took over the lease first.
+			return nil, &LockHeldError{Name: name}
+		}
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	return lock, nil
+}
+
+// Name returns the name of the lock.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// TTL returns how long the lease lasts without renewal.
+func (l *Lock) TTL() time.Duration {
+	return l.ttl
+}
+
+// Renew extends the lease by its TTL. It fails when the lease was taken over
+// after it expired.
+func (l *Lock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.write(contextOrBackground(ctx), l.version, l.record.AcquiredAt); err != nil {
+		return fmt.Errorf("failed to renew lock %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// Release deletes the lease so that another process can take the lock at
+// once. A lease that was taken over is left alone.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.leaser.DeleteLease(contextOrBackground(ctx), l.object, l.version)
+	if err != nil && !errors.Is(err, ErrLeaseNotFound) && !errors.Is(err, ErrLeaseConflict) {
+		return fmt.Errorf("failed to release lock %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// KeepAlive renews the lease every third of its TTL until ctx is done. The
+// returned context is cancelled, with the renewal error as its cause, when a
+// renewal fails, so that work guarded by the lock stops before another
+// process can take it over. Call the returned function to stop renewing.
+func (l *Lock) KeepAlive(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(contextOrBackground(ctx))
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.Renew(ctx); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			cancel(nil)
+		})
+	}
+}
+
+func (l *Lock) write(ctx context.Context, version string, acquiredAt time.Time) error {
+	record := LeaseRecord{Holder: l.holder, AcquiredAt: acquiredAt, ExpiresAt: l.now().Add(l.ttl)}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	newVersion, err := l.leaser.WriteLease(ctx, l.object, data, version)
+	if err != nil {
+		return err
+	}
+	l.version = newVersion
+	l.record = record
+	return nil
+}
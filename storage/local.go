@@ -2,13 +2,18 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/egose/database-tools/flagdef"
 	"github.com/egose/database-tools/utils"
 	mlog "github.com/mongodb/mongo-tools/common/log"
 )
@@ -17,6 +22,61 @@ type LocalStorage struct {
 	LocalPath    string
 	ExpiryDays   int
 	BackupPrefix string
+	NameTemplate *NameTemplate
+	Bandwidth    *Bandwidth
+	InstanceName string
+	Now          func() time.Time
+}
+
+var localBackendType = BackendType{
+	Name:  BackendLocal,
+	Label: "Local",
+	StringFlags: []flagdef.StringFlagDef{
+		{Name: "local-path", EnvKey: "LOCAL_PATH", Usage: "Local directory path to store backups"},
+	},
+	Missing:   RequireSettings("local-path"),
+	New:       newLocalBackend,
+	URLScheme: "file",
+	ParseURL:  parseLocalURL,
+	Instance: func(storageBackend Storage) (string, bool) {
+		localStorage, ok := storageBackend.(*LocalStorage)
+		if !ok {
+			return "", false
+		}
+		return localStorage.InstanceName, true
+	},
+	Location: func(settings BackendSettings) string {
+		return filepath.Clean(settings.Get("local-path"))
+	},
+}
+
+func newLocalBackend(_ context.Context, config BackendConfig) (Storage, error) {
+	localStorage := new(LocalStorage)
+	if err := localStorage.Init(config.Settings.Get("local-path"), config.ExpiryDays, config.BackupPrefix); err != nil {
+		return nil, err
+	}
+	localStorage.Bandwidth = config.Bandwidth
+	localStorage.InstanceName = config.InstanceName
+	localStorage.NameTemplate = config.NameTemplate
+	return localStorage, nil
+}
+
+// parseLocalURL reads file://<path>?prefix=. A relative path such as
+// file://./backups is kept relative.
+func parseLocalURL(location *url.URL, settings BackendSettings) (string, error) {
+	if err := CheckURLParameters(location, "prefix"); err != nil {
+		return "", err
+	}
+
+	path := location.Opaque
+	if path == "" {
+		path = location.Host + location.Path
+	}
+	if path == "" {
+		return "", errors.New("missing path")
+	}
+	settings["local-path"] = path
+	return location.Query().Get("prefix"), nil
 }
 
 func (this *LocalStorage) Init(localPath string, expiryDays int, backupPrefix string) error {
@@ -36,7 +96,7 @@ func (this *LocalStorage) GetTargetObjectName(ctx context.Context, objectName st
 		return this.getLastUpdatedFile()
 	}
 
-	resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, objectName, func(candidate string) (bool, error) {
+	resolved, found, err := resolveExplicitObjectName(this.BackupPrefix, this.NameTemplate, objectName, func(candidate string) (bool, error) {
 		targetPath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(candidate))
 		if err != nil {
 			return false, err
@@ -64,7 +124,7 @@ func (this *LocalStorage) Upload(ctx context.Context, objectName string, filePat
 	if err != nil {
 		return "", err
 	}
-	err = copyFile(ctx, filePath, targetPath)
+	err = copyFile(ctx, filePath, targetPath, this.Bandwidth, transferUpload)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload object: %w", err)
 	}
@@ -90,7 +150,7 @@ func (this *LocalStorage) Download(ctx context.Context, objectName string, fileP
 		return err
 	}
 
-	err = copyFile(ctx, sourceFile, filePath)
+	err = copyFile(ctx, sourceFile, filePath, this.Bandwidth, transferDownload)
 	if err != nil {
 		return fmt.Errorf("failed to download object: %w", err)
 	}
@@ -114,13 +174,13 @@ func (this *LocalStorage) DeleteOldObjects(ctx context.Context, currentObjectNam
 		return err
 	}
 
-	now := time.Now()
+	now := currentTime(this.Now)
 	for _, obj := range objects {
 		daysOld := now.Sub(obj.ModifiedAt).Hours() / 24
 		mlog.Logvf(mlog.Info, "Checking object: %s (%.1f days old)", obj.Name, daysOld)
 	}
 
-	return deleteExpiredObjects(objects, this.BackupPrefix, this.ExpiryDays, now, currentObjectName, func(name string) error {
+	return deleteExpiredObjects(ctx, objects, this.BackupPrefix, this.NameTemplate, this.ExpiryDays, now, currentObjectName, objectPinLookup(ctx, this), func(name string) error {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
@@ -137,17 +197,166 @@ func (this *LocalStorage) DeleteOldObjects(ctx context.Context, currentObjectNam
 	})
 }
 
+// ReclaimAbandonedUploads removes temporary files under the backup prefix that
+// were left behind by copies interrupted more than olderThan ago.
+func (this *LocalStorage) ReclaimAbandonedUploads(ctx context.Context, olderThan time.Duration) ([]ReclaimedUpload, error) {
+	ctx = contextOrBackground(ctx)
+	scopeRoot, err := this.getScopeRoot()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(scopeRoot); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	reclaimed := make([]ReclaimedUpload, 0)
+	err = filepath.Walk(scopeRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !isPartialUploadFile(info.Name()) || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(this.LocalPath, path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		reclaimed = append(reclaimed, ReclaimedUpload{Object: filepath.ToSlash(relPath), Detail: "partial file", Bytes: info.Size()})
+		return nil
+	})
+
+	return reclaimed, err
+}
+
 func (this *LocalStorage) Close() error {
 	return nil
 }
 
+func (this *LocalStorage) ManagedPrefix() string {
+	return this.BackupPrefix
+}
+
+func (this *LocalStorage) ManagedNameTemplate() *NameTemplate {
+	return this.NameTemplate
+}
+
+func (this *LocalStorage) ListBackups(ctx context.Context) ([]BackupObject, error) {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	objects, err := this.listScopedObjects()
+	if err != nil {
+		return nil, err
+	}
+	return backupObjects(objects, this.BackupPrefix, this.NameTemplate), nil
+}
+
+func (this *LocalStorage) ListObjects(ctx context.Context, prefix string) ([]BackupObject, error) {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	all, err := this.listObjectsUnder(this.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]BackupObject, 0, len(all))
+	for _, object := range all {
+		if strings.HasPrefix(object.Name, prefix) {
+			objects = append(objects, BackupObject{Name: object.Name, Size: object.Size, ModifiedAt: object.ModifiedAt})
+		}
+	}
+	return objects, nil
+}
+
+func (this *LocalStorage) DeleteObject(ctx context.Context, objectName string) error {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return err
+	}
+
+	targetPath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(objectName))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(targetPath); err != nil {
+		return fmt.Errorf("failed to delete object %q: %w", objectName, err)
+	}
+	if err := os.Remove(targetPath + pinSidecarSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete the pin of object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+// PinObject records reason in a sidecar file next to the backup.
+func (this *LocalStorage) PinObject(ctx context.Context, objectName string, reason string) error {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return err
+	}
+
+	targetPath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(objectName))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(targetPath); err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	if err := os.WriteFile(targetPath+pinSidecarSuffix, []byte(reason), 0o644); err != nil {
+		return fmt.Errorf("failed to pin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *LocalStorage) UnpinObject(ctx context.Context, objectName string) error {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return err
+	}
+
+	targetPath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(objectName))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(targetPath + pinSidecarSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to unpin object %q: %w", objectName, err)
+	}
+	return nil
+}
+
+func (this *LocalStorage) ObjectPin(ctx context.Context, objectName string) (string, bool, error) {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return "", false, err
+	}
+
+	targetPath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(objectName))
+	if err != nil {
+		return "", false, err
+	}
+	reason, err := os.ReadFile(targetPath + pinSidecarSuffix)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the pin of object %q: %w", objectName, err)
+	}
+	return string(reason), true, nil
+}
+
 func (this *LocalStorage) getLastUpdatedFile() (string, error) {
 	objects, err := this.listScopedObjects()
 	if err != nil {
 		return "", err
 	}
 
-	latest, ok := latestEligibleObject(objects, this.BackupPrefix)
+	latest, ok := latestEligibleObject(objects, this.BackupPrefix, this.NameTemplate)
 	if !ok {
 		return "", fmt.Errorf("no objects found in %q", this.LocalPath)
 	}
@@ -160,7 +369,12 @@ func (this *LocalStorage) listScopedObjects() ([]objectTimestamp, error) {
 	if err != nil {
 		return nil, err
 	}
-	if _, err := os.Stat(scopeRoot); err != nil {
+	return this.listObjectsUnder(scopeRoot)
+}
+
+// listObjectsUnder lists the files below root, named relative to LocalPath.
+func (this *LocalStorage) listObjectsUnder(root string) ([]objectTimestamp, error) {
+	if _, err := os.Stat(root); err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
@@ -168,7 +382,7 @@ func (this *LocalStorage) listScopedObjects() ([]objectTimestamp, error) {
 	}
 
 	objects := make([]objectTimestamp, 0)
-	err = filepath.Walk(scopeRoot, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -183,10 +397,14 @@ func (this *LocalStorage) listScopedObjects() ([]objectTimestamp, error) {
 		if info.Mode()&os.ModeSymlink != 0 {
 			return fmt.Errorf("symlink objects are not allowed: %q", relPath)
 		}
+		if isPinSidecar(relPath) {
+			return nil
+		}
 
 		objects = append(objects, objectTimestamp{
 			Name:       filepath.ToSlash(relPath),
 			ModifiedAt: info.ModTime(),
+			Size:       info.Size(),
 		})
 		return nil
 	})
@@ -199,7 +417,7 @@ func (this *LocalStorage) getScopeRoot() (string, error) {
 	return utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(prefixPath))
 }
 
-func copyFile(ctx context.Context, sourceFile string, destFile string) (retErr error) {
+func copyFile(ctx context.Context, sourceFile string, destFile string, bandwidth *Bandwidth, direction transferDirection) (retErr error) {
 	ctx = contextOrBackground(ctx)
 	if err := ctx.Err(); err != nil {
 		return err
@@ -225,6 +443,7 @@ func copyFile(ctx context.Context, sourceFile string, destFile string) (retErr e
 		}
 	}()
 
+	reader := bandwidth.reader(ctx, direction, source)
 	return utils.WriteFileAtomically(destFile, func(dest *os.File) error {
 		buf := make([]byte, 32*1024)
 		for {
@@ -232,7 +451,7 @@ func copyFile(ctx context.Context, sourceFile string, destFile string) (retErr e
 				return err
 			}
 
-			n, readErr := source.Read(buf)
+			n, readErr := reader.Read(buf)
 			if n > 0 {
 				if _, err := dest.Write(buf[:n]); err != nil {
 					return err
@@ -248,3 +467,155 @@ func copyFile(ctx context.Context, sourceFile string, destFile string) (retErr e
 		}
 	})
 }
+
+// ReadLease returns the content of a lease file and its SHA-256 checksum as
+// its version.
+func (this *LocalStorage) ReadLease(ctx context.Context, name string) ([]byte, string, error) {
+	if err := contextOrBackground(ctx).Err(); err != nil {
+		return nil, "", err
+	}
+
+	leasePath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(name))
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(leasePath)
+	if os.IsNotExist(err) {
+		return nil, "", ErrLeaseNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lease %q: %w", name, err)
+	}
+	return data, localLeaseVersion(data), nil
+}
+
+// WriteLease creates or replaces a lease file while holding its lock file, so
+// that checking the version and writing happen as one step. The new content
+// is renamed over the lease, which therefore never goes missing while it is
+// renewed.
+func (this *LocalStorage) WriteLease(ctx context.Context, name string, data []byte, version string) (string, error) {
+	ctx = contextOrBackground(ctx)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	leasePath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(leasePath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to write lease %q: %w", name, err)
+	}
+
+	unlock, err := lockLocalLease(ctx, leasePath)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if err := checkLocalLeaseVersion(leasePath, version); err != nil {
+		return "", err
+	}
+	if err := utils.WriteFileAtomically(leasePath, func(dest *os.File) error {
+		_, err := dest.Write(data)
+		return err
+	}); err != nil {
+		return "", fmt.Errorf("failed to write lease %q: %w", name, err)
+	}
+	return localLeaseVersion(data), nil
+}
+
+// DeleteLease removes a lease file that still has version.
+func (this *LocalStorage) DeleteLease(ctx context.Context, name string, version string) error {
+	ctx = contextOrBackground(ctx)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	leasePath, err := utils.ResolvePathWithinRoot(this.LocalPath, filepath.FromSlash(name))
+	if err != nil {
+		return err
+	}
+	unlock, err := lockLocalLease(ctx, leasePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := checkLocalLeaseVersion(leasePath, version); err != nil {
+		return err
+	}
+	if err := os.Remove(leasePath); err != nil {
+		return fmt.Errorf("failed to delete lease %q: %w", name, err)
+	}
+	return nil
+}
+
+const (
+	// localLeaseLockWait bounds how long a lease operation waits for another
+	// process to release the lease's lock file.
+	localLeaseLockWait = 10 * time.Second
+	// localLeaseLockStale is the age after which a lock file is taken to be
+	// left behind by a process that died while holding it. Lease operations
+	// hold the lock only to read and write a small file.
+	localLeaseLockStale = 5 * time.Second
+	localLeaseLockRetry = 5 * time.Millisecond
+)
+
+// lockLocalLease creates the lock file of the lease at leasePath exclusively,
+// waiting while another process holds it, and returns the function that
+// removes it.
+func lockLocalLease(ctx context.Context, leasePath string) (func(), error) {
+	lockPath := leasePath + ".lock"
+	deadline := time.Now().Add(localLeaseLockWait)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock lease %q: %w", leasePath, err)
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > localLeaseLockStale {
+			mlog.Logvf(mlog.Always, "Removing stale lease lock %q", lockPath)
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock lease %q: %s is still held", leasePath, lockPath)
+		}
+
+		timer := time.NewTimer(localLeaseLockRetry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// checkLocalLeaseVersion reports ErrLeaseConflict unless the lease at
+// leasePath has version, where an empty version means it must not exist. The
+// caller holds the lease's lock.
+func checkLocalLeaseVersion(leasePath string, version string) error {
+	data, err := os.ReadFile(leasePath)
+	switch {
+	case os.IsNotExist(err):
+		if version != "" {
+			return ErrLeaseConflict
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to read lease %q: %w", leasePath, err)
+	case version == "" || localLeaseVersion(data) != version:
+		return ErrLeaseConflict
+	}
+	return nil
+}
+
+func localLeaseVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
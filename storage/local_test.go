@@ -3,10 +3,13 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/egose/database-tools/utils"
 )
@@ -216,6 +219,45 @@ func TestLocalStorageGetTargetObjectNameUsesManagedPrefix(t *testing.T) {
 	}
 }
 
+func TestLocalStorageReclaimAbandonedUploadsRemovesOldPartialFiles(t *testing.T) {
+	s := &LocalStorage{}
+	if err := s.Init(t.TempDir(), 0, DefaultBackupPrefix); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	managedDir := filepath.Join(s.LocalPath, "mongo-archive")
+	if err := os.MkdirAll(managedDir, 0o755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	stale := filepath.Join(managedDir, ".backup.tar.gz.partial-123")
+	recent := filepath.Join(managedDir, ".other.tar.gz.partial-456")
+	backup := filepath.Join(managedDir, "9987654320999-2026-08-12T010203.456Z.tar.gz")
+	for _, path := range []string{stale, recent, backup} {
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, path := range []string{stale, backup} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+
+	reclaimed, err := s.ReclaimAbandonedUploads(context.Background(), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("ReclaimAbandonedUploads() error = %v", err)
+	}
+	if len(reclaimed) != 1 || reclaimed[0].Object != "mongo-archive/.backup.tar.gz.partial-123" || reclaimed[0].Bytes != 4 {
+		t.Fatalf("ReclaimAbandonedUploads() = %#v", reclaimed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("Stat(%q) error = %v, want not exist", stale, err)
+	}
+	assertLocalFileContent(t, recent, "data")
+	assertLocalFileContent(t, backup, "data")
+}
+
 func assertLocalFileContent(t *testing.T, filePath string, want string) {
 	t.Helper()
 	got, err := os.ReadFile(filePath)
@@ -226,3 +268,72 @@ func assertLocalFileContent(t *testing.T, filePath string, want string) {
 		t.Fatalf("ReadFile() = %q, want %q", string(got), want)
 	}
 }
+
+func TestLocalStorageLeaseRenewalRacesAcquisition(t *testing.T) {
+	root := t.TempDir()
+	holder := &LocalStorage{LocalPath: root}
+	competitor := &LocalStorage{LocalPath: root}
+	lock, err := AcquireLock(context.Background(), holder, "nightly", LockOptions{Holder: "holder", TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	const attempts = 200
+	var wg sync.WaitGroup
+	renewErrs := make(chan error, attempts)
+	acquireErrs := make(chan error, attempts)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < attempts; i++ {
+			if err := lock.Renew(context.Background()); err != nil {
+				renewErrs <- err
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < attempts; i++ {
+			_, err := AcquireLock(context.Background(), competitor, "nightly", LockOptions{Holder: "competitor", TTL: time.Hour})
+			var heldErr *LockHeldError
+			if !errors.As(err, &heldErr) {
+				acquireErrs <- fmt.Errorf("AcquireLock() error = %v, want *LockHeldError", err)
+			}
+		}
+	}()
+	wg.Wait()
+	close(renewErrs)
+	close(acquireErrs)
+
+	for err := range renewErrs {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	for err := range acquireErrs {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStorageLeaseRemovesStaleLockFile(t *testing.T) {
+	s := &LocalStorage{LocalPath: t.TempDir()}
+	version, err := s.WriteLease(context.Background(), ".locks/nightly.json", []byte("first"), "")
+	if err != nil {
+		t.Fatalf("WriteLease() error = %v", err)
+	}
+
+	// A process that died while holding the lock left its lock file behind.
+	lockPath := filepath.Join(s.LocalPath, ".locks", "nightly.json.lock")
+	if err := os.WriteFile(lockPath, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	staleAt := time.Now().Add(-2 * localLeaseLockStale)
+	if err := os.Chtimes(lockPath, staleAt, staleAt); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	if _, err := s.WriteLease(context.Background(), ".locks/nightly.json", []byte("second"), version); err != nil {
+		t.Fatalf("WriteLease() over a stale lock file error = %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("Stat(%s) error = %v, want the lock file removed", lockPath, err)
+	}
+}
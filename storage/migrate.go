@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/egose/database-tools/utils"
+	mlog "github.com/mongodb/mongo-tools/common/log"
+)
+
+// ObjectStore is implemented by backends that can list and delete any object,
+// not only managed backups, which migrating legacy backups requires.
+type ObjectStore interface {
+	BackupLister
+	// ListObjects returns every object whose name starts with prefix.
+	ListObjects(ctx context.Context, prefix string) ([]BackupObject, error)
+	DeleteObject(ctx context.Context, objectName string) error
+}
+
+// MigrationAction is what MigrateBackups does with one legacy object.
+type MigrationAction string
+
+const (
+	// MigrationCopy copies the object into the managed prefix.
+	MigrationCopy MigrationAction = "copy"
+	// MigrationMove copies the object into the managed prefix and deletes the
+	// original once the copy is verified.
+	MigrationMove MigrationAction = "move"
+	// MigrationSkip leaves an object whose managed copy already exists.
+	MigrationSkip MigrationAction = "skip"
+	// MigrationConflict leaves an object whose managed name is taken by a
+	// different object.
+	MigrationConflict MigrationAction = "conflict"
+)
+
+// MigrationOptions selects the legacy objects MigrateBackups migrates.
+type MigrationOptions struct {
+	// Pattern matches the full names of the legacy objects to migrate. Nil
+	// matches generated backup filenames at the root of the backend.
+	Pattern *regexp.Regexp
+	// Move deletes each legacy object after its managed copy is verified.
+	Move bool
+	// DryRun only plans the migration.
+	DryRun bool
+	// StagingDir holds each archive between its download and its upload.
+	StagingDir string
+	// Values fill in the placeholders of the backend's name template other
+	// than {utc} and {seq}. A template restricted to a tier supplies {tier}.
+	Values NameValues
+}
+
+// MigrationEntry maps one legacy object to its managed name.
+type MigrationEntry struct {
+	Source string
+	Target string
+	Size   int64
+	Action MigrationAction
+	// Done reports whether the action was carried out; it is always false on
+	// a dry run.
+	Done bool
+}
+
+// MigrateBackups copies legacy backups held outside the managed prefix, or
+// moves them with Move, to contract-compliant names under it, so that
+// latest-object selection and retention see them. Each copy is named with the
+// backend's name template, and so lands in the template's tier, after the
+// time recorded in the legacy filename or else the object's modification
+// time. Without a template, a legacy object whose filename already follows the
+// generated format keeps it. Objects are migrated oldest first, and originals
+// are only deleted once every copy has been verified by listing the managed
+// prefix again. The returned entries are the mapping report, including on a
+// dry run.
+func MigrateBackups(ctx context.Context, s Storage, options MigrationOptions) ([]MigrationEntry, error) {
+	ctx = contextOrBackground(ctx)
+	store, ok := s.(ObjectStore)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s cannot list and delete arbitrary objects", StorageName(s))
+	}
+
+	entries, err := planMigration(ctx, store, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.DryRun {
+		return entries, nil
+	}
+
+	migrated := make([]*MigrationEntry, 0, len(entries))
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Action != MigrationCopy && entry.Action != MigrationMove {
+			continue
+		}
+		if err := migrateObject(ctx, s, *entry, options.StagingDir); err != nil {
+			return entries, err
+		}
+		migrated = append(migrated, entry)
+	}
+
+	backups, err := store.ListBackups(ctx)
+	if err != nil {
+		return entries, fmt.Errorf("failed to list backups on %s: %w", StorageName(s), err)
+	}
+	sizes := make(map[string]int64, len(backups))
+	for _, backup := range backups {
+		sizes[backup.Name] = backup.Size
+	}
+
+	var migrateErrors []error
+	for _, entry := range migrated {
+		if size, ok := sizes[entry.Target]; !ok || size != entry.Size {
+			migrateErrors = append(migrateErrors, fmt.Errorf("failed to verify migration of %s to %s on %s", entry.Source, entry.Target, StorageName(s)))
+			continue
+		}
+		if entry.Action == MigrationMove {
+			if err := store.DeleteObject(ctx, entry.Source); err != nil {
+				migrateErrors = append(migrateErrors, err)
+				continue
+			}
+		}
+		entry.Done = true
+	}
+
+	return entries, errors.Join(migrateErrors...)
+}
+
+func planMigration(ctx context.Context, store ObjectStore, options MigrationOptions) ([]MigrationEntry, error) {
+	objects, err := store.ListObjects(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	prefix := store.ManagedPrefix()
+	template := store.ManagedNameTemplate()
+	existing := map[string]int64{}
+	managed := make([]BackupObject, 0)
+	legacy := make([]BackupObject, 0)
+	for _, object := range objects {
+		if strings.HasPrefix(object.Name, prefix) {
+			existing[object.Name] = object.Size
+			managed = append(managed, object)
+			continue
+		}
+		if isLegacyBackup(object.Name, options.Pattern) {
+			legacy = append(legacy, object)
+		}
+	}
+	managed = ManagedBackups(managed, prefix, template)
+
+	// Oldest first, so that {seq} numbers follow the order of the backups.
+	sort.SliceStable(legacy, func(i, j int) bool {
+		return legacyBackupTime(legacy[i]).Before(legacyBackupTime(legacy[j]))
+	})
+
+	action := MigrationCopy
+	if options.Move {
+		action = MigrationMove
+	}
+
+	entries := make([]MigrationEntry, 0, len(legacy))
+	claimed := map[string]struct{}{}
+	seq := template.NextBackupSeq(managed)
+	for _, object := range legacy {
+		createdAt := legacyBackupTime(object)
+		entry := MigrationEntry{Source: object.Name, Size: object.Size, Action: action}
+		if template.UsesSeq() {
+			// A sequence number is new on every run, so an earlier copy is
+			// recognized by its time and size instead of its name.
+			if copied, ok := migratedCopy(managed, createdAt, object.Size); ok {
+				entry.Target, entry.Action = copied, MigrationSkip
+				entries = append(entries, entry)
+				continue
+			}
+		}
+
+		filename := legacyBackupFilename(object)
+		if template != nil {
+			values := options.Values
+			values.Time, values.Seq = createdAt, seq
+			if tier := template.Tier(); tier != "" {
+				values.Tier = tier
+			}
+			if filename, err = template.Name(values); err != nil {
+				return nil, fmt.Errorf("failed to name the managed copy of %s: %w", object.Name, err)
+			}
+			if template.UsesSeq() {
+				seq++
+			}
+		}
+		entry.Target, err = BuildBackupObjectName(prefix, template, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		if size, ok := existing[entry.Target]; ok {
+			entry.Action = MigrationConflict
+			if size == object.Size {
+				entry.Action = MigrationSkip
+			}
+		} else if _, ok := claimed[entry.Target]; ok {
+			entry.Action = MigrationConflict
+		}
+		claimed[entry.Target] = struct{}{}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func isLegacyBackup(name string, pattern *regexp.Regexp) bool {
+	if pattern != nil {
+		return pattern.MatchString(name)
+	}
+	return backupObjectPattern.MatchString(name)
+}
+
+func legacyBackupFilename(object BackupObject) string {
+	if filename := path.Base(object.Name); backupObjectPattern.MatchString(filename) {
+		return filename
+	}
+	filename, _ := utils.GetFilenameAt(object.ModifiedAt.UTC())
+	return filename
+}
+
+// legacyBackupTime returns when a legacy object was taken: the time in its
+// filename when it follows the generated format, or else its modification
+// time, to the millisecond that names record.
+func legacyBackupTime(object BackupObject) time.Time {
+	if parsed, ok := parseLegacyBackupName(path.Base(object.Name)); ok {
+		return parsed.createdAt
+	}
+	return object.ModifiedAt.UTC().Truncate(time.Millisecond)
+}
+
+// migratedCopy returns the managed backup taken at createdAt with size, which
+// an earlier migration copied.
+func migratedCopy(managed []BackupObject, createdAt time.Time, size int64) (string, bool) {
+	for _, backup := range managed {
+		if backup.CreatedAt.Equal(createdAt) && backup.Size == size {
+			return backup.Name, true
+		}
+	}
+	return "", false
+}
+
+func migrateObject(ctx context.Context, s Storage, entry MigrationEntry, stagingDir string) error {
+	backup := BackupObject{Name: entry.Source, Size: entry.Size}
+	stagedPath := filepath.Join(stagingDir, path.Base(entry.Target))
+	if err := stageBackup(ctx, s, backup, stagedPath); err != nil {
+		return err
+	}
+	defer os.Remove(stagedPath)
+
+	if _, err := s.Upload(ctx, entry.Target, stagedPath); err != nil {
+		return fmt.Errorf("failed to migrate %s to %s: %w", entry.Source, entry.Target, err)
+	}
+	mlog.Logvf(mlog.Always, "Migrated %s to %s on %s (%d bytes)", entry.Source, entry.Target, StorageName(s), entry.Size)
+	return nil
+}
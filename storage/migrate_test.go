@@ -0,0 +1,135 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+	"github.com/egose/database-tools/utils"
+)
+
+func TestMigrateBackupsMovesLegacyBackupsIntoManagedPrefix(t *testing.T) {
+	older, newer, managed := backupFilename(t, 20), backupFilename(t, 10), backupFilename(t, 0)
+	s := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "mongo-archive"})
+	uploadObject(t, s, older, "older")
+	uploadObject(t, s, newer, "newer")
+	uploadObject(t, s, "mongo-archive/"+managed, "managed")
+	uploadObject(t, s, "exports/"+older, "not at the root")
+	uploadObject(t, s, "notes.txt", "not a backup")
+
+	options := storage.MigrationOptions{Move: true, DryRun: true, StagingDir: t.TempDir()}
+	entries, err := storage.MigrateBackups(context.Background(), s, options)
+	if err != nil {
+		t.Fatalf("MigrateBackups() dry run error = %v", err)
+	}
+	want := []storage.MigrationEntry{
+		{Source: older, Target: "mongo-archive/" + older, Size: 5, Action: storage.MigrationMove},
+		{Source: newer, Target: "mongo-archive/" + newer, Size: 5, Action: storage.MigrationMove},
+	}
+	if !slices.Equal(entries, want) {
+		t.Fatalf("MigrateBackups() dry run = %+v, want %+v", entries, want)
+	}
+	if got := len(s.Objects()); got != 5 {
+		t.Fatalf("dry run changed storage: %v", s.Objects())
+	}
+
+	options.DryRun = false
+	entries, err = storage.MigrateBackups(context.Background(), s, options)
+	if err != nil {
+		t.Fatalf("MigrateBackups() error = %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.Done {
+			t.Fatalf("MigrateBackups() entry %+v not done", entry)
+		}
+	}
+	wantObjects := []string{"exports/" + older, "mongo-archive/" + managed, "mongo-archive/" + newer, "mongo-archive/" + older, "notes.txt"}
+	if got := s.Objects(); !slices.Equal(got, wantObjects) {
+		t.Fatalf("objects after migration = %v, want %v", got, wantObjects)
+	}
+}
+
+func TestMigrateBackupsRenamesPatternMatchesAndReportsConflicts(t *testing.T) {
+	modifiedAt := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	s := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "managed", Now: func() time.Time { return modifiedAt }})
+	uploadObject(t, s, "dumps/nightly.tar.gz", "legacy")
+	uploadObject(t, s, "dumps/weekly.tar.gz", "other")
+	uploadObject(t, s, "dumps/"+backupFilename(t, 0), "present")
+	uploadObject(t, s, "managed/"+backupFilename(t, 0), "present")
+
+	generated, _ := utils.GetFilenameAt(modifiedAt)
+	entries, err := storage.MigrateBackups(context.Background(), s, storage.MigrationOptions{Pattern: regexp.MustCompile(`^dumps/`), StagingDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("MigrateBackups() error = %v", err)
+	}
+
+	got := map[string]storage.MigrationEntry{}
+	for _, entry := range entries {
+		got[entry.Source] = entry
+	}
+	if entry := got["dumps/nightly.tar.gz"]; entry.Action != storage.MigrationCopy || entry.Target != "managed/"+generated || !entry.Done {
+		t.Fatalf("nightly entry = %+v, want a copy to managed/%s", entry, generated)
+	}
+	if entry := got["dumps/weekly.tar.gz"]; entry.Action != storage.MigrationConflict || entry.Done {
+		t.Fatalf("weekly entry = %+v, want a conflict on the same generated name", entry)
+	}
+	if entry := got["dumps/"+backupFilename(t, 0)]; entry.Action != storage.MigrationSkip {
+		t.Fatalf("present entry = %+v, want skip", entry)
+	}
+	if !slices.Contains(s.Objects(), "dumps/nightly.tar.gz") {
+		t.Fatal("copy migration deleted the legacy object")
+	}
+}
+
+func TestMigrateBackupsNamesCopiesWithTheBackendTemplate(t *testing.T) {
+	template, err := storage.ParseNameTemplate("{tier}/{db}-{utc}-{seq}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate() error = %v", err)
+	}
+	older, _ := utils.GetFilenameAt(time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC))
+	newer, _ := utils.GetFilenameAt(time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC))
+	s := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "managed", NameTemplate: template.ForTier("daily")})
+	uploadObject(t, s, newer, "newer")
+	uploadObject(t, s, older, "older")
+	uploadObject(t, s, "managed/daily/orders-2026-01-03T030000.000Z-000007.tar.gz", "current")
+
+	options := storage.MigrationOptions{StagingDir: t.TempDir(), Values: storage.NameValues{DB: "orders"}}
+	entries, err := storage.MigrateBackups(context.Background(), s, options)
+	if err != nil {
+		t.Fatalf("MigrateBackups() error = %v", err)
+	}
+	want := []storage.MigrationEntry{
+		{Source: older, Target: "managed/daily/orders-2026-01-01T030000.000Z-000008.tar.gz", Size: 5, Action: storage.MigrationCopy, Done: true},
+		{Source: newer, Target: "managed/daily/orders-2026-01-02T030000.000Z-000009.tar.gz", Size: 5, Action: storage.MigrationCopy, Done: true},
+	}
+	if !slices.Equal(entries, want) {
+		t.Fatalf("MigrateBackups() = %+v, want %+v", entries, want)
+	}
+
+	// The copies fall under the tier's retention, and a second run finds them
+	// despite their sequence numbers.
+	backups, err := s.ListBackups(context.Background())
+	if err != nil || len(backups) != 3 {
+		t.Fatalf("ListBackups() = %+v, %v, want the migrated backups in the daily tier", backups, err)
+	}
+	entries, err = storage.MigrateBackups(context.Background(), s, options)
+	if err != nil {
+		t.Fatalf("MigrateBackups() again error = %v", err)
+	}
+	for i, entry := range entries {
+		if entry.Action != storage.MigrationSkip || entry.Target != want[i].Target {
+			t.Fatalf("MigrateBackups() again entry = %+v, want a skip of %s", entry, want[i].Target)
+		}
+	}
+
+	// Without a tier, a tiered template cannot name the copies.
+	untiered := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "managed", NameTemplate: template})
+	uploadObject(t, untiered, older, "older")
+	if _, err := storage.MigrateBackups(context.Background(), untiered, storage.MigrationOptions{DryRun: true, Values: storage.NameValues{DB: "orders"}}); err == nil {
+		t.Fatal("MigrateBackups() into a tiered template without a tier error = nil, want an error")
+	}
+}
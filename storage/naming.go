@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egose/database-tools/utils"
+)
+
+// backupExtension ends every managed backup name.
+const backupExtension = ".tar.gz"
+
+// nameTimeLayout formats the {utc} placeholder. Colons are left out because
+// some filesystems do not allow them.
+const nameTimeLayout = "2006-01-02T150405.000Z"
+
+// legacyTimestampBase is subtracted from a Unix time in milliseconds to build
+// the leading field of legacy names, so that newer names sort first.
+const legacyTimestampBase = 9999999999999
+
+var (
+	nameTemplateValuePattern = `[A-Za-z0-9._-]+`
+	nameTemplateLiteral      = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+	nameValueInvalid         = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// nameTemplatePlaceholders maps each placeholder to the pattern its values
+// match. Only {utc}, {seq} and {tier} are read back from a name.
+var nameTemplatePlaceholders = map[string]string{
+	"db":      nameTemplateValuePattern,
+	"cluster": nameTemplateValuePattern,
+	"label":   nameTemplateValuePattern,
+	"tier":    `(?P<tier>` + nameTemplateValuePattern + `)`,
+	"utc":     `(?P<utc>\d{4}-\d{2}-\d{2}T\d{6}\.\d{3}Z)`,
+	"seq":     `(?P<seq>\d{6,})`,
+}
+
+// nameTemplateUnique lists the placeholders that are read back from a name,
+// which may therefore appear only once.
+var nameTemplateUnique = []string{"utc", "seq", "tier"}
+
+// NameTemplate generates the names of managed backups below the backup prefix
+// and recognizes them again. A template such as "{cluster}/{db}/{utc}-{seq}"
+// combines literal text with the placeholders {db}, {cluster}, {label},
+// {tier}, {utc} and {seq}; "/" places backups in sub-directories of the
+// prefix, and ".tar.gz" is appended. Names generated before templates existed
+// are recognized, so the template can change without orphaning older backups,
+// unless the template is restricted to one tier with ForTier. The nil template
+// generates those legacy names.
+type NameTemplate struct {
+	template string
+	pattern  *regexp.Regexp
+	segments int
+	usesSeq  bool
+	tier     string
+}
+
+// NameValues fills in the placeholders of a NameTemplate.
+type NameValues struct {
+	DB      string
+	Cluster string
+	Label   string
+	Tier    string
+	Time    time.Time
+	Seq     int
+}
+
+// ParseNameTemplate parses a backup naming template. An empty template
+// returns nil, which keeps the legacy naming.
+func ParseNameTemplate(template string) (*NameTemplate, error) {
+	template = strings.TrimSuffix(strings.TrimSpace(template), backupExtension)
+	if template == "" {
+		return nil, nil
+	}
+
+	segments := strings.Split(template, "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("invalid backup name template %q: every path segment must be non-empty and neither . nor ..", template)
+		}
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	placeholders := map[string]int{}
+	rest := template
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		literal := rest
+		if start >= 0 {
+			literal = rest[:start]
+		}
+		if !nameTemplateLiteral.MatchString(literal) {
+			return nil, fmt.Errorf("invalid backup name template %q: literal text may only hold letters, digits, and . _ - /", template)
+		}
+		pattern.WriteString(regexp.QuoteMeta(literal))
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid backup name template %q: unclosed placeholder", template)
+		}
+		name := rest[start+1 : start+end]
+		placeholderPattern, ok := nameTemplatePlaceholders[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid backup name template %q: unknown placeholder {%s} (expected {db}, {cluster}, {label}, {tier}, {utc}, or {seq})", template, name)
+		}
+		placeholders[name]++
+		if slices.Contains(nameTemplateUnique, name) && placeholders[name] > 1 {
+			return nil, fmt.Errorf("invalid backup name template %q: {%s} may appear only once", template, name)
+		}
+		pattern.WriteString(placeholderPattern)
+		rest = rest[start+end+1:]
+	}
+	pattern.WriteString(regexp.QuoteMeta(backupExtension) + "$")
+
+	if placeholders["utc"] == 0 {
+		return nil, fmt.Errorf("invalid backup name template %q: {utc} is required to order backups", template)
+	}
+
+	return &NameTemplate{
+		template: template,
+		pattern:  regexp.MustCompile(pattern.String()),
+		segments: len(segments),
+		usesSeq:  placeholders["seq"] > 0,
+	}, nil
+}
+
+// String returns the template as configured, or "" for the legacy naming.
+func (t *NameTemplate) String() string {
+	if t == nil {
+		return ""
+	}
+	return t.template
+}
+
+// ForTier returns a copy of the template that recognizes only the backups of
+// tier, so that retention and sequence numbers apply to that tier alone.
+// Legacy names and the names of other tiers are left alone. It returns the
+// template unchanged when tier is empty or the template has no {tier}.
+func (t *NameTemplate) ForTier(tier string) *NameTemplate {
+	if tier == "" || !t.Uses("tier") {
+		return t
+	}
+	scoped := *t
+	scoped.tier = tier
+	return &scoped
+}
+
+// Tier returns the tier the template is restricted to, or "".
+func (t *NameTemplate) Tier() string {
+	if t == nil {
+		return ""
+	}
+	return t.tier
+}
+
+// UsesSeq reports whether names carry a {seq} sequence number, which the
+// caller must fill in from the backups that already exist.
+func (t *NameTemplate) UsesSeq() bool {
+	return t != nil && t.usesSeq
+}
+
+// Uses reports whether the template holds the placeholder {name}.
+func (t *NameTemplate) Uses(name string) bool {
+	return t != nil && strings.Contains(t.template, "{"+name+"}")
+}
+
+// Name returns the backup name, relative to the backup prefix, for values.
+// Values are reduced to letters, digits, and . _ - so that they stay within
+// one path segment.
+func (t *NameTemplate) Name(values NameValues) (string, error) {
+	if t == nil {
+		filename, _ := utils.GetFilenameAt(values.Time)
+		return filename, nil
+	}
+
+	replacements := make([]string, 0, 2*len(nameTemplatePlaceholders))
+	for _, placeholder := range []struct{ name, value string }{
+		{name: "db", value: values.DB},
+		{name: "cluster", value: values.Cluster},
+		{name: "label", value: values.Label},
+		{name: "tier", value: values.Tier},
+	} {
+		if !t.Uses(placeholder.name) {
+			continue
+		}
+		value := strings.Trim(nameValueInvalid.ReplaceAllString(placeholder.value, "-"), "-.")
+		if value == "" {
+			return "", fmt.Errorf("backup name template %q uses {%s}, which is empty", t.template, placeholder.name)
+		}
+		replacements = append(replacements, "{"+placeholder.name+"}", value)
+	}
+	replacements = append(replacements,
+		"{utc}", values.Time.UTC().Format(nameTimeLayout),
+		"{seq}", fmt.Sprintf("%06d", values.Seq),
+	)
+
+	return strings.NewReplacer(replacements...).Replace(t.template) + backupExtension, nil
+}
+
+// backupName is what a managed backup's name records about it.
+type backupName struct {
+	createdAt time.Time
+	seq       int
+}
+
+// parse reads a backup name relative to the backup prefix. It accepts names
+// generated by the template and, unless the template is restricted to a tier,
+// legacy names.
+func (t *NameTemplate) parse(name string) (backupName, bool) {
+	if t != nil {
+		if match := t.pattern.FindStringSubmatch(name); match != nil {
+			if t.tier != "" && match[t.pattern.SubexpIndex("tier")] != t.tier {
+				return backupName{}, false
+			}
+			parsed := backupName{}
+			createdAt, err := time.Parse(nameTimeLayout, match[t.pattern.SubexpIndex("utc")])
+			if err != nil {
+				return backupName{}, false
+			}
+			parsed.createdAt = createdAt
+			if t.usesSeq {
+				if parsed.seq, err = strconv.Atoi(match[t.pattern.SubexpIndex("seq")]); err != nil {
+					return backupName{}, false
+				}
+			}
+			return parsed, true
+		}
+		if t.tier != "" {
+			return backupName{}, false
+		}
+	}
+
+	return parseLegacyBackupName(name)
+}
+
+// parseLegacyBackupName reads the creation time of a legacy name from its
+// leading field. The date that follows it was formatted in local time despite
+// its Z suffix, so it is not used.
+func parseLegacyBackupName(name string) (backupName, bool) {
+	if !backupObjectPattern.MatchString(name) {
+		return backupName{}, false
+	}
+	field, _, _ := strings.Cut(name, "-")
+	reversed, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return backupName{}, false
+	}
+	return backupName{createdAt: time.UnixMilli(legacyTimestampBase - reversed).UTC()}, true
+}
+
+// relativeName returns the trailing part of objectName that names a managed
+// backup: as many path segments as the template produces, or the last segment
+// for a legacy name.
+func (t *NameTemplate) relativeName(objectName string) (string, bool) {
+	segments := strings.Split(objectName, "/")
+	if t != nil && len(segments) >= t.segments {
+		name := strings.Join(segments[len(segments)-t.segments:], "/")
+		if _, ok := t.parse(name); ok {
+			return name, true
+		}
+		if t.tier != "" {
+			return "", false
+		}
+	}
+	name := segments[len(segments)-1]
+	if backupObjectPattern.MatchString(name) {
+		return name, true
+	}
+	return "", false
+}
+
+// NextBackupSeq returns the sequence number for the next backup: one more
+// than the highest {seq} among backups, or 1 when none has one.
+func (t *NameTemplate) NextBackupSeq(backups []BackupObject) int {
+	highest := 0
+	for _, backup := range backups {
+		if parsed, ok := t.parse(backup.Filename()); ok && parsed.seq > highest {
+			highest = parsed.seq
+		}
+	}
+	return highest + 1
+}
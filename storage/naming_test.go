@@ -0,0 +1,148 @@
+package storage_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+)
+
+func TestParseNameTemplateRejectsInvalidTemplates(t *testing.T) {
+	for _, raw := range []string{
+		"{db}-{seq}",
+		"{utc}-{utc}",
+		"{utc}-{seq}-{seq}",
+		"{utc}-{host}",
+		"{utc",
+		"nightly backup/{utc}",
+		"../{utc}",
+		"{cluster}//{utc}",
+		"/{utc}",
+	} {
+		if _, err := storage.ParseNameTemplate(raw); err == nil {
+			t.Fatalf("ParseNameTemplate(%q) error = nil, want an error", raw)
+		}
+	}
+
+	template, err := storage.ParseNameTemplate("  ")
+	if err != nil || template != nil {
+		t.Fatalf("ParseNameTemplate(\"  \") = %v, %v, want nil, nil", template, err)
+	}
+}
+
+func TestNameTemplateNamesAndRecognizesBackups(t *testing.T) {
+	template, err := storage.ParseNameTemplate("{cluster}/{db}/{label}-{utc}-{seq}.tar.gz")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate() error = %v", err)
+	}
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 678000000, time.FixedZone("CET", 3600))
+	name, err := template.Name(storage.NameValues{DB: "app", Cluster: "rs0", Label: "nightly run", Time: createdAt, Seq: 42})
+	if err != nil {
+		t.Fatalf("Name() error = %v", err)
+	}
+	if want := "rs0/app/nightly-run-2026-01-02T020405.678Z-000042.tar.gz"; name != want {
+		t.Fatalf("Name() = %q, want %q", name, want)
+	}
+	if _, err := template.Name(storage.NameValues{DB: "app", Cluster: "rs0", Time: createdAt}); err == nil {
+		t.Fatal("Name() error = nil, want an error for the empty {label}")
+	}
+
+	legacy := backupFilename(t, 0)
+	for _, objectName := range []string{"backups/" + name, "backups/" + legacy} {
+		if !storage.IsEligibleBackupObject(objectName, "backups", template) {
+			t.Fatalf("IsEligibleBackupObject(%q) = false, want true", objectName)
+		}
+	}
+	for _, objectName := range []string{"backups/app/" + name, "backups/rs0/" + legacy, "other/" + name} {
+		if storage.IsEligibleBackupObject(objectName, "backups", template) {
+			t.Fatalf("IsEligibleBackupObject(%q) = true, want false", objectName)
+		}
+	}
+	if got, want := storage.LookupObjectCandidates("backups", template, name), []string{"backups/" + name, name}; !slices.Equal(got, want) {
+		t.Fatalf("LookupObjectCandidates() = %v, want %v", got, want)
+	}
+
+	backups := storage.ManagedBackups([]storage.BackupObject{{Name: "backups/" + name}, {Name: "backups/" + legacy}}, "backups/", template)
+	if len(backups) != 2 || backups[1].Filename() != name || !backups[1].CreatedAt.Equal(createdAt) {
+		t.Fatalf("ManagedBackups() = %+v, want %q created at %v", backups, name, createdAt)
+	}
+	if got := template.NextBackupSeq(backups); got != 43 {
+		t.Fatalf("NextBackupSeq() = %d, want 43", got)
+	}
+}
+
+func TestNameTemplateForTierRecognizesOnlyItsTier(t *testing.T) {
+	template, err := storage.ParseNameTemplate("{tier}/{utc}-{seq}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate() error = %v", err)
+	}
+	if _, err := storage.ParseNameTemplate("{tier}-{tier}-{utc}"); err == nil {
+		t.Fatal("ParseNameTemplate() error = nil, want an error for a repeated {tier}")
+	}
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	hourly, err := template.Name(storage.NameValues{Tier: "hourly", Time: createdAt, Seq: 5})
+	if err != nil {
+		t.Fatalf("Name() error = %v", err)
+	}
+	daily, err := template.Name(storage.NameValues{Tier: "daily", Time: createdAt, Seq: 2})
+	if err != nil {
+		t.Fatalf("Name() error = %v", err)
+	}
+	legacy := backupFilename(t, 0)
+
+	scoped := template.ForTier("daily")
+	if scoped.Tier() != "daily" || template.Tier() != "" {
+		t.Fatalf("Tier() = %q and %q, want daily and empty", scoped.Tier(), template.Tier())
+	}
+	for name, want := range map[string]bool{hourly: false, daily: true, legacy: false} {
+		if got := storage.IsEligibleBackupObject("backups/"+name, "backups", scoped); got != want {
+			t.Fatalf("IsEligibleBackupObject(%q) for the daily tier = %v, want %v", name, got, want)
+		}
+		if !storage.IsEligibleBackupObject("backups/"+name, "backups", template) {
+			t.Fatalf("IsEligibleBackupObject(%q) = false, want true", name)
+		}
+	}
+	backups := storage.ManagedBackups([]storage.BackupObject{{Name: "backups/" + hourly}, {Name: "backups/" + daily}}, "backups/", scoped)
+	if got := scoped.NextBackupSeq(backups); len(backups) != 1 || got != 3 {
+		t.Fatalf("NextBackupSeq() for the daily tier = %d over %d backups, want 3 over 1", got, len(backups))
+	}
+	untiered, err := storage.ParseNameTemplate("{utc}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate() error = %v", err)
+	}
+	if got := untiered.ForTier("daily"); got != untiered {
+		t.Fatalf("ForTier() on a template without {tier} = %v, want the template unchanged", got)
+	}
+}
+
+func TestCopyBackupsKeepsTemplatedNames(t *testing.T) {
+	template, err := storage.ParseNameTemplate("{db}/{utc}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate() error = %v", err)
+	}
+	source := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "primary", NameTemplate: template})
+	target := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "offsite", NameTemplate: template})
+	names := make([]string, 0, 2)
+	for _, minutesAgo := range []int{10, 20} {
+		name, err := template.Name(storage.NameValues{DB: "app", Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Add(-time.Duration(minutesAgo) * time.Minute)})
+		if err != nil {
+			t.Fatalf("Name() error = %v", err)
+		}
+		uploadObject(t, source, "primary/"+name, "archive "+name)
+		names = append(names, name)
+	}
+
+	results, err := storage.CopyBackups(context.Background(), source, []storage.Storage{target}, storage.CopyOptions{StagingDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("CopyBackups() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Object != "offsite/"+names[1] || results[1].Object != "offsite/"+names[0] {
+		t.Fatalf("CopyBackups() = %+v, want the oldest backup copied first", results)
+	}
+	if got, want := target.Objects(), []string{"offsite/" + names[1], "offsite/" + names[0]}; !slices.Equal(got, want) {
+		t.Fatalf("target objects = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultPinReason is recorded when a backup is pinned without a reason.
+const DefaultPinReason = "pinned"
+
+// pinTagKey is the object tag or blob index tag that pins a backup. Backends
+// whose metadata updates change an object's modification time store the pin
+// in a sidecar object named after the backup plus pinSidecarSuffix instead.
+const (
+	pinTagKey        = "pinned"
+	pinSidecarSuffix = ".pinned"
+)
+
+// pinReasonPattern accepts the characters every backend allows in a tag value.
+var pinReasonPattern = regexp.MustCompile(`^[A-Za-z0-9 +\-./:=_]{0,256}$`)
+
+// Pinner is implemented by backends that can pin backups. Retention and
+// tiering skip pinned backups, so they are kept until they are unpinned.
+type Pinner interface {
+	// PinObject pins objectName, recording reason.
+	PinObject(ctx context.Context, objectName string, reason string) error
+	// UnpinObject removes the pin from objectName. Unpinning a backup that is
+	// not pinned is not an error.
+	UnpinObject(ctx context.Context, objectName string) error
+	// ObjectPin reports whether objectName is pinned, and why.
+	ObjectPin(ctx context.Context, objectName string) (string, bool, error)
+}
+
+// PinResult records one copy of a backup pinned or unpinned by PinBackups or
+// UnpinBackups.
+type PinResult struct {
+	Storage Storage
+	Object  string
+}
+
+// PinnedBackup is a backup held by a backend together with its pin.
+type PinnedBackup struct {
+	BackupObject
+	Pinned    bool
+	PinReason string
+}
+
+// ValidatePinReason checks that reason can be stored on every backend: at most
+// 256 letters, digits, spaces, and + - . / : = _ characters.
+func ValidatePinReason(reason string) error {
+	if !pinReasonPattern.MatchString(reason) {
+		return fmt.Errorf("invalid pin reason %q: use at most 256 letters, digits, spaces, and + - . / : = _", reason)
+	}
+	return nil
+}
+
+// PinBackups pins every copy of the given backups, named by filename or full
+// object name, on every backend that holds them. An empty reason records
+// DefaultPinReason.
+func PinBackups(ctx context.Context, storages []Storage, objects []string, reason string) ([]PinResult, error) {
+	if reason == "" {
+		reason = DefaultPinReason
+	}
+	if err := ValidatePinReason(reason); err != nil {
+		return nil, err
+	}
+	return forEachBackupCopy(ctx, storages, objects, func(ctx context.Context, pinner Pinner, objectName string) error {
+		return pinner.PinObject(ctx, objectName, reason)
+	})
+}
+
+// UnpinBackups removes the pin from every copy of the given backups, named by
+// filename or full object name, on every backend that holds them.
+func UnpinBackups(ctx context.Context, storages []Storage, objects []string) ([]PinResult, error) {
+	return forEachBackupCopy(ctx, storages, objects, func(ctx context.Context, pinner Pinner, objectName string) error {
+		return pinner.UnpinObject(ctx, objectName)
+	})
+}
+
+// ListPinnedBackups lists the backups s holds, newest first, and reports which
+// of them are pinned. Backups on a backend that cannot pin are never pinned.
+func ListPinnedBackups(ctx context.Context, s Storage) ([]PinnedBackup, error) {
+	ctx = contextOrBackground(ctx)
+	lister, ok := s.(BackupLister)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s cannot list its backups", StorageName(s))
+	}
+	backups, err := lister.ListBackups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups on %s: %w", StorageName(s), err)
+	}
+	slices.SortFunc(backups, func(a, b BackupObject) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Filename(), b.Filename())
+	})
+
+	pinReason := objectPinLookup(ctx, s)
+	listing := make([]PinnedBackup, 0, len(backups))
+	for _, backup := range backups {
+		entry := PinnedBackup{BackupObject: backup}
+		if pinReason != nil {
+			if entry.PinReason, entry.Pinned, err = pinReason(backup.Name); err != nil {
+				return listing, fmt.Errorf("failed to check whether object %q is pinned: %w", backup.Name, err)
+			}
+		}
+		listing = append(listing, entry)
+	}
+	return listing, nil
+}
+
+// forEachBackupCopy calls fn for every copy of the given backups. It fails
+// when a backup is found on no backend.
+func forEachBackupCopy(ctx context.Context, storages []Storage, objects []string, fn func(context.Context, Pinner, string) error) ([]PinResult, error) {
+	ctx = contextOrBackground(ctx)
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no backups given")
+	}
+
+	found := make(map[string]bool, len(objects))
+	results := make([]PinResult, 0)
+	for _, s := range storages {
+		pinner, ok := s.(Pinner)
+		if !ok {
+			return results, fmt.Errorf("storage backend %s cannot pin backups", StorageName(s))
+		}
+		lister, ok := s.(BackupLister)
+		if !ok {
+			return results, fmt.Errorf("storage backend %s cannot list its backups", StorageName(s))
+		}
+		backups, err := lister.ListBackups(ctx)
+		if err != nil {
+			return results, fmt.Errorf("failed to list backups on %s: %w", StorageName(s), err)
+		}
+
+		for _, backup := range backups {
+			for _, object := range objects {
+				if object != backup.Name && object != backup.Filename() {
+					continue
+				}
+				if err := fn(ctx, pinner, backup.Name); err != nil {
+					return results, fmt.Errorf("failed to update the pin of %s on %s: %w", backup.Name, StorageName(s), err)
+				}
+				found[object] = true
+				results = append(results, PinResult{Storage: s, Object: backup.Name})
+			}
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, object := range objects {
+		if !found[object] {
+			missing = append(missing, object)
+		}
+	}
+	if len(missing) > 0 {
+		return results, fmt.Errorf("backup(s) not found on any backend: %s", strings.Join(missing, ", "))
+	}
+	return results, nil
+}
+
+// objectPinLookup returns s's pin lookup for retention, or nil when s cannot
+// pin backups.
+func objectPinLookup(ctx context.Context, s Storage) func(string) (string, bool, error) {
+	pinner, ok := s.(Pinner)
+	if !ok {
+		return nil
+	}
+	return func(objectName string) (string, bool, error) {
+		return pinner.ObjectPin(ctx, objectName)
+	}
+}
+
+// unpinnedObjects returns the names on s that are not pinned.
+func unpinnedObjects(ctx context.Context, s Storage, names []string) ([]string, error) {
+	pinReason := objectPinLookup(ctx, s)
+	if pinReason == nil {
+		return names, nil
+	}
+
+	unpinned := make([]string, 0, len(names))
+	for _, name := range names {
+		_, pinned, err := pinReason(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check whether object %q is pinned: %w", name, err)
+		}
+		if !pinned {
+			unpinned = append(unpinned, name)
+		}
+	}
+	return unpinned, nil
+}
+
+// isPinSidecar reports whether name is the sidecar object of a pinned backup.
+func isPinSidecar(name string) bool {
+	return strings.HasSuffix(name, pinSidecarSuffix)
+}
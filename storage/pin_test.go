@@ -0,0 +1,55 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+)
+
+func TestPinBackupsPinsEveryCopy(t *testing.T) {
+	filename, other := backupFilename(t, 10), backupFilename(t, 20)
+	primary := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "primary"})
+	offsite := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "offsite"})
+	uploadObject(t, primary, "primary/"+filename, "archive")
+	uploadObject(t, primary, "primary/"+other, "archive")
+	uploadObject(t, offsite, "offsite/"+filename, "archive")
+	storages := []storage.Storage{primary, offsite}
+
+	results, err := storage.PinBackups(context.Background(), storages, []string{filename}, "")
+	if err != nil {
+		t.Fatalf("PinBackups() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Object != "primary/"+filename || results[1].Object != "offsite/"+filename {
+		t.Fatalf("PinBackups() = %+v, want the primary and offsite copies", results)
+	}
+	for _, backupCopy := range []struct {
+		s    *storagetest.MemoryStorage
+		name string
+	}{{primary, "primary/" + filename}, {offsite, "offsite/" + filename}} {
+		if reason, ok, err := backupCopy.s.ObjectPin(context.Background(), backupCopy.name); err != nil || !ok || reason != storage.DefaultPinReason {
+			t.Fatalf("ObjectPin(%q) = %q, %v, %v, want %q, true, nil", backupCopy.name, reason, ok, err, storage.DefaultPinReason)
+		}
+	}
+	if _, ok, _ := primary.ObjectPin(context.Background(), "primary/"+other); ok {
+		t.Fatalf("PinBackups() pinned %q, which was not named", other)
+	}
+
+	if _, err := storage.UnpinBackups(context.Background(), storages, []string{"offsite/" + filename}); err != nil {
+		t.Fatalf("UnpinBackups() error = %v", err)
+	}
+	if _, ok, _ := offsite.ObjectPin(context.Background(), "offsite/"+filename); ok {
+		t.Fatal("UnpinBackups() left the offsite copy pinned")
+	}
+	if _, ok, _ := primary.ObjectPin(context.Background(), "primary/"+filename); !ok {
+		t.Fatal("UnpinBackups() unpinned the primary copy, which was named by another object name")
+	}
+
+	if _, err := storage.PinBackups(context.Background(), storages, []string{backupFilename(t, 30)}, ""); err == nil {
+		t.Fatal("PinBackups() error = nil, want a backup not found error")
+	}
+	if _, err := storage.PinBackups(context.Background(), storages, []string{filename}, "reason; with punctuation!"); err == nil {
+		t.Fatal("PinBackups() error = nil, want an invalid reason error")
+	}
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/egose/database-tools/flagdef"
+)
+
+// BackendSettings holds the flag values of one storage instance, keyed by
+// flag name. Bool flags hold "true" or "false".
+type BackendSettings map[string]string
+
+// BackendConfig is passed to a BackendType's constructor.
+type BackendConfig struct {
+	InstanceName string
+	Settings     BackendSettings
+	ExpiryDays   int
+	BackupPrefix string
+	NameTemplate *NameTemplate
+	Transfers    *TransferStateStore
+	Bandwidth    *Bandwidth
+}
+
+// BackendType describes a kind of storage backend to the tools: the flags
+// that configure it, when it counts as configured, and how to construct it.
+// The tools bind, document and construct every registered type, so a
+// program embedding them can add a backend with RegisterBackend.
+type BackendType struct {
+	// Name identifies the type in --storage-backend, --storage-instances
+	// and --backend-rate-limits.
+	Name string
+	// Label names the type in log messages.
+	Label       string
+	StringFlags []flagdef.StringFlagDef
+	BoolFlags   []flagdef.BoolFlagDef
+	// Missing returns the flags that settings must still set before the
+	// backend is enabled.
+	Missing func(BackendSettings) []string
+	New     func(context.Context, BackendConfig) (Storage, error)
+	// Instance reports whether a Storage was built by this type and, if so,
+	// its instance name.
+	Instance func(Storage) (string, bool)
+	// URLScheme and ParseURL are optional. ParseURL copies the location in a
+	// destination URL into settings and returns the backup prefix it names,
+	// or "" to keep the configured one.
+	URLScheme string
+	ParseURL  func(*url.URL, BackendSettings) (string, error)
+	// Location is optional. It returns where settings keep their objects, so
+	// that instances with the same location are known to share them. Without
+	// it, instances share a location only when every flag of the type is
+	// equal.
+	Location func(BackendSettings) string
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = []BackendType{localBackendType, azureBackendType, awsBackendType, gcpBackendType}
+)
+
+// RegisterBackend adds a backend type. It panics if the type is incomplete or
+// its name or URL scheme is already registered, so it is meant to be called
+// from an init function.
+func RegisterBackend(backendType BackendType) {
+	if backendType.Name == "" || backendType.Missing == nil || backendType.New == nil || backendType.Instance == nil {
+		panic("storage: RegisterBackend requires Name, Missing, New and Instance")
+	}
+	if (backendType.URLScheme == "") != (backendType.ParseURL == nil) {
+		panic("storage: RegisterBackend requires URLScheme and ParseURL together")
+	}
+
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	for _, existing := range backends {
+		if existing.Name == backendType.Name {
+			panic(fmt.Sprintf("storage: backend %q registered twice", backendType.Name))
+		}
+		if backendType.URLScheme != "" && existing.URLScheme == backendType.URLScheme {
+			panic(fmt.Sprintf("storage: URL scheme %q registered twice", backendType.URLScheme))
+		}
+	}
+	backends = append(backends, backendType)
+}
+
+// Backends returns the registered backend types in registration order, which
+// is also the order in which their instances are used.
+func Backends() []BackendType {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	return slices.Clone(backends)
+}
+
+// LookupBackend returns the registered backend type called name.
+func LookupBackend(name string) (BackendType, bool) {
+	for _, backendType := range Backends() {
+		if backendType.Name == name {
+			return backendType, true
+		}
+	}
+	return BackendType{}, false
+}
+
+// LookupBackendScheme returns the registered backend type whose destination
+// URLs use scheme.
+func LookupBackendScheme(scheme string) (BackendType, bool) {
+	for _, backendType := range Backends() {
+		if backendType.URLScheme != "" && strings.EqualFold(backendType.URLScheme, scheme) {
+			return backendType, true
+		}
+	}
+	return BackendType{}, false
+}
+
+// Enabled reports whether settings configure an instance of the type.
+func (t BackendType) Enabled(settings BackendSettings) bool {
+	return len(t.Missing(settings)) == 0
+}
+
+// Settings resolves every flag of the type from env alone.
+func (t BackendType) Settings(env flagdef.EnvReader) BackendSettings {
+	settings := BackendSettings{}
+	for _, def := range t.StringFlags {
+		settings[def.Name] = def.Value(env)
+	}
+	for _, def := range t.BoolFlags {
+		settings.SetBool(def.Name, def.Value(env))
+	}
+	return settings
+}
+
+// StorageLocation returns where settings keep the objects of an instance of
+// the type. It is meant for comparison rather than display, as it may hold
+// credentials.
+func (t BackendType) StorageLocation(settings BackendSettings) string {
+	if t.Location != nil {
+		return t.Location(settings)
+	}
+	names := make([]string, 0, len(t.StringFlags)+len(t.BoolFlags))
+	for _, def := range t.StringFlags {
+		names = append(names, def.Name)
+	}
+	for _, def := range t.BoolFlags {
+		names = append(names, def.Name)
+	}
+	return LocationSettings(names...)(settings)
+}
+
+// Get returns the value of the named flag.
+func (s BackendSettings) Get(name string) string {
+	return s[name]
+}
+
+// Bool returns the value of the named bool flag.
+func (s BackendSettings) Bool(name string) bool {
+	return strings.EqualFold(s[name], "true")
+}
+
+// SetBool stores the value of the named bool flag.
+func (s BackendSettings) SetBool(name string, value bool) {
+	s[name] = fmt.Sprint(value)
+}
+
+// Clone returns a copy of s that can be changed independently.
+func (s BackendSettings) Clone() BackendSettings {
+	clone := make(BackendSettings, len(s))
+	for name, value := range s {
+		clone[name] = value
+	}
+	return clone
+}
+
+// RequireSettings returns a Missing function for a backend that is enabled
+// once every named flag is set.
+func RequireSettings(names ...string) func(BackendSettings) []string {
+	return func(settings BackendSettings) []string {
+		missing := make([]string, 0)
+		for _, name := range names {
+			if settings.Get(name) == "" {
+				missing = append(missing, name)
+			}
+		}
+		return missing
+	}
+}
+
+// LocationSettings returns a Location function for a backend whose objects
+// are located by the named flags.
+func LocationSettings(names ...string) func(BackendSettings) string {
+	return func(settings BackendSettings) string {
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			values = append(values, name+"="+strings.TrimSpace(settings.Get(name)))
+		}
+		return strings.Join(values, "\n")
+	}
+}
+
+// CheckURLParameters rejects query parameters in a destination URL other than
+// allowed.
+func CheckURLParameters(location *url.URL, allowed ...string) error {
+	for key := range location.Query() {
+		if !slices.Contains(allowed, key) {
+			return fmt.Errorf("unknown parameter %q (expected one of %s)", key, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
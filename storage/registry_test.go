@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+type recordingStorage struct {
+	instanceName string
+	root         string
+}
+
+func (s *recordingStorage) Upload(context.Context, string, string) (string, error) { return "", nil }
+func (s *recordingStorage) Download(context.Context, string, string) error         { return nil }
+func (s *recordingStorage) GetTargetObjectName(context.Context, string) (string, error) {
+	return "", nil
+}
+func (s *recordingStorage) DeleteOldObjects(context.Context, string) error { return nil }
+func (s *recordingStorage) Close() error                                   { return nil }
+
+var recordingBackendType = BackendType{
+	Name:    "recording",
+	Label:   "Recording",
+	Missing: RequireSettings("recording-root"),
+	New: func(_ context.Context, config BackendConfig) (Storage, error) {
+		return &recordingStorage{instanceName: config.InstanceName, root: config.Settings.Get("recording-root")}, nil
+	},
+	Instance: func(s Storage) (string, bool) {
+		recording, ok := s.(*recordingStorage)
+		if !ok {
+			return "", false
+		}
+		return recording.instanceName, true
+	},
+	URLScheme: "rec",
+	ParseURL: func(location *url.URL, settings BackendSettings) (string, error) {
+		if err := CheckURLParameters(location); err != nil {
+			return "", err
+		}
+		settings["recording-root"] = location.Host
+		return "", nil
+	},
+}
+
+func registerTestBackend(t *testing.T, backendType BackendType) {
+	t.Helper()
+	registered := Backends()
+	t.Cleanup(func() {
+		backendsMu.Lock()
+		backends = registered
+		backendsMu.Unlock()
+	})
+	RegisterBackend(backendType)
+}
+
+func TestRegisterBackendAddsBackendType(t *testing.T) {
+	registerTestBackend(t, recordingBackendType)
+
+	backendType, ok := LookupBackend("recording")
+	if !ok || backendType.Label != "Recording" {
+		t.Fatalf("LookupBackend() = %+v, %v", backendType, ok)
+	}
+	if backendType, ok := LookupBackendScheme("REC"); !ok || backendType.Name != "recording" {
+		t.Fatalf("LookupBackendScheme() = %+v, %v", backendType, ok)
+	}
+
+	names := make([]string, 0)
+	for _, registered := range Backends() {
+		names = append(names, registered.Name)
+	}
+	if !slices.Equal(names, []string{BackendLocal, BackendAzure, BackendAWS, BackendGCP, "recording"}) {
+		t.Fatalf("Backends() = %v, want built-in types followed by recording", names)
+	}
+
+	storages := []Storage{&LocalStorage{}, &recordingStorage{instanceName: "scratch"}, &recordingStorage{}}
+	if name, err := BackendName(storages[1]); err != nil || name != "recording" {
+		t.Fatalf("BackendName() = %q, %v", name, err)
+	}
+	if name := StorageName(storages[2]); name != "recording" {
+		t.Fatalf("StorageName() = %q, want recording", name)
+	}
+
+	got, err := SelectRestoreStorage(storages, "scratch")
+	if err != nil {
+		t.Fatalf("SelectRestoreStorage() error = %v", err)
+	}
+	if got != storages[1] {
+		t.Fatalf("SelectRestoreStorage() = %s, want scratch", StorageName(got))
+	}
+}
+
+func TestRegisterBackendRejectsDuplicatesAndIncompleteTypes(t *testing.T) {
+	registerTestBackend(t, recordingBackendType)
+
+	renamed := recordingBackendType
+	renamed.Name = "other"
+	incomplete := recordingBackendType
+	incomplete.Name = "incomplete"
+	incomplete.New = nil
+	noParser := recordingBackendType
+	noParser.Name = "no-parser"
+	noParser.URLScheme = "np"
+	noParser.ParseURL = nil
+
+	for name, backendType := range map[string]BackendType{
+		"duplicate name":   recordingBackendType,
+		"duplicate scheme": renamed,
+		"missing New":      incomplete,
+		"scheme only":      noParser,
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("RegisterBackend() expected panic")
+				}
+			}()
+			RegisterBackend(backendType)
+		})
+	}
+}
+
+func TestBackendTypeSettingsReadsEveryFlag(t *testing.T) {
+	settings := awsBackendType.Settings(nil)
+	if settings.Get("aws-region") != "us-east-1" || settings.Bool("aws-s3-force-path-style") {
+		t.Fatalf("Settings(nil) = %v, want flag defaults", settings)
+	}
+	if awsBackendType.Enabled(settings) {
+		t.Fatal("Enabled() = true for an AWS type without credentials or bucket")
+	}
+
+	clone := settings.Clone()
+	clone["aws-region"] = "ca-central-1"
+	if settings.Get("aws-region") != "us-east-1" {
+		t.Fatal("Clone() shares storage with the original settings")
+	}
+}
+
+func TestBackendTypeStorageLocationIgnoresCredentials(t *testing.T) {
+	settings := BackendSettings{"aws-access-key-id": "first", "aws-secret-access-key": "secret", "aws-bucket": "backups"}
+	other := settings.Clone()
+	other["aws-access-key-id"] = "second"
+	if awsBackendType.StorageLocation(settings) != awsBackendType.StorageLocation(other) {
+		t.Fatal("StorageLocation() differs for the same bucket under other credentials")
+	}
+	other["aws-bucket"] = "archive"
+	if awsBackendType.StorageLocation(settings) == awsBackendType.StorageLocation(other) {
+		t.Fatal("StorageLocation() is equal for different buckets")
+	}
+	if localBackendType.StorageLocation(BackendSettings{"local-path": "/backups/"}) != localBackendType.StorageLocation(BackendSettings{"local-path": "/backups"}) {
+		t.Fatal("StorageLocation() differs for the same local directory")
+	}
+}
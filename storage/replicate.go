@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	mlog "github.com/mongodb/mongo-tools/common/log"
+)
+
+// BackupObject is a managed backup held by a backend.
+type BackupObject struct {
+	Name       string
+	Size       int64
+	ModifiedAt time.Time
+	// Prefix is the backup prefix Name was listed under.
+	Prefix string
+	// CreatedAt is the creation time recorded in the backup's name.
+	CreatedAt time.Time
+}
+
+// Filename returns the generated backup name relative to the prefix. It
+// identifies the same backup on every backend.
+func (o BackupObject) Filename() string {
+	return strings.TrimPrefix(o.Name, o.Prefix)
+}
+
+// BackupLister is implemented by backends that can enumerate their managed
+// backups, which copying backups between backends requires.
+type BackupLister interface {
+	// ManagedPrefix returns the normalized backup prefix.
+	ManagedPrefix() string
+	// ManagedNameTemplate returns the template backup names are generated
+	// with, or nil for the legacy naming.
+	ManagedNameTemplate() *NameTemplate
+	// ListBackups returns every eligible backup under the prefix, sorted by
+	// name.
+	ListBackups(ctx context.Context) ([]BackupObject, error)
+}
+
+// CopyOptions selects what CopyBackups copies.
+type CopyOptions struct {
+	// Objects limits the copy to these backups, given as filenames or full
+	// object names. Empty copies every backup the source holds.
+	Objects []string
+	// StagingDir holds each archive between its download and its uploads.
+	StagingDir string
+}
+
+// CopyResult records what CopyBackups did with one backup on one target.
+type CopyResult struct {
+	Target  string
+	Object  string
+	Bytes   int64
+	Skipped bool
+}
+
+// CopyBackups copies the source's backups that a target is missing, or holds
+// at a different size, to every target. Each archive is downloaded once into
+// StagingDir and uploaded from there, so uploads keep their multipart resume
+// and bandwidth limits. Copies keep their generated filename under the
+// target's prefix, which records when each backup was taken, and are uploaded
+// oldest first. Every target is listed again afterwards to verify the copies.
+// A target that fails is skipped for the rest of the run while the others
+// continue.
+func CopyBackups(ctx context.Context, source Storage, targets []Storage, options CopyOptions) ([]CopyResult, error) {
+	ctx = contextOrBackground(ctx)
+	sourceLister, ok := source.(BackupLister)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s cannot list its backups", StorageName(source))
+	}
+	for _, target := range targets {
+		if _, ok := target.(BackupLister); !ok {
+			return nil, fmt.Errorf("storage backend %s cannot list its backups", StorageName(target))
+		}
+	}
+
+	backups, err := sourceLister.ListBackups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups on %s: %w", StorageName(source), err)
+	}
+	backups, err = selectBackups(backups, options.Objects, StorageName(source))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(backups, func(i, j int) bool { return backupCreatedBefore(backups[i], backups[j]) })
+
+	existing := make([]map[string]int64, len(targets))
+	for i, target := range targets {
+		held, err := target.(BackupLister).ListBackups(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups on %s: %w", StorageName(target), err)
+		}
+		existing[i] = backupSizes(held)
+	}
+
+	results := make([]CopyResult, 0)
+	copied := make([][]CopyResult, len(targets))
+	failed := make([]error, len(targets))
+	for _, backup := range backups {
+		pending := make([]int, 0, len(targets))
+		for i, target := range targets {
+			if failed[i] != nil {
+				continue
+			}
+			if size, ok := existing[i][backup.Filename()]; ok && size == backup.Size {
+				results = append(results, CopyResult{Target: StorageName(target), Object: target.(BackupLister).ManagedPrefix() + backup.Filename(), Bytes: backup.Size, Skipped: true})
+				continue
+			}
+			pending = append(pending, i)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		stagedPath := filepath.Join(options.StagingDir, path.Base(backup.Filename()))
+		if err := stageBackup(ctx, source, backup, stagedPath); err != nil {
+			return results, err
+		}
+		for _, i := range pending {
+			objectName, err := copyStagedBackup(ctx, targets[i], backup, stagedPath)
+			if err != nil {
+				failed[i] = err
+				continue
+			}
+			result := CopyResult{Target: StorageName(targets[i]), Object: objectName, Bytes: backup.Size}
+			results = append(results, result)
+			copied[i] = append(copied[i], result)
+		}
+		if err := os.Remove(stagedPath); err != nil && !os.IsNotExist(err) {
+			return results, fmt.Errorf("failed to remove staged archive: %w", err)
+		}
+	}
+
+	for i, target := range targets {
+		if failed[i] == nil {
+			failed[i] = verifyCopies(ctx, target, copied[i])
+		}
+	}
+
+	return results, errors.Join(failed...)
+}
+
+func selectBackups(backups []BackupObject, objects []string, sourceName string) ([]BackupObject, error) {
+	if len(objects) == 0 {
+		return backups, nil
+	}
+
+	selected := make([]BackupObject, 0, len(objects))
+	seen := map[string]struct{}{}
+	for _, object := range objects {
+		object = strings.TrimSpace(object)
+		index := slices.IndexFunc(backups, func(backup BackupObject) bool { return namesBackup(object, backup) })
+		if index < 0 {
+			return nil, fmt.Errorf("backup %q not found on %s", object, sourceName)
+		}
+		backup := backups[index]
+		if _, ok := seen[backup.Filename()]; ok {
+			continue
+		}
+		seen[backup.Filename()] = struct{}{}
+		selected = append(selected, backup)
+	}
+	return selected, nil
+}
+
+// namesBackup reports whether object names backup: as its object name, as its
+// name relative to the prefix, or as an object name under another backend's
+// prefix.
+func namesBackup(object string, backup BackupObject) bool {
+	return object == backup.Name || object == backup.Filename() || strings.HasSuffix(object, "/"+backup.Filename())
+}
+
+// backupCreatedBefore orders backups by the creation time in their names,
+// oldest first. Legacy names sort newest first, which breaks ties.
+func backupCreatedBefore(a BackupObject, b BackupObject) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.Filename() > b.Filename()
+}
+
+func backupSizes(backups []BackupObject) map[string]int64 {
+	sizes := make(map[string]int64, len(backups))
+	for _, backup := range backups {
+		sizes[backup.Filename()] = backup.Size
+	}
+	return sizes
+}
+
+func listBackupSizes(ctx context.Context, target Storage) (map[string]int64, error) {
+	backups, err := target.(BackupLister).ListBackups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups on %s: %w", StorageName(target), err)
+	}
+	return backupSizes(backups), nil
+}
+
+func stageBackup(ctx context.Context, source Storage, backup BackupObject, stagedPath string) error {
+	if err := source.Download(ctx, backup.Name, stagedPath); err != nil {
+		return fmt.Errorf("failed to download %s from %s: %w", backup.Name, StorageName(source), err)
+	}
+
+	info, err := os.Stat(stagedPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify download of %s: %w", backup.Name, err)
+	}
+	if info.Size() != backup.Size {
+		return fmt.Errorf("failed to verify download of %s: got %d bytes, want %d", backup.Name, info.Size(), backup.Size)
+	}
+	return nil
+}
+
+func copyStagedBackup(ctx context.Context, target Storage, backup BackupObject, stagedPath string) (string, error) {
+	objectName, err := BuildBackupObjectName(target.(BackupLister).ManagedPrefix(), target.(BackupLister).ManagedNameTemplate(), backup.Filename())
+	if err != nil {
+		return "", err
+	}
+	if _, err := target.Upload(ctx, objectName, stagedPath); err != nil {
+		return "", fmt.Errorf("failed to copy %s to %s: %w", backup.Filename(), StorageName(target), err)
+	}
+	mlog.Logvf(mlog.Always, "Copied %s to %s (%d bytes)", backup.Filename(), StorageName(target), backup.Size)
+	return objectName, nil
+}
+
+func verifyCopies(ctx context.Context, target Storage, copied []CopyResult) error {
+	if len(copied) == 0 {
+		return nil
+	}
+	sizes, err := listBackupSizes(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	targetName := StorageName(target)
+	for _, result := range copied {
+		size, ok := sizes[strings.TrimPrefix(result.Object, target.(BackupLister).ManagedPrefix())]
+		if !ok {
+			return fmt.Errorf("failed to verify copy of %s on %s: object is missing", result.Object, targetName)
+		}
+		if size != result.Bytes {
+			return fmt.Errorf("failed to verify copy of %s on %s: got %d bytes, want %d", result.Object, targetName, size, result.Bytes)
+		}
+	}
+	return nil
+}
+
+// backupObjects keeps the eligible backups among candidates, sorted by name.
+func backupObjects(candidates []objectTimestamp, prefix string, template *NameTemplate) []BackupObject {
+	objects := make([]BackupObject, 0, len(candidates))
+	for _, candidate := range candidates {
+		objects = append(objects, BackupObject{Name: candidate.Name, Size: candidate.Size, ModifiedAt: candidate.ModifiedAt})
+	}
+	return ManagedBackups(objects, prefix, template)
+}
+
+// ManagedBackups keeps the eligible backups among objects, sorted by name, and
+// fills in their Prefix and CreatedAt.
+func ManagedBackups(objects []BackupObject, prefix string, template *NameTemplate) []BackupObject {
+	backups := make([]BackupObject, 0, len(objects))
+	for _, object := range objects {
+		if !strings.HasPrefix(object.Name, prefix) {
+			continue
+		}
+		parsed, ok := template.parse(strings.TrimPrefix(object.Name, prefix))
+		if !ok {
+			continue
+		}
+		object.Prefix = prefix
+		object.CreatedAt = parsed.createdAt
+		backups = append(backups, object)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name < backups[j].Name })
+	return backups
+}
@@ -0,0 +1,96 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+	"github.com/egose/database-tools/utils"
+)
+
+func backupFilename(t *testing.T, minutesAgo int) string {
+	t.Helper()
+	filename, _ := utils.GetFilenameAt(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Add(-time.Duration(minutesAgo) * time.Minute))
+	return filename
+}
+
+func uploadObject(t *testing.T, s storage.Storage, objectName string, content string) {
+	t.Helper()
+	sourcePath := filepath.Join(t.TempDir(), "upload.tar.gz")
+	if err := os.WriteFile(sourcePath, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := s.Upload(context.Background(), objectName, sourcePath); err != nil {
+		t.Fatalf("Upload(%q) error = %v", objectName, err)
+	}
+}
+
+func TestCopyBackupsCopiesMissingBackupsUnderTargetPrefix(t *testing.T) {
+	newest, middle, oldest := backupFilename(t, 0), backupFilename(t, 10), backupFilename(t, 20)
+	source := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "primary"})
+	for _, filename := range []string{newest, middle, oldest} {
+		uploadObject(t, source, "primary/"+filename, "archive "+filename)
+	}
+	uploadObject(t, source, "primary/notes.txt", "not a backup")
+
+	target := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "replica"})
+	uploadObject(t, target, "replica/"+middle, "archive "+middle)
+	stale := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "stale"})
+	uploadObject(t, stale, "stale/"+oldest, "truncated")
+
+	results, err := storage.CopyBackups(context.Background(), source, []storage.Storage{target, stale}, storage.CopyOptions{StagingDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("CopyBackups() error = %v", err)
+	}
+
+	if got, want := target.Objects(), []string{"replica/" + newest, "replica/" + middle, "replica/" + oldest}; !slices.Equal(got, want) {
+		t.Fatalf("target objects = %v, want %v", got, want)
+	}
+	if got, want := stale.Objects(), []string{"stale/" + newest, "stale/" + middle, "stale/" + oldest}; !slices.Equal(got, want) {
+		t.Fatalf("stale target objects = %v, want %v", got, want)
+	}
+	if latest, err := target.GetTargetObjectName(context.Background(), ""); err != nil || latest != "replica/"+newest {
+		t.Fatalf("GetTargetObjectName(\"\") = %q, %v, want the newest copied backup", latest, err)
+	}
+
+	copied, skipped := 0, 0
+	for _, result := range results {
+		if result.Skipped {
+			skipped++
+			if result.Object != "replica/"+middle {
+				t.Fatalf("skipped %q, want only the backup the target already held", result.Object)
+			}
+			continue
+		}
+		copied++
+	}
+	if copied != 5 || skipped != 1 {
+		t.Fatalf("CopyBackups() copied %d and skipped %d, want 5 and 1", copied, skipped)
+	}
+}
+
+func TestCopyBackupsCopiesSelectedBackups(t *testing.T) {
+	newest, oldest := backupFilename(t, 0), backupFilename(t, 10)
+	source := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "primary"})
+	uploadObject(t, source, "primary/"+newest, "newest")
+	uploadObject(t, source, "primary/"+oldest, "oldest")
+	target := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "replica"})
+
+	options := storage.CopyOptions{Objects: []string{"primary/" + oldest, oldest}, StagingDir: t.TempDir()}
+	if _, err := storage.CopyBackups(context.Background(), source, []storage.Storage{target}, options); err != nil {
+		t.Fatalf("CopyBackups() error = %v", err)
+	}
+	if got, want := target.Objects(), []string{"replica/" + oldest}; !slices.Equal(got, want) {
+		t.Fatalf("target objects = %v, want %v", got, want)
+	}
+
+	options.Objects = []string{backupFilename(t, 30)}
+	if _, err := storage.CopyBackups(context.Background(), source, []storage.Storage{target}, options); err == nil {
+		t.Fatal("CopyBackups() error = nil, want an error for a backup the source does not hold")
+	}
+}
@@ -0,0 +1,64 @@
+package storage_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+)
+
+func TestOrderRestoreStoragesPutsPriorityFirst(t *testing.T) {
+	storages := []storage.Storage{
+		&storage.LocalStorage{InstanceName: "primary"},
+		&storage.LocalStorage{InstanceName: "offsite"},
+		&storage.LocalStorage{InstanceName: "spare"},
+	}
+
+	ordered, err := storage.OrderRestoreStorages(storages, []string{"spare", "offsite", "spare"})
+	if err != nil {
+		t.Fatalf("OrderRestoreStorages() error = %v", err)
+	}
+	if want := []storage.Storage{storages[2], storages[1], storages[0]}; !slices.Equal(ordered, want) {
+		t.Fatalf("OrderRestoreStorages() = %v, want spare, offsite, primary", ordered)
+	}
+
+	if _, err := storage.OrderRestoreStorages(storages, []string{"missing"}); err == nil {
+		t.Fatal("OrderRestoreStorages() error = nil, want an unknown backend error")
+	}
+}
+
+func TestFindRestoreSourcesPicksNewestBackupOnAnyBackend(t *testing.T) {
+	newest, older := backupFilename(t, 0), backupFilename(t, 10)
+	later := func() time.Time { return time.Now().Add(time.Hour) }
+	stale := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "stale", Now: later})
+	current := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "current"})
+	empty := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "empty"})
+	// The stale backend's copy of the older backup was uploaded last, so it
+	// must be compared by filename rather than modification time.
+	uploadObject(t, stale, "stale/"+older, "older")
+	uploadObject(t, current, "current/"+older, "older")
+	uploadObject(t, current, "current/"+newest, "newest")
+
+	sources, err := storage.FindRestoreSources(context.Background(), []storage.Storage{empty, stale, current}, "")
+	if err != nil {
+		t.Fatalf("FindRestoreSources() error = %v", err)
+	}
+	if len(sources) != 1 || sources[0].Storage != current || sources[0].ObjectName != "current/"+newest {
+		t.Fatalf("FindRestoreSources() = %+v, want only current/%s", sources, newest)
+	}
+
+	sources, err = storage.FindRestoreSources(context.Background(), []storage.Storage{empty, stale, current}, older)
+	if err != nil {
+		t.Fatalf("FindRestoreSources(%q) error = %v", older, err)
+	}
+	if len(sources) != 2 || sources[0].ObjectName != "stale/"+older || sources[1].ObjectName != "current/"+older {
+		t.Fatalf("FindRestoreSources(%q) = %+v, want stale then current", older, sources)
+	}
+
+	if _, err := storage.FindRestoreSources(context.Background(), []storage.Storage{empty}, ""); err == nil {
+		t.Fatal("FindRestoreSources() error = nil, want no backups found")
+	}
+}
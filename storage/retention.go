@@ -1,11 +1,40 @@
 package storage
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
-func isExpired(modifiedAt time.Time, expiryDays int, now time.Time) bool {
+type retentionObserverKey struct{}
+
+// WithRetentionObserver returns a context under which DeleteOldObjects calls
+// observe with the name of each expired backup it deletes.
+func WithRetentionObserver(ctx context.Context, observe func(objectName string)) context.Context {
+	return context.WithValue(contextOrBackground(ctx), retentionObserverKey{}, observe)
+}
+
+func observeRetention(ctx context.Context, objectName string) {
+	if ctx == nil {
+		return
+	}
+	if observe, ok := ctx.Value(retentionObserverKey{}).(func(string)); ok {
+		observe(objectName)
+	}
+}
+
+func isExpired(createdAt time.Time, expiryDays int, now time.Time) bool {
 	if expiryDays <= 0 {
 		return false
 	}
 
-	return now.Sub(modifiedAt).Hours()/24 > float64(expiryDays)
+	return now.Sub(createdAt).Hours()/24 > float64(expiryDays)
+}
+
+// currentTime returns now(), or the wall clock when now is nil. Backends use it
+// for retention so tests can judge object age against a fixed clock.
+func currentTime(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now()
+	}
+	return now()
 }
@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/egose/database-tools/utils"
 )
 
 func TestIsExpired(t *testing.T) {
@@ -50,7 +53,7 @@ func TestNormalizeBackupPrefix(t *testing.T) {
 }
 
 func TestBuildBackupObjectName(t *testing.T) {
-	got, err := BuildBackupObjectName("custom", "9987654321000-2026-08-12T010203.456Z.tar.gz")
+	got, err := BuildBackupObjectName("custom", nil, "9987654321000-2026-08-12T010203.456Z.tar.gz")
 	if err != nil {
 		t.Fatalf("BuildBackupObjectName() error = %v", err)
 	}
@@ -58,19 +61,19 @@ func TestBuildBackupObjectName(t *testing.T) {
 		t.Fatalf("BuildBackupObjectName() = %q", got)
 	}
 
-	if _, err := BuildBackupObjectName("custom", "not-a-backup.tar.gz"); err == nil {
+	if _, err := BuildBackupObjectName("custom", nil, "not-a-backup.tar.gz"); err == nil {
 		t.Fatal("BuildBackupObjectName() expected contract error")
 	}
 }
 
 func TestLookupObjectCandidatesSupportsPrefixedAndLegacyLookups(t *testing.T) {
-	got := lookupObjectCandidates("custom", "9987654321000-2026-08-12T010203.456Z.tar.gz")
+	got := LookupObjectCandidates("custom", nil, "9987654321000-2026-08-12T010203.456Z.tar.gz")
 	want := []string{
 		"custom/9987654321000-2026-08-12T010203.456Z.tar.gz",
 		"9987654321000-2026-08-12T010203.456Z.tar.gz",
 	}
 	if !reflect.DeepEqual(got, want) {
-		t.Fatalf("lookupObjectCandidates() = %#v, want %#v", got, want)
+		t.Fatalf("LookupObjectCandidates() = %#v, want %#v", got, want)
 	}
 }
 
@@ -84,7 +87,7 @@ func TestDeleteExpiredObjectsOnlyDeletesEligibleScopedBackups(t *testing.T) {
 	}
 
 	deleted := make([]string, 0, 1)
-	err := deleteExpiredObjects(candidates, "custom", 1, now, "custom/9987654320999-2026-08-12T010203.456Z.tar.gz", func(name string) error {
+	err := deleteExpiredObjects(context.Background(), candidates, "custom", nil, 1, now, "custom/9987654320999-2026-08-12T010203.456Z.tar.gz", nil, func(name string) error {
 		deleted = append(deleted, name)
 		return nil
 	})
@@ -98,13 +101,62 @@ func TestDeleteExpiredObjectsOnlyDeletesEligibleScopedBackups(t *testing.T) {
 	}
 }
 
+func TestDeleteExpiredObjectsJudgesAgeByNameTime(t *testing.T) {
+	now := time.Date(2026, time.August, 12, 12, 0, 0, 0, time.UTC)
+	takenLongAgo, _ := utils.GetFilenameAt(now.Add(-72 * time.Hour))
+	takenRecently, _ := utils.GetFilenameAt(now.Add(-time.Hour))
+	candidates := []objectTimestamp{
+		// Rewritten an hour ago, by a copy say, but taken three days ago.
+		{Name: "custom/" + takenLongAgo, ModifiedAt: now.Add(-time.Hour)},
+		// Modified three days ago, but taken an hour ago.
+		{Name: "custom/" + takenRecently, ModifiedAt: now.Add(-72 * time.Hour)},
+	}
+
+	deleted := make([]string, 0, 1)
+	err := deleteExpiredObjects(context.Background(), candidates, "custom", nil, 1, now, "", nil, func(name string) error {
+		deleted = append(deleted, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("deleteExpiredObjects() error = %v", err)
+	}
+	if want := []string{candidates[0].Name}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleteExpiredObjects() deleted = %#v, want %#v", deleted, want)
+	}
+}
+
+func TestDeleteExpiredObjectsKeepsPinnedObjects(t *testing.T) {
+	now := time.Date(2026, time.August, 12, 12, 0, 0, 0, time.UTC)
+	candidates := []objectTimestamp{
+		{Name: "custom/9987654321000-2026-08-10T010203.456Z.tar.gz", ModifiedAt: now.Add(-72 * time.Hour)},
+		{Name: "custom/9987654321001-2026-08-10T010203.455Z.tar.gz", ModifiedAt: now.Add(-72 * time.Hour)},
+	}
+	pinReason := func(name string) (string, bool, error) {
+		return "before migration", name == candidates[0].Name, nil
+	}
+
+	deleted := make([]string, 0, 1)
+	var observed []string
+	ctx := WithRetentionObserver(context.Background(), func(name string) { observed = append(observed, name) })
+	err := deleteExpiredObjects(ctx, candidates, "custom", nil, 1, now, "", pinReason, func(name string) error {
+		deleted = append(deleted, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("deleteExpiredObjects() error = %v", err)
+	}
+	if want := []string{candidates[1].Name}; !reflect.DeepEqual(deleted, want) || !reflect.DeepEqual(observed, want) {
+		t.Fatalf("deleteExpiredObjects() deleted = %#v, observed = %#v, want %#v", deleted, observed, want)
+	}
+}
+
 func TestDeleteExpiredObjectsReturnsDeletionFailure(t *testing.T) {
 	now := time.Date(2026, time.August, 12, 12, 0, 0, 0, time.UTC)
 	deleteErr := errors.New("boom")
-	err := deleteExpiredObjects([]objectTimestamp{{
+	err := deleteExpiredObjects(context.Background(), []objectTimestamp{{
 		Name:       "custom/9987654321000-2026-08-10T010203.456Z.tar.gz",
 		ModifiedAt: now.Add(-72 * time.Hour),
-	}}, "custom", 1, now, "", func(string) error {
+	}}, "custom", nil, 1, now, "", nil, func(string) error {
 		return deleteErr
 	})
 	if !errors.Is(err, deleteErr) {
@@ -1,13 +1,17 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"path"
 	"sort"
 	"strings"
 	"time"
 
 	gcs "cloud.google.com/go/storage"
 	"github.com/aws/aws-sdk-go/service/s3"
+	mlog "github.com/mongodb/mongo-tools/common/log"
 )
 
 const (
@@ -20,14 +24,28 @@ const (
 type objectTimestamp struct {
 	Name       string
 	ModifiedAt time.Time
+	Size       int64
+	// CreatedAt is the creation time recorded in a managed backup's name. It
+	// orders and ages backups, since copies, repairs, migrations and tiering
+	// rewrite objects and so give them a fresh modification time.
+	CreatedAt time.Time
+}
+
+// backupTime returns the creation time recorded in the object's name, or its
+// modification time when the name records none.
+func (o objectTimestamp) backupTime() time.Time {
+	if !o.CreatedAt.IsZero() {
+		return o.CreatedAt
+	}
+	return o.ModifiedAt
 }
 
 func chooseLaterObject(current *objectTimestamp, candidate objectTimestamp) *objectTimestamp {
-	if candidate.Name == "" || candidate.ModifiedAt.IsZero() {
+	if candidate.Name == "" || candidate.backupTime().IsZero() {
 		return current
 	}
 
-	if current == nil || candidate.ModifiedAt.After(current.ModifiedAt) || (candidate.ModifiedAt.Equal(current.ModifiedAt) && candidate.Name < current.Name) {
+	if current == nil || createdLater(candidate, *current) {
 		candidateCopy := candidate
 		return &candidateCopy
 	}
@@ -35,6 +53,19 @@ func chooseLaterObject(current *objectTimestamp, candidate objectTimestamp) *obj
 	return current
 }
 
+// createdLater reports whether a was created after b. Objects created at the
+// same time are ordered by modification time, then by name. Legacy names sort
+// newest first.
+func createdLater(a objectTimestamp, b objectTimestamp) bool {
+	if !a.backupTime().Equal(b.backupTime()) {
+		return a.backupTime().After(b.backupTime())
+	}
+	if !a.ModifiedAt.Equal(b.ModifiedAt) {
+		return a.ModifiedAt.After(b.ModifiedAt)
+	}
+	return a.Name < b.Name
+}
+
 func latestObject(candidates []objectTimestamp) (objectTimestamp, bool) {
 	var latest *objectTimestamp
 	for _, candidate := range candidates {
@@ -80,8 +111,8 @@ func latestGCPObject(objects []*gcs.ObjectAttrs) (objectTimestamp, bool) {
 	return latestObject(candidates)
 }
 
-func resolveExplicitObjectName(prefix string, objectName string, exists func(string) (bool, error)) (string, bool, error) {
-	for _, candidate := range lookupObjectCandidates(prefix, objectName) {
+func resolveExplicitObjectName(prefix string, template *NameTemplate, objectName string, exists func(string) (bool, error)) (string, bool, error) {
+	for _, candidate := range LookupObjectCandidates(prefix, template, objectName) {
 		found, err := exists(candidate)
 		if err != nil {
 			return "", false, err
@@ -94,31 +125,42 @@ func resolveExplicitObjectName(prefix string, objectName string, exists func(str
 	return "", false, nil
 }
 
+// BackendName returns the name of the registered backend type that built
+// storageBackend.
 func BackendName(storageBackend Storage) (string, error) {
-	switch storageBackend.(type) {
-	case *AzBlob:
-		return BackendAzure, nil
-	case *AwsS3:
-		return BackendAWS, nil
-	case *GcpStorage:
-		return BackendGCP, nil
-	case *LocalStorage:
-		return BackendLocal, nil
-	default:
-		return "", fmt.Errorf("unsupported storage backend type %T", storageBackend)
+	for _, backendType := range Backends() {
+		if _, ok := backendType.Instance(storageBackend); ok {
+			return backendType.Name, nil
+		}
 	}
+	return "", fmt.Errorf("unsupported storage backend type %T", storageBackend)
 }
 
+// StorageName returns the instance name of storageBackend, falling back to
+// its backend type for unnamed instances and to its Go type for backends that
+// are not registered.
+func StorageName(storageBackend Storage) string {
+	for _, backendType := range Backends() {
+		if instanceName, ok := backendType.Instance(storageBackend); ok {
+			if instanceName != "" {
+				return instanceName
+			}
+			return backendType.Name
+		}
+	}
+	return fmt.Sprintf("%T", storageBackend)
+}
+
+// SelectRestoreStorage picks the backend to restore from. requestedBackend
+// names either a storage instance or, when only one instance of that type is
+// configured, a backend type.
 func SelectRestoreStorage(storages []Storage, requestedBackend string) (Storage, error) {
 	if len(storages) == 0 {
 		return nil, fmt.Errorf("no storage backends configured")
 	}
 
 	requestedBackend = normalizeBackendName(requestedBackend)
-	availableBackends, err := configuredBackendNames(storages)
-	if err != nil {
-		return nil, err
-	}
+	availableBackends := configuredStorageNames(storages)
 
 	if requestedBackend == "" {
 		if len(storages) == 1 {
@@ -127,27 +169,130 @@ func SelectRestoreStorage(storages []Storage, requestedBackend string) (Storage,
 		return nil, fmt.Errorf("multiple storage backends configured (%s); specify --storage-backend", strings.Join(availableBackends, ", "))
 	}
 
+	for _, storageBackend := range storages {
+		if normalizeBackendName(StorageName(storageBackend)) == requestedBackend {
+			return storageBackend, nil
+		}
+	}
+
+	matches := make([]Storage, 0, 1)
+	matchNames := make([]string, 0, 1)
 	for _, storageBackend := range storages {
 		backendName, err := BackendName(storageBackend)
+		if err == nil && backendName == requestedBackend {
+			matches = append(matches, storageBackend)
+			matchNames = append(matchNames, StorageName(storageBackend))
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("storage backend %q is not configured; available backends: %s", requestedBackend, strings.Join(availableBackends, ", "))
+	case 1:
+		return matches[0], nil
+	default:
+		sort.Strings(matchNames)
+		return nil, fmt.Errorf("storage backend %q matches multiple instances (%s); specify an instance name", requestedBackend, strings.Join(matchNames, ", "))
+	}
+}
+
+// OrderRestoreStorages returns storages in restore priority order: the
+// backends named in priority first, in that order, then the remaining ones in
+// configuration order. Each name is resolved like SelectRestoreStorage.
+func OrderRestoreStorages(storages []Storage, priority []string) ([]Storage, error) {
+	ordered := make([]Storage, 0, len(storages))
+	seen := make(map[Storage]struct{}, len(storages))
+	for _, name := range priority {
+		storageBackend, err := SelectRestoreStorage(storages, name)
 		if err != nil {
 			return nil, err
 		}
-		if backendName == requestedBackend {
-			return storageBackend, nil
+		if _, ok := seen[storageBackend]; ok {
+			continue
 		}
+		seen[storageBackend] = struct{}{}
+		ordered = append(ordered, storageBackend)
 	}
+	for _, storageBackend := range storages {
+		if _, ok := seen[storageBackend]; !ok {
+			ordered = append(ordered, storageBackend)
+		}
+	}
+	return ordered, nil
+}
 
-	return nil, fmt.Errorf("storage backend %q is not configured; available backends: %s", requestedBackend, strings.Join(availableBackends, ", "))
+// RestoreSource is a backend that holds the archive to restore.
+type RestoreSource struct {
+	Storage    Storage
+	ObjectName string
 }
 
-func configuredBackendNames(storages []Storage) ([]string, error) {
-	names := make([]string, 0, len(storages))
-	seen := make(map[string]struct{}, len(storages))
+// FindRestoreSources returns every backend that holds the archive to restore,
+// in the order of storages. An explicit objectName is looked up on each
+// backend. Without one, the newest backup on any backend is restored: each
+// backend's latest object is compared by its generated filename, which orders
+// backups by creation time even when a copy was uploaded later. Backends that
+// fail a lookup are logged and skipped.
+func FindRestoreSources(ctx context.Context, storages []Storage, objectName string) ([]RestoreSource, error) {
+	ctx = contextOrBackground(ctx)
+	if len(storages) == 0 {
+		return nil, fmt.Errorf("no storage backends configured")
+	}
+
+	var lookupErrors []error
+	if strings.TrimSpace(objectName) == "" {
+		var newest time.Time
+		for _, storageBackend := range storages {
+			latest, err := storageBackend.GetTargetObjectName(ctx, "")
+			if err != nil {
+				mlog.Logvf(mlog.Always, "Skipping %s: %v", StorageName(storageBackend), err)
+				lookupErrors = append(lookupErrors, fmt.Errorf("%s: %w", StorageName(storageBackend), err))
+				continue
+			}
+			filename, createdAt := managedBackupName(storageBackend, latest)
+			if objectName == "" || createdAt.After(newest) || (createdAt.Equal(newest) && filename < objectName) {
+				objectName, newest = filename, createdAt
+			}
+		}
+		if objectName == "" {
+			return nil, fmt.Errorf("no backups found on any storage backend: %w", errors.Join(lookupErrors...))
+		}
+		lookupErrors = nil
+	}
+
+	sources := make([]RestoreSource, 0, len(storages))
 	for _, storageBackend := range storages {
-		name, err := BackendName(storageBackend)
+		resolved, err := storageBackend.GetTargetObjectName(ctx, objectName)
 		if err != nil {
-			return nil, err
+			lookupErrors = append(lookupErrors, fmt.Errorf("%s: %w", StorageName(storageBackend), err))
+			continue
+		}
+		sources = append(sources, RestoreSource{Storage: storageBackend, ObjectName: resolved})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("object %q not found on any storage backend: %w", objectName, errors.Join(lookupErrors...))
+	}
+	return sources, nil
+}
+
+// managedBackupName returns the name of the managed backup objectName on s
+// relative to the backup prefix, and the creation time the name records. Names
+// s does not manage keep their last path segment and a zero time.
+func managedBackupName(s Storage, objectName string) (string, time.Time) {
+	if lister, ok := s.(BackupLister); ok {
+		if parsed, ok := parseManagedName(objectName, lister.ManagedPrefix(), lister.ManagedNameTemplate()); ok {
+			return strings.TrimPrefix(objectName, lister.ManagedPrefix()), parsed.createdAt
 		}
+	}
+	filename := path.Base(objectName)
+	parsed, _ := parseLegacyBackupName(filename)
+	return filename, parsed.createdAt
+}
+
+func configuredStorageNames(storages []Storage) []string {
+	names := make([]string, 0, len(storages))
+	seen := make(map[string]struct{}, len(storages))
+	for _, storageBackend := range storages {
+		name := StorageName(storageBackend)
 		if _, ok := seen[name]; ok {
 			continue
 		}
@@ -155,7 +300,7 @@ func configuredBackendNames(storages []Storage) ([]string, error) {
 		names = append(names, name)
 	}
 	sort.Strings(names)
-	return names, nil
+	return names
 }
 
 func normalizeBackendName(name string) string {
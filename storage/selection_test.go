@@ -9,6 +9,7 @@ import (
 	gcs "cloud.google.com/go/storage"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/egose/database-tools/utils"
 )
 
 func TestLatestObjectReturnsNewestCandidate(t *testing.T) {
@@ -73,7 +74,7 @@ func TestLatestEligibleObjectIgnoresMalformedAndOutOfScopeObjects(t *testing.T)
 		{Name: "mongo-archive/not-a-backup.tar.gz", ModifiedAt: now.Add(2 * time.Hour)},
 		{Name: "mongo-archive/9987654321000-2026-08-10T010203.456Z.tar.gz", ModifiedAt: now.Add(-time.Hour)},
 		{Name: "mongo-archive/9987654320999-2026-08-12T010203.456Z.tar.gz", ModifiedAt: now},
-	}, DefaultBackupPrefix)
+	}, DefaultBackupPrefix, nil)
 	if !ok {
 		t.Fatal("latestEligibleObject() ok = false, want true")
 	}
@@ -84,7 +85,7 @@ func TestLatestEligibleObjectIgnoresMalformedAndOutOfScopeObjects(t *testing.T)
 
 func TestResolveExplicitObjectNamePrefersManagedPrefixCandidate(t *testing.T) {
 	var tried []string
-	got, found, err := resolveExplicitObjectName(DefaultBackupPrefix, "9987654320999-2026-08-12T010203.456Z.tar.gz", func(candidate string) (bool, error) {
+	got, found, err := resolveExplicitObjectName(DefaultBackupPrefix, nil, "9987654320999-2026-08-12T010203.456Z.tar.gz", func(candidate string) (bool, error) {
 		tried = append(tried, candidate)
 		return candidate == "mongo-archive/9987654320999-2026-08-12T010203.456Z.tar.gz", nil
 	})
@@ -105,7 +106,7 @@ func TestResolveExplicitObjectNamePrefersManagedPrefixCandidate(t *testing.T) {
 
 func TestResolveExplicitObjectNameDoesNotFallBackToLatestSelection(t *testing.T) {
 	var tried []string
-	got, found, err := resolveExplicitObjectName(DefaultBackupPrefix, "missing.tar.gz", func(candidate string) (bool, error) {
+	got, found, err := resolveExplicitObjectName(DefaultBackupPrefix, nil, "missing.tar.gz", func(candidate string) (bool, error) {
 		tried = append(tried, candidate)
 		return false, nil
 	})
@@ -123,7 +124,7 @@ func TestResolveExplicitObjectNameDoesNotFallBackToLatestSelection(t *testing.T)
 
 func TestResolveExplicitObjectNamePropagatesLookupErrors(t *testing.T) {
 	lookupErr := errors.New("lookup failed")
-	_, _, err := resolveExplicitObjectName(DefaultBackupPrefix, "missing.tar.gz", func(string) (bool, error) {
+	_, _, err := resolveExplicitObjectName(DefaultBackupPrefix, nil, "missing.tar.gz", func(string) (bool, error) {
 		return false, lookupErr
 	})
 	if !errors.Is(err, lookupErr) {
@@ -162,3 +163,55 @@ func TestSelectRestoreStorageRejectsUnknownBackend(t *testing.T) {
 		t.Fatalf("SelectRestoreStorage() error = %q", err)
 	}
 }
+
+func TestSelectRestoreStoragePrefersInstanceNames(t *testing.T) {
+	storages := []Storage{
+		&AwsS3{InstanceName: "minio"},
+		&AwsS3{InstanceName: "aws-west"},
+		&LocalStorage{},
+	}
+
+	got, err := SelectRestoreStorage(storages, "AWS-West")
+	if err != nil {
+		t.Fatalf("SelectRestoreStorage() error = %v", err)
+	}
+	if got != storages[1] {
+		t.Fatalf("SelectRestoreStorage() = %s, want aws-west", StorageName(got))
+	}
+
+	got, err = SelectRestoreStorage(storages, "local")
+	if err != nil {
+		t.Fatalf("SelectRestoreStorage() error = %v", err)
+	}
+	if got != storages[2] {
+		t.Fatalf("SelectRestoreStorage() = %s, want local", StorageName(got))
+	}
+
+	_, err = SelectRestoreStorage(storages, "aws")
+	if err == nil {
+		t.Fatal("SelectRestoreStorage() expected error")
+	}
+	if err.Error() != "storage backend \"aws\" matches multiple instances (aws-west, minio); specify an instance name" {
+		t.Fatalf("SelectRestoreStorage() error = %q", err)
+	}
+
+	_, err = SelectRestoreStorage(storages, "")
+	if err == nil || err.Error() != "multiple storage backends configured (aws-west, local, minio); specify --storage-backend" {
+		t.Fatalf("SelectRestoreStorage() error = %v", err)
+	}
+}
+
+func TestLatestEligibleObjectOrdersByNameTime(t *testing.T) {
+	now := time.Date(2026, time.August, 12, 12, 0, 0, 0, time.UTC)
+	older, _ := utils.GetFilenameAt(now.Add(-48 * time.Hour))
+	newer, _ := utils.GetFilenameAt(now.Add(-time.Hour))
+	// The older backup was rewritten, by a copy say, after the newer one was
+	// uploaded.
+	got, ok := latestEligibleObject([]objectTimestamp{
+		{Name: "mongo-archive/" + older, ModifiedAt: now},
+		{Name: "mongo-archive/" + newer, ModifiedAt: now.Add(-time.Hour)},
+	}, DefaultBackupPrefix, nil)
+	if !ok || got.Name != "mongo-archive/"+newer {
+		t.Fatalf("latestEligibleObject() = %q, %v, want the backup taken last", got.Name, ok)
+	}
+}
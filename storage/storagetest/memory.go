@@ -0,0 +1,313 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+)
+
+// MemoryStorage is an in-memory storage.Storage. It is the reference
+// implementation of the backup object contract that Run checks, and it can
+// stand in for a real backend in tests. The zero value is not usable; create
+// one with NewMemoryStorage.
+type MemoryStorage struct {
+	BackupPrefix string
+	NameTemplate *storage.NameTemplate
+	ExpiryDays   int
+	Now          func() time.Time
+
+	mu         sync.Mutex
+	objects    map[string]memoryObject
+	generation int
+}
+
+type memoryObject struct {
+	data       []byte
+	modifiedAt time.Time
+	pinned     bool
+	pinReason  string
+	generation int
+}
+
+// NewMemoryStorage returns an empty MemoryStorage configured from config.
+func NewMemoryStorage(config Config) *MemoryStorage {
+	return &MemoryStorage{
+		BackupPrefix: storage.NormalizeBackupPrefix(config.BackupPrefix),
+		NameTemplate: config.NameTemplate,
+		ExpiryDays:   config.ExpiryDays,
+		Now:          config.Now,
+		objects:      map[string]memoryObject{},
+	}
+}
+
+// Objects returns the names of every stored object, sorted.
+func (this *MemoryStorage) Objects() []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	names := make([]string, 0, len(this.objects))
+	for name := range this.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (this *MemoryStorage) Upload(ctx context.Context, objectName string, filePath string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.objects[objectName] = memoryObject{data: data, modifiedAt: this.now()}
+	return objectName, nil
+}
+
+func (this *MemoryStorage) Download(ctx context.Context, objectName string, filePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	object, ok := this.objects[objectName]
+	this.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("failed to download object: object %q not found", objectName)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("failed to download object: %w", err)
+	}
+	if err := os.WriteFile(filePath, object.data, 0o600); err != nil {
+		return fmt.Errorf("failed to download object: %w", err)
+	}
+	return nil
+}
+
+func (this *MemoryStorage) GetTargetObjectName(ctx context.Context, objectName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if objectName != "" {
+		for _, candidate := range storage.LookupObjectCandidates(this.BackupPrefix, this.NameTemplate, objectName) {
+			if _, ok := this.objects[candidate]; ok {
+				return candidate, nil
+			}
+		}
+		return "", fmt.Errorf("object %q not found", objectName)
+	}
+
+	var latest *storage.BackupObject
+	for _, backup := range this.managedBackups() {
+		if latest == nil || backup.CreatedAt.After(latest.CreatedAt) || (backup.CreatedAt.Equal(latest.CreatedAt) && backup.ModifiedAt.After(latest.ModifiedAt)) {
+			latest = &backup
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no objects found under prefix %q", this.BackupPrefix)
+	}
+	return latest.Name, nil
+}
+
+func (this *MemoryStorage) DeleteOldObjects(ctx context.Context, currentObjectName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if this.ExpiryDays <= 0 {
+		return nil
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	cutoff := this.now().Add(-time.Duration(this.ExpiryDays) * 24 * time.Hour)
+	for _, backup := range this.managedBackups() {
+		if backup.Name == currentObjectName || this.objects[backup.Name].pinned {
+			continue
+		}
+		if backup.CreatedAt.Before(cutoff) {
+			delete(this.objects, backup.Name)
+		}
+	}
+	return nil
+}
+
+func (this *MemoryStorage) ManagedPrefix() string {
+	return this.BackupPrefix
+}
+
+func (this *MemoryStorage) ManagedNameTemplate() *storage.NameTemplate {
+	return this.NameTemplate
+}
+
+func (this *MemoryStorage) ListBackups(ctx context.Context) ([]storage.BackupObject, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.managedBackups(), nil
+}
+
+// managedBackups lists the eligible backups. The caller holds mu.
+func (this *MemoryStorage) managedBackups() []storage.BackupObject {
+	objects := make([]storage.BackupObject, 0, len(this.objects))
+	for name, object := range this.objects {
+		objects = append(objects, storage.BackupObject{Name: name, Size: int64(len(object.data)), ModifiedAt: object.modifiedAt})
+	}
+	return storage.ManagedBackups(objects, this.BackupPrefix, this.NameTemplate)
+}
+
+func (this *MemoryStorage) ListObjects(ctx context.Context, prefix string) ([]storage.BackupObject, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	objects := make([]storage.BackupObject, 0)
+	for name, object := range this.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, storage.BackupObject{Name: name, Size: int64(len(object.data)), ModifiedAt: object.modifiedAt})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (this *MemoryStorage) DeleteObject(ctx context.Context, objectName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, ok := this.objects[objectName]; !ok {
+		return fmt.Errorf("failed to delete object: object %q not found", objectName)
+	}
+	delete(this.objects, objectName)
+	return nil
+}
+
+func (this *MemoryStorage) PinObject(ctx context.Context, objectName string, reason string) error {
+	return this.setPin(ctx, objectName, true, reason)
+}
+
+func (this *MemoryStorage) UnpinObject(ctx context.Context, objectName string) error {
+	return this.setPin(ctx, objectName, false, "")
+}
+
+func (this *MemoryStorage) ObjectPin(ctx context.Context, objectName string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	object, ok := this.objects[objectName]
+	if !ok {
+		return "", false, fmt.Errorf("object %q not found", objectName)
+	}
+	return object.pinReason, object.pinned, nil
+}
+
+func (this *MemoryStorage) setPin(ctx context.Context, objectName string, pinned bool, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	object, ok := this.objects[objectName]
+	if !ok {
+		return fmt.Errorf("object %q not found", objectName)
+	}
+	object.pinned, object.pinReason = pinned, reason
+	this.objects[objectName] = object
+	return nil
+}
+
+func (this *MemoryStorage) ReadLease(ctx context.Context, name string) ([]byte, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	object, ok := this.objects[name]
+	if !ok {
+		return nil, "", storage.ErrLeaseNotFound
+	}
+	return object.data, strconv.Itoa(object.generation), nil
+}
+
+func (this *MemoryStorage) WriteLease(ctx context.Context, name string, data []byte, version string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if !this.leaseHasVersion(name, version) {
+		return "", storage.ErrLeaseConflict
+	}
+	this.generation++
+	this.objects[name] = memoryObject{data: data, modifiedAt: this.now(), generation: this.generation}
+	return strconv.Itoa(this.generation), nil
+}
+
+func (this *MemoryStorage) DeleteLease(ctx context.Context, name string, version string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if version == "" || !this.leaseHasVersion(name, version) {
+		return storage.ErrLeaseConflict
+	}
+	delete(this.objects, name)
+	return nil
+}
+
+// leaseHasVersion reports whether the lease name has version, where the empty
+// version stands for a lease that does not exist.
+func (this *MemoryStorage) leaseHasVersion(name string, version string) bool {
+	object, ok := this.objects[name]
+	if version == "" {
+		return !ok
+	}
+	return ok && strconv.Itoa(object.generation) == version
+}
+
+func (this *MemoryStorage) Close() error {
+	return nil
+}
+
+func (this *MemoryStorage) now() time.Time {
+	if this.Now == nil {
+		return time.Now()
+	}
+	return this.Now()
+}
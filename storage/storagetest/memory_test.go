@@ -0,0 +1,13 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/egose/database-tools/storage"
+)
+
+func TestMemoryStorageConformance(t *testing.T) {
+	Run(t, func(t *testing.T, config Config) storage.Storage {
+		return NewMemoryStorage(config)
+	})
+}
@@ -0,0 +1,579 @@
+// Package storagetest checks storage.Storage implementations against the
+// managed backup object contract: uploads round-trip, latest-object selection
+// and retention only consider generated backup filenames directly under the
+// backup prefix, explicit object names resolve to their candidates in order,
+// and retention never deletes the object it was told to preserve.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/utils"
+)
+
+// Config is how the suite asks for a storage under test.
+type Config struct {
+	BackupPrefix string
+	ExpiryDays   int
+	// NameTemplate is the template the storage must recognize backup names
+	// by; nil keeps the legacy naming.
+	NameTemplate *storage.NameTemplate
+	// Now is the clock the storage must judge object age by during
+	// retention. The suite advances it to age objects without waiting.
+	Now func() time.Time
+}
+
+// NewFunc returns the storage under test, configured from config. Objects
+// written through earlier calls may still be present: every check works under
+// a prefix of its own.
+type NewFunc func(t *testing.T, config Config) storage.Storage
+
+const expiryDays = 7
+
+// Run checks the storage returned by newStorage against the backup object
+// contract, one subtest per behavior.
+func Run(t *testing.T, newStorage NewFunc) {
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, newStorage) })
+	t.Run("LatestObjectIsScopedToPrefix", func(t *testing.T) { testLatestObject(t, newStorage) })
+	t.Run("EmptyPrefixHasNoLatestObject", func(t *testing.T) { testEmptyPrefix(t, newStorage) })
+	t.Run("ExplicitNameCandidates", func(t *testing.T) { testExplicitName(t, newStorage) })
+	t.Run("RetentionPreservesCurrentObject", func(t *testing.T) { testRetention(t, newStorage) })
+	t.Run("RetentionDisabled", func(t *testing.T) { testRetentionDisabled(t, newStorage) })
+	t.Run("ListBackups", func(t *testing.T) { testListBackups(t, newStorage) })
+	t.Run("ObjectStore", func(t *testing.T) { testObjectStore(t, newStorage) })
+	t.Run("Pinner", func(t *testing.T) { testPinner(t, newStorage) })
+	t.Run("NameTemplate", func(t *testing.T) { testNameTemplate(t, newStorage) })
+	t.Run("Leaser", func(t *testing.T) { testLeaser(t, newStorage) })
+}
+
+type fixture struct {
+	t       *testing.T
+	storage storage.Storage
+	clock   *clock
+	root    string
+	prefix  string
+	base    time.Time
+}
+
+func newFixture(t *testing.T, newStorage NewFunc, config Config) *fixture {
+	t.Helper()
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+
+	f := &fixture{t: t, clock: &clock{now: time.Now()}, base: time.Now().UTC()}
+	f.root = "storagetest-" + hex.EncodeToString(suffix) + "/"
+	f.prefix = f.root + "managed/"
+	config.BackupPrefix, config.Now = f.prefix, f.clock.Now
+	f.storage = newStorage(t, config)
+	t.Cleanup(func() {
+		if err := f.storage.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	})
+	return f
+}
+
+// backupName returns the generated backup filename of a run minutesAgo
+// minutes before the fixture was created.
+func (f *fixture) backupName(minutesAgo int) string {
+	filename, _ := utils.GetFilenameAt(f.base.Add(-time.Duration(minutesAgo) * time.Minute))
+	return filename
+}
+
+func (f *fixture) upload(objectName string, content string) {
+	f.t.Helper()
+	sourcePath := filepath.Join(f.t.TempDir(), "upload.tar.gz")
+	if err := os.WriteFile(sourcePath, []byte(content), 0o600); err != nil {
+		f.t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := f.storage.Upload(context.Background(), objectName, sourcePath); err != nil {
+		f.t.Fatalf("Upload(%q) error = %v", objectName, err)
+	}
+}
+
+func (f *fixture) download(objectName string) string {
+	f.t.Helper()
+	destPath := filepath.Join(f.t.TempDir(), "restore", "download.tar.gz")
+	if err := f.storage.Download(context.Background(), objectName, destPath); err != nil {
+		f.t.Fatalf("Download(%q) error = %v", objectName, err)
+	}
+	data, err := os.ReadFile(destPath)
+	if err != nil {
+		f.t.Fatalf("ReadFile() error = %v", err)
+	}
+	return string(data)
+}
+
+func (f *fixture) targetObjectName(objectName string) string {
+	f.t.Helper()
+	got, err := f.storage.GetTargetObjectName(context.Background(), objectName)
+	if err != nil {
+		f.t.Fatalf("GetTargetObjectName(%q) error = %v", objectName, err)
+	}
+	return got
+}
+
+func (f *fixture) exists(objectName string) bool {
+	_, err := f.storage.GetTargetObjectName(context.Background(), objectName)
+	return err == nil
+}
+
+// uploadDistractors writes objects that look like backups but sit outside the
+// managed contract: under another prefix, under a sibling prefix that shares
+// the managed prefix as a string prefix, nested below the managed prefix, and
+// malformed names inside it. It returns their names.
+func (f *fixture) uploadDistractors(filename string) []string {
+	f.t.Helper()
+	names := []string{
+		f.root + "legacy/" + filename,
+		f.root + "managed-other/" + filename,
+		f.prefix + "nested/" + filename,
+		f.prefix + "not-a-backup.tar.gz",
+		f.prefix + filename + ".partial",
+	}
+	for _, name := range names {
+		f.upload(name, "distractor")
+	}
+	return names
+}
+
+func testRoundTrip(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+
+	managed := f.prefix + f.backupName(0)
+	content := string(bytes.Repeat([]byte("archive"), 1024))
+	f.upload(managed, content)
+	if got := f.download(managed); got != content {
+		t.Fatalf("Download(%q) content length = %d, want %d", managed, len(got), len(content))
+	}
+
+	nested := f.root + "nested/deep/archive.tar.gz"
+	f.upload(nested, "nested")
+	if got := f.download(nested); got != "nested" {
+		t.Fatalf("Download(%q) = %q, want %q", nested, got, "nested")
+	}
+
+	f.upload(managed, "replaced")
+	if got := f.download(managed); got != "replaced" {
+		t.Fatalf("Download(%q) after overwrite = %q, want %q", managed, got, "replaced")
+	}
+}
+
+func testLatestObject(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+
+	// The older backup is uploaded last, as a copy may be; the time in the
+	// names decides which is the latest.
+	f.upload(f.prefix+f.backupName(10), "newer")
+	f.upload(f.prefix+f.backupName(20), "older")
+	f.uploadDistractors(f.backupName(0))
+
+	if got, want := f.targetObjectName(""), f.prefix+f.backupName(10); got != want {
+		t.Fatalf("GetTargetObjectName(\"\") = %q, want %q", got, want)
+	}
+}
+
+func testEmptyPrefix(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+	f.uploadDistractors(f.backupName(0))
+
+	if got, err := f.storage.GetTargetObjectName(context.Background(), ""); err == nil {
+		t.Fatalf("GetTargetObjectName(\"\") = %q, want an error when the prefix holds no backups", got)
+	}
+}
+
+func testExplicitName(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+
+	managed := f.backupName(10)
+	legacyOnly := f.backupName(20)
+	f.upload(f.prefix+managed, "managed")
+	f.upload(f.root+"legacy/"+managed, "legacy")
+	f.upload(f.root+"legacy/"+legacyOnly, "legacy")
+
+	tests := []struct {
+		objectName string
+		want       string
+	}{
+		{objectName: managed, want: f.prefix + managed},
+		{objectName: f.prefix + managed, want: f.prefix + managed},
+		{objectName: f.root + "legacy/" + managed, want: f.root + "legacy/" + managed},
+		{objectName: f.root + "legacy/" + legacyOnly, want: f.root + "legacy/" + legacyOnly},
+	}
+	for _, tt := range tests {
+		if got := f.targetObjectName(tt.objectName); got != tt.want {
+			t.Fatalf("GetTargetObjectName(%q) = %q, want %q", tt.objectName, got, tt.want)
+		}
+	}
+
+	for _, objectName := range []string{legacyOnly, f.prefix + f.backupName(30), f.root + "missing.tar.gz"} {
+		if got, err := f.storage.GetTargetObjectName(context.Background(), objectName); err == nil {
+			t.Fatalf("GetTargetObjectName(%q) = %q, want a not-found error", objectName, got)
+		}
+	}
+}
+
+func testRetention(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{ExpiryDays: expiryDays})
+
+	expired := []string{f.prefix + f.backupName(30), f.prefix + f.backupName(20)}
+	current := f.prefix + f.backupName(10)
+	for _, name := range append(expired, current) {
+		f.upload(name, "backup")
+	}
+	distractors := f.uploadDistractors(f.backupName(40))
+
+	if err := f.storage.DeleteOldObjects(context.Background(), current); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	for _, name := range append(append(expired, current), distractors...) {
+		if !f.exists(name) {
+			t.Fatalf("DeleteOldObjects() deleted %q before it expired", name)
+		}
+	}
+
+	f.clock.Advance((expiryDays + 1) * 24 * time.Hour)
+	if err := f.storage.DeleteOldObjects(context.Background(), current); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	for _, name := range expired {
+		if f.exists(name) {
+			t.Fatalf("DeleteOldObjects() kept expired backup %q", name)
+		}
+	}
+	for _, name := range append([]string{current}, distractors...) {
+		if !f.exists(name) {
+			t.Fatalf("DeleteOldObjects() deleted %q, which retention must not touch", name)
+		}
+	}
+}
+
+func testRetentionDisabled(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+
+	names := []string{f.prefix + f.backupName(20), f.prefix + f.backupName(10)}
+	for _, name := range names {
+		f.upload(name, "backup")
+	}
+
+	f.clock.Advance(365 * 24 * time.Hour)
+	if err := f.storage.DeleteOldObjects(context.Background(), ""); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	for _, name := range names {
+		if !f.exists(name) {
+			t.Fatalf("DeleteOldObjects() deleted %q with retention disabled", name)
+		}
+	}
+}
+
+func testListBackups(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+	lister, ok := f.storage.(storage.BackupLister)
+	if !ok {
+		t.Skipf("%T does not implement storage.BackupLister", f.storage)
+	}
+
+	if got := lister.ManagedPrefix(); got != f.prefix {
+		t.Fatalf("ManagedPrefix() = %q, want %q", got, f.prefix)
+	}
+
+	want := []string{f.prefix + f.backupName(10), f.prefix + f.backupName(20)}
+	f.upload(want[1], "older")
+	f.upload(want[0], "newer backup")
+	f.uploadDistractors(f.backupName(0))
+
+	backups, err := lister.ListBackups(context.Background())
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != len(want) {
+		t.Fatalf("ListBackups() = %+v, want %v", backups, want)
+	}
+	for i, backup := range backups {
+		if backup.Name != want[i] {
+			t.Fatalf("ListBackups()[%d].Name = %q, want %q", i, backup.Name, want[i])
+		}
+		if wantSize := int64(len(f.download(backup.Name))); backup.Size != wantSize {
+			t.Fatalf("ListBackups()[%d].Size = %d, want %d", i, backup.Size, wantSize)
+		}
+		if backup.ModifiedAt.IsZero() {
+			t.Fatalf("ListBackups()[%d].ModifiedAt is zero", i)
+		}
+	}
+}
+
+func testObjectStore(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+	store, ok := f.storage.(storage.ObjectStore)
+	if !ok {
+		t.Skipf("%T does not implement storage.ObjectStore", f.storage)
+	}
+
+	managed := f.prefix + f.backupName(10)
+	f.upload(managed, "managed")
+	distractors := f.uploadDistractors(f.backupName(0))
+
+	objects, err := store.ListObjects(context.Background(), f.root)
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	listed := map[string]int64{}
+	for _, object := range objects {
+		listed[object.Name] = object.Size
+	}
+	for _, name := range append([]string{managed}, distractors...) {
+		if _, ok := listed[name]; !ok {
+			t.Fatalf("ListObjects(%q) = %v, missing %q", f.root, objects, name)
+		}
+	}
+	if len(listed) != len(distractors)+1 {
+		t.Fatalf("ListObjects(%q) = %v, want only objects under the prefix", f.root, objects)
+	}
+	if listed[managed] != int64(len("managed")) {
+		t.Fatalf("ListObjects() size of %q = %d, want %d", managed, listed[managed], len("managed"))
+	}
+
+	legacy := distractors[0]
+	if err := store.DeleteObject(context.Background(), legacy); err != nil {
+		t.Fatalf("DeleteObject(%q) error = %v", legacy, err)
+	}
+	if f.exists(legacy) {
+		t.Fatalf("DeleteObject(%q) left the object in place", legacy)
+	}
+	if !f.exists(managed) {
+		t.Fatalf("DeleteObject(%q) deleted %q", legacy, managed)
+	}
+}
+
+func testPinner(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{ExpiryDays: expiryDays})
+	pinner, ok := f.storage.(storage.Pinner)
+	if !ok {
+		t.Skipf("%T does not implement storage.Pinner", f.storage)
+	}
+
+	pinned, expired, current := f.prefix+f.backupName(30), f.prefix+f.backupName(20), f.prefix+f.backupName(10)
+	for _, name := range []string{pinned, expired, current} {
+		f.upload(name, "backup")
+	}
+
+	const reason = "before schema migration"
+	if err := pinner.PinObject(context.Background(), pinned, reason); err != nil {
+		t.Fatalf("PinObject(%q) error = %v", pinned, err)
+	}
+	if got, ok, err := pinner.ObjectPin(context.Background(), pinned); err != nil || !ok || got != reason {
+		t.Fatalf("ObjectPin(%q) = %q, %v, %v, want %q, true, nil", pinned, got, ok, err, reason)
+	}
+	if _, ok, err := pinner.ObjectPin(context.Background(), expired); err != nil || ok {
+		t.Fatalf("ObjectPin(%q) = %v, %v, want false, nil", expired, ok, err)
+	}
+	if got := f.targetObjectName(""); got != current {
+		t.Fatalf("GetTargetObjectName(\"\") after pinning = %q, want %q", got, current)
+	}
+	if store, ok := f.storage.(storage.ObjectStore); ok {
+		objects, err := store.ListObjects(context.Background(), f.prefix)
+		if err != nil {
+			t.Fatalf("ListObjects() error = %v", err)
+		}
+		if len(objects) != 3 {
+			t.Fatalf("ListObjects(%q) = %v, want only the three backups", f.prefix, objects)
+		}
+	}
+
+	f.clock.Advance((expiryDays + 1) * 24 * time.Hour)
+	if err := f.storage.DeleteOldObjects(context.Background(), current); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	if !f.exists(pinned) {
+		t.Fatalf("DeleteOldObjects() deleted pinned backup %q", pinned)
+	}
+	if f.exists(expired) {
+		t.Fatalf("DeleteOldObjects() kept expired backup %q", expired)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := pinner.UnpinObject(context.Background(), pinned); err != nil {
+			t.Fatalf("UnpinObject(%q) error = %v", pinned, err)
+		}
+	}
+	if _, ok, err := pinner.ObjectPin(context.Background(), pinned); err != nil || ok {
+		t.Fatalf("ObjectPin(%q) after unpinning = %v, %v, want false, nil", pinned, ok, err)
+	}
+	if err := f.storage.DeleteOldObjects(context.Background(), current); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	if f.exists(pinned) {
+		t.Fatalf("DeleteOldObjects() kept unpinned backup %q", pinned)
+	}
+}
+
+func testNameTemplate(t *testing.T, newStorage NewFunc) {
+	template, err := storage.ParseNameTemplate("{cluster}/{db}/{utc}-{seq}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate() error = %v", err)
+	}
+	f := newFixture(t, newStorage, Config{ExpiryDays: expiryDays, NameTemplate: template})
+	name := func(minutesAgo int, seq int) string {
+		t.Helper()
+		name, err := template.Name(storage.NameValues{DB: "app", Cluster: "rs0", Time: f.base.Add(-time.Duration(minutesAgo) * time.Minute), Seq: seq})
+		if err != nil {
+			t.Fatalf("Name() error = %v", err)
+		}
+		return name
+	}
+
+	legacy, older, current := f.prefix+f.backupName(30), f.prefix+name(20, 1), name(10, 2)
+	for _, objectName := range []string{legacy, older, f.prefix + current} {
+		f.upload(objectName, "backup")
+	}
+	distractors := []string{f.prefix + "rs0/app/not-a-backup.tar.gz", f.prefix + "rs0/" + name(0, 3)}
+	for _, objectName := range distractors {
+		f.upload(objectName, "distractor")
+	}
+
+	if got := f.targetObjectName(""); got != f.prefix+current {
+		t.Fatalf("GetTargetObjectName(\"\") = %q, want %q", got, f.prefix+current)
+	}
+	if got := f.targetObjectName(current); got != f.prefix+current {
+		t.Fatalf("GetTargetObjectName(%q) = %q, want %q", current, got, f.prefix+current)
+	}
+	if lister, ok := f.storage.(storage.BackupLister); ok {
+		backups, err := lister.ListBackups(context.Background())
+		if err != nil {
+			t.Fatalf("ListBackups() error = %v", err)
+		}
+		if len(backups) != 3 || backups[0].Name != legacy || backups[2].Filename() != current {
+			t.Fatalf("ListBackups() = %+v, want %q, %q and %q", backups, legacy, older, f.prefix+current)
+		}
+		if !backups[0].CreatedAt.Before(backups[1].CreatedAt) || !backups[1].CreatedAt.Before(backups[2].CreatedAt) {
+			t.Fatalf("ListBackups() creation times = %v, %v, %v, want them in upload order", backups[0].CreatedAt, backups[1].CreatedAt, backups[2].CreatedAt)
+		}
+	}
+
+	f.clock.Advance((expiryDays + 1) * 24 * time.Hour)
+	if err := f.storage.DeleteOldObjects(context.Background(), f.prefix+current); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	for _, objectName := range []string{legacy, older} {
+		if f.exists(objectName) {
+			t.Fatalf("DeleteOldObjects() kept expired backup %q", objectName)
+		}
+	}
+	for _, objectName := range append([]string{f.prefix + current}, distractors...) {
+		if !f.exists(objectName) {
+			t.Fatalf("DeleteOldObjects() deleted %q, which retention must not touch", objectName)
+		}
+	}
+}
+
+func testLeaser(t *testing.T, newStorage NewFunc) {
+	f := newFixture(t, newStorage, Config{})
+	leaser, ok := f.storage.(storage.Leaser)
+	if !ok {
+		t.Skipf("%T does not implement storage.Leaser", f.storage)
+	}
+	ctx := context.Background()
+
+	name := f.prefix + "leases/primitive.json"
+	if _, _, err := leaser.ReadLease(ctx, name); !errors.Is(err, storage.ErrLeaseNotFound) {
+		t.Fatalf("ReadLease() of a missing lease error = %v, want ErrLeaseNotFound", err)
+	}
+	first, err := leaser.WriteLease(ctx, name, []byte("first"), "")
+	if err != nil {
+		t.Fatalf("WriteLease() creating the lease error = %v", err)
+	}
+	if _, err := leaser.WriteLease(ctx, name, []byte("again"), ""); !errors.Is(err, storage.ErrLeaseConflict) {
+		t.Fatalf("WriteLease() creating an existing lease error = %v, want ErrLeaseConflict", err)
+	}
+	second, err := leaser.WriteLease(ctx, name, []byte("second"), first)
+	if err != nil {
+		t.Fatalf("WriteLease() replacing the lease error = %v", err)
+	}
+	if _, err := leaser.WriteLease(ctx, name, []byte("stale"), first); !errors.Is(err, storage.ErrLeaseConflict) {
+		t.Fatalf("WriteLease() with a stale version error = %v, want ErrLeaseConflict", err)
+	}
+	if data, version, err := leaser.ReadLease(ctx, name); err != nil || string(data) != "second" || version != second {
+		t.Fatalf("ReadLease() = %q, %q, %v, want %q, %q, nil", data, version, err, "second", second)
+	}
+	if err := leaser.DeleteLease(ctx, name, first); !errors.Is(err, storage.ErrLeaseConflict) {
+		t.Fatalf("DeleteLease() with a stale version error = %v, want ErrLeaseConflict", err)
+	}
+	if err := leaser.DeleteLease(ctx, name, second); err != nil {
+		t.Fatalf("DeleteLease() error = %v", err)
+	}
+	if _, _, err := leaser.ReadLease(ctx, name); !errors.Is(err, storage.ErrLeaseNotFound) {
+		t.Fatalf("ReadLease() of a deleted lease error = %v, want ErrLeaseNotFound", err)
+	}
+
+	f.upload(f.prefix+f.backupName(10), "backup")
+	lockClock := &clock{now: time.Now()}
+	lock, err := storage.AcquireLock(ctx, f.storage, "nightly", storage.LockOptions{Holder: "replica-a", TTL: time.Minute, Now: lockClock.Now})
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	var held *storage.LockHeldError
+	if _, err := storage.AcquireLock(ctx, f.storage, "nightly", storage.LockOptions{Holder: "replica-b", TTL: time.Minute, Now: lockClock.Now}); !errors.As(err, &held) || held.Lease.Holder != "replica-a" {
+		t.Fatalf("AcquireLock() of a held lock error = %v, want a LockHeldError naming replica-a", err)
+	}
+	if got := f.targetObjectName(""); got != f.prefix+f.backupName(10) {
+		t.Fatalf("GetTargetObjectName(\"\") with a lease = %q, want the backup", got)
+	}
+	if err := lock.Renew(ctx); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+
+	lockClock.Advance(2 * time.Minute)
+	takeover, err := storage.AcquireLock(ctx, f.storage, "nightly", storage.LockOptions{Holder: "replica-b", TTL: time.Minute, Now: lockClock.Now})
+	if err != nil {
+		t.Fatalf("AcquireLock() of an expired lock error = %v", err)
+	}
+	if err := lock.Renew(ctx); err == nil {
+		t.Fatal("Renew() of a lock taken over error = nil, want an error")
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release() of a lock taken over error = %v", err)
+	}
+	if _, err := storage.AcquireLock(ctx, f.storage, "nightly", storage.LockOptions{Holder: "replica-a", TTL: time.Minute, Now: lockClock.Now}); !errors.As(err, &held) {
+		t.Fatalf("AcquireLock() after a stale release error = %v, want a LockHeldError", err)
+	}
+	if err := takeover.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	released, err := storage.AcquireLock(ctx, f.storage, "nightly", storage.LockOptions{Holder: "replica-a", TTL: time.Minute, Now: lockClock.Now})
+	if err != nil {
+		t.Fatalf("AcquireLock() of a released lock error = %v", err)
+	}
+	if err := released.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TierOptions configures TierBackups.
+type TierOptions struct {
+	// AfterDays is the age, in days, at which a backup leaves the hot tier.
+	AfterDays int
+	// Preserve names a backup that stays on the hot tier whatever its age,
+	// normally the one just uploaded.
+	Preserve string
+	// StagingDir holds each archive between its download and its upload.
+	StagingDir string
+	// Now returns the time against which backup age is judged; nil uses the
+	// wall clock.
+	Now func() time.Time
+}
+
+// TierResult records one backup moved from the hot tier to the cold tier and
+// deleted from the hot tier.
+type TierResult struct {
+	// Source is the backup's object name on the hot tier.
+	Source string
+	// Copy is the verified copy on the cold tier. Copy.Skipped is set when the
+	// cold tier already held an identical copy.
+	Copy CopyResult
+}
+
+// TierBackups moves the hot backend's backups older than AfterDays to the cold
+// backend. Backups are selected with the same rules as retention, so only
+// eligible backups under the hot backend's prefix are considered and pinned
+// backups stay on the hot backend. They are copied with CopyBackups, and each
+// is deleted from the hot backend only after its copy has been verified on the
+// cold backend. Nothing is deleted when the copy fails.
+func TierBackups(ctx context.Context, hot Storage, cold Storage, options TierOptions) ([]TierResult, error) {
+	ctx = contextOrBackground(ctx)
+	if options.AfterDays <= 0 {
+		return nil, errors.New("tiering requires a positive age")
+	}
+	store, ok := hot.(ObjectStore)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s cannot delete individual backups", StorageName(hot))
+	}
+
+	backups, err := store.ListBackups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups on %s: %w", StorageName(hot), err)
+	}
+	candidates := make([]objectTimestamp, 0, len(backups))
+	for _, backup := range backups {
+		candidates = append(candidates, objectTimestamp{Name: backup.Name, ModifiedAt: backup.ModifiedAt, Size: backup.Size})
+	}
+	aging, err := unpinnedObjects(ctx, hot, expiredObjects(candidates, store.ManagedPrefix(), store.ManagedNameTemplate(), options.AfterDays, currentTime(options.Now), options.Preserve))
+	if err != nil {
+		return nil, err
+	}
+	if len(aging) == 0 {
+		return nil, nil
+	}
+
+	copies, err := CopyBackups(ctx, hot, []Storage{cold}, CopyOptions{Objects: aging, StagingDir: options.StagingDir})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy aging backups from %s to %s: %w", StorageName(hot), StorageName(cold), err)
+	}
+	copiesByFilename := make(map[string]CopyResult, len(copies))
+	for _, backupCopy := range copies {
+		copiesByFilename[strings.TrimPrefix(backupCopy.Object, cold.(BackupLister).ManagedPrefix())] = backupCopy
+	}
+
+	results := make([]TierResult, 0, len(aging))
+	for _, name := range aging {
+		backupCopy, ok := copiesByFilename[strings.TrimPrefix(name, store.ManagedPrefix())]
+		if !ok {
+			return results, fmt.Errorf("no verified copy of %s on %s", name, StorageName(cold))
+		}
+		if err := store.DeleteObject(ctx, name); err != nil {
+			return results, fmt.Errorf("failed to delete %s from %s after tiering: %w", name, StorageName(hot), err)
+		}
+		results = append(results, TierResult{Source: name, Copy: backupCopy})
+	}
+	return results, nil
+}
@@ -0,0 +1,68 @@
+package storage_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egose/database-tools/storage"
+	"github.com/egose/database-tools/storage/storagetest"
+)
+
+func TestTierBackupsMovesAgingBackupsToColdTier(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	// Every object was rewritten an hour ago, as a migration does; their age
+	// is read from their names.
+	clock := func() time.Time { return now.Add(-time.Hour) }
+	hot := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "hot", Now: clock})
+	cold := storagetest.NewMemoryStorage(storagetest.Config{BackupPrefix: "cold", ExpiryDays: 14, Now: clock})
+
+	day := 24 * 60
+	oldest, aging, recent, preserved, pinned := backupFilename(t, 30*day), backupFilename(t, 8*day), backupFilename(t, day), backupFilename(t, 40*day), backupFilename(t, 50*day)
+	for _, name := range []string{"hot/" + oldest, "hot/" + aging, "hot/" + recent, "hot/" + preserved, "hot/" + pinned, "hot/notes.txt"} {
+		uploadObject(t, hot, name, "archive "+name)
+	}
+	uploadObject(t, cold, "cold/"+oldest, "archive hot/"+oldest)
+	if err := hot.PinObject(context.Background(), "hot/"+pinned, "legal hold"); err != nil {
+		t.Fatalf("PinObject() error = %v", err)
+	}
+
+	results, err := storage.TierBackups(context.Background(), hot, cold, storage.TierOptions{
+		AfterDays:  7,
+		Preserve:   "hot/" + preserved,
+		StagingDir: t.TempDir(),
+		Now:        func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("TierBackups() error = %v", err)
+	}
+
+	sources := make([]string, 0, len(results))
+	for _, result := range results {
+		sources = append(sources, result.Source)
+	}
+	slices.Sort(sources)
+	if want := []string{"hot/" + aging, "hot/" + oldest}; !slices.Equal(sources, want) {
+		t.Fatalf("TierBackups() sources = %v, want %v", sources, want)
+	}
+	if got, want := hot.Objects(), []string{"hot/" + recent, "hot/" + preserved, "hot/" + pinned, "hot/notes.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("hot objects = %v, want %v", got, want)
+	}
+	if got, want := cold.Objects(), []string{"cold/" + aging, "cold/" + oldest}; !slices.Equal(got, want) {
+		t.Fatalf("cold objects = %v, want %v", got, want)
+	}
+
+	// The cold tier's retention counts from when each backup was taken, not
+	// from when it was copied there.
+	if err := cold.DeleteOldObjects(context.Background(), ""); err != nil {
+		t.Fatalf("DeleteOldObjects() error = %v", err)
+	}
+	if got, want := cold.Objects(), []string{"cold/" + aging}; !slices.Equal(got, want) {
+		t.Fatalf("cold objects after retention = %v, want %v", got, want)
+	}
+
+	if _, err := storage.TierBackups(context.Background(), hot, cold, storage.TierOptions{}); err == nil {
+		t.Fatal("TierBackups() error = nil, want an error for a zero age")
+	}
+}
@@ -0,0 +1,461 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/egose/database-tools/utils"
+	mlog "github.com/mongodb/mongo-tools/common/log"
+)
+
+const (
+	DefaultTransferResumeWindow = 6 * time.Hour
+	DefaultTransferPartSize     = int64(64 << 20)
+
+	maxTransferParts        = 10000
+	transferStateFileSuffix = ".json"
+	transferPartialSuffix   = ".partial"
+)
+
+type transferDirection string
+
+const (
+	transferUpload   transferDirection = "upload"
+	transferDownload transferDirection = "download"
+)
+
+// errTransferSessionGone reports that the remote side no longer knows about a
+// persisted multipart session, so the transfer has to start over.
+var errTransferSessionGone = errors.New("transfer session no longer exists")
+
+// TransferStateStore persists multipart upload and ranged download progress on
+// disk so that a later run can resume an interrupted transfer instead of
+// starting over. Sessions that have not made progress within MaxAge are
+// considered abandoned and are aborted on the next transfer to the same target.
+type TransferStateStore struct {
+	Dir      string
+	MaxAge   time.Duration
+	PartSize int64
+	now      func() time.Time
+}
+
+type TransferPart struct {
+	Number int    `json:"number"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+type TransferState struct {
+	Key       string            `json:"key"`
+	Direction transferDirection `json:"direction"`
+	Target    string            `json:"target"`
+	Object    string            `json:"object"`
+	Source    string            `json:"source,omitempty"`
+	Size      int64             `json:"size"`
+	ModTime   time.Time         `json:"modTime,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	SessionID string            `json:"sessionId,omitempty"`
+	PartSize  int64             `json:"partSize,omitempty"`
+	Parts     []TransferPart    `json:"parts,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// multipartUpload is implemented by each backend to drive a resumable upload
+// for a single object. Part ETags returned by uploadPart are persisted and
+// handed back to resume, complete and abort.
+type multipartUpload interface {
+	begin(ctx context.Context) (string, error)
+	resume(ctx context.Context, sessionID string, parts []TransferPart) ([]TransferPart, error)
+	uploadPart(ctx context.Context, sessionID string, part TransferPart, body io.ReadSeeker) (string, error)
+	complete(ctx context.Context, sessionID string, parts []TransferPart) (string, error)
+	abort(ctx context.Context, sessionID string, parts []TransferPart) error
+}
+
+// rangedDownload is implemented by each backend to read an object starting at
+// an offset while guaranteeing the object has not changed since stat.
+type rangedDownload interface {
+	stat(ctx context.Context) (string, int64, error)
+	readRange(ctx context.Context, version string, offset int64) (io.ReadCloser, error)
+}
+
+func NewTransferStateStore(dir string, maxAge time.Duration) (*TransferStateStore, error) {
+	if dir == "" {
+		return nil, errors.New("transfer state directory cannot be empty")
+	}
+	if maxAge < 0 {
+		return nil, errors.New("transfer resume window cannot be negative")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create transfer state directory: %w", err)
+	}
+
+	return &TransferStateStore{Dir: dir, MaxAge: maxAge, PartSize: DefaultTransferPartSize}, nil
+}
+
+// resumable reports whether a transfer of size bytes should go through the
+// resumable path. Objects that fit in a single part are cheaper to retry whole.
+func (this *TransferStateStore) resumable(size int64) bool {
+	return this != nil && size > this.partSize(0)
+}
+
+func (this *TransferStateStore) partSize(total int64) int64 {
+	size := this.PartSize
+	if size <= 0 {
+		size = DefaultTransferPartSize
+	}
+	if minimum := (total + maxTransferParts - 1) / maxTransferParts; minimum > size {
+		size = minimum
+	}
+	return size
+}
+
+func (this *TransferStateStore) currentTime() time.Time {
+	if this.now != nil {
+		return this.now()
+	}
+	return time.Now()
+}
+
+func (this *TransferStateStore) key(direction transferDirection, target string, objectName string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{string(direction), target, objectName}, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (this *TransferStateStore) statePath(key string) string {
+	return filepath.Join(this.Dir, key+transferStateFileSuffix)
+}
+
+func (this *TransferStateStore) partialPath(key string) string {
+	return filepath.Join(this.Dir, key+transferPartialSuffix)
+}
+
+func (this *TransferStateStore) load(key string) (*TransferState, error) {
+	buf, err := os.ReadFile(this.statePath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read transfer state: %w", err)
+	}
+
+	state := &TransferState{}
+	if err := json.Unmarshal(buf, state); err != nil {
+		// A torn or foreign state file cannot be resumed; start over.
+		mlog.Logvf(mlog.Always, "Ignoring unreadable transfer state %s: %v", this.statePath(key), err)
+		return nil, nil
+	}
+
+	return state, nil
+}
+
+func (this *TransferStateStore) save(state *TransferState) error {
+	state.UpdatedAt = this.currentTime()
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode transfer state: %w", err)
+	}
+
+	return utils.WriteFileAtomically(this.statePath(state.Key), func(dest *os.File) error {
+		_, err := dest.Write(buf)
+		return err
+	})
+}
+
+func (this *TransferStateStore) remove(key string) error {
+	var removeErrors []error
+	for _, path := range []string{this.statePath(key), this.partialPath(key)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			removeErrors = append(removeErrors, err)
+		}
+	}
+
+	return errors.Join(removeErrors...)
+}
+
+func (this *TransferStateStore) list() ([]*TransferState, error) {
+	entries, err := os.ReadDir(this.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list transfer states: %w", err)
+	}
+
+	states := make([]*TransferState, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), transferStateFileSuffix) {
+			continue
+		}
+
+		state, err := this.load(strings.TrimSuffix(entry.Name(), transferStateFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			states = append(states, state)
+		}
+	}
+
+	return states, nil
+}
+
+func (this *TransferStateStore) expired(state *TransferState) bool {
+	return this.MaxAge > 0 && this.currentTime().Sub(state.UpdatedAt) > this.MaxAge
+}
+
+// abandonExpired aborts and forgets sessions for target that have outlived the
+// resume window. Abort failures are logged and the state is kept so that the
+// next run can try again.
+func (this *TransferStateStore) abandonExpired(direction transferDirection, target string, abort func(*TransferState) error) {
+	states, err := this.list()
+	if err != nil {
+		mlog.Logvf(mlog.Always, "Failed to scan abandoned transfers: %v", err)
+		return
+	}
+
+	for _, state := range states {
+		if state.Direction != direction || state.Target != target || !this.expired(state) {
+			continue
+		}
+		if abort != nil {
+			if err := abort(state); err != nil {
+				mlog.Logvf(mlog.Always, "Failed to abort abandoned %s of %s: %v", state.Direction, state.Object, err)
+				continue
+			}
+		}
+		if err := this.remove(state.Key); err != nil {
+			mlog.Logvf(mlog.Always, "Failed to remove abandoned transfer state for %s: %v", state.Object, err)
+			continue
+		}
+		mlog.Logvf(mlog.Always, "Discarded abandoned %s of %s", state.Direction, state.Object)
+	}
+}
+
+func (this *TransferStateStore) discard(ctx context.Context, state *TransferState, upload multipartUpload) {
+	if state.SessionID != "" {
+		if err := upload.abort(ctx, state.SessionID, state.Parts); err != nil {
+			mlog.Logvf(mlog.Always, "Failed to abort previous upload session for %s: %v", state.Object, err)
+		}
+	}
+	if err := this.remove(state.Key); err != nil {
+		mlog.Logvf(mlog.Always, "Failed to remove transfer state for %s: %v", state.Object, err)
+	}
+}
+
+func uploadResumably(ctx context.Context, store *TransferStateStore, target string, objectName string, filePath string, newUpload func(string) multipartUpload) (string, error) {
+	store.abandonExpired(transferUpload, target, func(state *TransferState) error {
+		return newUpload(state.Object).abort(ctx, state.SessionID, state.Parts)
+	})
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	// The source path is not part of the key so that an archive moved aside
+	// between runs still matches its session; size and mtime guard against a
+	// different file being uploaded under the same name.
+	upload := newUpload(objectName)
+	key := store.key(transferUpload, target, objectName)
+	state, err := store.load(key)
+	if err != nil {
+		return "", err
+	}
+
+	if state != nil && (state.Size != info.Size() || !state.ModTime.Equal(info.ModTime()) || state.PartSize <= 0) {
+		mlog.Logvf(mlog.Always, "Source file for %s changed since the interrupted upload; starting over", objectName)
+		store.discard(ctx, state, upload)
+		state = nil
+	}
+
+	if state != nil {
+		parts, err := upload.resume(ctx, state.SessionID, state.Parts)
+		if errors.Is(err, errTransferSessionGone) {
+			mlog.Logvf(mlog.Always, "Previous upload session for %s no longer exists; starting over", objectName)
+			store.discard(ctx, state, upload)
+			state = nil
+		} else if err != nil {
+			return "", fmt.Errorf("failed to inspect interrupted upload: %w", err)
+		} else {
+			state.Parts = parts
+			mlog.Logvf(mlog.Always, "Resuming upload of %s with %d part(s) already uploaded", objectName, len(parts))
+		}
+	}
+
+	if state == nil {
+		sessionID, err := upload.begin(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+
+		now := store.currentTime()
+		state = &TransferState{
+			Key:       key,
+			Direction: transferUpload,
+			Target:    target,
+			Object:    objectName,
+			Source:    filePath,
+			Size:      info.Size(),
+			ModTime:   info.ModTime(),
+			SessionID: sessionID,
+			PartSize:  store.partSize(info.Size()),
+			CreatedAt: now,
+		}
+		if err := store.save(state); err != nil {
+			return "", err
+		}
+	}
+
+	uploaded := make(map[int]bool, len(state.Parts))
+	for _, part := range state.Parts {
+		uploaded[part.Number] = true
+	}
+
+	partCount := int((state.Size + state.PartSize - 1) / state.PartSize)
+	for number := 1; number <= partCount; number++ {
+		if uploaded[number] {
+			continue
+		}
+
+		offset := int64(number-1) * state.PartSize
+		part := TransferPart{Number: number, Size: min(state.PartSize, state.Size-offset)}
+		etag, err := upload.uploadPart(ctx, state.SessionID, part, io.NewSectionReader(file, offset, part.Size))
+		if err != nil {
+			return "", fmt.Errorf("failed to upload part %d of %d: %w", number, partCount, err)
+		}
+
+		part.ETag = etag
+		state.Parts = append(state.Parts, part)
+		if err := store.save(state); err != nil {
+			return "", err
+		}
+		mlog.Logvf(mlog.Info, "Uploaded part %d of %d for %s", number, partCount, objectName)
+	}
+
+	sort.Slice(state.Parts, func(i, j int) bool { return state.Parts[i].Number < state.Parts[j].Number })
+	result, err := upload.complete(ctx, state.SessionID, state.Parts)
+	if err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	if err := store.remove(key); err != nil {
+		mlog.Logvf(mlog.Always, "Failed to remove transfer state for %s: %v", objectName, err)
+	}
+
+	return result, nil
+}
+
+// downloadResumably falls back to downloadWhole for objects that fit in a
+// single part.
+func downloadResumably(ctx context.Context, store *TransferStateStore, target string, objectName string, filePath string, source rangedDownload, downloadWhole func() error) error {
+	store.abandonExpired(transferDownload, target, nil)
+
+	version, size, err := source.stat(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve metadata: %w", err)
+	}
+	if !store.resumable(size) {
+		return downloadWhole()
+	}
+
+	// Downloads land in a fresh workspace on every run, so the destination path
+	// is deliberately not part of the key.
+	key := store.key(transferDownload, target, objectName)
+	state, err := store.load(key)
+	if err != nil {
+		return err
+	}
+	if state != nil && (state.Version != version || state.Size != size) {
+		mlog.Logvf(mlog.Always, "Object %s changed since the interrupted download; starting over", objectName)
+		if err := store.remove(key); err != nil {
+			return fmt.Errorf("failed to discard partial download: %w", err)
+		}
+		state = nil
+	}
+	if state == nil {
+		now := store.currentTime()
+		state = &TransferState{
+			Key:       key,
+			Direction: transferDownload,
+			Target:    target,
+			Object:    objectName,
+			Size:      size,
+			Version:   version,
+			CreatedAt: now,
+		}
+		if err := store.save(state); err != nil {
+			return err
+		}
+	}
+
+	err = utils.WriteFileResumably(filePath, store.partialPath(key), func(dest *os.File, offset int64) error {
+		if offset > size {
+			if err := dest.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := dest.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			offset = 0
+		}
+		if offset == size {
+			return nil
+		}
+		if offset > 0 {
+			mlog.Logvf(mlog.Always, "Resuming download of %s at byte %d of %d", objectName, offset, size)
+		}
+
+		reader, err := source.readRange(ctx, version, offset)
+		if err != nil {
+			return fmt.Errorf("failed to download object: %w", err)
+		}
+		defer reader.Close()
+
+		written, err := io.Copy(dest, reader)
+		if err != nil {
+			return fmt.Errorf("failed to download object: %w", err)
+		}
+		if offset+written != size {
+			return fmt.Errorf("failed to download object: received %d of %d bytes", offset+written, size)
+		}
+		return nil
+	})
+	if err != nil {
+		if saveErr := store.save(state); saveErr != nil {
+			mlog.Logvf(mlog.Always, "Failed to record download progress for %s: %v", objectName, saveErr)
+		}
+		return err
+	}
+
+	if err := store.remove(key); err != nil {
+		mlog.Logvf(mlog.Always, "Failed to remove transfer state for %s: %v", objectName, err)
+	}
+
+	return nil
+}
+
+func newTransferSessionID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate transfer session id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
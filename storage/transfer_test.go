@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeMultipartUpload struct {
+	sessions  map[string]map[int][]byte
+	completed map[string][]byte
+	aborted   []string
+	failPart  int
+	begun     int
+	uploads   []int
+}
+
+type fakeRangedDownload struct {
+	data    []byte
+	version string
+	failAt  int64
+	offsets []int64
+}
+
+func newFakeMultipartUpload() *fakeMultipartUpload {
+	return &fakeMultipartUpload{sessions: map[string]map[int][]byte{}, completed: map[string][]byte{}}
+}
+
+func (f *fakeMultipartUpload) bind(objectName string) multipartUpload {
+	return &boundFakeMultipartUpload{fake: f, objectName: objectName}
+}
+
+type boundFakeMultipartUpload struct {
+	fake       *fakeMultipartUpload
+	objectName string
+}
+
+func (b *boundFakeMultipartUpload) begin(ctx context.Context) (string, error) {
+	b.fake.begun++
+	sessionID := fmt.Sprintf("session-%d", b.fake.begun)
+	b.fake.sessions[sessionID] = map[int][]byte{}
+	return sessionID, nil
+}
+
+func (b *boundFakeMultipartUpload) resume(ctx context.Context, sessionID string, parts []TransferPart) ([]TransferPart, error) {
+	session, ok := b.fake.sessions[sessionID]
+	if !ok {
+		return nil, errTransferSessionGone
+	}
+	confirmed := []TransferPart{}
+	for _, part := range parts {
+		if _, ok := session[part.Number]; ok {
+			confirmed = append(confirmed, part)
+		}
+	}
+	return confirmed, nil
+}
+
+func (b *boundFakeMultipartUpload) uploadPart(ctx context.Context, sessionID string, part TransferPart, body io.ReadSeeker) (string, error) {
+	if part.Number == b.fake.failPart {
+		b.fake.failPart = 0
+		return "", errors.New("connection reset")
+	}
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	b.fake.uploads = append(b.fake.uploads, part.Number)
+	b.fake.sessions[sessionID][part.Number] = buf
+	return fmt.Sprintf("etag-%d", part.Number), nil
+}
+
+func (b *boundFakeMultipartUpload) complete(ctx context.Context, sessionID string, parts []TransferPart) (string, error) {
+	var out bytes.Buffer
+	for _, part := range parts {
+		out.Write(b.fake.sessions[sessionID][part.Number])
+	}
+	b.fake.completed[b.objectName] = out.Bytes()
+	delete(b.fake.sessions, sessionID)
+	return "final-etag", nil
+}
+
+func (b *boundFakeMultipartUpload) abort(ctx context.Context, sessionID string, parts []TransferPart) error {
+	b.fake.aborted = append(b.fake.aborted, b.objectName+"/"+sessionID)
+	delete(b.fake.sessions, sessionID)
+	return nil
+}
+
+func (f *fakeRangedDownload) stat(ctx context.Context) (string, int64, error) {
+	return f.version, int64(len(f.data)), nil
+}
+
+func (f *fakeRangedDownload) readRange(ctx context.Context, version string, offset int64) (io.ReadCloser, error) {
+	if version != f.version {
+		return nil, errors.New("precondition failed")
+	}
+	f.offsets = append(f.offsets, offset)
+	data := f.data[offset:]
+	if f.failAt > 0 {
+		data = f.data[offset:f.failAt]
+		f.failAt = 0
+		return io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{})), nil
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func newTestTransferStore(t *testing.T) *TransferStateStore {
+	t.Helper()
+	store, err := NewTransferStateStore(filepath.Join(t.TempDir(), "transfers"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewTransferStateStore() error = %v", err)
+	}
+	store.PartSize = 4
+	return store
+}
+
+func writeTransferSource(t *testing.T, content string) string {
+	t.Helper()
+	sourcePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := os.WriteFile(sourcePath, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return sourcePath
+}
+
+func TestUploadResumablyResumesFromPersistedParts(t *testing.T) {
+	store := newTestTransferStore(t)
+	sourcePath := writeTransferSource(t, "0123456789")
+	fake := newFakeMultipartUpload()
+	fake.failPart = 2
+
+	if _, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind); err == nil {
+		t.Fatal("uploadResumably() expected part failure")
+	}
+
+	result, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind)
+	if err != nil {
+		t.Fatalf("uploadResumably() error = %v", err)
+	}
+	if result != "final-etag" {
+		t.Fatalf("uploadResumably() = %q, want final-etag", result)
+	}
+	if fake.begun != 1 {
+		t.Fatalf("uploadResumably() began %d sessions, want 1", fake.begun)
+	}
+	if got := fmt.Sprint(fake.uploads); got != "[1 2 3]" {
+		t.Fatalf("uploadResumably() uploaded parts %s, want [1 2 3]", got)
+	}
+	if got := string(fake.completed["backup.tar.gz"]); got != "0123456789" {
+		t.Fatalf("uploadResumably() completed content = %q", got)
+	}
+
+	states, err := store.list()
+	if err != nil {
+		t.Fatalf("list() error = %v", err)
+	}
+	if len(states) != 0 {
+		t.Fatalf("list() = %d states after completion, want 0", len(states))
+	}
+}
+
+func TestUploadResumablyRestartsWhenSessionIsGone(t *testing.T) {
+	store := newTestTransferStore(t)
+	sourcePath := writeTransferSource(t, "0123456789")
+	fake := newFakeMultipartUpload()
+	fake.failPart = 3
+
+	if _, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind); err == nil {
+		t.Fatal("uploadResumably() expected part failure")
+	}
+	fake.sessions = map[string]map[int][]byte{}
+
+	if _, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind); err != nil {
+		t.Fatalf("uploadResumably() error = %v", err)
+	}
+	if fake.begun != 2 {
+		t.Fatalf("uploadResumably() began %d sessions, want 2", fake.begun)
+	}
+	if got := string(fake.completed["backup.tar.gz"]); got != "0123456789" {
+		t.Fatalf("uploadResumably() completed content = %q", got)
+	}
+}
+
+func TestUploadResumablyAbortsAbandonedSessions(t *testing.T) {
+	store := newTestTransferStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	fake := newFakeMultipartUpload()
+	fake.failPart = 2
+
+	stalePath := writeTransferSource(t, "abcdefghij")
+	if _, err := uploadResumably(context.Background(), store, "fake", "stale.tar.gz", stalePath, fake.bind); err == nil {
+		t.Fatal("uploadResumably() expected part failure")
+	}
+
+	now = now.Add(2 * time.Hour)
+	sourcePath := writeTransferSource(t, "0123456789")
+	if _, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind); err != nil {
+		t.Fatalf("uploadResumably() error = %v", err)
+	}
+
+	if len(fake.aborted) != 1 || !strings.HasPrefix(fake.aborted[0], "stale.tar.gz/") {
+		t.Fatalf("uploadResumably() aborted = %v, want stale session", fake.aborted)
+	}
+	states, err := store.list()
+	if err != nil {
+		t.Fatalf("list() error = %v", err)
+	}
+	if len(states) != 0 {
+		t.Fatalf("list() = %d states, want 0", len(states))
+	}
+}
+
+func TestUploadResumablyStartsOverWhenSourceChanges(t *testing.T) {
+	store := newTestTransferStore(t)
+	sourcePath := writeTransferSource(t, "0123456789")
+	fake := newFakeMultipartUpload()
+	fake.failPart = 2
+
+	if _, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind); err == nil {
+		t.Fatal("uploadResumably() expected part failure")
+	}
+	if err := os.WriteFile(sourcePath, []byte("abcdefghijkl"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if _, err := uploadResumably(context.Background(), store, "fake", "backup.tar.gz", sourcePath, fake.bind); err != nil {
+		t.Fatalf("uploadResumably() error = %v", err)
+	}
+	if len(fake.aborted) != 1 {
+		t.Fatalf("uploadResumably() aborted = %v, want previous session", fake.aborted)
+	}
+	if got := string(fake.completed["backup.tar.gz"]); got != "abcdefghijkl" {
+		t.Fatalf("uploadResumably() completed content = %q", got)
+	}
+}
+
+func TestDownloadResumablyContinuesPartialDownload(t *testing.T) {
+	store := newTestTransferStore(t)
+	source := &fakeRangedDownload{data: []byte("0123456789"), version: "v1", failAt: 6}
+	whole := func() error { t.Fatal("downloadWhole() called for resumable object"); return nil }
+
+	firstPath := filepath.Join(t.TempDir(), "run-1", "backup.tar.gz")
+	if err := downloadResumably(context.Background(), store, "fake", "backup.tar.gz", firstPath, source, whole); err == nil {
+		t.Fatal("downloadResumably() expected read failure")
+	}
+
+	secondPath := filepath.Join(t.TempDir(), "run-2", "backup.tar.gz")
+	if err := downloadResumably(context.Background(), store, "fake", "backup.tar.gz", secondPath, source, whole); err != nil {
+		t.Fatalf("downloadResumably() error = %v", err)
+	}
+
+	got, err := os.ReadFile(secondPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(got) != "0123456789" {
+		t.Fatalf("downloadResumably() content = %q", got)
+	}
+	if fmt.Sprint(source.offsets) != "[0 6]" {
+		t.Fatalf("downloadResumably() offsets = %v, want [0 6]", source.offsets)
+	}
+}
+
+func TestDownloadResumablyStartsOverWhenObjectChanges(t *testing.T) {
+	store := newTestTransferStore(t)
+	source := &fakeRangedDownload{data: []byte("0123456789"), version: "v1", failAt: 6}
+	whole := func() error { return nil }
+
+	destPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := downloadResumably(context.Background(), store, "fake", "backup.tar.gz", destPath, source, whole); err == nil {
+		t.Fatal("downloadResumably() expected read failure")
+	}
+
+	source.data = []byte("abcdefghij")
+	source.version = "v2"
+	if err := downloadResumably(context.Background(), store, "fake", "backup.tar.gz", destPath, source, whole); err != nil {
+		t.Fatalf("downloadResumably() error = %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(got) != "abcdefghij" {
+		t.Fatalf("downloadResumably() content = %q", got)
+	}
+}
+
+func TestDownloadResumablyUsesWholeDownloadForSmallObjects(t *testing.T) {
+	store := newTestTransferStore(t)
+	source := &fakeRangedDownload{data: []byte("0123"), version: "v1"}
+	called := false
+
+	if err := downloadResumably(context.Background(), store, "fake", "backup.tar.gz", filepath.Join(t.TempDir(), "backup.tar.gz"), source, func() error {
+		called = true
+		return nil
+	}); err != nil {
+		t.Fatalf("downloadResumably() error = %v", err)
+	}
+	if !called {
+		t.Fatal("downloadResumably() did not fall back to whole download")
+	}
+	if len(source.offsets) != 0 {
+		t.Fatalf("downloadResumably() offsets = %v, want none", source.offsets)
+	}
+}
+
+func TestTransferStateStorePartSizeStaysWithinPartLimit(t *testing.T) {
+	store := &TransferStateStore{PartSize: 4}
+	if got := store.partSize(40); got != 4 {
+		t.Fatalf("partSize(40) = %d, want 4", got)
+	}
+	if got := store.partSize(4 * maxTransferParts * 3); got != 12 {
+		t.Fatalf("partSize() = %d, want 12", got)
+	}
+
+	var nilStore *TransferStateStore
+	if nilStore.resumable(1 << 40) {
+		t.Fatal("resumable() on nil store = true, want false")
+	}
+}
+
+func TestTransferStateStorePruneExpiredRemovesStalePartialDownloads(t *testing.T) {
+	store := newTestTransferStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	source := &fakeRangedDownload{data: []byte("0123456789"), version: "v1", failAt: 6}
+	whole := func() error { return nil }
+
+	destPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := downloadResumably(context.Background(), store, "fake", "backup.tar.gz", destPath, source, whole); err == nil {
+		t.Fatal("downloadResumably() expected read failure")
+	}
+
+	if reclaimed, err := store.PruneExpired(); err != nil || len(reclaimed) != 0 {
+		t.Fatalf("PruneExpired() = %#v, %v; want nothing within the resume window", reclaimed, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	reclaimed, err := store.PruneExpired()
+	if err != nil {
+		t.Fatalf("PruneExpired() error = %v", err)
+	}
+	if len(reclaimed) != 1 || reclaimed[0].Object != "backup.tar.gz" || reclaimed[0].Bytes != 6 {
+		t.Fatalf("PruneExpired() = %#v", reclaimed)
+	}
+	entries, err := os.ReadDir(store.Dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("PruneExpired() left %d file(s) in %s", len(entries), store.Dir)
+	}
+}
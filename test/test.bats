@@ -66,7 +66,7 @@ storage_count() {
 
   run ./dist/mongo-archive --uri="$DATABASE_URL" --db="$DATABASE_NAME" --local-path=./dist/backup
   assert_success
-  assert_output_contains "Successfully uploaded backup to *storage.LocalStorage"
+  assert_output_contains "Successfully uploaded backup to local:"
 
   after_count="$(storage_count --provider=local --local-path=./dist/backup)"
   [ "$after_count" -eq $((before_count + 1)) ]
@@ -114,7 +114,7 @@ storage_count() {
 
   run ./dist/mongo-archive --uri="$DATABASE_URL" --db="$DATABASE_NAME" --aws-endpoint="$MINIO_URL" --aws-access-key-id="$MINIO_ACCESS_KEY" --aws-secret-access-key="$MINIO_SECRET_KEY" --aws-bucket="$MINIO_BUCKET" --aws-s3-force-path-style=true
   assert_success
-  assert_output_contains "Successfully uploaded backup to *storage.AwsS3:"
+  assert_output_contains "Successfully uploaded backup to aws:"
 
   after_count="$(storage_count --provider=s3)"
   [ "$after_count" -eq $((before_count + 1)) ]
@@ -155,7 +155,7 @@ storage_count() {
 
   run ./dist/mongo-archive --uri="$DATABASE_URL" --db="$DATABASE_NAME" --az-endpoint="$AZURITE_URL" --az-account-name="$AZURITE_ACCOUNT_NAME" --az-account-key="$AZURITE_ACCOUNT_KEY" --az-container-name="$AZURITE_CONTAINER"
   assert_success
-  assert_output_contains "Successfully uploaded backup to *storage.AzBlob:"
+  assert_output_contains "Successfully uploaded backup to azure:"
 
   after_count="$(storage_count --provider=azure)"
   [ "$after_count" -eq $((before_count + 1)) ]
@@ -191,7 +191,7 @@ storage_count() {
 
   run env STORAGE_EMULATOR_HOST="$FAKE_GCP_URL" ./dist/mongo-archive --uri="$DATABASE_URL" --db="$DATABASE_NAME" --gcp-endpoint="$FAKE_GCP_URL/storage/v1/" --gcp-bucket="$FAKE_GCP_BUCKET"
   assert_success
-  assert_output_contains "Successfully uploaded backup to *storage.GcpStorage:"
+  assert_output_contains "Successfully uploaded backup to gcp:"
 
   after_count="$(storage_count --provider=gcp)"
   [ "$after_count" -eq $((before_count + 1)) ]
@@ -228,8 +228,8 @@ storage_count() {
 
   run ./dist/mongo-archive --uri="$DATABASE_URL" --db="$DATABASE_NAME" --local-path=./dist/backup --aws-endpoint="$MINIO_URL" --aws-access-key-id="$MINIO_ACCESS_KEY" --aws-secret-access-key="$MINIO_SECRET_KEY" --aws-bucket="$MINIO_BUCKET" --aws-s3-force-path-style=true
   assert_success
-  assert_output_contains "*storage.LocalStorage"
-  assert_output_contains "*storage.AwsS3"
+  assert_output_contains "backend #1 (local)"
+  assert_output_contains "backend #2 (aws)"
 
   local_after_count="$(storage_count --provider=local --local-path=./dist/backup)"
   s3_after_count="$(storage_count --provider=s3)"
@@ -7,7 +7,12 @@ import (
 )
 
 func GetNewFilename() (string, string) {
-	now := time.Now()
+	return GetFilenameAt(time.Now())
+}
+
+// GetFilenameAt returns the backup filename, and the name without its
+// extension, that GetNewFilename would generate at now.
+func GetFilenameAt(now time.Time) (string, string) {
 	timestamp := 9999999999999 - now.UnixNano()/int64(time.Millisecond)
 	date := strings.ReplaceAll(now.Format("2006-01-02T15:04:05.000Z"), ":", "")
 	name := fmt.Sprintf("%d-%s", timestamp, date)
@@ -177,6 +177,65 @@ func WriteFileAtomically(filePath string, write func(*os.File) error) (retErr er
 	return nil
 }
 
+// WriteFileResumably appends to a stable partial file and renames it into place
+// after write succeeds. write receives the partial file positioned at its end
+// together with the number of bytes already present. Unlike
+// WriteFileAtomically the partial file is kept when write fails so that a later
+// call can continue where this one stopped. partialPath must be on the same
+// filesystem as filePath.
+func WriteFileResumably(filePath string, partialPath string, write func(dest *os.File, offset int64) error) (retErr error) {
+	if filePath == "" || partialPath == "" {
+		return fmt.Errorf("file path cannot be empty")
+	}
+
+	cleanPath := filepath.Clean(filePath)
+	cleanPartialPath := filepath.Clean(partialPath)
+	for _, dir := range []string{filepath.Dir(cleanPath), filepath.Dir(cleanPartialPath)} {
+		if err := ensureNoSymlinkComponents(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	for _, path := range []string{cleanPath, cleanPartialPath} {
+		if err := ensureNoSymlinkComponents(path); err != nil {
+			return err
+		}
+	}
+
+	partialFile, err := os.OpenFile(cleanPartialPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			if closeErr := partialFile.Close(); retErr == nil && closeErr != nil {
+				retErr = closeErr
+			}
+		}
+	}()
+
+	if err := partialFile.Chmod(0o600); err != nil {
+		return err
+	}
+	offset, err := partialFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if err := write(partialFile, offset); err != nil {
+		return err
+	}
+	if err := partialFile.Close(); err != nil {
+		closed = true
+		return err
+	}
+	closed = true
+
+	return os.Rename(cleanPartialPath, cleanPath)
+}
+
 func GetFileNameWithoutExtension(filePath string) string {
 	fileName := filepath.Base(filePath)
 	ext := filepath.Ext(fileName)
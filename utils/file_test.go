@@ -251,6 +251,40 @@ func TestWriteFileAtomicallyRejectsSymlinkDestination(t *testing.T) {
 	assertPathAbsent(t, filepath.Join(outside, "archive.tar.gz"))
 }
 
+func TestWriteFileResumablyContinuesFromPartialFile(t *testing.T) {
+	root := t.TempDir()
+	targetPath := filepath.Join(root, "run-1", "archive.tar.gz")
+	partialPath := filepath.Join(root, "transfers", "archive.partial")
+
+	err := WriteFileResumably(targetPath, partialPath, func(file *os.File, offset int64) error {
+		if offset != 0 {
+			t.Fatalf("WriteFileResumably() first offset = %d, want 0", offset)
+		}
+		if _, err := file.Write([]byte("hello ")); err != nil {
+			return err
+		}
+		return errors.New("connection reset")
+	})
+	if err == nil {
+		t.Fatal("WriteFileResumably() expected error")
+	}
+	assertPathAbsent(t, targetPath)
+	assertMode(t, partialPath, 0o600)
+
+	if err := WriteFileResumably(targetPath, partialPath, func(file *os.File, offset int64) error {
+		if offset != 6 {
+			t.Fatalf("WriteFileResumably() resumed offset = %d, want 6", offset)
+		}
+		_, err := file.Write([]byte("world"))
+		return err
+	}); err != nil {
+		t.Fatalf("WriteFileResumably() error = %v", err)
+	}
+
+	assertFileContent(t, targetPath, "hello world")
+	assertPathAbsent(t, partialPath)
+}
+
 func TestListDirectChildrenReadsOnlyRootDirectory(t *testing.T) {
 	root := t.TempDir()
 	for _, name := range []string{"alpha", "beta"} {
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WorkspaceOwnerFile is written into every run workspace so that a later
+// janitor pass can tell whether the process that created it is still alive.
+const WorkspaceOwnerFile = ".owner"
+
+// DefaultJanitorMinAge is how long leftovers whose owner cannot be checked are
+// kept before a janitor pass reclaims them.
+const DefaultJanitorMinAge = 24 * time.Hour
+
+// WorkspaceOwner identifies the process that created a workspace. Instance is
+// random per process, so that a process restarted under the same PID, as a
+// container's PID 1 is, does not mistake the workspaces of its crashed
+// predecessor for its own.
+type WorkspaceOwner struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Instance  string    `json:"instance,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+var processInstance = sync.OnceValue(func() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+})
+
+type ReclaimedWorkspace struct {
+	Path   string
+	Bytes  int64
+	Reason string
+}
+
+// CreateOwnedWorkspace creates a private temporary directory under basePath and
+// records the current process as its owner.
+func CreateOwnedWorkspace(basePath string, pattern string) (string, error) {
+	if err := os.MkdirAll(basePath, 0o700); err != nil {
+		return "", err
+	}
+
+	workspace, err := os.MkdirTemp(basePath, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	host, _ := os.Hostname()
+	buf, err := json.Marshal(WorkspaceOwner{PID: os.Getpid(), Host: host, Instance: processInstance(), StartedAt: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(workspace, WorkspaceOwnerFile), buf, 0o600); err != nil {
+		_ = os.RemoveAll(workspace)
+		return "", err
+	}
+
+	return workspace, nil
+}
+
+// CleanStaleWorkspaces removes workspaces under basePath whose names start with
+// pattern and whose owner is gone. A workspace owned by a process on this host
+// is removed as soon as that process has exited, or when it carries this
+// process's PID but not its instance, as after a restart. Workspaces owned by another
+// host, or without an owner file, cannot be checked and are only removed once
+// they are older than minAge.
+func CleanStaleWorkspaces(basePath string, pattern string, minAge time.Duration, now time.Time) ([]ReclaimedWorkspace, error) {
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	reclaimed := make([]ReclaimedWorkspace, 0)
+	var cleanupErrors []error
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), pattern) {
+			continue
+		}
+
+		workspace := filepath.Join(basePath, entry.Name())
+		reason, stale, err := workspaceStaleReason(workspace, host, minAge, now)
+		if err != nil {
+			cleanupErrors = append(cleanupErrors, fmt.Errorf("inspect %q: %w", workspace, err))
+			continue
+		}
+		if !stale {
+			continue
+		}
+
+		size := directorySize(workspace)
+		if err := os.RemoveAll(workspace); err != nil {
+			cleanupErrors = append(cleanupErrors, fmt.Errorf("remove %q: %w", workspace, err))
+			continue
+		}
+		reclaimed = append(reclaimed, ReclaimedWorkspace{Path: workspace, Bytes: size, Reason: reason})
+	}
+
+	return reclaimed, errors.Join(cleanupErrors...)
+}
+
+func workspaceStaleReason(workspace string, host string, minAge time.Duration, now time.Time) (string, bool, error) {
+	info, err := os.Stat(workspace)
+	if err != nil {
+		return "", false, err
+	}
+	startedAt := info.ModTime()
+
+	buf, err := os.ReadFile(filepath.Join(workspace, WorkspaceOwnerFile))
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, err
+	}
+	if err == nil {
+		owner := WorkspaceOwner{}
+		if json.Unmarshal(buf, &owner) == nil && owner.PID > 0 {
+			if owner.Host == host {
+				if owner.PID == os.Getpid() {
+					if owner.Instance == processInstance() {
+						return "", false, nil
+					}
+					return fmt.Sprintf("owner process %d was restarted", owner.PID), true, nil
+				}
+				if processAlive(owner.PID) {
+					return "", false, nil
+				}
+				return fmt.Sprintf("owner process %d exited", owner.PID), true, nil
+			}
+			startedAt = owner.StartedAt
+		}
+	}
+
+	if now.Sub(startedAt) <= minAge {
+		return "", false, nil
+	}
+	return fmt.Sprintf("no live owner for more than %s", minAge), true, nil
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	defer process.Release()
+
+	// On Windows FindProcess already fails for processes that do not exist.
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+func directorySize(root string) int64 {
+	var size int64
+	_ = filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateOwnedWorkspaceRecordsCurrentProcess(t *testing.T) {
+	workspace, err := CreateOwnedWorkspace(filepath.Join(t.TempDir(), "base"), "run-")
+	if err != nil {
+		t.Fatalf("CreateOwnedWorkspace() error = %v", err)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(workspace, WorkspaceOwnerFile))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	owner := WorkspaceOwner{}
+	if err := json.Unmarshal(buf, &owner); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if owner.PID != os.Getpid() || owner.Instance != processInstance() {
+		t.Fatalf("owner = %+v, want PID %d and instance %s", owner, os.Getpid(), processInstance())
+	}
+	assertMode(t, workspace, 0o700)
+}
+
+func TestCleanStaleWorkspaces(t *testing.T) {
+	base := t.TempDir()
+	host, _ := os.Hostname()
+	now := time.Now()
+
+	writeOwner := func(name string, owner WorkspaceOwner) string {
+		t.Helper()
+		workspace := filepath.Join(base, name)
+		if err := os.MkdirAll(workspace, 0o700); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		buf, _ := json.Marshal(owner)
+		if err := os.WriteFile(filepath.Join(workspace, WorkspaceOwnerFile), buf, 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return workspace
+	}
+
+	live := writeOwner("run-live", WorkspaceOwner{PID: os.Getpid(), Host: host, Instance: processInstance(), StartedAt: now.Add(-48 * time.Hour)})
+	// A restarted container runs as the same PID on the same host as the
+	// process that crashed.
+	restarted := writeOwner("run-restarted", WorkspaceOwner{PID: os.Getpid(), Host: host, Instance: "crashed", StartedAt: now})
+	legacy := writeOwner("run-legacy", WorkspaceOwner{PID: os.Getpid(), Host: host, StartedAt: now})
+	dead := writeOwner("run-dead", WorkspaceOwner{PID: 1 << 22, Host: host, StartedAt: now})
+	foreignRecent := writeOwner("run-foreign-recent", WorkspaceOwner{PID: 42, Host: host + "-other", StartedAt: now.Add(-time.Hour)})
+	foreignOld := writeOwner("run-foreign-old", WorkspaceOwner{PID: 42, Host: host + "-other", StartedAt: now.Add(-48 * time.Hour)})
+	unrelated := writeOwner("pending", WorkspaceOwner{PID: 1 << 22, Host: host, StartedAt: now.Add(-48 * time.Hour)})
+
+	ownerless := filepath.Join(base, "run-ownerless")
+	if err := os.MkdirAll(ownerless, 0o700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	old := now.Add(-48 * time.Hour)
+	if err := os.Chtimes(ownerless, old, old); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	reclaimed, err := CleanStaleWorkspaces(base, "run-", 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("CleanStaleWorkspaces() error = %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, workspace := range reclaimed {
+		got[workspace.Path] = true
+	}
+	for _, path := range []string{dead, restarted, legacy, foreignOld, ownerless} {
+		if !got[path] {
+			t.Fatalf("CleanStaleWorkspaces() did not reclaim %q; reclaimed %#v", path, reclaimed)
+		}
+		assertPathAbsent(t, path)
+	}
+	for _, path := range []string{live, foreignRecent, unrelated} {
+		if got[path] {
+			t.Fatalf("CleanStaleWorkspaces() reclaimed %q", path)
+		}
+	}
+}